@@ -0,0 +1,144 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+var (
+	// ErrMissingToken is returned when a request carries no bearer token.
+	ErrMissingToken = errors.New("auth: missing bearer token")
+	// ErrMalformedHeader is returned when the Authorization header isn't "Bearer <token>".
+	ErrMalformedHeader = errors.New("auth: malformed authorization header")
+	// ErrInvalidToken is returned when a token fails signature or claim checks.
+	ErrInvalidToken = errors.New("auth: invalid token")
+)
+
+// Principal is the authenticated caller.
+type Principal struct {
+	UserID string
+	Email  string
+	Roles  []string
+}
+
+// HasRole reports whether the principal was granted role.
+func (p *Principal) HasRole(role string) bool {
+	return slices.Contains(p.Roles, role)
+}
+
+type principalKey struct{}
+
+// NewContext returns a context carrying p.
+func NewContext(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// FromContext returns the principal stored by the auth middleware.
+func FromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(*Principal)
+	return p, ok && p != nil
+}
+
+// Require returns middleware that rejects requests without a valid token
+// with 401, and those whose principal lacks any of roles with 403. The
+// principal is available to the wrapped handler through FromContext.
+func (v *Verifier) Require(roles ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token, err := requestToken(r)
+			if err != nil {
+				v.log.Infow("Unauthenticated request", "path", r.URL.Path, "error", err)
+				unauthorized(w)
+				return
+			}
+
+			p, err := v.Verify(r.Context(), token)
+			if err != nil {
+				v.log.Infow("Rejected token", "path", r.URL.Path, "error", err)
+				unauthorized(w)
+				return
+			}
+
+			for _, role := range roles {
+				if !p.HasRole(role) {
+					v.log.Infow("Forbidden", "path", r.URL.Path, "user_id", p.UserID, "role", role)
+					http.Error(w, `{"error":"forbidden"}`, http.StatusForbidden)
+					return
+				}
+			}
+
+			next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), p)))
+		})
+	}
+}
+
+// Optional returns middleware that attaches the principal when the request
+// carries a token, and passes anonymous requests through untouched. A token
+// that is present but invalid is still rejected with 401, so clients notice
+// an expired session instead of silently getting the anonymous response.
+func (v *Verifier) Optional() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token, err := requestToken(r)
+			if errors.Is(err, ErrMissingToken) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if err != nil {
+				v.log.Infow("Unauthenticated request", "path", r.URL.Path, "error", err)
+				unauthorized(w)
+				return
+			}
+
+			p, err := v.Verify(r.Context(), token)
+			if err != nil {
+				v.log.Infow("Rejected token", "path", r.URL.Path, "error", err)
+				unauthorized(w)
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), p)))
+		})
+	}
+}
+
+// BearerToken extracts the token from the Authorization header.
+func BearerToken(r *http.Request) (string, error) {
+	header := r.Header.Get("Authorization")
+	if header == "" {
+		return "", ErrMissingToken
+	}
+
+	scheme, token, ok := strings.Cut(header, " ")
+	token = strings.TrimSpace(token)
+	if !ok || !strings.EqualFold(scheme, "bearer") || token == "" {
+		return "", ErrMalformedHeader
+	}
+	return token, nil
+}
+
+// requestToken is BearerToken, except that WebSocket handshakes may pass the
+// token as ?access_token= because browsers can't set headers on them.
+func requestToken(r *http.Request) (string, error) {
+	token, err := BearerToken(r)
+	if errors.Is(err, ErrMissingToken) && isWebSocketUpgrade(r) {
+		if token = r.URL.Query().Get("access_token"); token != "" {
+			return token, nil
+		}
+	}
+	return token, err
+}
+
+func isWebSocketUpgrade(r *http.Request) bool {
+	return r.Method == http.MethodGet &&
+		strings.EqualFold(r.Header.Get("Upgrade"), "websocket") &&
+		strings.Contains(strings.ToLower(r.Header.Get("Connection")), "upgrade")
+}
+
+func unauthorized(w http.ResponseWriter) {
+	w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+	http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+}
@@ -0,0 +1,172 @@
+package auth
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	// jwksTTL is how long fetched keys are trusted before a refetch.
+	jwksTTL = time.Hour
+	// jwksMinRefresh limits refetches triggered by unknown key IDs.
+	jwksMinRefresh = time.Minute
+)
+
+var errUnknownKey = errors.New("unknown signing key")
+
+// jwks caches the RSA public keys published at a JWKS endpoint.
+type jwks struct {
+	url        string
+	httpClient *http.Client
+	group      singleflight.Group
+
+	mu   sync.Mutex
+	keys map[string]*rsa.PublicKey
+	// fetchedAt is the last successful fetch, attemptedAt the last try
+	fetchedAt   time.Time
+	attemptedAt time.Time
+}
+
+func newJWKS(url string) *jwks {
+	return &jwks{
+		url:        url,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// key returns the key for kid, refetching the set when it is stale or the
+// kid is unknown (keys were rotated). Refetches are at most one a minute,
+// even while they fail, and are shared by concurrent callers so a slow
+// endpoint never holds up requests for keys already known.
+func (j *jwks) key(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	j.mu.Lock()
+	k, ok := j.lookup(kid)
+	stale := time.Since(j.fetchedAt) > jwksTTL
+	throttled := time.Since(j.attemptedAt) < jwksMinRefresh
+	j.mu.Unlock()
+
+	if ok && (!stale || throttled) {
+		return k, nil
+	}
+	if throttled {
+		return nil, errUnknownKey
+	}
+
+	_, err, _ := j.group.Do("", func() (interface{}, error) {
+		return nil, j.refresh(context.WithoutCancel(ctx))
+	})
+	if err != nil {
+		// Keep serving the last known keys if the endpoint is briefly down
+		if ok {
+			return k, nil
+		}
+		return nil, err
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if k, ok := j.lookup(kid); ok {
+		return k, nil
+	}
+	return nil, errUnknownKey
+}
+
+// refresh fetches the key set, recording the attempt whether or not it
+// succeeds.
+func (j *jwks) refresh(ctx context.Context) error {
+	keys, err := j.fetch(ctx)
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.attemptedAt = time.Now()
+	if err != nil {
+		return err
+	}
+	j.keys = keys
+	j.fetchedAt = j.attemptedAt
+	return nil
+}
+
+// lookup finds kid in the cached set. Tokens without a kid are accepted
+// only when the set has a single key.
+func (j *jwks) lookup(kid string) (*rsa.PublicKey, bool) {
+	if kid == "" && len(j.keys) == 1 {
+		for _, k := range j.keys {
+			return k, true
+		}
+	}
+	k, ok := j.keys[kid]
+	return k, ok
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+func (j *jwks) fetch(ctx context.Context) (map[string]*rsa.PublicKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, j.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := j.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetch jwks: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetch jwks: status %d", resp.StatusCode)
+	}
+
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return nil, fmt.Errorf("decode jwks: %w", err)
+	}
+
+	keys := make(map[string]*rsa.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+		pub, err := rsaPublicKey(k)
+		if err != nil {
+			continue
+		}
+		keys[k.Kid] = pub
+	}
+	return keys, nil
+}
+
+func rsaPublicKey(k jsonWebKey) (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(k.N)
+	if err != nil {
+		return nil, err
+	}
+	e, err := base64.RawURLEncoding.DecodeString(k.E)
+	if err != nil {
+		return nil, err
+	}
+	exp := new(big.Int).SetBytes(e)
+	if !exp.IsInt64() || exp.Int64() > 1<<31-1 {
+		return nil, errors.New("rsa exponent too large")
+	}
+	return &rsa.PublicKey{
+		N: new(big.Int).SetBytes(n),
+		E: int(exp.Int64()),
+	}, nil
+}
@@ -0,0 +1,110 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/mager/occipital/config"
+	"go.uber.org/zap"
+)
+
+// clockSkew is how much expiry and not-before checks tolerate.
+const clockSkew = 30 * time.Second
+
+// Verifier validates bearer tokens. HS256 tokens are checked against the
+// shared NextAuth secret and RS256 tokens against the configured JWKS.
+type Verifier struct {
+	log      *zap.SugaredLogger
+	secret   []byte
+	jwks     *jwks
+	issuer   string
+	audience string
+	methods  []string
+}
+
+// claims are the token claims we read. NextAuth puts the user ID in sub;
+// some providers use id instead.
+type claims struct {
+	jwt.RegisteredClaims
+	ID    string   `json:"id,omitempty"`
+	Email string   `json:"email,omitempty"`
+	Roles []string `json:"roles,omitempty"`
+}
+
+func ProvideVerifier(cfg config.Config, log *zap.SugaredLogger) *Verifier {
+	v := &Verifier{
+		log:      log,
+		issuer:   cfg.AuthIssuer,
+		audience: cfg.AuthAudience,
+	}
+	if cfg.NextAuthSecret != "" {
+		v.secret = []byte(cfg.NextAuthSecret)
+		v.methods = append(v.methods, jwt.SigningMethodHS256.Alg())
+	}
+	if cfg.AuthJWKSURL != "" {
+		v.jwks = newJWKS(cfg.AuthJWKSURL)
+		v.methods = append(v.methods, jwt.SigningMethodRS256.Alg())
+	}
+	if len(v.methods) == 0 {
+		log.Warn("No auth keys configured, authenticated routes will reject every request")
+	}
+	return v
+}
+
+var Options = ProvideVerifier
+
+// Verify checks the token's signature, algorithm, expiry, issuer and
+// audience and returns the principal it identifies.
+func (v *Verifier) Verify(ctx context.Context, token string) (*Principal, error) {
+	if len(v.methods) == 0 {
+		return nil, fmt.Errorf("%w: no keys configured", ErrInvalidToken)
+	}
+
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods(v.methods),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(clockSkew),
+	}
+	if v.issuer != "" {
+		opts = append(opts, jwt.WithIssuer(v.issuer))
+	}
+	if v.audience != "" {
+		opts = append(opts, jwt.WithAudience(v.audience))
+	}
+
+	var c claims
+	_, err := jwt.ParseWithClaims(token, &c, func(t *jwt.Token) (interface{}, error) {
+		switch t.Method.Alg() {
+		case jwt.SigningMethodHS256.Alg():
+			if len(v.secret) == 0 {
+				return nil, errUnknownKey
+			}
+			return v.secret, nil
+		case jwt.SigningMethodRS256.Alg():
+			if v.jwks == nil {
+				return nil, errUnknownKey
+			}
+			kid, _ := t.Header["kid"].(string)
+			return v.jwks.key(ctx, kid)
+		}
+		return nil, fmt.Errorf("unexpected signing method %s", t.Method.Alg())
+	}, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	p := &Principal{
+		UserID: c.Subject,
+		Email:  c.Email,
+		Roles:  c.Roles,
+	}
+	if p.UserID == "" {
+		p.UserID = c.ID
+	}
+	if p.UserID == "" {
+		return nil, fmt.Errorf("%w: no subject", ErrInvalidToken)
+	}
+	return p, nil
+}
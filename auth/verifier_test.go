@@ -0,0 +1,361 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"go.uber.org/zap"
+)
+
+const (
+	testSecret   = "nextauth-secret"
+	testIssuer   = "https://auth.example.com"
+	testAudience = "occipital"
+)
+
+var (
+	rsaKeysOnce sync.Once
+	rsaKeys     [2]*rsa.PrivateKey
+)
+
+// testRSAKeys returns two signing keys, generated once per run.
+func testRSAKeys(t *testing.T) [2]*rsa.PrivateKey {
+	t.Helper()
+	rsaKeysOnce.Do(func() {
+		for i := range rsaKeys {
+			k, err := rsa.GenerateKey(rand.Reader, 2048)
+			if err != nil {
+				panic(err)
+			}
+			rsaKeys[i] = k
+		}
+	})
+	return rsaKeys
+}
+
+// keyServer publishes keys as a JWKS and counts fetches. Status, when set,
+// is returned instead.
+type keyServer struct {
+	mu      sync.Mutex
+	keys    map[string]*rsa.PublicKey
+	status  int
+	fetches atomic.Int32
+}
+
+func (s *keyServer) set(keys map[string]*rsa.PublicKey, status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys, s.status = keys, status
+}
+
+func (s *keyServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.fetches.Add(1)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.status != 0 {
+		w.WriteHeader(s.status)
+		return
+	}
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	for kid, k := range s.keys {
+		set.Keys = append(set.Keys, jsonWebKey{
+			Kty: "RSA",
+			Kid: kid,
+			Use: "sig",
+			N:   base64.RawURLEncoding.EncodeToString(k.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(k.E)).Bytes()),
+		})
+	}
+	json.NewEncoder(w).Encode(set)
+}
+
+// newTestVerifier accepts HS256 tokens signed with testSecret and RS256
+// tokens signed with keys published by ks.
+func newTestVerifier(t *testing.T, ks *keyServer) *Verifier {
+	t.Helper()
+	srv := httptest.NewServer(ks)
+	t.Cleanup(srv.Close)
+	return &Verifier{
+		log:      zap.NewNop().Sugar(),
+		secret:   []byte(testSecret),
+		jwks:     newJWKS(srv.URL),
+		issuer:   testIssuer,
+		audience: testAudience,
+		methods:  []string{jwt.SigningMethodHS256.Alg(), jwt.SigningMethodRS256.Alg()},
+	}
+}
+
+func validClaims() jwt.MapClaims {
+	return jwt.MapClaims{
+		"sub":   "user-1",
+		"email": "user@example.com",
+		"iss":   testIssuer,
+		"aud":   testAudience,
+		"exp":   time.Now().Add(time.Hour).Unix(),
+	}
+}
+
+func sign(t *testing.T, method jwt.SigningMethod, kid string, c jwt.MapClaims, key interface{}) string {
+	t.Helper()
+	tok := jwt.NewWithClaims(method, c)
+	if kid != "" {
+		tok.Header["kid"] = kid
+	}
+	s, err := tok.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestVerify(t *testing.T) {
+	keys := testRSAKeys(t)
+	pubPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: must(x509.MarshalPKIXPublicKey(&keys[0].PublicKey))})
+
+	with := func(k string, v interface{}) jwt.MapClaims {
+		c := validClaims()
+		if v == nil {
+			delete(c, k)
+		} else {
+			c[k] = v
+		}
+		return c
+	}
+
+	tests := []struct {
+		name  string
+		token func(t *testing.T) string
+		ok    bool
+	}{
+		{
+			name: "HS256",
+			token: func(t *testing.T) string {
+				return sign(t, jwt.SigningMethodHS256, "", validClaims(), []byte(testSecret))
+			},
+			ok: true,
+		},
+		{
+			name:  "RS256",
+			token: func(t *testing.T) string { return sign(t, jwt.SigningMethodRS256, "k1", validClaims(), keys[0]) },
+			ok:    true,
+		},
+		{
+			name: "expired",
+			token: func(t *testing.T) string {
+				return sign(t, jwt.SigningMethodHS256, "", with("exp", time.Now().Add(-time.Hour).Unix()), []byte(testSecret))
+			},
+		},
+		{
+			name: "within clock skew",
+			token: func(t *testing.T) string {
+				return sign(t, jwt.SigningMethodHS256, "", with("exp", time.Now().Add(-clockSkew/2).Unix()), []byte(testSecret))
+			},
+			ok: true,
+		},
+		{
+			name: "no expiry",
+			token: func(t *testing.T) string {
+				return sign(t, jwt.SigningMethodHS256, "", with("exp", nil), []byte(testSecret))
+			},
+		},
+		{
+			name: "wrong issuer",
+			token: func(t *testing.T) string {
+				return sign(t, jwt.SigningMethodHS256, "", with("iss", "https://evil.example.com"), []byte(testSecret))
+			},
+		},
+		{
+			name: "wrong audience",
+			token: func(t *testing.T) string {
+				return sign(t, jwt.SigningMethodHS256, "", with("aud", "other"), []byte(testSecret))
+			},
+		},
+		{
+			name: "no subject",
+			token: func(t *testing.T) string {
+				return sign(t, jwt.SigningMethodHS256, "", with("sub", nil), []byte(testSecret))
+			},
+		},
+		{
+			name: "id instead of subject",
+			token: func(t *testing.T) string {
+				c := with("sub", nil)
+				c["id"] = "user-1"
+				return sign(t, jwt.SigningMethodHS256, "", c, []byte(testSecret))
+			},
+			ok: true,
+		},
+		{
+			name: "alg none",
+			token: func(t *testing.T) string {
+				return sign(t, jwt.SigningMethodNone, "", validClaims(), jwt.UnsafeAllowNoneSignatureType)
+			},
+		},
+		{
+			name: "HS256 signed with the RSA public key",
+			token: func(t *testing.T) string {
+				return sign(t, jwt.SigningMethodHS256, "k1", validClaims(), pubPEM)
+			},
+		},
+		{
+			name:  "RS256 with a key not in the set",
+			token: func(t *testing.T) string { return sign(t, jwt.SigningMethodRS256, "k1", validClaims(), keys[1]) },
+		},
+		{
+			name:  "RS512",
+			token: func(t *testing.T) string { return sign(t, jwt.SigningMethodRS512, "k1", validClaims(), keys[0]) },
+		},
+	}
+	ks := &keyServer{}
+	ks.set(map[string]*rsa.PublicKey{"k1": &keys[0].PublicKey}, 0)
+	v := newTestVerifier(t, ks)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := v.Verify(context.Background(), tt.token(t))
+			if tt.ok {
+				if err != nil {
+					t.Fatalf("Verify: %v", err)
+				}
+				if p.UserID != "user-1" {
+					t.Errorf("UserID = %q, want user-1", p.UserID)
+				}
+				return
+			}
+			if !errors.Is(err, ErrInvalidToken) {
+				t.Errorf("err = %v, want ErrInvalidToken", err)
+			}
+		})
+	}
+}
+
+func TestVerifyRejectsHS256WithoutSecret(t *testing.T) {
+	keys := testRSAKeys(t)
+	ks := &keyServer{}
+	ks.set(map[string]*rsa.PublicKey{"k1": &keys[0].PublicKey}, 0)
+	v := newTestVerifier(t, ks)
+	// Only the JWKS is configured
+	v.secret, v.methods = nil, []string{jwt.SigningMethodRS256.Alg()}
+
+	token := sign(t, jwt.SigningMethodHS256, "k1", validClaims(), []byte(testSecret))
+	if _, err := v.Verify(context.Background(), token); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("err = %v, want ErrInvalidToken", err)
+	}
+}
+
+func TestVerifyKeyRotation(t *testing.T) {
+	keys := testRSAKeys(t)
+	ks := &keyServer{}
+	ks.set(map[string]*rsa.PublicKey{"k1": &keys[0].PublicKey}, 0)
+	v := newTestVerifier(t, ks)
+	ctx := context.Background()
+
+	if _, err := v.Verify(ctx, sign(t, jwt.SigningMethodRS256, "k1", validClaims(), keys[0])); err != nil {
+		t.Fatalf("Verify k1: %v", err)
+	}
+
+	// k2 is published, but a refetch was just made
+	ks.set(map[string]*rsa.PublicKey{"k1": &keys[0].PublicKey, "k2": &keys[1].PublicKey}, 0)
+	rotated := sign(t, jwt.SigningMethodRS256, "k2", validClaims(), keys[1])
+	if _, err := v.Verify(ctx, rotated); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("err = %v, want ErrInvalidToken before the refresh interval", err)
+	}
+	if n := ks.fetches.Load(); n != 1 {
+		t.Errorf("fetches = %d, want 1", n)
+	}
+
+	v.jwks.attemptedAt = time.Now().Add(-jwksMinRefresh)
+	if _, err := v.Verify(ctx, rotated); err != nil {
+		t.Errorf("Verify k2 after rotation: %v", err)
+	}
+	if n := ks.fetches.Load(); n != 2 {
+		t.Errorf("fetches = %d, want 2", n)
+	}
+}
+
+func TestJWKSOutage(t *testing.T) {
+	keys := testRSAKeys(t)
+	ks := &keyServer{}
+	ks.set(map[string]*rsa.PublicKey{"k1": &keys[0].PublicKey}, 0)
+	v := newTestVerifier(t, ks)
+	ctx := context.Background()
+
+	known := sign(t, jwt.SigningMethodRS256, "k1", validClaims(), keys[0])
+	if _, err := v.Verify(ctx, known); err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+
+	// The endpoint goes down after the keys expire
+	ks.set(nil, http.StatusServiceUnavailable)
+	v.jwks.fetchedAt = time.Now().Add(-jwksTTL - time.Minute)
+	v.jwks.attemptedAt = v.jwks.fetchedAt
+
+	unknown := sign(t, jwt.SigningMethodRS256, "k9", validClaims(), keys[1])
+	for range 5 {
+		if _, err := v.Verify(ctx, unknown); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("err = %v, want ErrInvalidToken", err)
+		}
+		// The last known keys are still served
+		if _, err := v.Verify(ctx, known); err != nil {
+			t.Errorf("Verify known key during outage: %v", err)
+		}
+	}
+	if n := ks.fetches.Load(); n != 2 {
+		t.Errorf("fetches = %d, want the failed refetch only once", n)
+	}
+}
+
+func TestRequireAccessToken(t *testing.T) {
+	v := newTestVerifier(t, &keyServer{})
+	token := sign(t, jwt.SigningMethodHS256, "", validClaims(), []byte(testSecret))
+	h := v.Require()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := FromContext(r.Context()); !ok {
+			t.Error("no principal in context")
+		}
+	}))
+
+	tests := []struct {
+		name    string
+		upgrade bool
+		status  int
+	}{
+		{"websocket upgrade", true, http.StatusOK},
+		{"plain request", false, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/player/ws?access_token="+token, nil)
+			if tt.upgrade {
+				r.Header.Set("Connection", "Upgrade")
+				r.Header.Set("Upgrade", "websocket")
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d", w.Code, tt.status)
+			}
+		})
+	}
+}
+
+func must[T any](v T, err error) T {
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
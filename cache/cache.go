@@ -0,0 +1,104 @@
+package cache
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/mager/occipital/config"
+	"go.uber.org/zap"
+)
+
+// ErrNotFound is returned by a Cache when a key has no entry.
+var ErrNotFound = errors.New("cache: not found")
+
+// Cache is a key/value store for serialized values and their expiry metadata.
+// Keys have the form "namespace/id" (see Key), which backends may use to
+// partition storage, e.g. one Firestore collection per namespace.
+type Cache interface {
+	Get(ctx context.Context, key string) (*Entry, error)
+	Set(ctx context.Context, key string, e *Entry) error
+	Delete(ctx context.Context, key string) error
+}
+
+// ErrScanUnsupported is returned by Scan when the cache can't enumerate keys.
+var ErrScanUnsupported = errors.New("cache: scan unsupported")
+
+// Scanner is implemented by caches that can enumerate a namespace. fn is
+// called once per entry; returning an error stops the scan.
+type Scanner interface {
+	Scan(ctx context.Context, namespace string, fn func(key string, e *Entry) error) error
+}
+
+// Entry is a cached value. It is fresh until ExpiresAt and may be served
+// stale, while a refresh runs in the background, until StaleUntil.
+type Entry struct {
+	Value      []byte
+	CachedAt   time.Time
+	ExpiresAt  time.Time
+	StaleUntil time.Time
+}
+
+// Fresh reports whether the entry can be served without revalidation.
+func (e *Entry) Fresh(now time.Time) bool {
+	return now.Before(e.ExpiresAt)
+}
+
+// Servable reports whether the entry can still be served, fresh or stale.
+func (e *Entry) Servable(now time.Time) bool {
+	return now.Before(e.ExpiresAt) || now.Before(e.StaleUntil)
+}
+
+// Key builds a cache key in the given namespace. Parts are joined with ":"
+// and any "/" is replaced so the id stays a single path segment.
+func Key(namespace string, parts ...string) string {
+	id := strings.Join(parts, ":")
+	id = strings.ReplaceAll(id, "/", "_")
+	return namespace + "/" + id
+}
+
+// splitKey returns the namespace and id of a key built with Key.
+func splitKey(key string) (string, string) {
+	if idx := strings.Index(key, "/"); idx > 0 {
+		return key[:idx], key[idx+1:]
+	}
+	return "cache", key
+}
+
+// ProvideCache provides a Loader over the configured backend, fronted by an
+// in-memory LRU so hot keys don't round-trip to the shared store.
+func ProvideCache(
+	cfg config.Config,
+	log *zap.SugaredLogger,
+	fs *firestore.Client,
+	db *sql.DB,
+) (*Loader, error) {
+	local := NewMemory(cfg.CacheMemoryEntries)
+
+	var remote Cache
+	switch cfg.CacheBackend {
+	case "memory":
+	case "postgres":
+		pg, err := NewPostgres(context.Background(), db, "cache_entries")
+		if err != nil {
+			return nil, err
+		}
+		remote = pg
+	default:
+		if fs == nil {
+			log.Warn("Firestore unavailable, using in-memory cache only")
+			break
+		}
+		remote = NewFirestore(fs)
+	}
+
+	if remote == nil {
+		return NewLoader(local, log), nil
+	}
+	return NewLoader(NewTiered(log, local, remote), log), nil
+}
+
+var Options = ProvideCache
@@ -0,0 +1,100 @@
+package cache
+
+import (
+	"context"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Firestore stores entries as documents, one collection per key namespace.
+type Firestore struct {
+	client *firestore.Client
+}
+
+type firestoreEntry struct {
+	Value      []byte    `firestore:"value"`
+	CachedAt   time.Time `firestore:"cached_at"`
+	ExpiresAt  time.Time `firestore:"expires_at"`
+	StaleUntil time.Time `firestore:"stale_until"`
+}
+
+// NewFirestore returns a Cache backed by the given Firestore client.
+func NewFirestore(client *firestore.Client) *Firestore {
+	return &Firestore{client: client}
+}
+
+func (f *Firestore) doc(key string) *firestore.DocumentRef {
+	namespace, id := splitKey(key)
+	return f.client.Collection(namespace).Doc(id)
+}
+
+func (f *Firestore) Get(ctx context.Context, key string) (*Entry, error) {
+	snap, err := f.doc(key).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var fe firestoreEntry
+	if err := snap.DataTo(&fe); err != nil {
+		return nil, err
+	}
+	// Documents written before this schema have no value; treat them as misses
+	if len(fe.Value) == 0 {
+		return nil, ErrNotFound
+	}
+	return &Entry{
+		Value:      fe.Value,
+		CachedAt:   fe.CachedAt,
+		ExpiresAt:  fe.ExpiresAt,
+		StaleUntil: fe.StaleUntil,
+	}, nil
+}
+
+func (f *Firestore) Set(ctx context.Context, key string, e *Entry) error {
+	_, err := f.doc(key).Set(ctx, firestoreEntry{
+		Value:      e.Value,
+		CachedAt:   e.CachedAt,
+		ExpiresAt:  e.ExpiresAt,
+		StaleUntil: e.StaleUntil,
+	})
+	return err
+}
+
+func (f *Firestore) Delete(ctx context.Context, key string) error {
+	_, err := f.doc(key).Delete(ctx)
+	return err
+}
+
+// Scan iterates the namespace's collection.
+func (f *Firestore) Scan(ctx context.Context, namespace string, fn func(key string, e *Entry) error) error {
+	iter := f.client.Collection(namespace).Documents(ctx)
+	defer iter.Stop()
+	for {
+		snap, err := iter.Next()
+		if err == iterator.Done {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		var fe firestoreEntry
+		if err := snap.DataTo(&fe); err != nil || len(fe.Value) == 0 {
+			continue
+		}
+		err = fn(namespace+"/"+snap.Ref.ID, &Entry{
+			Value:      fe.Value,
+			CachedAt:   fe.CachedAt,
+			ExpiresAt:  fe.ExpiresAt,
+			StaleUntil: fe.StaleUntil,
+		})
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	// revalidateTimeout bounds background refreshes of stale entries.
+	revalidateTimeout = 30 * time.Second
+	// loadTimeout bounds a shared load on a miss, which no longer ends with
+	// the request that started it.
+	loadTimeout = 30 * time.Second
+)
+
+type backgroundKey struct{}
+
+// IsBackground reports whether ctx belongs to a background refresh that
+// nobody is waiting on. Upstream clients can use it to queue that work
+// behind requests a user is waiting on.
+func IsBackground(ctx context.Context) bool {
+	b, _ := ctx.Value(backgroundKey{}).(bool)
+	return b
+}
+
+// Policy controls how long a loaded value is kept.
+type Policy struct {
+	// TTL is how long a value is served without revalidation.
+	TTL time.Duration
+	// StaleWhileRevalidate is how long past TTL a value is still served
+	// while a single background refresh replaces it.
+	StaleWhileRevalidate time.Duration
+	// Degraded, if set, reports whether a freshly loaded value is partial,
+	// e.g. built while an upstream was down. Such values are fresh for
+	// DegradedTTL instead of TTL so the next load soon retries them.
+	Degraded    func(v any) bool
+	DegradedTTL time.Duration
+}
+
+// ttl returns how long v is served without revalidation.
+func (p Policy) ttl(v any) time.Duration {
+	if p.Degraded != nil && p.Degraded(v) {
+		return p.DegradedTTL
+	}
+	return p.TTL
+}
+
+// Loader reads through a Cache, de-duplicating concurrent loads of the same key.
+type Loader struct {
+	cache Cache
+	log   *zap.SugaredLogger
+	group singleflight.Group
+}
+
+// NewLoader returns a Loader over the given cache.
+func NewLoader(c Cache, log *zap.SugaredLogger) *Loader {
+	return &Loader{cache: c, log: log}
+}
+
+// Fetch returns the value cached under key, calling load on a miss.
+// Concurrent misses for the same key share a single call to load, and stale
+// entries are served immediately while one background call refreshes them.
+// Values are stored as JSON, so T must round-trip through encoding/json.
+func Fetch[T any](ctx context.Context, l *Loader, key string, p Policy, load func(ctx context.Context) (T, error)) (T, error) {
+	now := time.Now()
+
+	e, err := l.cache.Get(ctx, key)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		l.log.Warnw("Cache read failed", "key", key, "error", err)
+	}
+	if err == nil && e.Servable(now) {
+		var v T
+		if err := json.Unmarshal(e.Value, &v); err == nil {
+			if !e.Fresh(now) {
+				l.log.Infow("Cache stale, revalidating", "key", key)
+				revalidate(ctx, l, key, p, load)
+			}
+			return v, nil
+		}
+		l.log.Warnw("Cache entry undecodable", "key", key, "error", err)
+	}
+
+	// Detach from the caller so one canceled request doesn't fail the others
+	// waiting on the same load.
+	res, err, _ := l.group.Do(key, func() (interface{}, error) {
+		shared, cancel := context.WithTimeout(context.WithoutCancel(ctx), loadTimeout)
+		defer cancel()
+		return loadAndStore(shared, l, key, p, load)
+	})
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return res.(T), nil
+}
+
+// Peek returns the value cached under key if one is still servable. It never
+// loads or revalidates, so callers that build values differently than the
+// key's owner can read without overwriting.
+func Peek[T any](ctx context.Context, l *Loader, key string) (T, bool) {
+	var v T
+	e, err := l.cache.Get(ctx, key)
+	if err != nil {
+		if !errors.Is(err, ErrNotFound) {
+			l.log.Warnw("Cache read failed", "key", key, "error", err)
+		}
+		return v, false
+	}
+	if !e.Servable(time.Now()) {
+		return v, false
+	}
+	if err := json.Unmarshal(e.Value, &v); err != nil {
+		l.log.Warnw("Cache entry undecodable", "key", key, "error", err)
+		return v, false
+	}
+	return v, true
+}
+
+// Scan calls fn with every servable value in namespace. Entries that no longer
+// decode as T are skipped. It returns ErrScanUnsupported if the backend can't
+// enumerate keys.
+func Scan[T any](ctx context.Context, l *Loader, namespace string, fn func(key string, v T) error) error {
+	sc, ok := l.cache.(Scanner)
+	if !ok {
+		return ErrScanUnsupported
+	}
+	now := time.Now()
+	return sc.Scan(ctx, namespace, func(key string, e *Entry) error {
+		if !e.Servable(now) {
+			return nil
+		}
+		var v T
+		if err := json.Unmarshal(e.Value, &v); err != nil {
+			return nil
+		}
+		return fn(key, v)
+	})
+}
+
+// Invalidate removes key from the cache.
+func (l *Loader) Invalidate(ctx context.Context, key string) error {
+	err := l.cache.Delete(ctx, key)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	return err
+}
+
+// revalidate refreshes a stale key in the background. Only one refresh per
+// key runs at a time; callers keep getting the stale value until it lands.
+// Nobody is waiting on the refresh, so load sees a context marked with
+// IsBackground.
+func revalidate[T any](ctx context.Context, l *Loader, key string, p Policy, load func(ctx context.Context) (T, error)) {
+	ctx = context.WithValue(context.WithoutCancel(ctx), backgroundKey{}, true)
+	ctx, cancel := context.WithTimeout(ctx, revalidateTimeout)
+	ch := l.group.DoChan(key, func() (interface{}, error) {
+		return loadAndStore(ctx, l, key, p, load)
+	})
+	go func() {
+		defer cancel()
+		if res := <-ch; res.Err != nil {
+			l.log.Warnw("Cache revalidation failed", "key", key, "error", res.Err)
+		}
+	}()
+}
+
+func loadAndStore[T any](ctx context.Context, l *Loader, key string, p Policy, load func(ctx context.Context) (T, error)) (interface{}, error) {
+	v, err := load(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		l.log.Warnw("Failed to marshal value for cache", "key", key, "error", err)
+		return v, nil
+	}
+	now := time.Now()
+	ttl := p.ttl(v)
+	e := &Entry{
+		Value:      b,
+		CachedAt:   now,
+		ExpiresAt:  now.Add(ttl),
+		StaleUntil: now.Add(ttl + p.StaleWhileRevalidate),
+	}
+	if err := l.cache.Set(ctx, key, e); err != nil {
+		l.log.Warnw("Failed to write cache", "key", key, "error", err)
+	} else {
+		l.log.Infow("Cached", "key", key, "ttl", ttl.String())
+	}
+	return v, nil
+}
@@ -0,0 +1,69 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestRevalidateRunsInBackground(t *testing.T) {
+	mem := NewMemory(10)
+	l := NewLoader(mem, zap.NewNop().Sugar())
+	ctx := context.Background()
+
+	now := time.Now()
+	b, _ := json.Marshal("stale")
+	mem.Set(ctx, "ns/key", &Entry{
+		Value:      b,
+		CachedAt:   now.Add(-2 * time.Hour),
+		ExpiresAt:  now.Add(-time.Hour),
+		StaleUntil: now.Add(time.Hour),
+	})
+
+	got := make(chan bool, 1)
+	v, err := Fetch(ctx, l, "ns/key", Policy{TTL: time.Hour}, func(ctx context.Context) (string, error) {
+		got <- IsBackground(ctx)
+		return "fresh", nil
+	})
+	if err != nil || v != "stale" {
+		t.Fatalf("Fetch = %q, %v; want the stale value", v, err)
+	}
+
+	select {
+	case bg := <-got:
+		if !bg {
+			t.Error("revalidation not marked as background")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("revalidation never ran")
+	}
+}
+
+func TestMissLoadIsDetachedButBounded(t *testing.T) {
+	l := NewLoader(NewMemory(10), zap.NewNop().Sugar())
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var bg, live, bounded bool
+	_, err := Fetch(ctx, l, "ns/key", Policy{TTL: time.Hour}, func(ctx context.Context) (string, error) {
+		bg = IsBackground(ctx)
+		live = ctx.Err() == nil
+		_, bounded = ctx.Deadline()
+		return "v", nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bg {
+		t.Error("miss marked as background")
+	}
+	if !live {
+		t.Error("caller's cancellation reached the shared load")
+	}
+	if !bounded {
+		t.Error("shared load has no deadline")
+	}
+}
@@ -0,0 +1,105 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"strings"
+	"sync"
+)
+
+// Memory is an in-process LRU cache bounded by number of entries.
+type Memory struct {
+	mu       sync.Mutex
+	capacity int
+	ll       *list.List
+	items    map[string]*list.Element
+}
+
+type memoryItem struct {
+	key   string
+	entry Entry
+}
+
+// NewMemory returns an LRU cache that holds at most capacity entries.
+func NewMemory(capacity int) *Memory {
+	if capacity <= 0 {
+		capacity = 1024
+	}
+	return &Memory{
+		capacity: capacity,
+		ll:       list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+func (m *Memory) Get(_ context.Context, key string) (*Entry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	el, ok := m.items[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	m.ll.MoveToFront(el)
+	e := el.Value.(*memoryItem).entry
+	return &e, nil
+}
+
+func (m *Memory) Set(_ context.Context, key string, e *Entry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if el, ok := m.items[key]; ok {
+		el.Value.(*memoryItem).entry = *e
+		m.ll.MoveToFront(el)
+		return nil
+	}
+
+	m.items[key] = m.ll.PushFront(&memoryItem{key: key, entry: *e})
+	for m.ll.Len() > m.capacity {
+		oldest := m.ll.Back()
+		m.ll.Remove(oldest)
+		delete(m.items, oldest.Value.(*memoryItem).key)
+	}
+	return nil
+}
+
+func (m *Memory) Delete(_ context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if el, ok := m.items[key]; ok {
+		m.ll.Remove(el)
+		delete(m.items, key)
+	}
+	return nil
+}
+
+// Len reports the number of entries currently held.
+func (m *Memory) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.ll.Len()
+}
+
+// Scan visits a snapshot of the entries in namespace, most recently used first.
+func (m *Memory) Scan(_ context.Context, namespace string, fn func(key string, e *Entry) error) error {
+	prefix := namespace + "/"
+
+	m.mu.Lock()
+	var items []memoryItem
+	for el := m.ll.Front(); el != nil; el = el.Next() {
+		it := el.Value.(*memoryItem)
+		if strings.HasPrefix(it.key, prefix) {
+			items = append(items, *it)
+		}
+	}
+	m.mu.Unlock()
+
+	for i := range items {
+		if err := fn(items[i].key, &items[i].entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package cache
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// Postgres stores entries in a single table keyed by the full cache key.
+type Postgres struct {
+	db    *sql.DB
+	table string
+}
+
+// NewPostgres returns a Cache backed by the given table, creating it if needed.
+func NewPostgres(ctx context.Context, db *sql.DB, table string) (*Postgres, error) {
+	query := fmt.Sprintf(`
+        CREATE TABLE IF NOT EXISTS %s (
+            key         TEXT PRIMARY KEY,
+            value       BYTEA NOT NULL,
+            cached_at   TIMESTAMPTZ NOT NULL,
+            expires_at  TIMESTAMPTZ NOT NULL,
+            stale_until TIMESTAMPTZ NOT NULL
+        )
+	`, table)
+	if _, err := db.ExecContext(ctx, query); err != nil {
+		return nil, err
+	}
+	return &Postgres{db: db, table: table}, nil
+}
+
+func (p *Postgres) Get(ctx context.Context, key string) (*Entry, error) {
+	query := fmt.Sprintf(`
+        SELECT value, cached_at, expires_at, stale_until
+        FROM %s
+		WHERE key = $1
+	`, p.table)
+
+	var e Entry
+	err := p.db.QueryRowContext(ctx, query, key).Scan(&e.Value, &e.CachedAt, &e.ExpiresAt, &e.StaleUntil)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+func (p *Postgres) Set(ctx context.Context, key string, e *Entry) error {
+	query := fmt.Sprintf(`
+        INSERT INTO %s (key, value, cached_at, expires_at, stale_until)
+        VALUES ($1, $2, $3, $4, $5)
+        ON CONFLICT (key) DO UPDATE
+        SET value = EXCLUDED.value,
+            cached_at = EXCLUDED.cached_at,
+            expires_at = EXCLUDED.expires_at,
+            stale_until = EXCLUDED.stale_until
+	`, p.table)
+	_, err := p.db.ExecContext(ctx, query, key, e.Value, e.CachedAt, e.ExpiresAt, e.StaleUntil)
+	return err
+}
+
+func (p *Postgres) Delete(ctx context.Context, key string) error {
+	query := fmt.Sprintf(`DELETE FROM %s WHERE key = $1`, p.table)
+	_, err := p.db.ExecContext(ctx, query, key)
+	return err
+}
+
+// Scan selects every row whose key is in namespace.
+func (p *Postgres) Scan(ctx context.Context, namespace string, fn func(key string, e *Entry) error) error {
+	// Match the prefix literally; namespaces contain "_", a LIKE wildcard
+	query := fmt.Sprintf(`
+        SELECT key, value, cached_at, expires_at, stale_until
+        FROM %s
+		WHERE left(key, length($1)) = $1
+	`, p.table)
+
+	rows, err := p.db.QueryContext(ctx, query, namespace+"/")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			key string
+			e   Entry
+		)
+		if err := rows.Scan(&key, &e.Value, &e.CachedAt, &e.ExpiresAt, &e.StaleUntil); err != nil {
+			return err
+		}
+		if err := fn(key, &e); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
@@ -0,0 +1,65 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Tiered puts a fast local cache in front of a slower shared one.
+// Reads fall through to the remote tier and backfill the local tier;
+// writes hit the local tier synchronously and the remote tier in the background.
+type Tiered struct {
+	log    *zap.SugaredLogger
+	local  Cache
+	remote Cache
+}
+
+// NewTiered returns a two-level cache.
+func NewTiered(log *zap.SugaredLogger, local, remote Cache) *Tiered {
+	return &Tiered{log: log, local: local, remote: remote}
+}
+
+func (t *Tiered) Get(ctx context.Context, key string) (*Entry, error) {
+	if e, err := t.local.Get(ctx, key); err == nil {
+		return e, nil
+	}
+	e, err := t.remote.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	t.local.Set(ctx, key, e)
+	return e, nil
+}
+
+func (t *Tiered) Set(ctx context.Context, key string, e *Entry) error {
+	if err := t.local.Set(ctx, key, e); err != nil {
+		return err
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := t.remote.Set(ctx, key, e); err != nil {
+			t.log.Warnw("Failed to write remote cache", "key", key, "error", err)
+		}
+	}()
+	return nil
+}
+
+func (t *Tiered) Delete(ctx context.Context, key string) error {
+	return errors.Join(t.local.Delete(ctx, key), t.remote.Delete(ctx, key))
+}
+
+// Scan enumerates the remote tier, which holds everything the local tier
+// does, falling back to the local tier when the remote can't scan.
+func (t *Tiered) Scan(ctx context.Context, namespace string, fn func(key string, e *Entry) error) error {
+	if sc, ok := t.remote.(Scanner); ok {
+		return sc.Scan(ctx, namespace, fn)
+	}
+	if sc, ok := t.local.(Scanner); ok {
+		return sc.Scan(ctx, namespace, fn)
+	}
+	return ErrScanUnsupported
+}
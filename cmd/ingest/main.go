@@ -0,0 +1,93 @@
+// Command ingest fills the discover source collections in Firestore.
+//
+//	go run ./cmd/ingest                 # run every source on its schedule
+//	go run ./cmd/ingest -once           # run every source once and exit
+//	go run ./cmd/ingest -once -source spotify_new_releases
+//
+// After the sources it records the day's discover v2 snapshot, hourly when
+// running on a schedule, so history and trending don't depend on traffic.
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/mager/occipital/config"
+	fs "github.com/mager/occipital/firestore"
+	discoverHandler "github.com/mager/occipital/handler/discover"
+	"github.com/mager/occipital/ingest"
+	"github.com/mager/occipital/logger"
+	"github.com/mager/occipital/musicbrainz"
+	"github.com/mager/occipital/spotify"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+// snapshotInterval is how often the day's discover snapshot is rewritten.
+const snapshotInterval = time.Hour
+
+func main() {
+	once := flag.Bool("once", false, "run each source once and exit")
+	sources := flag.String("source", "", "comma-separated sources to run; all when empty")
+	flag.Parse()
+
+	var names []string
+	if *sources != "" {
+		names = strings.Split(*sources, ",")
+	}
+
+	app := fx.New(
+		fx.Provide(
+			config.Options,
+			logger.Options,
+			fs.Options,
+			spotify.Options,
+			musicbrainz.Options,
+			ingest.Options,
+			discoverHandler.ProvideConfigStore,
+			discoverHandler.NewSnapshotter,
+		),
+		fx.Invoke(func(lc fx.Lifecycle, sh fx.Shutdowner, s *ingest.Scheduler, snapshotter *discoverHandler.Snapshotter, logger *zap.SugaredLogger) error {
+			jobs, err := s.Jobs(names...)
+			if err != nil {
+				return err
+			}
+			s.AddTask(ingest.Task{
+				Name:     "discover_snapshot",
+				Interval: snapshotInterval,
+				Run:      snapshotter.Record,
+			})
+
+			ctx, cancel := context.WithCancel(context.Background())
+			lc.Append(fx.Hook{
+				OnStart: func(context.Context) error {
+					if !*once {
+						s.Start(ctx, jobs)
+						return nil
+					}
+					go func() {
+						code := 0
+						if err := s.RunOnce(ctx, jobs); err != nil {
+							logger.Errorw("Ingestion failed", "err", err)
+							code = 1
+						}
+						sh.Shutdown(fx.ExitCode(code))
+					}()
+					return nil
+				},
+				OnStop: func(context.Context) error {
+					cancel()
+					return nil
+				},
+			})
+			return nil
+		}),
+	)
+	if err := app.Err(); err != nil {
+		log.Fatal(err)
+	}
+	app.Run()
+}
@@ -0,0 +1,269 @@
+// Package collab links creators who worked on the same recordings into a
+// collaboration graph.
+package collab
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/mager/occipital/occipital"
+)
+
+// Credit is one artist's role on a recording.
+type Credit struct {
+	ArtistID   string
+	ArtistName string
+	// Role is what the artist did, e.g. "produced" or "played bass"
+	Role string
+}
+
+// RoleCount is how many shared recordings a collaborator had a role on.
+type RoleCount struct {
+	Role  string `json:"role"`
+	Count int    `json:"count"`
+}
+
+// Collaborator is a creator who shares recordings with another.
+type Collaborator struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// Weight is the number of shared recordings
+	Weight int `json:"weight"`
+	// Roles are what the collaborator did on them, most frequent first
+	Roles []RoleCount `json:"roles"`
+}
+
+// Recording is a recording in the graph.
+type Recording struct {
+	ID    string `json:"id"`
+	Title string `json:"title"`
+}
+
+// Hop is one step of a path between creators.
+type Hop struct {
+	From Collaborator `json:"from"`
+	To   Collaborator `json:"to"`
+	// Recording is one of the recordings the two share
+	Recording Recording `json:"recording"`
+}
+
+// Graph is an undirected graph of creators, with an edge between any two
+// credited on the same recording. It is safe for concurrent use.
+type Graph struct {
+	mu    sync.RWMutex
+	names map[string]string
+	// recordings holds each recording's credits, so adding a recording again
+	// replaces its edges rather than counting it twice
+	recordings map[string]recordingCredits
+	// edges[a][b][recording] is b's roles on a recording shared with a
+	edges map[string]map[string]map[string][]string
+}
+
+type recordingCredits struct {
+	title   string
+	credits []Credit
+}
+
+// New returns an empty graph.
+func New() *Graph {
+	return &Graph{
+		names:      make(map[string]string),
+		recordings: make(map[string]recordingCredits),
+		edges:      make(map[string]map[string]map[string][]string),
+	}
+}
+
+// AddTrack adds the credits on a resolved track. Tracks without a
+// MusicBrainz recording ID are ignored.
+func (g *Graph) AddTrack(t occipital.Track) {
+	if t.ID == "" {
+		return
+	}
+	g.AddRecording(t.ID, t.Name, CreditsFor(t))
+}
+
+// AddRecording replaces the edges contributed by a recording.
+func (g *Graph) AddRecording(id, title string, credits []Credit) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if old, ok := g.recordings[id]; ok {
+		g.unlink(id, old.credits)
+	}
+	if len(credits) == 0 {
+		delete(g.recordings, id)
+		return
+	}
+	g.recordings[id] = recordingCredits{title: title, credits: credits}
+
+	roles := make(map[string][]string)
+	for _, c := range credits {
+		g.names[c.ArtistID] = c.ArtistName
+		roles[c.ArtistID] = append(roles[c.ArtistID], c.Role)
+	}
+	for a := range roles {
+		for b, bRoles := range roles {
+			if a == b {
+				continue
+			}
+			if g.edges[a] == nil {
+				g.edges[a] = make(map[string]map[string][]string)
+			}
+			if g.edges[a][b] == nil {
+				g.edges[a][b] = make(map[string][]string)
+			}
+			g.edges[a][b][id] = labelRoles(bRoles, roles[a])
+		}
+	}
+}
+
+func (g *Graph) unlink(id string, credits []Credit) {
+	for _, a := range credits {
+		for _, b := range credits {
+			if shared := g.edges[a.ArtistID][b.ArtistID]; shared != nil {
+				delete(shared, id)
+				if len(shared) == 0 {
+					delete(g.edges[a.ArtistID], b.ArtistID)
+				}
+			}
+		}
+		if len(g.edges[a.ArtistID]) == 0 {
+			delete(g.edges, a.ArtistID)
+		}
+	}
+}
+
+// Len reports the number of creators with at least one collaborator.
+func (g *Graph) Len() int {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return len(g.edges)
+}
+
+// Name returns a creator's name, or "" if the graph doesn't know them.
+func (g *Graph) Name(id string) string {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.names[id]
+}
+
+// Collaborators returns up to limit of a creator's collaborators, heaviest
+// edge first.
+func (g *Graph) Collaborators(id string, limit int) []Collaborator {
+	g.mu.RLock()
+	out := make([]Collaborator, 0, len(g.edges[id]))
+	for b := range g.edges[id] {
+		out = append(out, g.collaborator(id, b))
+	}
+	g.mu.RUnlock()
+
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Weight != out[j].Weight {
+			return out[i].Weight > out[j].Weight
+		}
+		return out[i].Name < out[j].Name
+	})
+	if limit > 0 && len(out) > limit {
+		out = out[:limit]
+	}
+	return out
+}
+
+// collaborator describes b as a collaborator of a. g.mu must be held.
+func (g *Graph) collaborator(a, b string) Collaborator {
+	shared := g.edges[a][b]
+	counts := make(map[string]int)
+	for _, roles := range shared {
+		for _, r := range roles {
+			counts[r]++
+		}
+	}
+	c := Collaborator{ID: b, Name: g.names[b], Weight: len(shared)}
+	for r, n := range counts {
+		c.Roles = append(c.Roles, RoleCount{Role: r, Count: n})
+	}
+	sort.Slice(c.Roles, func(i, j int) bool {
+		if c.Roles[i].Count != c.Roles[j].Count {
+			return c.Roles[i].Count > c.Roles[j].Count
+		}
+		return c.Roles[i].Role < c.Roles[j].Role
+	})
+	return c
+}
+
+// Path returns the shortest chain of collaborations from one creator to
+// another, at most maxHops long, and whether there is one. Among paths of
+// the same length it follows heavier edges first.
+func (g *Graph) Path(from, to string, maxHops int) ([]Hop, bool) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	if from == to {
+		return []Hop{}, g.edges[from] != nil
+	}
+
+	prev := map[string]string{from: ""}
+	frontier := []string{from}
+	for depth := 0; depth < maxHops && len(frontier) > 0; depth++ {
+		var next []string
+		for _, a := range frontier {
+			for _, b := range g.neighboursByWeight(a) {
+				if _, seen := prev[b]; seen {
+					continue
+				}
+				prev[b] = a
+				if b == to {
+					return g.hops(prev, to), true
+				}
+				next = append(next, b)
+			}
+		}
+		frontier = next
+	}
+	return nil, false
+}
+
+func (g *Graph) neighboursByWeight(a string) []string {
+	out := make([]string, 0, len(g.edges[a]))
+	for b := range g.edges[a] {
+		out = append(out, b)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		wi, wj := len(g.edges[a][out[i]]), len(g.edges[a][out[j]])
+		if wi != wj {
+			return wi > wj
+		}
+		return out[i] < out[j]
+	})
+	return out
+}
+
+// hops walks prev back from to. g.mu must be held.
+func (g *Graph) hops(prev map[string]string, to string) []Hop {
+	var hops []Hop
+	for b := to; prev[b] != ""; b = prev[b] {
+		a := prev[b]
+		hops = append(hops, Hop{
+			From:      g.collaborator(b, a),
+			To:        g.collaborator(a, b),
+			Recording: g.sharedRecording(a, b),
+		})
+	}
+	for i, j := 0, len(hops)-1; i < j; i, j = i+1, j-1 {
+		hops[i], hops[j] = hops[j], hops[i]
+	}
+	return hops
+}
+
+// sharedRecording picks one recording a and b share, by title for a stable
+// answer. g.mu must be held.
+func (g *Graph) sharedRecording(a, b string) Recording {
+	var best Recording
+	for id := range g.edges[a][b] {
+		r := Recording{ID: id, Title: g.recordings[id].title}
+		if best.ID == "" || r.Title < best.Title || r.Title == best.Title && r.ID < best.ID {
+			best = r
+		}
+	}
+	return best
+}
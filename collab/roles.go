@@ -0,0 +1,89 @@
+package collab
+
+import (
+	"slices"
+
+	"github.com/mager/occipital/occipital"
+)
+
+const (
+	rolePerformed = "performed"
+	roleProduced  = "produced"
+	roleWrote     = "wrote"
+)
+
+// creditRoles maps production and song credit types to roles.
+var creditRoles = map[string]string{
+	"producer":  roleProduced,
+	"mix":       "mixed",
+	"recording": "recorded",
+	"vocal":     "sang",
+	"composer":  "composed",
+	"lyricist":  "wrote lyrics",
+	"writer":    roleWrote,
+}
+
+// writingRoles are the roles that make two creators co-writers.
+var writingRoles = []string{"composed", "wrote lyrics", roleWrote}
+
+// CreditsFor lists every credited artist on a track with their role.
+func CreditsFor(t occipital.Track) []Credit {
+	var credits []Credit
+	add := func(a occipital.CreditArtist, role string) {
+		if a.ID != "" {
+			credits = append(credits, Credit{ArtistID: a.ID, ArtistName: a.Name, Role: role})
+		}
+	}
+	for _, a := range t.ArtistCredits {
+		add(a, rolePerformed)
+	}
+	for _, in := range t.Instruments {
+		for _, a := range in.Artists {
+			add(a, "played "+in.Instrument)
+		}
+	}
+	for _, pc := range t.ProductionCredits {
+		for _, a := range pc.Artists {
+			add(a, roleFor(pc.Credit))
+		}
+	}
+	for _, sc := range t.SongCredits {
+		for _, a := range sc.Artists {
+			add(a, roleFor(sc.Credit))
+		}
+	}
+	return credits
+}
+
+func roleFor(credit string) string {
+	if role, ok := creditRoles[credit]; ok {
+		return role
+	}
+	return credit
+}
+
+// labelRoles describes b's roles on a recording relative to a's, so two
+// writers are co-writers and two producers co-producers.
+func labelRoles(b, a []string) []string {
+	aWrote := slices.ContainsFunc(a, isWriting)
+	aProduced := slices.Contains(a, roleProduced)
+
+	var out []string
+	for _, r := range b {
+		switch {
+		case isWriting(r) && aWrote:
+			r = "co-wrote"
+		case r == roleProduced && aProduced:
+			r = "co-produced"
+		}
+		if !slices.Contains(out, r) {
+			out = append(out, r)
+		}
+	}
+	slices.Sort(out)
+	return out
+}
+
+func isWriting(role string) bool {
+	return slices.Contains(writingRoles, role)
+}
@@ -12,8 +12,34 @@ type Config struct {
 	SpotifyID          string
 	SpotifySecret      string
 	SpotifyRedirectURL string
+	// SpotifyStateSecret signs OAuth state; set it when running more than one instance
+	SpotifyStateSecret string
+	// SpotifyTokenKey is a base64 32-byte key that encrypts stored user tokens
+	SpotifyTokenKey string
 
 	MusixmatchAPIKey string
+
+	// AllowedOrigins lists browser origins that may open WebSockets,
+	// e.g. "https://occipital.app"; same-origin only when empty
+	AllowedOrigins []string
+
+	// NextAuthSecret verifies HS256 tokens; AuthJWKSURL enables RS256.
+	// AuthIssuer and AuthAudience are checked when set.
+	NextAuthSecret string
+	AuthJWKSURL    string
+	AuthIssuer     string
+	AuthAudience   string
+
+	// DiscoverConfigPath loads the discover v2 config from a JSON file
+	// instead of Firestore
+	DiscoverConfigPath string
+
+	// IngestSpotifyCountry is the market cmd/ingest reads Spotify new releases for
+	IngestSpotifyCountry string `default:"US"`
+
+	// CacheBackend selects the shared cache: "firestore", "postgres" or "memory"
+	CacheBackend       string `default:"firestore"`
+	CacheMemoryEntries int    `default:"4096"`
 }
 
 func ProvideConfig() Config {
@@ -0,0 +1,80 @@
+package creator
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/mager/occipital/collab"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultCollaboratorsLimit = 25
+	maxCollaboratorsLimit     = 100
+)
+
+// GetCreatorCollaboratorsHandler lists who a creator has worked with, from
+// the credits on every track the service has resolved.
+type GetCreatorCollaboratorsHandler struct {
+	log   *zap.SugaredLogger
+	graph *collab.Graph
+}
+
+func (*GetCreatorCollaboratorsHandler) Pattern() string {
+	return "/creator/collaborators"
+}
+
+// NewGetCreatorCollaboratorsHandler builds a new GetCreatorCollaboratorsHandler.
+func NewGetCreatorCollaboratorsHandler(log *zap.SugaredLogger, graph *collab.Graph) *GetCreatorCollaboratorsHandler {
+	return &GetCreatorCollaboratorsHandler{
+		log:   log,
+		graph: graph,
+	}
+}
+
+type GetCreatorCollaboratorsResponse struct {
+	MBID string `json:"mbid"`
+	Name string `json:"name,omitempty"`
+	// Total is the number of collaborators before limit
+	Total         int                   `json:"total"`
+	Collaborators []collab.Collaborator `json:"collaborators"`
+}
+
+// Get creator collaborators
+// @Summary Get creator collaborators
+// @Description Lists the creators who share recordings with a creator, weighted by shared recordings and labeled with their roles
+// @Tags Creator
+// @Produce json
+// @Param mbid query string true "MusicBrainz artist ID"
+// @Param limit query int false "Max collaborators (1-100, default 25)"
+// @Success 200 {object} GetCreatorCollaboratorsResponse
+// @Failure 400 {object} map[string]string
+// @Router /creator/collaborators [get]
+func (h *GetCreatorCollaboratorsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	q := r.URL.Query()
+	mbid := q.Get("mbid")
+	if mbid == "" {
+		http.Error(w, `{"error":"mbid is required"}`, http.StatusBadRequest)
+		return
+	}
+	limit := defaultCollaboratorsLimit
+	if raw := q.Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > maxCollaboratorsLimit {
+			http.Error(w, `{"error":"limit must be between 1 and 100"}`, http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	all := h.graph.Collaborators(mbid, 0)
+	resp := GetCreatorCollaboratorsResponse{
+		MBID:          mbid,
+		Name:          h.graph.Name(mbid),
+		Total:         len(all),
+		Collaborators: all[:min(limit, len(all))],
+	}
+	json.NewEncoder(w).Encode(resp)
+}
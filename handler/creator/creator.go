@@ -7,8 +7,10 @@ import (
 	"net/http"
 	"sort"
 	"strings"
+	"time"
 
 	mb "github.com/mager/musicbrainz-go/musicbrainz"
+	"github.com/mager/occipital/cache"
 	"github.com/mager/occipital/musicbrainz"
 	"github.com/mager/occipital/occipital"
 	"github.com/mager/occipital/spotify"
@@ -16,11 +18,19 @@ import (
 	"go.uber.org/zap"
 )
 
+const creatorCacheCollection = "creator_cache"
+
+var creatorCachePolicy = cache.Policy{
+	TTL:                  24 * time.Hour,
+	StaleWhileRevalidate: 7 * 24 * time.Hour,
+}
+
 // GetCreatorHandler is an http.Handler
 type GetCreatorHandler struct {
 	log               *zap.SugaredLogger
 	musicbrainzClient *musicbrainz.MusicbrainzClient
 	spotifyClient     *spotify.SpotifyClient
+	cache             *cache.Loader
 }
 
 func (*GetCreatorHandler) Pattern() string {
@@ -32,11 +42,13 @@ func NewGetCreatorHandler(
 	log *zap.SugaredLogger,
 	musicbrainzClient *musicbrainz.MusicbrainzClient,
 	spotifyClient *spotify.SpotifyClient,
+	cache *cache.Loader,
 ) *GetCreatorHandler {
 	return &GetCreatorHandler{
 		log:               log,
 		musicbrainzClient: musicbrainzClient,
 		spotifyClient:     spotifyClient,
+		cache:             cache,
 	}
 }
 
@@ -54,37 +66,57 @@ func (h *GetCreatorHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	h.log.Infow("Fetching MusicBrainz artist", "mbid", mbid)
-
-	artistResp, err := h.musicbrainzClient.Client.GetArtist(mb.GetArtistRequest{
-		ID: mbid,
-		Includes: []mb.Include{
-			"genres",
-			"url-rels",
-			"recording-rels",
-			"artist-credits",
-		},
-	})
+	creator, err := h.Creator(r.Context(), mbid)
 	if err != nil {
 		h.log.Errorf("error fetching artist: %v", err)
 		http.Error(w, `{"error":"failed to fetch artist"}`, http.StatusInternalServerError)
 		return
 	}
 
-	creator := transformArtistToCreator(artistResp.Artist)
-
-	// Fetch Spotify highlights
-	highlights := h.fetchHighlights(creator.Links)
-	if len(highlights) > 0 {
-		creator.Highlights = highlights
-	}
-
 	resp := GetCreatorResponse{Creator: creator}
 	json.NewEncoder(w).Encode(resp)
 }
 
+// Creator returns the creator for a MusicBrainz artist ID, served from the
+// creator cache when possible.
+func (h *GetCreatorHandler) Creator(ctx context.Context, mbid string) (occipital.Creator, error) {
+	key := cache.Key(creatorCacheCollection, mbid)
+	return cache.Fetch(ctx, h.cache, key, creatorCachePolicy, h.getCreator(mbid))
+}
+
+// getCreator returns a loader that builds a creator from MusicBrainz,
+// with highlights from Spotify.
+func (h *GetCreatorHandler) getCreator(mbid string) func(ctx context.Context) (occipital.Creator, error) {
+	return func(ctx context.Context) (occipital.Creator, error) {
+		h.log.Infow("Fetching MusicBrainz artist", "mbid", mbid)
+
+		artistResp, err := h.musicbrainzClient.GetArtist(ctx, mb.GetArtistRequest{
+			ID: mbid,
+			Includes: []mb.Include{
+				"genres",
+				"url-rels",
+				"recording-rels",
+				"artist-credits",
+			},
+		})
+		if err != nil {
+			return occipital.Creator{}, err
+		}
+
+		creator := transformArtistToCreator(artistResp.Artist)
+
+		// Fetch Spotify highlights
+		highlights := h.fetchHighlights(ctx, creator.Links)
+		if len(highlights) > 0 {
+			creator.Highlights = highlights
+		}
+
+		return creator, nil
+	}
+}
+
 // fetchHighlights extracts the Spotify artist ID from links and fetches top tracks.
-func (h *GetCreatorHandler) fetchHighlights(links []occipital.ExternalLink) []occipital.CreatorHighlight {
+func (h *GetCreatorHandler) fetchHighlights(ctx context.Context, links []occipital.ExternalLink) []occipital.CreatorHighlight {
 	spotifyID := extractSpotifyArtistID(links)
 	if spotifyID == "" {
 		return nil
@@ -92,7 +124,6 @@ func (h *GetCreatorHandler) fetchHighlights(links []occipital.ExternalLink) []oc
 
 	h.log.Infow("Fetching Spotify top tracks", "spotifyArtistID", spotifyID)
 
-	ctx := context.Background()
 	topTracks, err := h.spotifyClient.Client.GetArtistsTopTracks(ctx, spotifyLib.ID(spotifyID), "US")
 	if err != nil {
 		h.log.Warnw("Failed to fetch Spotify top tracks", "err", err)
@@ -244,26 +275,11 @@ func extractCredits(artist mb.Artist) []occipital.CreatorCredit {
 
 	for _, rel := range *artist.Relations {
 		if rel.TargetType == "recording" && rel.Recording != nil {
-			creditType := rel.Type
-			// For instrument relations, include the attribute (e.g., "guitar", "bass")
-			if rel.Type == "instrument" && len(rel.Attributes) > 0 {
-				creditType = rel.Attributes[0]
-			}
-
-			// Extract artist name from recording's artist-credit
-			artist := ""
-			if rel.Recording.ArtistCredits != nil {
-				var parts []string
-				for _, ac := range *rel.Recording.ArtistCredits {
-					parts = append(parts, ac.Name+ac.JoinPhrase)
-				}
-				artist = strings.Join(parts, "")
-			}
-
+			creditType := creditTypeOf(rel)
 			creditMap[creditType] = append(creditMap[creditType], occipital.CreatorRecording{
 				ID:     rel.Recording.ID,
 				Title:  rel.Recording.Title,
-				Artist: artist,
+				Artist: artistCredit(rel.Recording.ArtistCredits),
 			})
 		}
 	}
@@ -294,10 +310,11 @@ func extractCredits(artist mb.Artist) []occipital.CreatorCredit {
 				}
 			}
 		}
+		otherTypes := len(credits) - maxCreditTypes
 		credits = credits[:maxCreditTypes]
 		if len(otherRecordings) > 0 {
 			credits = append(credits, occipital.CreatorCredit{
-				Type:       fmt.Sprintf("other (%d types)", len(credits)),
+				Type:       fmt.Sprintf("other (%d types)", otherTypes),
 				Recordings: otherRecordings,
 			})
 		}
@@ -305,3 +322,25 @@ func extractCredits(artist mb.Artist) []occipital.CreatorCredit {
 
 	return credits
 }
+
+// creditTypeOf names the role a recording relation credits. Instrument
+// relations use the instrument, e.g. "guitar" or "bass".
+func creditTypeOf(rel mb.Relation) string {
+	if rel.Type == "instrument" && len(rel.Attributes) > 0 {
+		return rel.Attributes[0]
+	}
+	return rel.Type
+}
+
+// artistCredit joins an artist credit as MusicBrainz displays it,
+// e.g. "Artist feat. Other".
+func artistCredit(credits *[]mb.ArtistCredit) string {
+	if credits == nil {
+		return ""
+	}
+	var parts []string
+	for _, ac := range *credits {
+		parts = append(parts, ac.Name+ac.JoinPhrase)
+	}
+	return strings.Join(parts, "")
+}
@@ -0,0 +1,437 @@
+package creator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	mb "github.com/mager/musicbrainz-go/musicbrainz"
+	"github.com/mager/occipital/cache"
+	"github.com/mager/occipital/musicbrainz"
+	"github.com/mager/occipital/occipital"
+	"go.uber.org/zap"
+)
+
+const (
+	creditIndexCollection = "creator_credit_index"
+	creditPageCollection  = "creator_credit_pages"
+
+	// performerCredit is the role for recordings credited to the artist
+	// themselves. They are browsed, so every recording is listed; other
+	// roles come from the artist's recording relationships and those
+	// browsed recordings' artist relationships.
+	performerCredit     = "performer"
+	defaultCreditsLimit = 50
+	// maxCreditPages caps the relationship browse at 1,000 recordings.
+	maxCreditPages = 10
+	// lookupRelationsCap is where an artist lookup's recording-rels may
+	// have been cut off. MusicBrainz doesn't say when it truncates, so a
+	// list this long is treated as incomplete.
+	lookupRelationsCap = 100
+)
+
+// Pages missing years and cover art because the enrichment search failed
+// are retried sooner than complete ones.
+var creditsCachePolicy = cache.Policy{
+	TTL:                  creatorCachePolicy.TTL,
+	StaleWhileRevalidate: creatorCachePolicy.StaleWhileRevalidate,
+	Degraded: func(v any) bool {
+		p, ok := v.(creditsPage)
+		return ok && p.partial
+	},
+	DegradedTTL: 15 * time.Minute,
+}
+
+// Indexes cut short by a failed browse page are retried sooner.
+var creditIndexCachePolicy = cache.Policy{
+	TTL:                  creatorCachePolicy.TTL,
+	StaleWhileRevalidate: creatorCachePolicy.StaleWhileRevalidate,
+	Degraded: func(v any) bool {
+		x, ok := v.(creditIndex)
+		return ok && x.failed
+	},
+	DegradedTTL: 15 * time.Minute,
+}
+
+// GetCreatorCreditsHandler pages through every recording a creator is
+// credited on, one role at a time.
+type GetCreatorCreditsHandler struct {
+	log               *zap.SugaredLogger
+	musicbrainzClient *musicbrainz.MusicbrainzClient
+	cache             *cache.Loader
+}
+
+func (*GetCreatorCreditsHandler) Pattern() string {
+	return "/creator/credits"
+}
+
+// NewGetCreatorCreditsHandler builds a new GetCreatorCreditsHandler.
+func NewGetCreatorCreditsHandler(
+	log *zap.SugaredLogger,
+	musicbrainzClient *musicbrainz.MusicbrainzClient,
+	cache *cache.Loader,
+) *GetCreatorCreditsHandler {
+	return &GetCreatorCreditsHandler{
+		log:               log,
+		musicbrainzClient: musicbrainzClient,
+		cache:             cache,
+	}
+}
+
+type CreditTypeCount struct {
+	Type  string `json:"type"`
+	Count int    `json:"count"`
+	// Partial marks a role whose count may be short of every credit
+	Partial bool `json:"partial,omitempty"`
+}
+
+type GetCreatorCreditsResponse struct {
+	MBID       string                       `json:"mbid"`
+	Type       string                       `json:"type"`
+	Total      int                          `json:"total"`
+	Recordings []occipital.CreatorRecording `json:"recordings"`
+	// NextCursor fetches the next page; it is empty on the last one
+	NextCursor string `json:"next_cursor,omitempty"`
+	// Types lists every role the creator holds, most recordings first
+	Types []CreditTypeCount `json:"types"`
+	// Partial marks a relationship role that may be missing recordings
+	Partial bool `json:"partial,omitempty"`
+}
+
+// creditIndex is every role a creator holds on recordings.
+type creditIndex struct {
+	// Performer is the number of recordings credited to the creator
+	Performer int `json:"performer"`
+	// Relations maps each relationship role, e.g. producer or guitar, to
+	// its recordings in title order
+	Relations map[string][]occipital.CreatorRecording `json:"relations"`
+	// Partial is set when relationship roles may be missing recordings:
+	// the lookup's recording-rels reached lookupRelationsCap, or the
+	// creator's own recordings weren't all browsed
+	Partial bool `json:"partial"`
+	// failed marks an index whose browse stopped on an error
+	failed bool
+}
+
+type creditsPage struct {
+	Total      int                          `json:"total"`
+	Recordings []occipital.CreatorRecording `json:"recordings"`
+	// partial marks a page whose years and cover art couldn't be looked up
+	partial bool
+}
+
+// Get creator credits
+// @Summary Get creator credits
+// @Description Lists the recordings a creator is credited on for one role, a page at a time
+// @Tags Creator
+// @Produce json
+// @Param mbid query string true "MusicBrainz artist ID"
+// @Param type query string false "Role, e.g. performer (default), producer or guitar"
+// @Param cursor query string false "next_cursor from the previous page"
+// @Param limit query int false "Page size (1-100, default 50)"
+// @Success 200 {object} GetCreatorCreditsResponse
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /creator/credits [get]
+func (h *GetCreatorCreditsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	q := r.URL.Query()
+	mbid := q.Get("mbid")
+	if mbid == "" {
+		http.Error(w, `{"error":"mbid is required"}`, http.StatusBadRequest)
+		return
+	}
+	creditType := q.Get("type")
+	if creditType == "" {
+		creditType = performerCredit
+	}
+	offset, err := parseCursor(q.Get("cursor"))
+	if err != nil {
+		http.Error(w, `{"error":"invalid cursor"}`, http.StatusBadRequest)
+		return
+	}
+	limit := defaultCreditsLimit
+	if raw := q.Get("limit"); raw != "" {
+		limit, err = strconv.Atoi(raw)
+		if err != nil || limit < 1 || limit > musicbrainz.MaxBrowseLimit {
+			http.Error(w, fmt.Sprintf(`{"error":"limit must be between 1 and %d"}`, musicbrainz.MaxBrowseLimit), http.StatusBadRequest)
+			return
+		}
+	}
+
+	ctx := r.Context()
+	index, err := cache.Fetch(ctx, h.cache, cache.Key(creditIndexCollection, mbid), creditIndexCachePolicy, h.loadIndex(mbid))
+	if err != nil {
+		writeArtistError(w, h.log, mbid, err)
+		return
+	}
+	if creditType != performerCredit && len(index.Relations[creditType]) == 0 {
+		http.Error(w, `{"error":"no credits of that type"}`, http.StatusNotFound)
+		return
+	}
+
+	key := cache.Key(creditPageCollection, mbid, creditType, strconv.Itoa(offset), strconv.Itoa(limit))
+	page, err := cache.Fetch(ctx, h.cache, key, creditsCachePolicy, func(ctx context.Context) (creditsPage, error) {
+		if creditType == performerCredit {
+			return h.loadPerformerPage(ctx, mbid, offset, limit)
+		}
+		return h.loadRelationPage(ctx, index.Relations[creditType], offset, limit), nil
+	})
+	if err != nil {
+		writeArtistError(w, h.log, mbid, err)
+		return
+	}
+
+	resp := GetCreatorCreditsResponse{
+		MBID:       mbid,
+		Type:       creditType,
+		Total:      page.Total,
+		Recordings: page.Recordings,
+		Types:      index.types(),
+		Partial:    creditType != performerCredit && index.Partial,
+	}
+	if next := offset + len(page.Recordings); len(page.Recordings) > 0 && next < page.Total {
+		resp.NextCursor = strconv.Itoa(next)
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+func parseCursor(raw string) (int, error) {
+	if raw == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < 0 {
+		return 0, errors.New("invalid cursor")
+	}
+	return n, nil
+}
+
+// writeArtistError maps a MusicBrainz error to a response.
+func writeArtistError(w http.ResponseWriter, log *zap.SugaredLogger, mbid string, err error) {
+	if errors.Is(err, musicbrainz.ErrNotFound) {
+		http.Error(w, `{"error":"artist not found"}`, http.StatusNotFound)
+		return
+	}
+	log.Errorw("Failed to fetch artist", "mbid", mbid, "error", err)
+	http.Error(w, `{"error":"failed to fetch artist"}`, http.StatusInternalServerError)
+}
+
+// loadIndex groups the creator's recording relationships by role, with no
+// cap on roles, and counts the recordings credited to them. The creator's
+// own recordings are browsed with their artist relationships, so those
+// roles are paged in full. Credits on other artists' recordings can only
+// come from the artist lookup's truncated recording-rels; when that list
+// may have been cut off, or the browse is cut short, the relationship roles
+// are marked partial.
+func (h *GetCreatorCreditsHandler) loadIndex(mbid string) func(ctx context.Context) (creditIndex, error) {
+	return func(ctx context.Context) (creditIndex, error) {
+		artistResp, err := h.musicbrainzClient.GetArtist(ctx, mb.GetArtistRequest{
+			ID:       mbid,
+			Includes: []mb.Include{"recording-rels", "artist-credits"},
+		})
+		if err != nil {
+			return creditIndex{}, err
+		}
+
+		index := creditIndex{Relations: make(map[string][]occipital.CreatorRecording)}
+		seen := make(map[string]bool)
+		add := func(creditType string, rec occipital.CreatorRecording) {
+			if seen[creditType+"/"+rec.ID] {
+				return
+			}
+			seen[creditType+"/"+rec.ID] = true
+			index.Relations[creditType] = append(index.Relations[creditType], rec)
+		}
+
+		lookedUp := 0
+		if artistResp.Relations != nil {
+			for _, rel := range *artistResp.Relations {
+				if rel.TargetType != "recording" || rel.Recording == nil {
+					continue
+				}
+				lookedUp++
+				add(creditTypeOf(rel), occipital.CreatorRecording{
+					ID:     rel.Recording.ID,
+					Title:  rel.Recording.Title,
+					Artist: artistCredit(rel.Recording.ArtistCredits),
+				})
+			}
+		}
+
+		browsed := 0
+		for page := 0; page < maxCreditPages; page++ {
+			browse, err := h.musicbrainzClient.BrowseRecordingRelationsByArtist(ctx, mbid, browsed, musicbrainz.MaxBrowseLimit)
+			if err != nil {
+				if page == 0 {
+					return creditIndex{}, err
+				}
+				h.log.Warnw("Failed to browse credit relationships", "mbid", mbid, "offset", browsed, "error", err)
+				index.failed = true
+				break
+			}
+			index.Performer = browse.Count
+			for _, rec := range browse.Recordings {
+				for _, creditType := range rolesOf(rec, mbid) {
+					add(creditType, occipital.CreatorRecording{
+						ID:     rec.ID,
+						Title:  rec.Title,
+						Artist: artistCredit(rec.ArtistCredits),
+						Year:   yearOf(rec.FirstReleaseDate),
+					})
+				}
+			}
+			browsed += len(browse.Recordings)
+			if len(browse.Recordings) == 0 || browsed >= browse.Count {
+				break
+			}
+		}
+		index.Partial = lookedUp >= lookupRelationsCap || browsed < index.Performer
+
+		for _, recs := range index.Relations {
+			sort.SliceStable(recs, func(i, j int) bool {
+				return recs[i].Title < recs[j].Title
+			})
+		}
+		return index, nil
+	}
+}
+
+// rolesOf lists the roles an artist holds on a recording through its
+// artist relationships.
+func rolesOf(rec mb.Recording, mbid string) []string {
+	if rec.Relations == nil {
+		return nil
+	}
+	var roles []string
+	for _, rel := range *rec.Relations {
+		if rel.TargetType != "artist" || rel.Artist == nil || rel.Artist.ID != mbid {
+			continue
+		}
+		roles = append(roles, creditTypeOf(rel))
+	}
+	return roles
+}
+
+func (x creditIndex) types() []CreditTypeCount {
+	var types []CreditTypeCount
+	if x.Performer > 0 {
+		types = append(types, CreditTypeCount{Type: performerCredit, Count: x.Performer})
+	}
+	for t, recs := range x.Relations {
+		types = append(types, CreditTypeCount{Type: t, Count: len(recs), Partial: x.Partial})
+	}
+	sort.Slice(types, func(i, j int) bool {
+		if types[i].Count != types[j].Count {
+			return types[i].Count > types[j].Count
+		}
+		return types[i].Type < types[j].Type
+	})
+	return types
+}
+
+func (h *GetCreatorCreditsHandler) loadPerformerPage(ctx context.Context, mbid string, offset, limit int) (creditsPage, error) {
+	browse, err := h.musicbrainzClient.BrowseRecordingsByArtist(ctx, mbid, offset, limit)
+	if err != nil {
+		return creditsPage{}, err
+	}
+	page := creditsPage{
+		Total:      browse.Count,
+		Recordings: make([]occipital.CreatorRecording, 0, len(browse.Recordings)),
+	}
+	for _, rec := range browse.Recordings {
+		page.Recordings = append(page.Recordings, occipital.CreatorRecording{
+			ID:     rec.ID,
+			Title:  rec.Title,
+			Artist: artistCredit(rec.ArtistCredits),
+			Year:   yearOf(rec.FirstReleaseDate),
+		})
+	}
+	page.partial = !h.addReleaseDetails(ctx, page.Recordings)
+	return page, nil
+}
+
+func (h *GetCreatorCreditsHandler) loadRelationPage(ctx context.Context, all []occipital.CreatorRecording, offset, limit int) creditsPage {
+	page := creditsPage{Total: len(all), Recordings: []occipital.CreatorRecording{}}
+	if offset >= len(all) {
+		return page
+	}
+	// Copy, since the index may be shared with other requests
+	page.Recordings = append(page.Recordings, all[offset:min(offset+limit, len(all))]...)
+	page.partial = !h.addReleaseDetails(ctx, page.Recordings)
+	return page
+}
+
+// addReleaseDetails fills in each recording's year and cover art from its
+// earliest release with one MusicBrainz search. It reports false if the
+// search failed.
+func (h *GetCreatorCreditsHandler) addReleaseDetails(ctx context.Context, recs []occipital.CreatorRecording) bool {
+	if len(recs) == 0 {
+		return true
+	}
+	ids := make([]string, len(recs))
+	for i, r := range recs {
+		ids[i] = r.ID
+	}
+	found, err := h.musicbrainzClient.SearchRecordingsByIDs(ctx, ids)
+	if err != nil {
+		h.log.Warnw("Failed to look up credit releases", "recordings", len(ids), "error", err)
+		return false
+	}
+	for i := range recs {
+		rec, ok := found[recs[i].ID]
+		if !ok {
+			continue
+		}
+		if recs[i].Year == 0 {
+			recs[i].Year = yearOf(rec.FirstReleaseDate)
+		}
+		if rel := earliestRelease(rec.Releases); rel != nil {
+			if recs[i].Year == 0 {
+				recs[i].Year = yearOf(rel.Date)
+			}
+			recs[i].Image = fmt.Sprintf("https://coverartarchive.org/release/%s/front-250.jpg", rel.ID)
+		}
+	}
+	return true
+}
+
+// earliestRelease picks the first dated release, preferring official ones.
+func earliestRelease(releases *[]mb.Release) *mb.Release {
+	if releases == nil || len(*releases) == 0 {
+		return nil
+	}
+	better := func(a, b mb.Release) bool {
+		if (a.Status == "Official") != (b.Status == "Official") {
+			return a.Status == "Official"
+		}
+		if (a.Date == "") != (b.Date == "") {
+			return a.Date != ""
+		}
+		return a.Date < b.Date
+	}
+	best := &(*releases)[0]
+	for i := range *releases {
+		if better((*releases)[i], *best) {
+			best = &(*releases)[i]
+		}
+	}
+	return best
+}
+
+// yearOf reads the year from a YYYY[-MM[-DD]] date, or 0.
+func yearOf(date string) int {
+	if len(date) < 4 {
+		return 0
+	}
+	y, err := strconv.Atoi(date[:4])
+	if err != nil {
+		return 0
+	}
+	return y
+}
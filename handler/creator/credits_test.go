@@ -0,0 +1,116 @@
+package creator
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	mb "github.com/mager/musicbrainz-go/musicbrainz"
+	"github.com/mager/occipital/cache"
+	"github.com/mager/occipital/musicbrainz"
+	"github.com/mager/occipital/occipital"
+	"go.uber.org/zap"
+)
+
+func TestRolesOf(t *testing.T) {
+	const mbid = "artist-1"
+	rec := mb.Recording{ID: "rec-1", Relations: &[]mb.Relation{
+		{Type: "producer", TargetType: "artist", Artist: &mb.RelationArtist{ID: mbid}},
+		{Type: "instrument", Attributes: []string{"guitar"}, TargetType: "artist", Artist: &mb.RelationArtist{ID: mbid}},
+		// Someone else's role, and a relationship to another entity type
+		{Type: "mix", TargetType: "artist", Artist: &mb.RelationArtist{ID: "artist-2"}},
+		{Type: "performance", TargetType: "work"},
+	}}
+	if got, want := rolesOf(rec, mbid), []string{"producer", "guitar"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("rolesOf() = %q, want %q", got, want)
+	}
+	if got := rolesOf(mb.Recording{ID: "rec-2"}, mbid); got != nil {
+		t.Errorf("rolesOf() without relations = %q, want none", got)
+	}
+}
+
+func TestCreditIndexTypes(t *testing.T) {
+	x := creditIndex{
+		Performer: 3,
+		Relations: map[string][]occipital.CreatorRecording{
+			"producer": {{ID: "a"}, {ID: "b"}},
+			"guitar":   {{ID: "c"}, {ID: "d"}},
+		},
+		Partial: true,
+	}
+	want := []CreditTypeCount{
+		{Type: performerCredit, Count: 3},
+		{Type: "guitar", Count: 2, Partial: true},
+		{Type: "producer", Count: 2, Partial: true},
+	}
+	if got := x.types(); !reflect.DeepEqual(got, want) {
+		t.Errorf("types() = %+v, want %+v", got, want)
+	}
+}
+
+// fakeProducer serves a creator with no recordings of their own and n
+// producer credits from the artist lookup.
+func fakeProducer(t *testing.T, n int) *GetCreatorCreditsHandler {
+	t.Helper()
+	rels := make([]string, n)
+	for i := range rels {
+		rels[i] = fmt.Sprintf(`{"type":"producer","target-type":"recording","recording":{"id":"rec-%d","title":"Song %03d"}}`, i, i)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/artist/"):
+			fmt.Fprintf(w, `{"id":"producer-1","name":"Producer","relations":[%s]}`, strings.Join(rels, ","))
+		case r.URL.Path == "/recording" && r.URL.Query().Has("artist"):
+			fmt.Fprint(w, `{"recording-count":0,"recording-offset":0,"recordings":[]}`)
+		case r.URL.Path == "/recording":
+			fmt.Fprint(w, `{"count":0,"recordings":[]}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	cfg := musicbrainz.SchedulerConfig{Rate: 100, Burst: 10}
+	c := musicbrainz.NewClient(srv.URL, srv.URL, srv.Client(), cfg, cfg)
+	t.Cleanup(c.Stop)
+	log := zap.NewNop().Sugar()
+	return NewGetCreatorCreditsHandler(log, c, cache.NewLoader(cache.NewMemory(10), log))
+}
+
+func TestCreditsWithoutPerformerCredits(t *testing.T) {
+	tests := []struct {
+		name    string
+		credits int
+		partial bool
+	}{
+		{"short lookup", 3, false},
+		// The lookup may have been cut off, and there's nothing to page
+		{"lookup at the cap", lookupRelationsCap, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := fakeProducer(t, tt.credits)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/creator/credits?mbid=producer-1&type=producer", nil))
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d: %s", w.Code, w.Body)
+			}
+
+			var resp GetCreatorCreditsResponse
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.Total != tt.credits || resp.Partial != tt.partial {
+				t.Errorf("total = %d, partial = %v; want %d, %v", resp.Total, resp.Partial, tt.credits, tt.partial)
+			}
+			want := []CreditTypeCount{{Type: "producer", Count: tt.credits, Partial: tt.partial}}
+			if !reflect.DeepEqual(resp.Types, want) {
+				t.Errorf("types = %+v, want %+v", resp.Types, want)
+			}
+		})
+	}
+}
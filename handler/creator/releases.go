@@ -0,0 +1,195 @@
+package creator
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mager/occipital/cache"
+	"github.com/mager/occipital/musicbrainz"
+	"github.com/mager/occipital/occipital"
+	"go.uber.org/zap"
+)
+
+const (
+	creatorReleasesCollection = "creator_releases"
+	// maxDiscographyPages caps a discography at 1,000 release groups.
+	maxDiscographyPages = 10
+)
+
+// Discographies cut short by a failed page are retried sooner.
+var creatorReleasesCachePolicy = cache.Policy{
+	TTL:                  creatorCachePolicy.TTL,
+	StaleWhileRevalidate: creatorCachePolicy.StaleWhileRevalidate,
+	Degraded: func(v any) bool {
+		d, ok := v.(GetCreatorReleasesResponse)
+		return ok && d.partial
+	},
+	DegradedTTL: 15 * time.Minute,
+}
+
+// primaryTypeOrder is the order sections appear in; unknown types go last.
+var primaryTypeOrder = map[string]int{
+	"Album":     0,
+	"EP":        1,
+	"Single":    2,
+	"Broadcast": 3,
+	"Other":     4,
+}
+
+// GetCreatorReleasesHandler serves a creator's discography.
+type GetCreatorReleasesHandler struct {
+	log               *zap.SugaredLogger
+	musicbrainzClient *musicbrainz.MusicbrainzClient
+	cache             *cache.Loader
+}
+
+func (*GetCreatorReleasesHandler) Pattern() string {
+	return "/creator/releases"
+}
+
+// NewGetCreatorReleasesHandler builds a new GetCreatorReleasesHandler.
+func NewGetCreatorReleasesHandler(
+	log *zap.SugaredLogger,
+	musicbrainzClient *musicbrainz.MusicbrainzClient,
+	cache *cache.Loader,
+) *GetCreatorReleasesHandler {
+	return &GetCreatorReleasesHandler{
+		log:               log,
+		musicbrainzClient: musicbrainzClient,
+		cache:             cache,
+	}
+}
+
+// ReleaseGroupSection is the part of a discography of one type.
+type ReleaseGroupSection struct {
+	Type          string                          `json:"type"`
+	ReleaseGroups []occipital.CreatorReleaseGroup `json:"release_groups"`
+}
+
+type GetCreatorReleasesResponse struct {
+	MBID   string                `json:"mbid"`
+	Total  int                   `json:"total"`
+	Groups []ReleaseGroupSection `json:"groups"`
+	// partial marks a discography missing pages that failed to load
+	partial bool
+}
+
+// Get creator releases
+// @Summary Get creator discography
+// @Description Lists a creator's release groups, grouped by type (Album, Album + Live, Single, ...) and oldest first
+// @Tags Creator
+// @Produce json
+// @Param mbid query string true "MusicBrainz artist ID"
+// @Success 200 {object} GetCreatorReleasesResponse
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /creator/releases [get]
+func (h *GetCreatorReleasesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	mbid := r.URL.Query().Get("mbid")
+	if mbid == "" {
+		http.Error(w, `{"error":"mbid is required"}`, http.StatusBadRequest)
+		return
+	}
+
+	key := cache.Key(creatorReleasesCollection, mbid)
+	resp, err := cache.Fetch(r.Context(), h.cache, key, creatorReleasesCachePolicy, h.loadReleases(mbid))
+	if err != nil {
+		writeArtistError(w, h.log, mbid, err)
+		return
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+// loadReleases browses every release group of the creator and sections
+// them by type.
+func (h *GetCreatorReleasesHandler) loadReleases(mbid string) func(ctx context.Context) (GetCreatorReleasesResponse, error) {
+	return func(ctx context.Context) (GetCreatorReleasesResponse, error) {
+		resp := GetCreatorReleasesResponse{MBID: mbid}
+
+		var groups []musicbrainz.ReleaseGroup
+		for page := 0; page < maxDiscographyPages; page++ {
+			browse, err := h.musicbrainzClient.BrowseReleaseGroupsByArtist(ctx, mbid, len(groups), musicbrainz.MaxBrowseLimit)
+			if err != nil {
+				if page == 0 {
+					return resp, err
+				}
+				h.log.Warnw("Failed to browse release groups", "mbid", mbid, "offset", len(groups), "error", err)
+				resp.partial = true
+				break
+			}
+			groups = append(groups, browse.ReleaseGroups...)
+			if len(browse.ReleaseGroups) == 0 || len(groups) >= browse.Count {
+				break
+			}
+		}
+
+		sections := make(map[string][]occipital.CreatorReleaseGroup)
+		for _, rg := range groups {
+			t := releaseGroupType(rg)
+			sections[t] = append(sections[t], occipital.CreatorReleaseGroup{
+				ID:               rg.ID,
+				Title:            rg.Title,
+				Type:             t,
+				FirstReleaseDate: rg.FirstReleaseDate,
+				Year:             yearOf(rg.FirstReleaseDate),
+				Image:            fmt.Sprintf("https://coverartarchive.org/release-group/%s/front-250.jpg", rg.ID),
+			})
+		}
+		for t, rgs := range sections {
+			sort.SliceStable(rgs, func(i, j int) bool {
+				a, b := rgs[i].FirstReleaseDate, rgs[j].FirstReleaseDate
+				if (a == "") != (b == "") {
+					return a != ""
+				}
+				if a != b {
+					return a < b
+				}
+				return rgs[i].Title < rgs[j].Title
+			})
+			resp.Groups = append(resp.Groups, ReleaseGroupSection{Type: t, ReleaseGroups: rgs})
+		}
+		sort.Slice(resp.Groups, func(i, j int) bool {
+			return sectionLess(resp.Groups[i].Type, resp.Groups[j].Type)
+		})
+		resp.Total = len(groups)
+		return resp, nil
+	}
+}
+
+// releaseGroupType labels a release group the way MusicBrainz's own
+// discography does, e.g. "Album" or "Album + Live".
+func releaseGroupType(rg musicbrainz.ReleaseGroup) string {
+	primary := rg.PrimaryType
+	if primary == "" {
+		primary = "Other"
+	}
+	return strings.Join(append([]string{primary}, rg.SecondaryTypes...), " + ")
+}
+
+// sectionLess orders sections by primary type, then plain before
+// secondary types, then by name.
+func sectionLess(a, b string) bool {
+	pa, secA, _ := strings.Cut(a, " + ")
+	pb, secB, _ := strings.Cut(b, " + ")
+	ra, ok := primaryTypeOrder[pa]
+	if !ok {
+		ra = len(primaryTypeOrder)
+	}
+	rb, ok := primaryTypeOrder[pb]
+	if !ok {
+		rb = len(primaryTypeOrder)
+	}
+	if ra != rb {
+		return ra < rb
+	}
+	if (secA == "") != (secB == "") {
+		return secA == ""
+	}
+	return a < b
+}
@@ -0,0 +1,166 @@
+package discover
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	fsClient "github.com/mager/occipital/firestore"
+	"github.com/mager/occipital/occipital"
+	"go.uber.org/zap"
+)
+
+// scoredTrack is a charted track with the terms of its score.
+type scoredTrack struct {
+	track       occipital.Track
+	key         string
+	source      string
+	rank        int
+	weight      float64
+	maxRank     float64
+	sourceCount int
+	rankScore   float64
+	bonus       float64
+	score       float64
+	personal    *PersonalScore
+}
+
+// chart is a profile's tracks, read from its sources and scored. Requests
+// re-rank it for a user before calling rank; snapshots rank it as is.
+type chart struct {
+	results []scoredTrack
+	// sources maps a track key to its appearances, in profile order
+	sources    map[string][]SourceAppearance
+	dropped    []DroppedTrack
+	latestDate string
+}
+
+// collectChart reads profile's sources as of now and scores every track,
+// de-duplicating across sources and applying the per-artist and per-thumb
+// caps. Dropped tracks are only kept when explain is set.
+func collectChart(ctx context.Context, log *zap.SugaredLogger, fs *firestore.Client, now time.Time, profile DiscoverProfile, explain bool) *chart {
+	c := &chart{sources: make(map[string][]SourceAppearance)}
+
+	// Collect tracks from all sources, keyed by normalized artist+title
+	trackMap := make(map[string]*scoredTrack)
+	artistCount := make(map[string]int) // cap tracks per artist
+	thumbCount := make(map[string]int)  // cap tracks per album art
+	identities := newIdentityResolver(profile.MatchThreshold)
+
+	drop := func(fsTrack fsClient.Track, source, reason string) {
+		if explain {
+			c.dropped = append(c.dropped, DroppedTrack{
+				Artist: fsTrack.Artist,
+				Name:   fsTrack.Title,
+				Source: source,
+				Rank:   fsTrack.Rank,
+				Reason: reason,
+			})
+		}
+	}
+
+	for _, src := range profile.Sources {
+		tracks, dateUsed, err := fetchTracksWithFallback(ctx, log, fs, now, src.Collection)
+		if err != nil {
+			log.Warnw("Failed to fetch source, skipping",
+				"source", src.Collection, "err", err)
+			continue
+		}
+
+		log.Infow("Fetched tracks from source",
+			"source", src.Collection,
+			"trackCount", len(tracks),
+			"date", dateUsed,
+		)
+
+		if dateUsed > c.latestDate {
+			c.latestDate = dateUsed
+		}
+
+		for _, fsTrack := range tracks {
+			// Skip tracks without album art — they'd show as broken images
+			if fsTrack.Thumb == "" {
+				continue
+			}
+			oTrack := convertToOccipitalTrack(fsTrack, src.Collection)
+			oTrack.Source = src.Collection
+			key := identities.Resolve(fsTrack)
+			artistKey := normalizeArtist(fsTrack.Artist)
+
+			if existing, ok := trackMap[key]; ok {
+				// Track already seen from another source — keep the one with higher source weight
+				if src.Weight > existing.weight {
+					trackMap[key] = &scoredTrack{
+						track:   oTrack,
+						key:     key,
+						source:  src.Collection,
+						rank:    fsTrack.Rank,
+						weight:  src.Weight,
+						maxRank: src.MaxRank,
+					}
+				}
+			} else {
+				// Skip if this artist already has enough tracks
+				if artistCount[artistKey] >= profile.MaxTracksPerArtist {
+					drop(fsTrack, src.Collection, dropArtistCap)
+					continue
+				}
+				// Skip if this album art already appeared (prevents same-album flooding)
+				if thumbCount[fsTrack.Thumb] >= profile.MaxTracksPerThumb {
+					drop(fsTrack, src.Collection, dropThumbCap)
+					continue
+				}
+				artistCount[artistKey]++
+				thumbCount[fsTrack.Thumb]++
+				trackMap[key] = &scoredTrack{
+					track:   oTrack,
+					key:     key,
+					source:  src.Collection,
+					rank:    fsTrack.Rank,
+					weight:  src.Weight,
+					maxRank: src.MaxRank,
+				}
+			}
+
+			// Track source appearances for cross-source bonus; a source
+			// listing the same track twice only counts once
+			if apps := c.sources[key]; len(apps) == 0 || apps[len(apps)-1].Source != src.Collection {
+				c.sources[key] = append(apps, SourceAppearance{Source: src.Collection, Rank: fsTrack.Rank})
+			}
+		}
+	}
+
+	// Score all tracks
+	for key, st := range trackMap {
+		st.sourceCount = len(c.sources[key])
+		st.rankScore, st.bonus = computeScore(st.rank, st.weight, st.maxRank, st.sourceCount, profile.CrossSourceBonus)
+		st.score = st.rankScore + st.bonus
+		c.results = append(c.results, *st)
+	}
+	return c
+}
+
+// rank sorts the chart by score and cuts it to limit tracks.
+func (c *chart) rank(limit int, explain bool) {
+	// Sort by score descending
+	sort.Slice(c.results, func(i, j int) bool {
+		return c.results[i].score > c.results[j].score
+	})
+
+	if len(c.results) > limit {
+		if explain {
+			for _, st := range c.results[limit:] {
+				c.dropped = append(c.dropped, DroppedTrack{
+					Artist: st.track.Artist,
+					Name:   st.track.Name,
+					Source: st.source,
+					Rank:   st.rank,
+					Reason: dropLimit,
+					Score:  st.score,
+				})
+			}
+		}
+		c.results = c.results[:limit]
+	}
+}
@@ -0,0 +1,242 @@
+package discover
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/mager/occipital/config"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	configCollection = "occipital_config"
+	configDoc        = "discover_v2"
+
+	defaultProfile = "default"
+
+	// maxDiscoverLimit bounds ?limit= and profile limits alike
+	maxDiscoverLimit = 500
+
+	configFilePollInterval = 30 * time.Second
+	configRetryInterval    = time.Minute
+)
+
+// DiscoverConfig is the versioned discover v2 configuration. It lives in
+// Firestore at occipital_config/discover_v2, or in a JSON file when
+// OCCIPITAL_DISCOVERCONFIGPATH is set, and is reloaded when it changes.
+type DiscoverConfig struct {
+	Version  string                     `json:"version" firestore:"version"`
+	Profiles map[string]DiscoverProfile `json:"profiles" firestore:"profiles"`
+}
+
+// DiscoverProfile is one complete set of ranking parameters. "default"
+// serves requests that don't ask for a profile.
+type DiscoverProfile struct {
+	Sources            []SourceConfig     `json:"sources" firestore:"sources"`
+	MaxTracksPerArtist int                `json:"max_tracks_per_artist" firestore:"max_tracks_per_artist"`
+	MaxTracksPerThumb  int                `json:"max_tracks_per_thumb" firestore:"max_tracks_per_thumb"`
+	Limit              int                `json:"limit" firestore:"limit"`
+	CrossSourceBonus   []CrossSourceBonus `json:"cross_source_bonus" firestore:"cross_source_bonus"`
+	// MatchThreshold is the 0-1 similarity above which differently spelled
+	// tracks from two sources are treated as one; 0 means the default
+	MatchThreshold float64 `json:"match_threshold" firestore:"match_threshold"`
+	// Personalization tunes ?user_id= ranking; nil uses the defaults
+	Personalization *PersonalizationWeights `json:"personalization,omitempty" firestore:"personalization,omitempty"`
+}
+
+// SourceConfig defines a source and its scoring weight.
+// Higher weight = better signal for fresh music discovery.
+type SourceConfig struct {
+	Collection string  `json:"collection" firestore:"collection"`
+	Weight     float64 `json:"weight" firestore:"weight"`
+	MaxRank    float64 `json:"max_rank" firestore:"max_rank"`
+}
+
+// CrossSourceBonus is added to a track's score when it appears in at least
+// MinSources sources. The highest matching tier wins.
+type CrossSourceBonus struct {
+	MinSources int     `json:"min_sources" firestore:"min_sources"`
+	Bonus      float64 `json:"bonus" firestore:"bonus"`
+}
+
+// builtinConfig is used until a stored config loads, and whenever none exists.
+var builtinConfig = &DiscoverConfig{
+	Version: "builtin",
+	Profiles: map[string]DiscoverProfile{
+		defaultProfile: {
+			Sources: []SourceConfig{
+				{Collection: "spotify_new_releases", Weight: 1.0, MaxRank: 100},
+				{Collection: "reddit_fresh", Weight: 0.9, MaxRank: 50},
+				{Collection: "hnhh", Weight: 0.7, MaxRank: 100},
+				{Collection: "pitchfork_bnm", Weight: 0.6, MaxRank: 20},
+				{Collection: "billboard", Weight: 0.5, MaxRank: 100},
+			},
+			MaxTracksPerArtist: 2,
+			MaxTracksPerThumb:  1, // prevent same album cover flooding the wall
+			Limit:              150,
+			CrossSourceBonus: []CrossSourceBonus{
+				{MinSources: 3, Bonus: 1.0},
+				{MinSources: 2, Bonus: 0.5},
+			},
+			MatchThreshold: defaultMatchThreshold,
+		},
+	},
+}
+
+// validate rejects configs that would break ranking, so a bad edit leaves
+// the previous config serving.
+func (c *DiscoverConfig) validate() error {
+	if c.Version == "" {
+		return errors.New("version is required")
+	}
+	if _, ok := c.Profiles[defaultProfile]; !ok {
+		return fmt.Errorf("profile %q is required", defaultProfile)
+	}
+	for name, p := range c.Profiles {
+		if len(p.Sources) == 0 {
+			return fmt.Errorf("profile %q has no sources", name)
+		}
+		for _, src := range p.Sources {
+			if src.Collection == "" || src.Weight < 0 || src.MaxRank <= 0 {
+				return fmt.Errorf("profile %q has invalid source %+v", name, src)
+			}
+		}
+		if p.MaxTracksPerArtist < 1 || p.MaxTracksPerThumb < 1 {
+			return fmt.Errorf("profile %q needs positive per-artist and per-thumb caps", name)
+		}
+		if p.MatchThreshold < 0 || p.MatchThreshold > 1 {
+			return fmt.Errorf("profile %q match threshold must be between 0 and 1", name)
+		}
+		if p.Limit < 1 || p.Limit > maxDiscoverLimit {
+			return fmt.Errorf("profile %q limit must be between 1 and %d", name, maxDiscoverLimit)
+		}
+	}
+	return nil
+}
+
+// ConfigStore holds the live discover config.
+type ConfigStore struct {
+	log     *zap.SugaredLogger
+	current atomic.Pointer[DiscoverConfig]
+}
+
+// Current returns the config in effect; it is never nil.
+func (s *ConfigStore) Current() *DiscoverConfig {
+	return s.current.Load()
+}
+
+func (s *ConfigStore) apply(c *DiscoverConfig, source string) {
+	if err := c.validate(); err != nil {
+		s.log.Errorw("Rejected discover config", "error", err, "source", source, "version", c.Version)
+		return
+	}
+	if prev := s.current.Swap(c); prev.Version != c.Version {
+		s.log.Infow("Loaded discover config", "source", source, "version", c.Version, "previous", prev.Version)
+	}
+}
+
+// ProvideConfigStore starts watching the discover config and stops on shutdown.
+func ProvideConfigStore(lc fx.Lifecycle, cfg config.Config, log *zap.SugaredLogger, fs *firestore.Client) *ConfigStore {
+	s := &ConfigStore{log: log}
+	s.current.Store(builtinConfig)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	lc.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			switch {
+			case cfg.DiscoverConfigPath != "":
+				go s.watchFile(ctx, cfg.DiscoverConfigPath)
+			case fs != nil:
+				go s.watchFirestore(ctx, fs.Collection(configCollection).Doc(configDoc))
+			default:
+				log.Warnw("No discover config source; using builtin config")
+			}
+			return nil
+		},
+		OnStop: func(context.Context) error {
+			cancel()
+			return nil
+		},
+	})
+	return s
+}
+
+// watchFirestore follows the config doc, resubscribing after errors.
+func (s *ConfigStore) watchFirestore(ctx context.Context, ref *firestore.DocumentRef) {
+	for ctx.Err() == nil {
+		iter := ref.Snapshots(ctx)
+		for {
+			snap, err := iter.Next()
+			if err != nil {
+				if ctx.Err() == nil && status.Code(err) != codes.Canceled {
+					s.log.Warnw("Discover config watch failed", "error", err)
+				}
+				break
+			}
+			if !snap.Exists() {
+				s.log.Infow("No stored discover config; using builtin config")
+				s.current.Store(builtinConfig)
+				continue
+			}
+			var c DiscoverConfig
+			if err := snap.DataTo(&c); err != nil {
+				s.log.Errorw("Failed to decode discover config", "error", err)
+				continue
+			}
+			s.apply(&c, "firestore")
+		}
+		iter.Stop()
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(configRetryInterval):
+		}
+	}
+}
+
+// watchFile reloads the JSON config whenever its modification time changes.
+func (s *ConfigStore) watchFile(ctx context.Context, path string) {
+	var modTime time.Time
+	ticker := time.NewTicker(configFilePollInterval)
+	defer ticker.Stop()
+
+	for {
+		if fi, err := os.Stat(path); err != nil {
+			s.log.Warnw("Failed to stat discover config", "error", err, "path", path)
+		} else if !fi.ModTime().Equal(modTime) {
+			modTime = fi.ModTime()
+			if c, err := readConfigFile(path); err != nil {
+				s.log.Errorw("Failed to read discover config", "error", err, "path", path)
+			} else {
+				s.apply(c, path)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func readConfigFile(path string) (*DiscoverConfig, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var c DiscoverConfig
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
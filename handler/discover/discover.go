@@ -12,6 +12,12 @@ const maxDaysToLookBack = 5
 type DiscoverResponse struct {
 	Tracks  []occipital.Track `json:"tracks"`
 	Updated string            `json:"updated"`
+	// ConfigVersion and Profile identify the ranking config that produced Tracks
+	ConfigVersion string `json:"config_version,omitempty"`
+	Profile       string `json:"profile,omitempty"`
+	Personalized  bool   `json:"personalized,omitempty"`
+	// Explain is only set for ?explain=true
+	Explain *DiscoverExplanation `json:"explain,omitempty"`
 }
 
 func convertToOccipitalTrack(fsTrack fsClient.Track, thumbType string) occipital.Track {
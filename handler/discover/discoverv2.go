@@ -3,159 +3,153 @@ package discover
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"math"
 	"net/http"
-	"sort"
+	"net/url"
+	"strconv"
 	"strings"
 	"time"
 
 	"cloud.google.com/go/firestore"
+	"github.com/mager/occipital/auth"
 	fsClient "github.com/mager/occipital/firestore"
 	"github.com/mager/occipital/occipital"
+	"github.com/mager/occipital/spotify"
 	"go.uber.org/zap"
 )
 
 type DiscoverV2Handler struct {
-	log *zap.SugaredLogger
-	fs  *firestore.Client
+	log          *zap.SugaredLogger
+	fs           *firestore.Client
+	config       *ConfigStore
+	personalizer Personalizer
 }
 
-func NewDiscoverV2Handler(log *zap.SugaredLogger, fs *firestore.Client) *DiscoverV2Handler {
-	return &DiscoverV2Handler{log: log, fs: fs}
+func NewDiscoverV2Handler(log *zap.SugaredLogger, fs *firestore.Client, config *ConfigStore, personalizer Personalizer) *DiscoverV2Handler {
+	return &DiscoverV2Handler{log: log, fs: fs, config: config, personalizer: personalizer}
 }
 
 func (h *DiscoverV2Handler) Pattern() string {
 	return "/discover/v2"
 }
 
-// sourceConfig defines a source and its scoring weight
-type v2SourceConfig struct {
-	collection string
-	weight     float64
-	maxRank    float64
-}
+// resolveProfile picks the requested profile and applies ?sources= and
+// ?limit= on top of it. Sources can only be narrowed, so requests can't
+// make us read arbitrary collections.
+func resolveProfile(c *DiscoverConfig, q url.Values) (string, DiscoverProfile, error) {
+	name := q.Get("profile")
+	if name == "" {
+		name = defaultProfile
+	}
+	profile, ok := c.Profiles[name]
+	if !ok {
+		return "", profile, fmt.Errorf("unknown profile %q", name)
+	}
+
+	if raw := q.Get("sources"); raw != "" {
+		want := make(map[string]bool)
+		for _, s := range strings.Split(raw, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				want[s] = true
+			}
+		}
+		var sources []SourceConfig
+		for _, src := range profile.Sources {
+			if want[src.Collection] {
+				sources = append(sources, src)
+				delete(want, src.Collection)
+			}
+		}
+		for s := range want {
+			return "", profile, fmt.Errorf("source %q is not in profile %q", s, name)
+		}
+		if len(sources) == 0 {
+			return "", profile, errors.New("sources must name at least one source")
+		}
+		profile.Sources = sources
+	}
 
-// v2Sources defines all melodex sources with their scoring weights.
-// Higher weight = better signal for fresh music discovery.
-var v2Sources = []v2SourceConfig{
-	{collection: "spotify_new_releases", weight: 1.0, maxRank: 100},
-	{collection: "reddit_fresh", weight: 0.9, maxRank: 50},
-	{collection: "hnhh", weight: 0.7, maxRank: 100},
-	{collection: "pitchfork_bnm", weight: 0.6, maxRank: 20},
-	{collection: "billboard", weight: 0.5, maxRank: 100},
+	if raw := q.Get("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 1 || limit > maxDiscoverLimit {
+			return "", profile, fmt.Errorf("limit must be between 1 and %d", maxDiscoverLimit)
+		}
+		profile.Limit = limit
+	}
+
+	return name, profile, nil
 }
 
 func (h *DiscoverV2Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	ctx := context.Background()
+	ctx := r.Context()
 	w.Header().Set("Content-Type", "application/json")
 
 	now := time.Now()
 
-	type scoredTrack struct {
-		track       occipital.Track
-		source      string
-		rank        int
-		weight      float64
-		maxRank     float64
-		sourceCount int
-		score       float64
+	// Pin the config for the whole request so a reload can't mix versions
+	cfg := h.config.Current()
+	profileName, profile, err := resolveProfile(cfg, r.URL.Query())
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), http.StatusBadRequest)
+		return
 	}
 
-	// Collect tracks from all sources, keyed by normalized artist+title
-	trackMap := make(map[string]*scoredTrack)
-	sourceMap := make(map[string]map[string]bool) // key -> set of sources
-	artistCount := make(map[string]int)            // cap tracks per artist
-	thumbCount := make(map[string]int)             // cap tracks per album art
-	var latestDate string
-
-	const maxTracksPerArtist = 2
-	const maxTracksPerThumb = 1 // prevent same album cover flooding the wall
+	explain, _ := strconv.ParseBool(r.URL.Query().Get("explain"))
 
-	for _, src := range v2Sources {
-		tracks, dateUsed, err := h.fetchTracksWithFallback(ctx, now, src.collection)
-		if err != nil {
-			h.log.Warnw("Failed to fetch source, skipping",
-				"source", src.collection, "err", err)
-			continue
+	// ?user_id= re-ranks for that user; only they may ask for it
+	userID := r.URL.Query().Get("user_id")
+	var userTaste *taste
+	if userID != "" {
+		p, ok := auth.FromContext(ctx)
+		if !ok {
+			http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+			return
 		}
-
-		h.log.Infow("Fetched tracks from source",
-			"source", src.collection,
-			"trackCount", len(tracks),
-			"date", dateUsed,
-		)
-
-		if dateUsed > latestDate {
-			latestDate = dateUsed
+		if p.UserID != userID {
+			http.Error(w, `{"error":"forbidden"}`, http.StatusForbidden)
+			return
+		}
+		tasteProfile, err := h.personalizer.Taste(ctx, userID)
+		switch {
+		case errors.Is(err, spotify.ErrTokenNotFound):
+			http.Error(w, `{"error":"spotify not connected for this user"}`, http.StatusUnauthorized)
+			return
+		case errors.Is(err, spotify.ErrInsufficientScope):
+			http.Error(w, `{"error":"reconnect spotify to share listening history"}`, http.StatusForbidden)
+			return
+		case err != nil:
+			h.log.Errorw("Failed to load taste profile", "user_id", userID, "err", err)
+			http.Error(w, `{"error":"failed to load listening history"}`, http.StatusBadGateway)
+			return
 		}
+		userTaste = newTaste(tasteProfile)
+	}
 
-		for _, fsTrack := range tracks {
-			// Skip tracks without album art — they'd show as broken images
-			if fsTrack.Thumb == "" {
-				continue
-			}
-			oTrack := convertToOccipitalTrack(fsTrack, src.collection)
-			oTrack.Source = src.collection
-			key := normalizeTrackKey(fsTrack.Artist, fsTrack.Title)
-			artistKey := normalizeArtist(fsTrack.Artist)
-
-			if existing, ok := trackMap[key]; ok {
-				// Track already seen from another source — keep the one with higher source weight
-				if src.weight > existing.weight {
-					trackMap[key] = &scoredTrack{
-						track:   oTrack,
-						source:  src.collection,
-						rank:    fsTrack.Rank,
-						weight:  src.weight,
-						maxRank: src.maxRank,
-					}
-				}
-			} else {
-				// Skip if this artist already has enough tracks
-				if artistCount[artistKey] >= maxTracksPerArtist {
-					continue
-				}
-				// Skip if this album art already appeared (prevents same-album flooding)
-				if thumbCount[fsTrack.Thumb] >= maxTracksPerThumb {
-					continue
-				}
-				artistCount[artistKey]++
-				thumbCount[fsTrack.Thumb]++
-				trackMap[key] = &scoredTrack{
-					track:   oTrack,
-					source:  src.collection,
-					rank:    fsTrack.Rank,
-					weight:  src.weight,
-					maxRank: src.maxRank,
-				}
-			}
+	c := collectChart(ctx, h.log, h.fs, now, profile, explain)
 
-			// Track source appearances for cross-source bonus
-			if sourceMap[key] == nil {
-				sourceMap[key] = make(map[string]bool)
+	if userTaste != nil {
+		var ids []string
+		for _, st := range c.results {
+			if st.track.SourceID != "" {
+				ids = append(ids, st.track.SourceID)
 			}
-			sourceMap[key][src.collection] = true
+		}
+		// Without genres, artist affinity and known tracks still apply
+		genres, err := h.personalizer.TrackGenres(ctx, ids)
+		if err != nil {
+			h.log.Warnw("Failed to load track genres", "err", err)
+		}
+		weights := profile.Personalization.withDefaults()
+		for i := range c.results {
+			st := &c.results[i]
+			st.score, st.personal = userTaste.personalize(st.score, st.track.Artist, st.track.Name, st.track.SourceID, genres[st.track.SourceID], weights)
 		}
 	}
 
-	// Score all tracks
-	var results []scoredTrack
-	for key, st := range trackMap {
-		st.sourceCount = len(sourceMap[key])
-		st.score = computeScore(st.rank, st.weight, st.maxRank, st.sourceCount)
-		results = append(results, *st)
-	}
-
-	// Sort by score descending
-	sort.Slice(results, func(i, j int) bool {
-		return results[i].score > results[j].score
-	})
-
-	// Cap at 100 tracks
-	const maxDiscoverTracks = 150
-	if len(results) > maxDiscoverTracks {
-		results = results[:maxDiscoverTracks]
-	}
+	c.rank(profile.Limit, explain)
+	results, latestDate := c.results, c.latestDate
 
 	// Convert to response
 	finalTracks := make([]occipital.Track, 0, len(results))
@@ -165,13 +159,38 @@ func (h *DiscoverV2Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 
 	resp := &DiscoverResponse{
-		Tracks:  finalTracks,
-		Updated: latestDate,
+		Tracks:        finalTracks,
+		Updated:       latestDate,
+		ConfigVersion: cfg.Version,
+		Profile:       profileName,
+		Personalized:  userTaste != nil,
+	}
+
+	if explain {
+		resp.Explain = &DiscoverExplanation{
+			Tracks:  make([]TrackExplanation, 0, len(results)),
+			Dropped: c.dropped,
+		}
+		for _, st := range results {
+			resp.Explain.Tracks = append(resp.Explain.Tracks, TrackExplanation{
+				Artist:           st.track.Artist,
+				Name:             st.track.Name,
+				Score:            st.score,
+				RankScore:        st.rankScore,
+				CrossSourceBonus: st.bonus,
+				WinningSource:    st.source,
+				Weight:           st.weight,
+				Sources:          c.sources[st.key],
+				Personal:         st.personal,
+			})
+		}
 	}
 
 	h.log.Infow("Discover v2 response",
 		"totalTracks", len(finalTracks),
 		"updated", latestDate,
+		"configVersion", cfg.Version,
+		"profile", profileName,
 	)
 
 	if err := json.NewEncoder(w).Encode(resp); err != nil {
@@ -180,46 +199,31 @@ func (h *DiscoverV2Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// computeScore implements the melodex v2 scoring algorithm.
+// computeScore implements the melodex v2 scoring algorithm, returning the
+// two terms of
 //
 //	score = (source_weight * normalized_rank²) + cross_source_bonus
 //
 // Uses exponential rank decay so top-ranked tracks score much higher.
 // Cross-source bonus rewards tracks appearing on multiple charts.
-func computeScore(rank int, weight, maxRank float64, sourceCount int) float64 {
+func computeScore(rank int, weight, maxRank float64, sourceCount int, bonuses []CrossSourceBonus) (rankScore, crossSource float64) {
 	normalizedRank := 1.0 - (float64(rank) / maxRank)
 	normalizedRank = math.Max(0.0, math.Min(1.0, normalizedRank))
-	rankScore := weight * (normalizedRank * normalizedRank)
+	rankScore = weight * (normalizedRank * normalizedRank)
 
-	crossSource := 0.0
-	if sourceCount >= 3 {
-		crossSource = 1.0
-	} else if sourceCount >= 2 {
-		crossSource = 0.5
-	}
-
-	return rankScore + crossSource
-}
-
-// normalizeArtist strips feat/ft variations and lowercases the artist name.
-func normalizeArtist(artist string) string {
-	a := strings.ToLower(strings.TrimSpace(artist))
-	for _, sep := range []string{" feat.", " ft.", " featuring ", " feat ", " ft "} {
-		if idx := strings.Index(a, sep); idx > 0 {
-			a = a[:idx]
+	tier := 0
+	for _, b := range bonuses {
+		if sourceCount >= b.MinSources && b.MinSources > tier {
+			crossSource, tier = b.Bonus, b.MinSources
 		}
 	}
-	return a
-}
 
-// normalizeTrackKey creates a lookup key for deduplication.
-func normalizeTrackKey(artist, title string) string {
-	return normalizeArtist(artist) + " - " + strings.ToLower(strings.TrimSpace(title))
+	return rankScore, crossSource
 }
 
 // fetchTracksWithFallback tries today, then falls back up to 5 days.
-func (h *DiscoverV2Handler) fetchTracksWithFallback(ctx context.Context, now time.Time, collection string) ([]fsClient.Track, string, error) {
-	col := h.fs.Collection(collection)
+func fetchTracksWithFallback(ctx context.Context, log *zap.SugaredLogger, fs *firestore.Client, now time.Time, collection string) ([]fsClient.Track, string, error) {
+	col := fs.Collection(collection)
 
 	for i := 0; i <= maxDaysToLookBack; i++ {
 		date := now.AddDate(0, 0, -i).Format("2006-01-02")
@@ -229,12 +233,12 @@ func (h *DiscoverV2Handler) fetchTracksWithFallback(ctx context.Context, now tim
 		}
 		var tracksDoc fsClient.TracksDoc
 		if err := doc.DataTo(&tracksDoc); err != nil {
-			h.log.Warnw("Error decoding tracks doc",
+			log.Warnw("Error decoding tracks doc",
 				"collection", collection, "date", date, "err", err)
 			continue
 		}
 		if i > 0 {
-			h.log.Infow("Using fallback date for source",
+			log.Infow("Using fallback date for source",
 				"collection", collection, "date", date, "daysBack", i)
 		}
 		return tracksDoc.Tracks, date, nil
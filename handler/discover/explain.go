@@ -0,0 +1,49 @@
+package discover
+
+// Drop reasons reported in explain mode.
+const (
+	dropArtistCap = "artist_cap"
+	dropThumbCap  = "thumb_cap"
+	dropLimit     = "limit"
+)
+
+// DiscoverExplanation is returned with ?explain=true so editors can see why
+// tracks ranked where they did.
+type DiscoverExplanation struct {
+	// Tracks lines up with DiscoverResponse.Tracks
+	Tracks  []TrackExplanation `json:"tracks"`
+	Dropped []DroppedTrack     `json:"dropped"`
+}
+
+// TrackExplanation breaks a track's score into its components:
+//
+//	score = rank_score + cross_source_bonus
+type TrackExplanation struct {
+	Artist           string             `json:"artist"`
+	Name             string             `json:"name"`
+	Score            float64            `json:"score"`
+	RankScore        float64            `json:"rank_score"`
+	CrossSourceBonus float64            `json:"cross_source_bonus"`
+	WinningSource    string             `json:"winning_source"`
+	Weight           float64            `json:"weight"`
+	Sources          []SourceAppearance `json:"sources"`
+	// Personal is set for ?user_id= requests; Score then includes it
+	Personal *PersonalScore `json:"personal,omitempty"`
+}
+
+// SourceAppearance is a track's rank in one source.
+type SourceAppearance struct {
+	Source string `json:"source"`
+	Rank   int    `json:"rank"`
+}
+
+// DroppedTrack is a track left out of the response. Reason is "artist_cap",
+// "thumb_cap" or "limit".
+type DroppedTrack struct {
+	Artist string  `json:"artist"`
+	Name   string  `json:"name"`
+	Source string  `json:"source"`
+	Rank   int     `json:"rank"`
+	Reason string  `json:"reason"`
+	Score  float64 `json:"score,omitempty"`
+}
@@ -0,0 +1,303 @@
+package discover
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/mager/occipital/occipital"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultTrendingDays = 7
+	maxTrendingDays     = 60
+)
+
+// Trend statuses, as a chart would print them.
+const (
+	trendNew     = "new"
+	trendReentry = "reentry"
+	trendUp      = "up"
+	trendDown    = "down"
+	trendSame    = "same"
+)
+
+// parseDate reads ?date=YYYY-MM-DD, defaulting to today.
+func parseDate(r *http.Request) (string, bool) {
+	date := r.URL.Query().Get("date")
+	if date == "" {
+		return time.Now().Format("2006-01-02"), true
+	}
+	_, err := time.Parse("2006-01-02", date)
+	return date, err == nil
+}
+
+// --- History Handler ---
+
+// HistoryHandler serves the stored discover v2 chart for a day.
+type HistoryHandler struct {
+	log *zap.SugaredLogger
+	fs  *firestore.Client
+}
+
+func NewHistoryHandler(log *zap.SugaredLogger, fs *firestore.Client) *HistoryHandler {
+	return &HistoryHandler{log: log, fs: fs}
+}
+
+func (h *HistoryHandler) Pattern() string {
+	return "/discover/v2/history"
+}
+
+type HistoryResponse struct {
+	Date          string            `json:"date"`
+	Updated       string            `json:"updated"`
+	ConfigVersion string            `json:"config_version"`
+	Tracks        []occipital.Track `json:"tracks"`
+}
+
+// ServeHTTP returns the discover v2 chart as it stood on a date.
+//
+// @Summary      Discover v2 history
+// @Description  Returns the stored discover v2 chart for a day
+// @Tags         Discover
+// @Produce      json
+// @Param        date  query  string  false  "Day as YYYY-MM-DD; defaults to today"
+// @Success      200  {object}  HistoryResponse
+// @Failure      404  {object}  map[string]string
+// @Router       /discover/v2/history [get]
+func (h *HistoryHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	date, ok := parseDate(r)
+	if !ok {
+		http.Error(w, `{"error":"date must be YYYY-MM-DD"}`, http.StatusBadRequest)
+		return
+	}
+
+	snap, err := getSnapshot(r.Context(), h.fs, date)
+	if errors.Is(err, ErrSnapshotNotFound) {
+		http.Error(w, `{"error":"no snapshot for date"}`, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		h.log.Errorw("Failed to load discover snapshot", "date", date, "err", err)
+		http.Error(w, `{"error":"failed to load snapshot"}`, http.StatusInternalServerError)
+		return
+	}
+
+	resp := HistoryResponse{
+		Date:          snap.Date,
+		Updated:       snap.Updated,
+		ConfigVersion: snap.ConfigVersion,
+		Tracks:        make([]occipital.Track, 0, len(snap.Tracks)),
+	}
+	for _, t := range snap.Tracks {
+		resp.Tracks = append(resp.Tracks, t.track())
+	}
+
+	json.NewEncoder(w).Encode(resp)
+}
+
+// SnapshotTrackIDs returns the Spotify IDs on the chart for date, in chart
+// order. A day without a snapshot has no tracks.
+func (h *HistoryHandler) SnapshotTrackIDs(ctx context.Context, date string) ([]string, error) {
+	snap, err := getSnapshot(ctx, h.fs, date)
+	if errors.Is(err, ErrSnapshotNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for _, t := range snap.Tracks {
+		if t.SourceID != "" {
+			ids = append(ids, t.SourceID)
+		}
+	}
+	return ids, nil
+}
+
+// RecentTrackIDs returns the Spotify IDs charted in the last days
+// snapshots, newest chart first and each track once.
+func (h *HistoryHandler) RecentTrackIDs(ctx context.Context, days int) ([]string, error) {
+	snaps, err := recentSnapshots(ctx, h.fs, time.Now().Format("2006-01-02"), days)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	var ids []string
+	for _, snap := range snaps {
+		for _, t := range snap.Tracks {
+			if t.SourceID != "" && !seen[t.SourceID] {
+				seen[t.SourceID] = true
+				ids = append(ids, t.SourceID)
+			}
+		}
+	}
+	return ids, nil
+}
+
+// --- Trending Handler ---
+
+// TrendingHandler compares recent discover v2 snapshots chart-style.
+type TrendingHandler struct {
+	log *zap.SugaredLogger
+	fs  *firestore.Client
+}
+
+func NewTrendingHandler(log *zap.SugaredLogger, fs *firestore.Client) *TrendingHandler {
+	return &TrendingHandler{log: log, fs: fs}
+}
+
+func (h *TrendingHandler) Pattern() string {
+	return "/discover/v2/trending"
+}
+
+type TrendingResponse struct {
+	Date string `json:"date"`
+	// ComparedTo is the snapshot movement is measured against; empty when
+	// there is none yet
+	ComparedTo string          `json:"compared_to,omitempty"`
+	Days       int             `json:"days"`
+	Tracks     []TrendingTrack `json:"tracks"`
+	Exits      []TrendingExit  `json:"exits"`
+}
+
+// TrendingTrack is a charted track with its movement. DaysOnChart and
+// PeakPosition only count snapshots within the requested window.
+type TrendingTrack struct {
+	Track            occipital.Track `json:"track"`
+	Position         int             `json:"position"`
+	PreviousPosition int             `json:"previous_position,omitempty"`
+	// Movement is positive when a track climbed, e.g. 12 for "up 12"
+	Movement     int    `json:"movement"`
+	Status       string `json:"status"`
+	DaysOnChart  int    `json:"days_on_chart"`
+	PeakPosition int    `json:"peak_position"`
+}
+
+// TrendingExit is a track that fell off since the previous snapshot.
+type TrendingExit struct {
+	Track        occipital.Track `json:"track"`
+	LastPosition int             `json:"last_position"`
+}
+
+// ServeHTTP returns the latest chart with movement, new entries, days on
+// chart and peak positions.
+//
+// @Summary      Discover v2 trending
+// @Description  Compares the latest discover v2 snapshot with earlier ones
+// @Tags         Discover
+// @Produce      json
+// @Param        date  query  string  false  "Latest day as YYYY-MM-DD; defaults to today"
+// @Param        days  query  int     false  "Snapshots to consider (2-60, default 7)"
+// @Success      200  {object}  TrendingResponse
+// @Failure      404  {object}  map[string]string
+// @Router       /discover/v2/trending [get]
+func (h *TrendingHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	date, ok := parseDate(r)
+	if !ok {
+		http.Error(w, `{"error":"date must be YYYY-MM-DD"}`, http.StatusBadRequest)
+		return
+	}
+
+	days := defaultTrendingDays
+	if raw := r.URL.Query().Get("days"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 2 || n > maxTrendingDays {
+			http.Error(w, `{"error":"days must be between 2 and 60"}`, http.StatusBadRequest)
+			return
+		}
+		days = n
+	}
+
+	snaps, err := recentSnapshots(r.Context(), h.fs, date, days)
+	if err != nil {
+		h.log.Errorw("Failed to load discover snapshots", "date", date, "err", err)
+		http.Error(w, `{"error":"failed to load snapshots"}`, http.StatusInternalServerError)
+		return
+	}
+	if len(snaps) == 0 {
+		http.Error(w, `{"error":"no snapshots yet"}`, http.StatusNotFound)
+		return
+	}
+
+	resp := computeTrending(snaps)
+	resp.Days = days
+	json.NewEncoder(w).Encode(resp)
+}
+
+// computeTrending charts snaps[0] against the snapshots before it. snaps
+// must be newest first.
+func computeTrending(snaps []*DiscoverSnapshot) TrendingResponse {
+	latest := snaps[0]
+	positions := make([]map[string]int, len(snaps))
+	for i, snap := range snaps {
+		positions[i] = make(map[string]int, len(snap.Tracks))
+		for _, t := range snap.Tracks {
+			positions[i][t.Key] = t.Position
+		}
+	}
+
+	resp := TrendingResponse{
+		Date:   latest.Date,
+		Tracks: make([]TrendingTrack, 0, len(latest.Tracks)),
+		Exits:  []TrendingExit{},
+	}
+	if len(snaps) > 1 {
+		resp.ComparedTo = snaps[1].Date
+	}
+
+	for _, t := range latest.Tracks {
+		tt := TrendingTrack{
+			Track:        t.track(),
+			Position:     t.Position,
+			PeakPosition: t.Position,
+			Status:       trendNew,
+		}
+		for i := range snaps {
+			pos, ok := positions[i][t.Key]
+			if !ok {
+				continue
+			}
+			tt.DaysOnChart++
+			tt.PeakPosition = min(tt.PeakPosition, pos)
+			if i > 1 && tt.Status == trendNew {
+				tt.Status = trendReentry
+			}
+		}
+
+		if len(snaps) > 1 {
+			if prev, ok := positions[1][t.Key]; ok {
+				tt.PreviousPosition = prev
+				tt.Movement = prev - t.Position
+				switch {
+				case tt.Movement > 0:
+					tt.Status = trendUp
+				case tt.Movement < 0:
+					tt.Status = trendDown
+				default:
+					tt.Status = trendSame
+				}
+			}
+		}
+		resp.Tracks = append(resp.Tracks, tt)
+	}
+
+	if len(snaps) > 1 {
+		for _, t := range snaps[1].Tracks {
+			if _, ok := positions[0][t.Key]; !ok {
+				resp.Exits = append(resp.Exits, TrendingExit{Track: t.track(), LastPosition: t.Position})
+			}
+		}
+	}
+
+	return resp
+}
@@ -0,0 +1,227 @@
+package discover
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+
+	fsClient "github.com/mager/occipital/firestore"
+	"golang.org/x/text/unicode/norm"
+)
+
+// defaultMatchThreshold is used when a profile doesn't set one. It's high
+// enough that "Paper Planes" and "Paper Plane" merge but distinct songs by
+// the same artist don't.
+const defaultMatchThreshold = 0.88
+
+var (
+	// bracketed matches "(...)" and "[...]" segments of a title
+	bracketed = regexp.MustCompile(`\s*[(\[]([^)\]]*)[)\]]`)
+
+	// versionWords mark a bracket or " - " suffix as describing the release
+	// rather than the song
+	versionWords = regexp.MustCompile(`\b(feat|ft|featuring|with|remaster|remastered|radio|edit|version|explicit|clean|mono|stereo|single|bonus|from|prod)\b`)
+
+	// recordingWords win over versionWords: remixes, live and acoustic takes
+	// and re-recordings like "(Taylor's Version)" really are different tracks
+	recordingWords = regexp.MustCompile(`\b(remix|mix|live|acoustic|instrumental|demo)\b|['’]s version`)
+
+	// artistSeparators split featured artists off the primary artist. "&",
+	// "and" and commas are left alone since they're part of many band names,
+	// like "Simon & Garfunkel" and "Tyler, The Creator"
+	artistSeparators = regexp.MustCompile(`\s(feat\.?|ft\.?|featuring|with)\s`)
+)
+
+// foldText lowercases s, strips diacritics, spells out "&" and drops
+// punctuation, so "Beyoncé & JAY-Z" and "beyonce and jay z" compare equal.
+func foldText(s string) string {
+	s = strings.ToLower(norm.NFD.String(s))
+	s = strings.ReplaceAll(s, "&", " and ")
+
+	var b strings.Builder
+	space := true
+	for _, r := range s {
+		switch {
+		case unicode.Is(unicode.Mn, r):
+			// combining accent left over from NFD
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			b.WriteRune(r)
+			space = false
+		case r == '\'' || r == '’' || r == '.':
+			// "don't" and "dont", "M.I.A." and "MIA" should match
+		default:
+			if !space {
+				b.WriteByte(' ')
+				space = true
+			}
+		}
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// normalizeArtist reduces an artist credit to its folded primary artist, so
+// "Drake Featuring Future" and "Drake ft. Future" agree.
+func normalizeArtist(artist string) string {
+	a := strings.ToLower(strings.TrimSpace(artist))
+	if loc := artistSeparators.FindStringIndex(a); loc != nil && loc[0] > 0 {
+		a = a[:loc[0]]
+	}
+	return foldText(a)
+}
+
+// normalizeTitle folds a title and drops release decorations like
+// "(Remastered 2011)", "[feat. X]" and "- Radio Edit".
+func normalizeTitle(title string) string {
+	t := strings.ToLower(strings.TrimSpace(title))
+	t = bracketed.ReplaceAllStringFunc(t, func(m string) string {
+		if isVersionNote(m) {
+			return ""
+		}
+		return m
+	})
+	if i := strings.LastIndex(t, " - "); i > 0 && isVersionNote(t[i:]) {
+		t = t[:i]
+	}
+	return foldText(t)
+}
+
+func isVersionNote(s string) bool {
+	return versionWords.MatchString(s) && !recordingWords.MatchString(s)
+}
+
+type identityEntry struct {
+	key    string
+	artist string
+	title  string
+}
+
+// identityResolver assigns tracks from different sources a shared key when
+// they're the same song. Stable IDs win; otherwise titles and artists are
+// normalized and, failing an exact match, compared fuzzily.
+type identityResolver struct {
+	threshold float64
+	byID      map[string]string
+	byNorm    map[string]string
+	entries   []identityEntry
+}
+
+func newIdentityResolver(threshold float64) *identityResolver {
+	if threshold <= 0 {
+		threshold = defaultMatchThreshold
+	}
+	return &identityResolver{
+		threshold: threshold,
+		byID:      make(map[string]string),
+		byNorm:    make(map[string]string),
+	}
+}
+
+// trackIDs lists the stable identifiers a source gave us, namespaced so
+// they can't collide.
+func trackIDs(t fsClient.Track) []string {
+	var ids []string
+	if isrc := strings.ToUpper(strings.TrimSpace(t.ISRC)); isrc != "" {
+		ids = append(ids, "isrc:"+isrc)
+	}
+	if mbid := strings.TrimSpace(t.MBID); mbid != "" {
+		ids = append(ids, "mbid:"+mbid)
+	}
+	if sid := strings.TrimSpace(t.SpotifyID); sid != "" {
+		ids = append(ids, "spotify:"+sid)
+	}
+	return ids
+}
+
+// Resolve returns the identity key for t, remembering t's IDs and names so
+// later sources can match it.
+func (r *identityResolver) Resolve(t fsClient.Track) string {
+	ids := trackIDs(t)
+	artist, title := normalizeArtist(t.Artist), normalizeTitle(t.Title)
+	normKey := artist + " - " + title
+
+	key := ""
+	for _, id := range ids {
+		if k, ok := r.byID[id]; ok {
+			key = k
+			break
+		}
+	}
+	if key == "" {
+		key = r.byNorm[normKey]
+	}
+	if key == "" {
+		key = r.fuzzy(artist, title)
+	}
+	if key == "" {
+		key = normKey
+		r.entries = append(r.entries, identityEntry{key: key, artist: artist, title: title})
+	}
+
+	for _, id := range ids {
+		if _, ok := r.byID[id]; !ok {
+			r.byID[id] = key
+		}
+	}
+	if _, ok := r.byNorm[normKey]; !ok {
+		r.byNorm[normKey] = key
+	}
+	return key
+}
+
+// fuzzy returns the key of the closest known track above the threshold.
+// Both artist and title must be similar, so covers and same-titled songs by
+// different artists stay apart. Titles that differ in their numbers ("Pt. 1"
+// and "Pt. 2") never match.
+func (r *identityResolver) fuzzy(artist, title string) string {
+	best, bestScore := "", r.threshold
+	for _, e := range r.entries {
+		if similarity(artist, e.artist) < r.threshold || digits(title) != digits(e.title) {
+			continue
+		}
+		if s := similarity(title, e.title); s >= bestScore {
+			best, bestScore = e.key, s
+		}
+	}
+	return best
+}
+
+func digits(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsDigit(r) {
+			return r
+		}
+		return -1
+	}, s)
+}
+
+// similarity is 1 minus the normalized Levenshtein distance between a and b.
+func similarity(a, b string) float64 {
+	if a == b {
+		return 1
+	}
+	ra, rb := []rune(a), []rune(b)
+	if len(ra) == 0 || len(rb) == 0 {
+		return 0
+	}
+	return 1 - float64(levenshtein(ra, rb))/float64(max(len(ra), len(rb)))
+}
+
+func levenshtein(a, b []rune) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
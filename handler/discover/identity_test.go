@@ -0,0 +1,214 @@
+package discover
+
+import (
+	"testing"
+
+	fsClient "github.com/mager/occipital/firestore"
+)
+
+func TestNormalizeTitle(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"Here Comes the Sun", "here comes the sun"},
+		{"Here Comes the Sun (Remastered 2011)", "here comes the sun"},
+		{"Here Comes the Sun - Remastered 2009", "here comes the sun"},
+		{"Blinding Lights - Radio Edit", "blinding lights"},
+		{"Blinding Lights (Radio Edit)", "blinding lights"},
+		{"SICKO MODE (feat. Drake)", "sicko mode"},
+		{"SICKO MODE [ft. Drake]", "sicko mode"},
+		{"Peaches (featuring Daniel Caesar & Giveon)", "peaches"},
+		{"Die With A Smile (with Bruno Mars)", "die with a smile"},
+		{"Crazy in Love - Single Version", "crazy in love"},
+		{"Rock & Roll", "rock and roll"},
+		{"Rock and Roll", "rock and roll"},
+		{"Café del Mar", "cafe del mar"},
+		{"Don’t Stop Me Now", "dont stop me now"},
+		{"  22  ", "22"},
+		// Different recordings keep their notes
+		{"Levitating (Remix)", "levitating remix"},
+		{"Levitating - DaBaby Remix", "levitating dababy remix"},
+		{"Love Story (Taylor's Version)", "love story taylors version"},
+		{"Creep - Live at Reading", "creep live at reading"},
+		{"Skinny Love (Acoustic Version)", "skinny love acoustic version"},
+		// Brackets that are part of the title stay
+		{"(I Can't Get No) Satisfaction", "i cant get no satisfaction"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			if got := normalizeTitle(tt.in); got != tt.want {
+				t.Errorf("normalizeTitle(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeArtist(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"Drake", "drake"},
+		{"Drake Featuring Future", "drake"},
+		{"Drake feat. Future", "drake"},
+		{"Drake feat Future", "drake"},
+		{"Drake ft. Future", "drake"},
+		{"Drake ft Future", "drake"},
+		{"Drake with Future", "drake"},
+		// Band names keep their "&", "and" and commas
+		{"Simon & Garfunkel", "simon and garfunkel"},
+		{"Simon and Garfunkel", "simon and garfunkel"},
+		{"Earth, Wind & Fire", "earth wind and fire"},
+		{"Tyler, The Creator", "tyler the creator"},
+		{"Tyler, The Creator feat. Kali Uchis", "tyler the creator"},
+		{"Florence + the Machine", "florence the machine"},
+		{"Beyoncé", "beyonce"},
+		{"BEYONCE", "beyonce"},
+		{"Beyoncé feat. JAY-Z", "beyonce"},
+		{"JAY-Z", "jay z"},
+		{"M.I.A.", "mia"},
+		{"Sigur Rós", "sigur ros"},
+		// A leading separator word isn't a collaboration
+		{"With Confidence", "with confidence"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			if got := normalizeArtist(tt.in); got != tt.want {
+				t.Errorf("normalizeArtist(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIdentityResolver(t *testing.T) {
+	tests := []struct {
+		name      string
+		threshold float64
+		a, b      fsClient.Track
+		same      bool
+	}{
+		{
+			name: "same Spotify ID, different spelling",
+			a:    fsClient.Track{Artist: "Kendrick Lamar", Title: "Not Like Us", SpotifyID: "6AI3ezQ4o3HUoP6Dhudph3"},
+			b:    fsClient.Track{Artist: "K. Dot", Title: "Not Like Us (Clean)", SpotifyID: "6AI3ezQ4o3HUoP6Dhudph3"},
+			same: true,
+		},
+		{
+			name: "ISRC ignores case and padding",
+			a:    fsClient.Track{Artist: "A", Title: "One", ISRC: "usum72401234"},
+			b:    fsClient.Track{Artist: "B", Title: "Two", ISRC: " USUM72401234 "},
+			same: true,
+		},
+		{
+			name: "remaster suffix",
+			a:    fsClient.Track{Artist: "The Beatles", Title: "Here Comes the Sun"},
+			b:    fsClient.Track{Artist: "The Beatles", Title: "Here Comes The Sun - Remastered 2009"},
+			same: true,
+		},
+		{
+			name: "radio edit",
+			a:    fsClient.Track{Artist: "The Weeknd", Title: "Blinding Lights - Radio Edit"},
+			b:    fsClient.Track{Artist: "The Weeknd", Title: "Blinding Lights"},
+			same: true,
+		},
+		{
+			name: "feat. in the title and ft. in the artist",
+			a:    fsClient.Track{Artist: "Travis Scott", Title: "SICKO MODE (feat. Drake)"},
+			b:    fsClient.Track{Artist: "Travis Scott ft. Drake", Title: "SICKO MODE"},
+			same: true,
+		},
+		{
+			name: "with",
+			a:    fsClient.Track{Artist: "Lady Gaga with Bruno Mars", Title: "Die With A Smile"},
+			b:    fsClient.Track{Artist: "Lady Gaga", Title: "Die With A Smile (with Bruno Mars)"},
+			same: true,
+		},
+		{
+			name: "& and and",
+			a:    fsClient.Track{Artist: "Mumford & Sons", Title: "Rock & Roll"},
+			b:    fsClient.Track{Artist: "Mumford and Sons", Title: "Rock and Roll"},
+			same: true,
+		},
+		{
+			name: "diacritics",
+			a:    fsClient.Track{Artist: "Beyoncé", Title: "TEXAS HOLD 'EM"},
+			b:    fsClient.Track{Artist: "Beyonce", Title: "Texas Hold Em"},
+			same: true,
+		},
+		{
+			name: "fuzzy match above the threshold",
+			a:    fsClient.Track{Artist: "M.I.A.", Title: "Paper Planes"},
+			b:    fsClient.Track{Artist: "MIA", Title: "Paper Plane"},
+			same: true,
+		},
+		{
+			name:      "fuzzy match below a stricter threshold",
+			threshold: 0.95,
+			a:         fsClient.Track{Artist: "M.I.A.", Title: "Paper Planes"},
+			b:         fsClient.Track{Artist: "MIA", Title: "Paper Plane"},
+			same:      false,
+		},
+		{
+			name:      "digit guard",
+			threshold: 0.4,
+			a:         fsClient.Track{Artist: "Taylor Swift", Title: "22"},
+			b:         fsClient.Track{Artist: "Taylor Swift", Title: "21"},
+			same:      false,
+		},
+		{
+			name: "digit guard on part numbers",
+			a:    fsClient.Track{Artist: "Travis Scott", Title: "Sdp Interlude Pt. 1"},
+			b:    fsClient.Track{Artist: "Travis Scott", Title: "Sdp Interlude Pt. 2"},
+			same: false,
+		},
+		{
+			name: "same title, different artist",
+			a:    fsClient.Track{Artist: "Leonard Cohen", Title: "Hallelujah"},
+			b:    fsClient.Track{Artist: "Jeff Buckley", Title: "Hallelujah"},
+			same: false,
+		},
+		{
+			name: "band sharing a first word with another act",
+			a:    fsClient.Track{Artist: "Simon & Garfunkel", Title: "America"},
+			b:    fsClient.Track{Artist: "Simon", Title: "America"},
+			same: false,
+		},
+		{
+			name: "remix is a different track",
+			a:    fsClient.Track{Artist: "Dua Lipa", Title: "Levitating"},
+			b:    fsClient.Track{Artist: "Dua Lipa", Title: "Levitating (Remix)"},
+			same: false,
+		},
+		{
+			name: "re-recording is a different track",
+			a:    fsClient.Track{Artist: "Taylor Swift", Title: "Love Story"},
+			b:    fsClient.Track{Artist: "Taylor Swift", Title: "Love Story (Taylor's Version)"},
+			same: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newIdentityResolver(tt.threshold)
+			ka, kb := r.Resolve(tt.a), r.Resolve(tt.b)
+			if (ka == kb) != tt.same {
+				t.Errorf("keys %q and %q: same = %v, want %v", ka, kb, ka == kb, tt.same)
+			}
+		})
+	}
+}
+
+func TestSimilarity(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want float64
+	}{
+		{"abc", "abc", 1},
+		{"", "abc", 0},
+		{"kitten", "sitting", 1 - 3.0/7},
+		{"22", "21", 0.5},
+	}
+	for _, tt := range tests {
+		if got := similarity(tt.a, tt.b); got != tt.want {
+			t.Errorf("similarity(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package discover
+
+import (
+	"context"
+	"strings"
+
+	"github.com/mager/occipital/occipital"
+)
+
+// Personalizer supplies what personalized ranking needs about a user and
+// about the candidate tracks.
+type Personalizer interface {
+	Taste(ctx context.Context, userID string) (occipital.TasteProfile, error)
+	TrackGenres(ctx context.Context, spotifyIDs []string) (map[string][]string, error)
+}
+
+// PersonalizationWeights tune ?user_id= ranking. Zero fields fall back to
+// defaultPersonalization.
+type PersonalizationWeights struct {
+	// GenreBoost scales a track's score by 1 + GenreBoost × genre affinity
+	GenreBoost float64 `json:"genre_boost" firestore:"genre_boost"`
+	// ArtistBoost scales a track's score by 1 + ArtistBoost × artist affinity
+	ArtistBoost float64 `json:"artist_boost" firestore:"artist_boost"`
+	// AdjacentBonus × genre affinity is added for artists the user doesn't
+	// listen to yet, in genres they do
+	AdjacentBonus float64 `json:"adjacent_bonus" firestore:"adjacent_bonus"`
+	// KnownPenalty multiplies the score of tracks the user played recently
+	KnownPenalty float64 `json:"known_penalty" firestore:"known_penalty"`
+}
+
+var defaultPersonalization = PersonalizationWeights{
+	GenreBoost:    0.5,
+	ArtistBoost:   0.25,
+	AdjacentBonus: 0.5,
+	KnownPenalty:  0.25,
+}
+
+func (w *PersonalizationWeights) withDefaults() PersonalizationWeights {
+	out := defaultPersonalization
+	if w == nil {
+		return out
+	}
+	if w.GenreBoost > 0 {
+		out.GenreBoost = w.GenreBoost
+	}
+	if w.ArtistBoost > 0 {
+		out.ArtistBoost = w.ArtistBoost
+	}
+	if w.AdjacentBonus > 0 {
+		out.AdjacentBonus = w.AdjacentBonus
+	}
+	if w.KnownPenalty > 0 {
+		out.KnownPenalty = w.KnownPenalty
+	}
+	return out
+}
+
+// PersonalScore explains how a user's taste moved a track.
+type PersonalScore struct {
+	GlobalScore    float64 `json:"global_score"`
+	ArtistAffinity float64 `json:"artist_affinity"`
+	GenreAffinity  float64 `json:"genre_affinity"`
+	Known          bool    `json:"known"`
+	Adjacent       bool    `json:"adjacent"`
+}
+
+// taste is a TasteProfile indexed the way discover keys tracks.
+type taste struct {
+	artists     map[string]float64
+	genres      map[string]float64
+	genreWords  map[string]float64
+	knownIDs    map[string]bool
+	knownTracks map[string]bool
+}
+
+// newTaste normalizes names with the same rules as identity resolution,
+// so "Beyoncé" in the profile matches "Beyonce" on a chart.
+func newTaste(p occipital.TasteProfile) *taste {
+	t := &taste{
+		artists:     make(map[string]float64, len(p.Artists)),
+		genres:      p.Genres,
+		genreWords:  make(map[string]float64),
+		knownIDs:    make(map[string]bool, len(p.KnownTracks)),
+		knownTracks: make(map[string]bool, len(p.KnownTracks)),
+	}
+	for name, a := range p.Artists {
+		key := normalizeArtist(name)
+		t.artists[key] = max(t.artists[key], a)
+	}
+	// Half credit for sharing a word, so "uk drill" counts toward "drill"
+	for g, a := range p.Genres {
+		for _, word := range strings.Fields(g) {
+			t.genreWords[word] = max(t.genreWords[word], a/2)
+		}
+	}
+	for _, k := range p.KnownTracks {
+		if k.SpotifyID != "" {
+			t.knownIDs[k.SpotifyID] = true
+		}
+		t.knownTracks[normalizeArtist(k.Artist)+" - "+normalizeTitle(k.Name)] = true
+	}
+	return t
+}
+
+// genreAffinity is the best match between a track's genres and the user's.
+func (t *taste) genreAffinity(genres []string) float64 {
+	var best float64
+	for _, g := range genres {
+		g = strings.ToLower(g)
+		if a, ok := t.genres[g]; ok {
+			best = max(best, a)
+			continue
+		}
+		for _, word := range strings.Fields(g) {
+			best = max(best, t.genreWords[word])
+		}
+	}
+	return best
+}
+
+// personalize rescores a globally scored track for this user.
+func (t *taste) personalize(score float64, artist, title, spotifyID string, genres []string, w PersonalizationWeights) (float64, *PersonalScore) {
+	ps := &PersonalScore{
+		GlobalScore:    score,
+		ArtistAffinity: t.artists[normalizeArtist(artist)],
+		GenreAffinity:  t.genreAffinity(genres),
+		Known:          t.knownIDs[spotifyID] || t.knownTracks[normalizeArtist(artist)+" - "+normalizeTitle(title)],
+	}
+
+	score *= 1 + w.GenreBoost*ps.GenreAffinity + w.ArtistBoost*ps.ArtistAffinity
+	if ps.ArtistAffinity == 0 && ps.GenreAffinity > 0 {
+		ps.Adjacent = true
+		score += w.AdjacentBonus * ps.GenreAffinity
+	}
+	if ps.Known {
+		score *= w.KnownPenalty
+	}
+	return score, ps
+}
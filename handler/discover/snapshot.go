@@ -0,0 +1,170 @@
+package discover
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/mager/occipital/occipital"
+	"go.uber.org/zap"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const snapshotCollection = "discover_v2_snapshots"
+
+var (
+	// ErrSnapshotNotFound is returned when no snapshot exists for a date.
+	ErrSnapshotNotFound = errors.New("discover snapshot not found")
+	// ErrNoChart is returned when no source had tracks to snapshot.
+	ErrNoChart = errors.New("discover chart is empty")
+)
+
+// DiscoverSnapshot is the default discover v2 chart as served on Date,
+// stored under its date in discover_v2_snapshots.
+type DiscoverSnapshot struct {
+	Date          string          `json:"date" firestore:"date"`
+	Updated       string          `json:"updated" firestore:"updated"`
+	ConfigVersion string          `json:"config_version" firestore:"config_version"`
+	CreatedAt     time.Time       `json:"created_at" firestore:"created_at"`
+	Tracks        []SnapshotTrack `json:"tracks" firestore:"tracks"`
+}
+
+// SnapshotTrack is a charted track. Key is the normalized artist+title used
+// to follow a track across days.
+type SnapshotTrack struct {
+	Key      string  `json:"key" firestore:"key"`
+	Position int     `json:"position" firestore:"position"`
+	Score    float64 `json:"score" firestore:"score"`
+	Artist   string  `json:"artist" firestore:"artist"`
+	Name     string  `json:"name" firestore:"name"`
+	Image    string  `json:"image" firestore:"image"`
+	Source   string  `json:"source" firestore:"source"`
+	SourceID string  `json:"source_id" firestore:"source_id"`
+	MBID     string  `json:"mbid" firestore:"mbid"`
+	ISRC     string  `json:"isrc" firestore:"isrc"`
+}
+
+func (t SnapshotTrack) track() occipital.Track {
+	return occipital.Track{
+		ID:       t.MBID,
+		Artist:   t.Artist,
+		Name:     t.Name,
+		SourceID: t.SourceID,
+		Source:   t.Source,
+		Image:    t.Image,
+		ISRC:     t.ISRC,
+	}
+}
+
+// Snapshotter records the default discover v2 chart. It runs on the ingest
+// schedule rather than on requests, so a day without traffic still gets a
+// snapshot.
+type Snapshotter struct {
+	log    *zap.SugaredLogger
+	fs     *firestore.Client
+	config *ConfigStore
+}
+
+func NewSnapshotter(log *zap.SugaredLogger, fs *firestore.Client, config *ConfigStore) *Snapshotter {
+	return &Snapshotter{log: log, fs: fs, config: config}
+}
+
+// Record ranks the default profile from the sources as of now and saves it
+// as now's snapshot, replacing any earlier one from the same day. A chart
+// with no tracks isn't saved.
+func (s *Snapshotter) Record(ctx context.Context, now time.Time) error {
+	cfg := s.config.Current()
+	profile, ok := cfg.Profiles[defaultProfile]
+	if !ok {
+		return fmt.Errorf("config %s has no %q profile", cfg.Version, defaultProfile)
+	}
+
+	c := collectChart(ctx, s.log, s.fs, now, profile, false)
+	c.rank(profile.Limit, false)
+	if len(c.results) == 0 {
+		return ErrNoChart
+	}
+
+	snap := snapshotFrom(now, cfg.Version, c)
+	if err := saveSnapshot(ctx, s.fs, snap); err != nil {
+		return fmt.Errorf("save snapshot %s: %w", snap.Date, err)
+	}
+	s.log.Infow("Saved discover snapshot", "date", snap.Date, "updated", snap.Updated, "trackCount", len(snap.Tracks))
+	return nil
+}
+
+func snapshotFrom(now time.Time, configVersion string, c *chart) *DiscoverSnapshot {
+	snap := &DiscoverSnapshot{
+		Date:          now.Format("2006-01-02"),
+		Updated:       c.latestDate,
+		ConfigVersion: configVersion,
+		CreatedAt:     now,
+		Tracks:        make([]SnapshotTrack, 0, len(c.results)),
+	}
+	for i, st := range c.results {
+		snap.Tracks = append(snap.Tracks, SnapshotTrack{
+			Key:      st.key,
+			Position: i + 1,
+			Score:    st.score,
+			Artist:   st.track.Artist,
+			Name:     st.track.Name,
+			Image:    st.track.Image,
+			Source:   st.source,
+			SourceID: st.track.SourceID,
+			MBID:     st.track.ID,
+			ISRC:     st.track.ISRC,
+		})
+	}
+	return snap
+}
+
+func saveSnapshot(ctx context.Context, fs *firestore.Client, snap *DiscoverSnapshot) error {
+	_, err := fs.Collection(snapshotCollection).Doc(snap.Date).Set(ctx, snap)
+	return err
+}
+
+func getSnapshot(ctx context.Context, fs *firestore.Client, date string) (*DiscoverSnapshot, error) {
+	doc, err := fs.Collection(snapshotCollection).Doc(date).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return nil, ErrSnapshotNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var snap DiscoverSnapshot
+	if err := doc.DataTo(&snap); err != nil {
+		return nil, err
+	}
+	return &snap, nil
+}
+
+// recentSnapshots returns up to n snapshots on or before date, newest first.
+func recentSnapshots(ctx context.Context, fs *firestore.Client, date string, n int) ([]*DiscoverSnapshot, error) {
+	iter := fs.Collection(snapshotCollection).
+		Where("date", "<=", date).
+		OrderBy("date", firestore.Desc).
+		Limit(n).
+		Documents(ctx)
+	defer iter.Stop()
+
+	var snaps []*DiscoverSnapshot
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		var snap DiscoverSnapshot
+		if err := doc.DataTo(&snap); err != nil {
+			return nil, err
+		}
+		snaps = append(snaps, &snap)
+	}
+	return snaps, nil
+}
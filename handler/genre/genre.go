@@ -6,21 +6,37 @@ import (
 	"fmt"
 	"net/http"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	mb "github.com/mager/musicbrainz-go/musicbrainz"
+	"github.com/mager/occipital/cache"
 	"github.com/mager/occipital/musicbrainz"
 	"github.com/mager/occipital/spotify"
 	spot "github.com/zmb3/spotify/v2"
 	"go.uber.org/zap"
 )
 
+const genreCacheCollection = "genre_cache"
+
+var genreCachePolicy = cache.Policy{
+	TTL:                  6 * time.Hour,
+	StaleWhileRevalidate: 24 * time.Hour,
+}
+
+// fallbackEnrichmentBudget bounds how long a search waits on per-track
+// MusicBrainz lookups, which are paced at 1 req/s.
+const fallbackEnrichmentBudget = 5 * time.Second
+
 // GenreHandler handles genre-based track searches
 type GenreHandler struct {
 	log               *zap.SugaredLogger
 	spotifyClient     *spotify.SpotifyClient
 	musicbrainzClient *musicbrainz.MusicbrainzClient
+	cache             *cache.Loader
 }
 
 func (*GenreHandler) Pattern() string {
@@ -28,11 +44,12 @@ func (*GenreHandler) Pattern() string {
 }
 
 // NewGenreHandler builds a new GenreHandler
-func NewGenreHandler(log *zap.SugaredLogger, spotifyClient *spotify.SpotifyClient, musicbrainzClient *musicbrainz.MusicbrainzClient) *GenreHandler {
+func NewGenreHandler(log *zap.SugaredLogger, spotifyClient *spotify.SpotifyClient, musicbrainzClient *musicbrainz.MusicbrainzClient, cache *cache.Loader) *GenreHandler {
 	return &GenreHandler{
 		log:               log,
 		spotifyClient:     spotifyClient,
 		musicbrainzClient: musicbrainzClient,
+		cache:             cache,
 	}
 }
 
@@ -70,7 +87,6 @@ type GenreTrack struct {
 // @Success 200 {object} GenreResponse
 // @Router /genre/tracks [post]
 func (h *GenreHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	ctx := context.Background()
 	var req GenreRequest
 	w.Header().Set("Content-Type", "application/json")
 
@@ -85,18 +101,52 @@ func (h *GenreHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	resp, err := h.fetch(r.Context(), req.Genre, req.Limit)
+	if err != nil {
+		h.log.Errorw("spotify search error", "error", err, "genre", req.Genre)
+		http.Error(w, "spotify search error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(resp)
+}
+
+// fetch returns the cached search for a genre.
+func (h *GenreHandler) fetch(ctx context.Context, genre string, limit int) (GenreResponse, error) {
 	// Spotify API limits: 1-50 for track search
-	if req.Limit <= 0 {
-		req.Limit = 20 // Default limit
-	} else if req.Limit > 50 {
-		req.Limit = 50 // Max limit for Spotify
+	if limit <= 0 {
+		limit = 20 // Default limit
+	} else if limit > 50 {
+		limit = 50 // Max limit for Spotify
 	}
 
-	h.log.Infow("genre search", "genre", req.Genre, "limit", req.Limit)
+	key := cache.Key(genreCacheCollection, strings.ToLower(genre), strconv.Itoa(limit))
+	return cache.Fetch(ctx, h.cache, key, genreCachePolicy, func(ctx context.Context) (GenreResponse, error) {
+		return h.searchGenre(ctx, genre, limit)
+	})
+}
+
+// GenreTrackIDs returns the Spotify IDs of a genre search, sharing the
+// handler's cache.
+func (h *GenreHandler) GenreTrackIDs(ctx context.Context, genre string, limit int) ([]string, error) {
+	resp, err := h.fetch(ctx, genre, limit)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(resp.Tracks))
+	for _, t := range resp.Tracks {
+		ids = append(ids, t.ID)
+	}
+	return ids, nil
+}
+
+// searchGenre searches Spotify for tracks in a genre and enriches them with MusicBrainz
+func (h *GenreHandler) searchGenre(ctx context.Context, genre string, limit int) (GenreResponse, error) {
+	h.log.Infow("genre search", "genre", genre, "limit", limit)
 
 	// Search Spotify for tracks by genre with better query strategy
 	var query string
-	switch strings.ToLower(req.Genre) {
+	switch strings.ToLower(genre) {
 	case "rap", "hip-hop", "hip hop":
 		// For rap/hip-hop, use a more targeted query that tends to return popular tracks
 		query = "genre:rap tag:hip-hop"
@@ -107,36 +157,33 @@ func (h *GenreHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	case "electronic", "edm":
 		query = "genre:electronic tag:electronic"
 	default:
-		query = "genre:" + req.Genre
+		query = "genre:" + genre
 	}
 
 	// Search with popularity boost - use year filter and market targeting for better results
 	searchQuery := query + " year:2020-2024"
-	results, err := h.spotifyClient.Client.Search(ctx, searchQuery, spot.SearchTypeTrack, spot.Limit(req.Limit), spot.Market("US"))
+	results, err := h.spotifyClient.Client.Search(ctx, searchQuery, spot.SearchTypeTrack, spot.Limit(limit), spot.Market("US"))
 	if err != nil {
-		h.log.Errorw("spotify search error", "error", err, "genre", req.Genre)
-		http.Error(w, "spotify search error: "+err.Error(), http.StatusInternalServerError)
-		return
+		return GenreResponse{}, err
 	}
 
 	var resp GenreResponse
-	resp.Genre = req.Genre
+	resp.Genre = genre
 
 	if results.Tracks != nil {
-		// Collect ISRCs for bulk enrichment
+		for _, item := range results.Tracks.Tracks {
+			resp.Tracks = append(resp.Tracks, h.mapSpotifyTrack(item))
+		}
+
+		// Collect ISRCs for bulk enrichment. Pointers index into resp.Tracks
+		// so enrichment lands in the response.
 		var isrcsToEnrich []string
 		var tracksToEnrich []*GenreTrack
-
-		for i, item := range results.Tracks.Tracks {
-			track := h.mapSpotifyTrack(item)
-
-			// Only enrich the first few tracks to avoid overwhelming MusicBrainz
-			if i < 5 && track.ISRC != "" {
-				isrcsToEnrich = append(isrcsToEnrich, track.ISRC)
-				tracksToEnrich = append(tracksToEnrich, &track)
+		for i := range resp.Tracks {
+			if resp.Tracks[i].ISRC != "" {
+				isrcsToEnrich = append(isrcsToEnrich, resp.Tracks[i].ISRC)
+				tracksToEnrich = append(tracksToEnrich, &resp.Tracks[i])
 			}
-
-			resp.Tracks = append(resp.Tracks, track)
 		}
 
 		// Bulk enrich tracks with ISRCs
@@ -146,12 +193,17 @@ func (h *GenreHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			h.log.Infow("bulk enrichment completed", "tracks_enriched", enrichmentCount, "total_isrcs", len(isrcsToEnrich))
 		}
 
-		// Fallback: enrich remaining tracks without ISRCs using artist/track search
-		remainingTracks := len(resp.Tracks) - len(tracksToEnrich)
-		if remainingTracks > 0 {
-			fallbackCount := h.fallbackEnrichment(ctx, resp.Tracks[len(tracksToEnrich):])
+		// Fallback: enrich whatever the bulk search missed using artist/track search
+		var remaining []*GenreTrack
+		for i := range resp.Tracks {
+			if resp.Tracks[i].MBID == "" {
+				remaining = append(remaining, &resp.Tracks[i])
+			}
+		}
+		if len(remaining) > 0 {
+			fallbackCount := h.fallbackEnrichment(ctx, remaining)
 			enrichmentCount += fallbackCount
-			h.log.Infow("fallback enrichment completed", "tracks_enriched", fallbackCount, "total_fallback", remainingTracks)
+			h.log.Infow("fallback enrichment completed", "tracks_enriched", fallbackCount, "total_fallback", len(remaining))
 		}
 
 		// Log popularity info for debugging
@@ -168,7 +220,7 @@ func (h *GenreHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			h.log.Infow("popularity stats", "avg_popularity", avgPopularity, "max_popularity", maxPopularity, "min_popularity", resp.Tracks[len(resp.Tracks)-1].Popularity)
 		}
 
-		h.log.Infow("genre search completed", "genre", req.Genre, "total_tracks", len(resp.Tracks), "enriched_tracks", enrichmentCount, "note", "limited enrichment to respect MusicBrainz rate limits")
+		h.log.Infow("genre search completed", "genre", genre, "total_tracks", len(resp.Tracks), "enriched_tracks", enrichmentCount)
 
 		// Add a note about enrichment
 		if enrichmentCount > 0 {
@@ -181,7 +233,7 @@ func (h *GenreHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		})
 	}
 
-	json.NewEncoder(w).Encode(resp)
+	return resp, nil
 }
 
 func (h *GenreHandler) mapSpotifyTrack(t spot.FullTrack) GenreTrack {
@@ -212,17 +264,32 @@ func (h *GenreHandler) mapSpotifyTrack(t spot.FullTrack) GenreTrack {
 	return track
 }
 
+// bestRecording picks the search result that best matches track, since an
+// ISRC or a title often maps to live takes and reissues as well.
+func bestRecording(cands []musicbrainz.RecordingCandidate, track *GenreTrack) (mb.Recording, bool) {
+	m, ok := musicbrainz.Disambiguate(cands, musicbrainz.RecordingHint{
+		Artists: []string{track.Artist},
+		Title:   track.Name,
+	})
+	if !ok {
+		return mb.Recording{}, false
+	}
+	for _, c := range cands {
+		if c.ID == m.MBID {
+			return c.Recording, true
+		}
+	}
+	return mb.Recording{}, false
+}
+
 func (h *GenreHandler) enrichWithMusicBrainz(ctx context.Context, track *GenreTrack) bool {
 	// Try to find MusicBrainz data by ISRC first
 	if track.ISRC != "" {
-		mbResp, err := h.musicbrainzClient.Client.SearchRecordingsByISRC(mb.SearchRecordingsByISRCRequest{
-			ISRC: track.ISRC,
-		})
+		cands, err := h.musicbrainzClient.SearchRecordingCandidatesByISRC(ctx, track.ISRC)
 		if err != nil {
 			h.log.Debugw("MusicBrainz ISRC search failed", "isrc", track.ISRC, "error", err)
-		} else if mbResp.Count > 0 {
-			// Found by ISRC, use the first result
-			mbTrack := mbResp.Recordings[0]
+		} else if mbTrack, ok := bestRecording(cands, track); ok {
+			// Found by ISRC, use the best matching recording
 			track.MBID = mbTrack.ID
 
 			// Add MusicBrainz genres if available
@@ -247,15 +314,11 @@ func (h *GenreHandler) enrichWithMusicBrainz(ctx context.Context, track *GenreTr
 
 	// Fallback: search by artist and track name (only if we have both artist and track)
 	if track.Artist != "" && track.Name != "" {
-		mbResp, err := h.musicbrainzClient.Client.SearchRecordingsByArtistAndTrack(mb.SearchRecordingsByArtistAndTrackRequest{
-			Artist: track.Artist,
-			Track:  track.Name,
-		})
+		cands, err := h.musicbrainzClient.SearchRecordingCandidatesByArtistAndTrack(ctx, track.Artist, track.Name)
 		if err != nil {
 			h.log.Debugw("MusicBrainz artist/track search failed", "artist", track.Artist, "track", track.Name, "error", err)
-		} else if mbResp.Count > 0 {
-			// Found by artist/track, use the first result
-			mbTrack := mbResp.Recordings[0]
+		} else if mbTrack, ok := bestRecording(cands, track); ok {
+			// Found by artist/track, use the best matching recording
 			track.MBID = mbTrack.ID
 
 			// Add MusicBrainz genres if available
@@ -290,20 +353,18 @@ func (h *GenreHandler) bulkEnrichWithMusicBrainz(ctx context.Context, tracks []*
 	h.log.Infow("starting bulk enrichment", "isrcs_count", len(isrcs), "tracks_count", len(tracks))
 
 	// Use the new bulk ISRC search method
-	mbResp, err := h.musicbrainzClient.Client.SearchRecordingsByBulkISRC(mb.SearchRecordingsByBulkISRCRequest{
-		ISRCs: isrcs,
-	})
+	isrcMap, err := h.musicbrainzClient.SearchRecordingCandidatesByBulkISRC(ctx, isrcs)
 	if err != nil {
 		h.log.Warnw("bulk MusicBrainz enrichment failed", "error", err)
 		return 0
 	}
 
-	if mbResp.Count == 0 {
+	if len(isrcMap) == 0 {
 		h.log.Infow("no MusicBrainz recordings found for bulk ISRC search")
 		return 0
 	}
 
-	h.log.Infow("bulk enrichment found recordings", "recordings_count", mbResp.Count)
+	h.log.Infow("bulk enrichment found recordings", "isrcs_matched", len(isrcMap))
 
 	// Map the results back to tracks using the ISRC mapping
 	enrichedCount := 0
@@ -313,9 +374,8 @@ func (h *GenreHandler) bulkEnrichWithMusicBrainz(ctx context.Context, tracks []*
 		}
 
 		// Check if we have recordings for this ISRC
-		if recordings, exists := mbResp.ISRCMap[track.ISRC]; exists && len(recordings) > 0 {
-			// Use the first recording found
-			mbTrack := recordings[0]
+		if mbTrack, ok := bestRecording(isrcMap[track.ISRC], track); ok {
+			// Use the best matching recording
 			track.MBID = mbTrack.ID
 
 			// Add MusicBrainz genres if available
@@ -342,37 +402,33 @@ func (h *GenreHandler) bulkEnrichWithMusicBrainz(ctx context.Context, tracks []*
 	return enrichedCount
 }
 
-func (h *GenreHandler) fallbackEnrichment(ctx context.Context, tracks []GenreTrack) int {
+// fallbackEnrichment searches MusicBrainz by artist and title for each track.
+// Lookups are queued at background priority and whatever hasn't resolved
+// within fallbackEnrichmentBudget is left unenriched.
+func (h *GenreHandler) fallbackEnrichment(ctx context.Context, tracks []*GenreTrack) int {
 	if len(tracks) == 0 {
 		return 0
 	}
 
 	h.log.Infow("starting fallback enrichment", "tracks_count", len(tracks))
 
-	enrichedCount := 0
-	for i, track := range tracks {
-		// Only enrich a few tracks to avoid overwhelming MusicBrainz
-		if i >= 3 {
-			break
-		}
+	ctx, cancel := context.WithTimeout(musicbrainz.WithPriority(ctx, musicbrainz.PriorityBackground), fallbackEnrichmentBudget)
+	defer cancel()
 
-		// Use the existing individual enrichment method
-		if h.enrichWithMusicBrainz(ctx, &track) {
-			enrichedCount++
-			// Add delay to be respectful to MusicBrainz
-			time.Sleep(500 * time.Millisecond)
-		}
+	var enrichedCount atomic.Int32
+	var wg sync.WaitGroup
+	for _, track := range tracks {
+		wg.Add(1)
+		go func(track *GenreTrack) {
+			defer wg.Done()
+			if h.enrichWithMusicBrainz(ctx, track) {
+				enrichedCount.Add(1)
+			}
+		}(track)
 	}
+	wg.Wait()
 
-	h.log.Infow("fallback enrichment completed", "tracks_enriched", enrichedCount, "total_attempted", min(len(tracks), 3))
-	return enrichedCount
-}
-
-func min(a, b int) int {
-	if a < b {
-		return a
-	}
-	return b
+	return int(enrichedCount.Load())
 }
 
 func getFirstArtist(artists []spot.SimpleArtist) string {
@@ -0,0 +1,71 @@
+package graph
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/mager/occipital/collab"
+	"go.uber.org/zap"
+)
+
+// maxPathHops is how far apart two creators can be, as in six degrees of
+// separation.
+const maxPathHops = 6
+
+// PathHandler finds the chain of collaborations linking two creators.
+type PathHandler struct {
+	log   *zap.SugaredLogger
+	graph *collab.Graph
+}
+
+func (*PathHandler) Pattern() string {
+	return "/graph/path"
+}
+
+func NewPathHandler(log *zap.SugaredLogger, graph *collab.Graph) *PathHandler {
+	return &PathHandler{
+		log:   log,
+		graph: graph,
+	}
+}
+
+type PathResponse struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	// Degrees is the number of collaborations between them
+	Degrees int          `json:"degrees"`
+	Path    []collab.Hop `json:"path"`
+}
+
+// Get collaboration path
+// @Summary Get collaboration path
+// @Description Finds the shortest chain of shared recordings between two creators, up to six hops
+// @Tags Graph
+// @Produce json
+// @Param from query string true "MusicBrainz artist ID"
+// @Param to query string true "MusicBrainz artist ID"
+// @Success 200 {object} PathResponse
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /graph/path [get]
+func (h *PathHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	q := r.URL.Query()
+	from, to := q.Get("from"), q.Get("to")
+	if from == "" || to == "" {
+		http.Error(w, `{"error":"from and to are required"}`, http.StatusBadRequest)
+		return
+	}
+
+	path, ok := h.graph.Path(from, to, maxPathHops)
+	if !ok {
+		http.Error(w, `{"error":"no path found"}`, http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(PathResponse{
+		From:    from,
+		To:      to,
+		Degrees: len(path),
+		Path:    path,
+	})
+}
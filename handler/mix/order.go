@@ -0,0 +1,257 @@
+package mix
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/mager/occipital/handler/track"
+	"github.com/mager/occipital/harmonic"
+	"github.com/mager/occipital/occipital"
+	"go.uber.org/zap"
+)
+
+const (
+	maxOrderTracks = 50
+	// resolveWorkers bounds concurrent track lookups for one request.
+	resolveWorkers = 8
+)
+
+// TrackResolver resolves a Spotify ID to an enriched track. Errors wrap
+// track.ErrTrackNotFound when no source has the track.
+type TrackResolver interface {
+	Resolve(ctx context.Context, spotifyID string) (occipital.Track, error)
+}
+
+// OrderHandler orders a set of tracks for a DJ mix.
+type OrderHandler struct {
+	log    *zap.SugaredLogger
+	tracks TrackResolver
+}
+
+func (*OrderHandler) Pattern() string {
+	return "/mix/order"
+}
+
+func NewOrderHandler(log *zap.SugaredLogger, tracks TrackResolver) *OrderHandler {
+	return &OrderHandler{
+		log:    log,
+		tracks: tracks,
+	}
+}
+
+// OrderTrack is a track to place in the mix. Camelot and Tempo override
+// what Spotify detected and are required for tracks without a SpotifyID.
+type OrderTrack struct {
+	SpotifyID string  `json:"spotify_id,omitempty"`
+	Camelot   string  `json:"camelot,omitempty"`
+	Tempo     float64 `json:"tempo,omitempty"`
+}
+
+type OrderRequest struct {
+	Tracks []OrderTrack `json:"tracks"`
+	// Start, when set, is the index of the track the mix must open with
+	Start *int `json:"start,omitempty"`
+}
+
+// OrderedTrack is a track in mix order.
+type OrderedTrack struct {
+	// Index is the track's position in the request
+	Index     int     `json:"index"`
+	SpotifyID string  `json:"spotify_id,omitempty"`
+	Name      string  `json:"name,omitempty"`
+	Artist    string  `json:"artist,omitempty"`
+	Camelot   string  `json:"camelot,omitempty"`
+	KeyName   string  `json:"key_name,omitempty"`
+	Tempo     float64 `json:"tempo,omitempty"`
+}
+
+// Transition scores the move into the track at To from the one before it.
+// From and To are positions in the ordered list.
+type Transition struct {
+	From     int               `json:"from"`
+	To       int               `json:"to"`
+	Relation harmonic.Relation `json:"relation"`
+	// TempoShift is the tempo change as a fraction, after any half or double time
+	TempoShift float64 `json:"tempo_shift"`
+	KeyScore   float64 `json:"key_score"`
+	TempoScore float64 `json:"tempo_score"`
+	Score      float64 `json:"score"`
+}
+
+type OrderResponse struct {
+	Tracks      []OrderedTrack `json:"tracks"`
+	Transitions []Transition   `json:"transitions"`
+	// Score is the mean transition score
+	Score float64 `json:"score"`
+}
+
+func (req *OrderRequest) validate() error {
+	if len(req.Tracks) < 2 {
+		return errors.New("tracks must have at least 2 entries")
+	}
+	if len(req.Tracks) > maxOrderTracks {
+		return fmt.Errorf("tracks must have at most %d entries", maxOrderTracks)
+	}
+	if req.Start != nil && (*req.Start < 0 || *req.Start >= len(req.Tracks)) {
+		return errors.New("start must be the index of a track")
+	}
+	for i, t := range req.Tracks {
+		if t.Camelot != "" {
+			if _, err := harmonic.ParseCamelot(t.Camelot); err != nil {
+				return fmt.Errorf("tracks[%d]: %w", i, err)
+			}
+		}
+		if t.Tempo < 0 {
+			return fmt.Errorf("tracks[%d]: tempo must be positive", i)
+		}
+		if t.SpotifyID == "" && (t.Camelot == "" || t.Tempo == 0) {
+			return fmt.Errorf("tracks[%d]: spotify_id, or camelot and tempo, required", i)
+		}
+	}
+	return nil
+}
+
+// Order a mix
+// @Summary Order tracks for a mix
+// @Description Orders tracks to minimize key clashes and tempo jumps, scoring each transition
+// @Tags Mix
+// @Accept json
+// @Produce json
+// @Param request body OrderRequest true "Tracks"
+// @Success 200 {object} OrderResponse
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 502 {object} map[string]string
+// @Router /mix/order [post]
+func (h *OrderHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var req OrderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error":"invalid request body"}`, http.StatusBadRequest)
+		return
+	}
+	if err := req.validate(); err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	tracks, missing, err := h.resolve(r.Context(), req.Tracks)
+	switch {
+	case len(missing) > 0:
+		http.Error(w, fmt.Sprintf(`{"error":%q}`, "tracks not found: "+strings.Join(missing, ", ")), http.StatusNotFound)
+		return
+	case err != nil:
+		// Whether the tracks exist isn't known
+		http.Error(w, `{"error":"track source unavailable"}`, http.StatusBadGateway)
+		return
+	}
+
+	mixTracks := make([]harmonic.Track, len(tracks))
+	for i, t := range tracks {
+		mixTracks[i] = harmonic.Track{Key: t.key, Tempo: t.Tempo}
+	}
+	start := -1
+	if req.Start != nil {
+		start = *req.Start
+	}
+	order := harmonic.Order(mixTracks, start)
+
+	resp := OrderResponse{
+		Tracks:      make([]OrderedTrack, len(order)),
+		Transitions: make([]Transition, 0, len(order)-1),
+	}
+	for pos, idx := range order {
+		resp.Tracks[pos] = tracks[idx].OrderedTrack
+		if pos == 0 {
+			continue
+		}
+		t := harmonic.Transit(mixTracks[order[pos-1]], mixTracks[idx])
+		resp.Transitions = append(resp.Transitions, Transition{
+			From:       pos - 1,
+			To:         pos,
+			Relation:   t.Relation,
+			TempoShift: t.TempoShift,
+			KeyScore:   t.KeyScore,
+			TempoScore: t.TempoScore,
+			Score:      t.Score,
+		})
+		resp.Score += t.Score
+	}
+	resp.Score /= float64(len(resp.Transitions))
+
+	json.NewEncoder(w).Encode(resp)
+}
+
+type resolvedTrack struct {
+	OrderedTrack
+	key harmonic.Key
+}
+
+// resolve looks up key and tempo for tracks that didn't supply both. It
+// returns the Spotify IDs no source has, and an error if any other lookup
+// failed.
+func (h *OrderHandler) resolve(ctx context.Context, in []OrderTrack) ([]resolvedTrack, []string, error) {
+	out := make([]resolvedTrack, len(in))
+	errs := make([]error, len(in))
+
+	sem := make(chan struct{}, resolveWorkers)
+	var wg sync.WaitGroup
+	for i, t := range in {
+		out[i].Index = i
+		out[i].SpotifyID = t.SpotifyID
+		out[i].Tempo = t.Tempo
+		if t.Camelot != "" {
+			out[i].key, _ = harmonic.ParseCamelot(t.Camelot)
+		}
+		if t.SpotifyID == "" {
+			continue
+		}
+
+		wg.Add(1)
+		go func(rt *resolvedTrack) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			t, err := h.tracks.Resolve(ctx, rt.SpotifyID)
+			if err != nil {
+				h.log.Warnw("Failed to resolve mix track", "spotify_id", rt.SpotifyID, "err", err)
+				errs[rt.Index] = err
+				return
+			}
+			rt.Name = t.Name
+			rt.Artist = t.Artist
+			if t.Meta != nil && t.Meta.Tempo > 0 {
+				if !rt.key.Known() {
+					rt.key = harmonic.FromPitch(t.Meta.Key, t.Meta.Mode)
+				}
+				if rt.Tempo == 0 {
+					rt.Tempo = float64(t.Meta.Tempo)
+				}
+			}
+		}(&out[i])
+	}
+	wg.Wait()
+
+	var missing []string
+	for i, err := range errs {
+		if errors.Is(err, track.ErrTrackNotFound) {
+			missing = append(missing, in[i].SpotifyID)
+			errs[i] = nil
+		}
+	}
+	if err := errors.Join(errs...); err != nil || len(missing) > 0 {
+		return nil, missing, err
+	}
+	for i := range out {
+		out[i].Camelot = out[i].key.Camelot()
+		out[i].KeyName = out[i].key.Name()
+	}
+	return out, nil, nil
+}
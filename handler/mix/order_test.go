@@ -0,0 +1,110 @@
+package mix
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mager/occipital/handler/track"
+	"github.com/mager/occipital/occipital"
+	"go.uber.org/zap"
+)
+
+// fakeTracks resolves the IDs it has and fails the rest with their error.
+type fakeTracks struct {
+	tracks map[string]occipital.Track
+	errs   map[string]error
+}
+
+func (f fakeTracks) Resolve(_ context.Context, id string) (occipital.Track, error) {
+	if err, ok := f.errs[id]; ok {
+		return occipital.Track{}, err
+	}
+	return f.tracks[id], nil
+}
+
+func TestOrderResolveErrors(t *testing.T) {
+	tracks := fakeTracks{
+		tracks: map[string]occipital.Track{
+			// C major and A minor, 8B and 8A
+			"c-major": {Name: "C", Meta: &occipital.TrackMeta{Key: 0, Mode: 1, Tempo: 124}},
+			"a-minor": {Name: "Am", Meta: &occipital.TrackMeta{Key: 9, Mode: 0, Tempo: 124}},
+		},
+		errs: map[string]error{
+			"missing":  fmt.Errorf("resolve: %w", track.ErrTrackNotFound),
+			"upstream": fmt.Errorf("%w: spotify 503", track.ErrTrackUpstream),
+		},
+	}
+
+	tests := []struct {
+		name   string
+		ids    []string
+		status int
+		body   string
+	}{
+		{"resolved", []string{"c-major", "a-minor"}, http.StatusOK, ""},
+		{"not found", []string{"c-major", "missing"}, http.StatusNotFound, "tracks not found: missing"},
+		{"upstream down", []string{"c-major", "upstream"}, http.StatusBadGateway, "track source unavailable"},
+		// The missing track fails the request however often it's retried
+		{"both", []string{"upstream", "missing"}, http.StatusNotFound, "tracks not found: missing"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var req OrderRequest
+			for _, id := range tt.ids {
+				req.Tracks = append(req.Tracks, OrderTrack{SpotifyID: id})
+			}
+			body, _ := json.Marshal(req)
+
+			h := NewOrderHandler(zap.NewNop().Sugar(), tracks)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/mix/order", strings.NewReader(string(body))))
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			if tt.status != http.StatusOK {
+				var resp map[string]string
+				json.NewDecoder(w.Body).Decode(&resp)
+				if resp["error"] != tt.body {
+					t.Errorf("error = %q, want %q", resp["error"], tt.body)
+				}
+				return
+			}
+
+			var resp OrderResponse
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+			if len(resp.Transitions) != 1 || resp.Transitions[0].Relation != "relative" {
+				t.Errorf("transitions = %+v, want one relative move", resp.Transitions)
+			}
+			for _, tr := range resp.Tracks {
+				if tr.Camelot != "8A" && tr.Camelot != "8B" {
+					t.Errorf("track %s camelot = %q", tr.SpotifyID, tr.Camelot)
+				}
+			}
+		})
+	}
+}
+
+func TestOrderRequestValidate(t *testing.T) {
+	start := 5
+	tests := []struct {
+		name string
+		req  OrderRequest
+	}{
+		{"one track", OrderRequest{Tracks: []OrderTrack{{SpotifyID: "a"}}}},
+		{"start out of range", OrderRequest{Tracks: []OrderTrack{{SpotifyID: "a"}, {SpotifyID: "b"}}, Start: &start}},
+		{"bad camelot", OrderRequest{Tracks: []OrderTrack{{SpotifyID: "a"}, {SpotifyID: "b", Camelot: "13A"}}}},
+		{"no id, no tempo", OrderRequest{Tracks: []OrderTrack{{SpotifyID: "a"}, {Camelot: "8A"}}}},
+	}
+	for _, tt := range tests {
+		if err := tt.req.validate(); err == nil {
+			t.Errorf("%s: validate() succeeded", tt.name)
+		}
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"net/http"
 
+	"github.com/mager/occipital/auth"
 	"github.com/mager/occipital/database"
 	"go.uber.org/zap"
 )
@@ -34,19 +35,20 @@ type ProfileResponse struct {
 }
 
 // GetProfile godoc
-// @Summary Get profile by ID
-// @Description Get profile details by user ID
+// @Summary Get profile
+// @Description Get the authenticated user's profile
 // @Accept json
 // @Produce json
-// @Param id query string true "User ID"
+// @Security BearerAuth
 // @Success 200 {object} ProfileResponse
 // @Router /profile [get]
 func (h *ProfileHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	userID := r.URL.Query().Get("id")
-	if userID == "" {
-		w.WriteHeader(http.StatusBadRequest)
+	p, ok := auth.FromContext(r.Context())
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
 		return
 	}
+	userID := p.UserID
 
 	query := `
         SELECT id, username
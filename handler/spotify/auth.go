@@ -3,29 +3,29 @@ package spotify
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
+	"strings"
 	"time"
 
 	"cloud.google.com/go/firestore"
+	"github.com/mager/occipital/auth"
 	"github.com/mager/occipital/config"
+	"github.com/mager/occipital/spotify"
 	spot "github.com/zmb3/spotify/v2"
 	spotifyauth "github.com/zmb3/spotify/v2/auth"
 	"go.uber.org/zap"
 	"golang.org/x/oauth2"
 )
 
-// SpotifyToken is stored in Firestore per user.
-type SpotifyToken struct {
-	AccessToken  string `json:"access_token" firestore:"access_token"`
-	RefreshToken string `json:"refresh_token" firestore:"refresh_token"`
-	TokenType    string `json:"token_type" firestore:"token_type"`
-	Expiry       int64  `json:"expiry" firestore:"expiry"`
-}
-
 var userScopes = []string{
 	spotifyauth.ScopeUserReadPlaybackState,
 	spotifyauth.ScopeUserModifyPlaybackState,
 	spotifyauth.ScopeUserReadCurrentlyPlaying,
+	spotifyauth.ScopeUserTopRead,
+	spotifyauth.ScopeUserReadRecentlyPlayed,
+	spotifyauth.ScopePlaylistModifyPublic,
+	spotifyauth.ScopePlaylistModifyPrivate,
 }
 
 func newAuthenticator(cfg config.Config) *spotifyauth.Authenticator {
@@ -41,25 +41,48 @@ func newAuthenticator(cfg config.Config) *spotifyauth.Authenticator {
 
 // AuthLoginHandler redirects the user to Spotify's OAuth consent screen.
 type AuthLoginHandler struct {
-	log  *zap.SugaredLogger
-	auth *spotifyauth.Authenticator
+	log    *zap.SugaredLogger
+	auth   *spotifyauth.Authenticator
+	logins loginStore
+	key    []byte
 }
 
 func (*AuthLoginHandler) Pattern() string {
 	return "/auth/spotify"
 }
 
-func NewAuthLoginHandler(log *zap.SugaredLogger, cfg config.Config) *AuthLoginHandler {
-	return &AuthLoginHandler{log: log, auth: newAuthenticator(cfg)}
+func NewAuthLoginHandler(log *zap.SugaredLogger, cfg config.Config, fs *firestore.Client) *AuthLoginHandler {
+	return &AuthLoginHandler{log: log, auth: newAuthenticator(cfg), logins: newLoginStore(fs), key: stateKey(cfg)}
 }
 
+type AuthLoginResponse struct {
+	URL string `json:"url"`
+}
+
+// ServeHTTP starts a connect flow for the authenticated user. Browsers are
+// redirected; API clients that accept JSON get the URL to open instead,
+// since a navigation can't carry their bearer token.
 func (h *AuthLoginHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	userID := r.URL.Query().Get("user_id")
-	if userID == "" {
-		http.Error(w, `{"error":"missing user_id"}`, http.StatusBadRequest)
+	p, ok := auth.FromContext(r.Context())
+	if !ok {
+		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+
+	verifier := oauth2.GenerateVerifier()
+	state, err := issueState(r.Context(), h.logins, h.key, p.UserID, verifier)
+	if err != nil {
+		h.log.Errorw("Failed to issue OAuth state", "error", err, "user_id", p.UserID)
+		http.Error(w, `{"error":"failed to start spotify login"}`, http.StatusInternalServerError)
+		return
+	}
+
+	url := h.auth.AuthURL(state, oauth2.S256ChallengeOption(verifier))
+	if strings.Contains(r.Header.Get("Accept"), "application/json") {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(AuthLoginResponse{URL: url})
 		return
 	}
-	url := h.auth.AuthURL(userID)
 	http.Redirect(w, r, url, http.StatusTemporaryRedirect)
 }
 
@@ -67,89 +90,198 @@ func (h *AuthLoginHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 // AuthCallbackHandler exchanges the OAuth code for tokens and stores them.
 type AuthCallbackHandler struct {
-	log  *zap.SugaredLogger
-	auth *spotifyauth.Authenticator
-	fs   *firestore.Client
+	log    *zap.SugaredLogger
+	auth   *spotifyauth.Authenticator
+	logins loginStore
+	tokens spotify.TokenStore
+	key    []byte
 }
 
 func (*AuthCallbackHandler) Pattern() string {
 	return "/auth/spotify/callback"
 }
 
-func NewAuthCallbackHandler(log *zap.SugaredLogger, cfg config.Config, fs *firestore.Client) *AuthCallbackHandler {
-	return &AuthCallbackHandler{log: log, auth: newAuthenticator(cfg), fs: fs}
+func NewAuthCallbackHandler(log *zap.SugaredLogger, cfg config.Config, fs *firestore.Client, tokens spotify.TokenStore) *AuthCallbackHandler {
+	return &AuthCallbackHandler{log: log, auth: newAuthenticator(cfg), logins: newLoginStore(fs), tokens: tokens, key: stateKey(cfg)}
+}
+
+// AuthErrorResponse is returned when the connect flow fails.
+// Code is stable and safe for clients to switch on.
+type AuthErrorResponse struct {
+	Error string `json:"error"`
+	Code  string `json:"code"`
 }
 
 func (h *AuthCallbackHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	ctx := context.Background()
+	ctx := r.Context()
+	w.Header().Set("Content-Type", "application/json")
 
-	userID := r.URL.Query().Get("state")
-	if userID == "" {
-		http.Error(w, `{"error":"missing state"}`, http.StatusBadRequest)
+	state := r.URL.Query().Get("state")
+	if state == "" {
+		writeAuthError(w, http.StatusBadRequest, "missing state", "state_missing")
 		return
 	}
 
-	token, err := h.auth.Token(ctx, userID, r)
+	login, err := consumeState(ctx, h.logins, h.key, state)
 	if err != nil {
-		h.log.Errorw("Failed to exchange Spotify token", "error", err)
-		http.Error(w, `{"error":"token exchange failed"}`, http.StatusInternalServerError)
+		h.log.Warnw("Rejected OAuth state", "error", err)
+		switch {
+		case errors.Is(err, ErrStateForged):
+			writeAuthError(w, http.StatusBadRequest, "invalid state", "state_forged")
+		case errors.Is(err, ErrStateExpired):
+			writeAuthError(w, http.StatusBadRequest, "login expired, please try again", "state_expired")
+		case errors.Is(err, ErrStateReplayed):
+			writeAuthError(w, http.StatusConflict, "login already completed", "state_replayed")
+		default:
+			writeAuthError(w, http.StatusInternalServerError, "failed to verify state", "state_error")
+		}
 		return
 	}
 
-	if err := storeToken(ctx, h.fs, userID, token); err != nil {
+	token, err := h.auth.Token(ctx, state, r, oauth2.VerifierOption(login.Verifier))
+	if err != nil {
+		h.log.Errorw("Failed to exchange Spotify token", "error", err, "user_id", login.UserID)
+		writeAuthError(w, http.StatusBadGateway, "token exchange failed", "token_exchange_failed")
+		return
+	}
+
+	err = h.tokens.Put(ctx, login.UserID, &spotify.StoredToken{
+		Token:  token,
+		Scopes: grantedScopes(token),
+	})
+	if err != nil {
 		h.log.Errorw("Failed to store token", "error", err)
-		http.Error(w, `{"error":"failed to store token"}`, http.StatusInternalServerError)
+		writeAuthError(w, http.StatusInternalServerError, "failed to store token", "token_store_failed")
 		return
 	}
 
-	h.log.Infow("Spotify account connected", "user_id", userID)
+	h.log.Infow("Spotify account connected", "user_id", login.UserID)
 
-	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{
 		"status":  "connected",
-		"user_id": userID,
+		"user_id": login.UserID,
 	})
 }
 
-// --- Token Helpers ---
+func writeAuthError(w http.ResponseWriter, status int, msg, code string) {
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(AuthErrorResponse{Error: msg, Code: code})
+}
+
+// --- Disconnect Handler ---
+
+// DisconnectHandler forgets the user's Spotify tokens. Spotify has no token
+// revocation endpoint; users can also remove the app from their account page.
+type DisconnectHandler struct {
+	log    *zap.SugaredLogger
+	tokens spotify.TokenStore
+}
+
+func (*DisconnectHandler) Pattern() string {
+	return "/auth/spotify"
+}
+
+func NewDisconnectHandler(log *zap.SugaredLogger, tokens spotify.TokenStore) *DisconnectHandler {
+	return &DisconnectHandler{log: log, tokens: tokens}
+}
+
+func (h *DisconnectHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
 
-func storeToken(ctx context.Context, fs *firestore.Client, userID string, token *oauth2.Token) error {
-	st := SpotifyToken{
-		AccessToken:  token.AccessToken,
-		RefreshToken: token.RefreshToken,
-		TokenType:    token.TokenType,
-		Expiry:       token.Expiry.Unix(),
+	p, ok := auth.FromContext(r.Context())
+	if !ok {
+		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+
+	if err := h.tokens.Delete(r.Context(), p.UserID); err != nil {
+		h.log.Errorw("Failed to delete Spotify token", "error", err, "user_id", p.UserID)
+		http.Error(w, `{"error":"failed to disconnect spotify"}`, http.StatusInternalServerError)
+		return
 	}
-	_, err := fs.Collection("spotify_tokens").Doc(userID).Set(ctx, st)
-	return err
+
+	h.log.Infow("Spotify account disconnected", "user_id", p.UserID)
+	json.NewEncoder(w).Encode(map[string]string{"status": "disconnected"})
+}
+
+// --- Status Handler ---
+
+// AuthStatusHandler reports whether the user has connected Spotify.
+type AuthStatusHandler struct {
+	log    *zap.SugaredLogger
+	tokens spotify.TokenStore
 }
 
-func loadToken(ctx context.Context, fs *firestore.Client, userID string) (*oauth2.Token, error) {
-	doc, err := fs.Collection("spotify_tokens").Doc(userID).Get(ctx)
+func (*AuthStatusHandler) Pattern() string {
+	return "/auth/spotify/status"
+}
+
+func NewAuthStatusHandler(log *zap.SugaredLogger, tokens spotify.TokenStore) *AuthStatusHandler {
+	return &AuthStatusHandler{log: log, tokens: tokens}
+}
+
+type AuthStatusResponse struct {
+	Connected bool     `json:"connected"`
+	Scopes    []string `json:"scopes,omitempty"`
+	// ExpiresAt is when the current access token expires. It is refreshed
+	// automatically on the next Spotify call.
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+}
+
+func (h *AuthStatusHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	p, ok := auth.FromContext(r.Context())
+	if !ok {
+		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+
+	st, err := h.tokens.Get(r.Context(), p.UserID)
+	if errors.Is(err, spotify.ErrTokenNotFound) {
+		json.NewEncoder(w).Encode(AuthStatusResponse{Connected: false})
+		return
+	}
 	if err != nil {
-		return nil, err
+		h.log.Errorw("Failed to load Spotify token", "error", err, "user_id", p.UserID)
+		http.Error(w, `{"error":"failed to load spotify connection"}`, http.StatusInternalServerError)
+		return
 	}
-	var st SpotifyToken
-	if err := doc.DataTo(&st); err != nil {
-		return nil, err
+
+	resp := AuthStatusResponse{
+		Connected: true,
+		Scopes:    st.Scopes,
+	}
+	if !st.Token.Expiry.IsZero() {
+		resp.ExpiresAt = &st.Token.Expiry
+	}
+	if !st.UpdatedAt.IsZero() {
+		resp.UpdatedAt = &st.UpdatedAt
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+// --- Token Helpers ---
+
+// grantedScopes returns the scopes Spotify granted with a token, falling
+// back to the ones we asked for.
+func grantedScopes(token *oauth2.Token) []string {
+	if scope, ok := token.Extra("scope").(string); ok && scope != "" {
+		return strings.Fields(scope)
 	}
-	return &oauth2.Token{
-		AccessToken:  st.AccessToken,
-		RefreshToken: st.RefreshToken,
-		TokenType:    st.TokenType,
-		Expiry:       time.Unix(st.Expiry, 0),
-	}, nil
+	return userScopes
 }
 
-// getUserSpotifyClient creates a per-user Spotify client from stored OAuth tokens.
-// The underlying oauth2 transport handles token refresh automatically.
-func getUserSpotifyClient(ctx context.Context, cfg config.Config, fs *firestore.Client, userID string) (*spot.Client, error) {
-	token, err := loadToken(ctx, fs, userID)
+// getUserSpotifyClient creates a per-user Spotify client from stored OAuth
+// tokens. Refreshed tokens are written back to the store.
+func getUserSpotifyClient(ctx context.Context, log *zap.SugaredLogger, cfg config.Config, tokens spotify.TokenStore, userID string) (*spot.Client, error) {
+	st, err := tokens.Get(ctx, userID)
 	if err != nil {
 		return nil, err
 	}
 
-	auth := newAuthenticator(cfg)
-	httpClient := auth.Client(ctx, token)
-	return spot.New(httpClient), nil
+	authenticator := newAuthenticator(cfg)
+	src := spotify.NewPersistingTokenSource(ctx, log, tokens, userID, st, authenticator.RefreshToken)
+	return spot.New(oauth2.NewClient(ctx, src)), nil
 }
@@ -1,47 +1,227 @@
 package spotify
 
 import (
-	"context"
 	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
+	"strings"
 
-	"cloud.google.com/go/firestore"
+	"github.com/mager/occipital/auth"
 	"github.com/mager/occipital/config"
+	"github.com/mager/occipital/occipital"
+	"github.com/mager/occipital/spotify"
 	spot "github.com/zmb3/spotify/v2"
 	"go.uber.org/zap"
 )
 
+var (
+	// ErrNoActiveDevice is returned when a command has no device to target.
+	ErrNoActiveDevice = errors.New("no active spotify device")
+	// ErrDeviceNotFound is returned when device_id doesn't name one of the user's devices.
+	ErrDeviceNotFound = errors.New("spotify device not found")
+	// ErrPremiumRequired is returned when the user's account can't be remote controlled.
+	ErrPremiumRequired = errors.New("spotify premium required")
+)
+
+// PlaybackErrorResponse is returned by all playback endpoints. Code is stable
+// for clients to branch on: "no_active_device", "device_not_found",
+// "premium_required", "spotify_not_connected", "rate_limited",
+// "invalid_request" or "playback_failed".
+type PlaybackErrorResponse struct {
+	Error string `json:"error"`
+	Code  string `json:"code"`
+}
+
+func writePlaybackError(w http.ResponseWriter, status int, msg, code string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(PlaybackErrorResponse{Error: msg, Code: code})
+}
+
+// playerError maps Spotify's player failures onto our errors. Spotify tells
+// them apart by a "reason" field the client library drops, so match on the
+// message instead.
+func playerError(err error) error {
+	var spotErr spot.Error
+	if !errors.As(err, &spotErr) {
+		return err
+	}
+	msg := strings.ToLower(spotErr.Message)
+	switch {
+	case strings.Contains(msg, "no active device"):
+		return ErrNoActiveDevice
+	case strings.Contains(msg, "device not found"):
+		return ErrDeviceNotFound
+	case strings.Contains(msg, "premium required"):
+		return ErrPremiumRequired
+	}
+	return err
+}
+
+// playback holds what every playback handler needs.
+type playback struct {
+	log    *zap.SugaredLogger
+	cfg    config.Config
+	tokens spotify.TokenStore
+}
+
+// client returns the caller's Spotify client. When it can't, it has already
+// written the error response.
+func (pb *playback) client(w http.ResponseWriter, r *http.Request) (*spot.Client, *auth.Principal, bool) {
+	p, ok := auth.FromContext(r.Context())
+	if !ok {
+		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		return nil, nil, false
+	}
+
+	client, err := getUserSpotifyClient(r.Context(), pb.log, pb.cfg, pb.tokens, p.UserID)
+	if errors.Is(err, spotify.ErrTokenNotFound) {
+		writePlaybackError(w, http.StatusUnauthorized, "spotify not connected for this user", "spotify_not_connected")
+		return nil, nil, false
+	}
+	if err != nil {
+		pb.log.Errorw("Failed to get user Spotify client", "error", err, "user_id", p.UserID)
+		writePlaybackError(w, http.StatusInternalServerError, "failed to load spotify connection", "playback_failed")
+		return nil, nil, false
+	}
+	return client, p, true
+}
+
+// fail writes the response for a failed player command.
+func (pb *playback) fail(w http.ResponseWriter, p *auth.Principal, action string, err error) {
+	err = playerError(err)
+	var spotErr spot.Error
+	switch {
+	case errors.Is(err, ErrNoActiveDevice):
+		writePlaybackError(w, http.StatusConflict, "no active device; start Spotify on a device or pass device_id", "no_active_device")
+	case errors.Is(err, ErrDeviceNotFound):
+		writePlaybackError(w, http.StatusNotFound, "device not found", "device_not_found")
+	case errors.Is(err, ErrPremiumRequired):
+		writePlaybackError(w, http.StatusForbidden, "spotify premium is required for playback control", "premium_required")
+	case isRevoked(err):
+		writePlaybackError(w, http.StatusUnauthorized, "spotify authorization revoked; reconnect spotify", "spotify_not_connected")
+	case errors.As(err, &spotErr) && spotErr.Status == http.StatusTooManyRequests:
+		writePlaybackError(w, http.StatusTooManyRequests, "spotify rate limit reached", "rate_limited")
+	case errors.As(err, &spotErr) && spotErr.Status == http.StatusBadRequest:
+		writePlaybackError(w, http.StatusBadRequest, spotErr.Message, "invalid_request")
+	default:
+		pb.log.Errorw("Playback command failed", "error", err, "action", action, "user_id", p.UserID)
+		writePlaybackError(w, http.StatusBadGateway, action+" failed", "playback_failed")
+		return
+	}
+	pb.log.Infow("Playback command rejected", "error", err, "action", action, "user_id", p.UserID)
+}
+
+// decodeOptional decodes a JSON body that may be empty.
+func decodeOptional(r *http.Request, v any) error {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	return nil
+}
+
+// DeviceRequest targets a specific device; the active one is used otherwise.
+type DeviceRequest struct {
+	DeviceID string `json:"device_id,omitempty"`
+}
+
+func (d DeviceRequest) options() *spot.PlayOptions {
+	opts := &spot.PlayOptions{}
+	if d.DeviceID != "" {
+		id := spot.ID(d.DeviceID)
+		opts.DeviceID = &id
+	}
+	return opts
+}
+
+type PlaybackResponse struct {
+	Status   string `json:"status"`
+	DeviceID string `json:"device_id,omitempty"`
+}
+
 // --- Play Handler ---
 
-// PlayHandler starts playback of a track on the user's active Spotify device.
+// PlayHandler starts playback on the user's active Spotify device: a track,
+// a context (album, playlist or artist), or whatever was paused.
 type PlayHandler struct {
-	log *zap.SugaredLogger
-	cfg config.Config
-	fs  *firestore.Client
+	playback
 }
 
 func (*PlayHandler) Pattern() string {
 	return "/spotify/play"
 }
 
-func NewPlayHandler(log *zap.SugaredLogger, cfg config.Config, fs *firestore.Client) *PlayHandler {
-	return &PlayHandler{log: log, cfg: cfg, fs: fs}
+func NewPlayHandler(log *zap.SugaredLogger, cfg config.Config, tokens spotify.TokenStore) *PlayHandler {
+	return &PlayHandler{playback{log: log, cfg: cfg, tokens: tokens}}
 }
 
 type PlayRequest struct {
-	UserID   string `json:"user_id"`
-	TrackID  string `json:"track_id"`            // Spotify track ID (e.g. "6rqhFgbbKwnb9MLmUQDhG6")
-	DeviceID string `json:"device_id,omitempty"`  // Optional: target a specific device
+	TrackID    string      `json:"track_id,omitempty"`    // Spotify track ID (e.g. "6rqhFgbbKwnb9MLmUQDhG6")
+	ContextURI string      `json:"context_uri,omitempty"` // e.g. "spotify:album:1DFixLWuPkv3KT3TnV35m3"
+	Offset     *PlayOffset `json:"offset,omitempty"`      // Where to start within an album or playlist
+	PositionMs int         `json:"position_ms,omitempty"`
+	DeviceRequest
+}
+
+// PlayOffset picks the first track by zero-based position or by track URI.
+type PlayOffset struct {
+	Position *int   `json:"position,omitempty"`
+	URI      string `json:"uri,omitempty"`
 }
 
 type PlayResponse struct {
-	Status   string `json:"status"`
-	TrackID  string `json:"track_id"`
-	DeviceID string `json:"device_id,omitempty"`
+	Status     string `json:"status"`
+	TrackID    string `json:"track_id,omitempty"`
+	ContextURI string `json:"context_uri,omitempty"`
+	DeviceID   string `json:"device_id,omitempty"`
+}
+
+// validate checks the request and reports what's wrong with it.
+func (req PlayRequest) validate() string {
+	if req.TrackID != "" && req.ContextURI != "" {
+		return "track_id and context_uri are mutually exclusive"
+	}
+	if req.ContextURI != "" {
+		kind, ok := contextKind(req.ContextURI)
+		if !ok {
+			return "context_uri must be a spotify album, playlist or artist URI"
+		}
+		if req.Offset != nil && kind == "artist" {
+			return "offset is not supported for artist contexts"
+		}
+	}
+	if req.Offset != nil {
+		if req.ContextURI == "" {
+			return "offset requires context_uri"
+		}
+		if (req.Offset.Position == nil) == (req.Offset.URI == "") {
+			return "offset needs exactly one of position or uri"
+		}
+		if req.Offset.Position != nil && *req.Offset.Position < 0 {
+			return "offset position can't be negative"
+		}
+	}
+	if req.PositionMs < 0 {
+		return "position_ms can't be negative"
+	}
+	return ""
+}
+
+// contextKind returns the type of a spotify:<kind>:<id> context URI.
+func contextKind(uri string) (string, bool) {
+	parts := strings.Split(uri, ":")
+	if len(parts) != 3 || parts[0] != "spotify" || parts[2] == "" {
+		return "", false
+	}
+	switch parts[1] {
+	case "album", "playlist", "artist":
+		return parts[1], true
+	}
+	return "", false
 }
 
 func (h *PlayHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	ctx := context.Background()
 	w.Header().Set("Content-Type", "application/json")
 
 	if r.Method != http.MethodPost {
@@ -49,46 +229,47 @@ func (h *PlayHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// An empty body resumes playback
 	var req PlayRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+	if err := decodeOptional(r, &req); err != nil {
 		http.Error(w, `{"error":"invalid request body"}`, http.StatusBadRequest)
 		return
 	}
-
-	if req.UserID == "" || req.TrackID == "" {
-		http.Error(w, `{"error":"user_id and track_id are required"}`, http.StatusBadRequest)
+	if msg := req.validate(); msg != "" {
+		writePlaybackError(w, http.StatusBadRequest, msg, "invalid_request")
 		return
 	}
 
-	client, err := getUserSpotifyClient(ctx, h.cfg, h.fs, req.UserID)
-	if err != nil {
-		h.log.Errorw("Failed to get user Spotify client", "error", err, "user_id", req.UserID)
-		http.Error(w, `{"error":"spotify not connected for this user"}`, http.StatusUnauthorized)
+	client, p, ok := h.client(w, r)
+	if !ok {
 		return
 	}
 
-	trackURI := spot.URI("spotify:track:" + req.TrackID)
-	opts := &spot.PlayOptions{
-		URIs: []spot.URI{trackURI},
+	opts := req.options()
+	opts.PositionMs = spot.Numeric(req.PositionMs)
+	if req.TrackID != "" {
+		opts.URIs = []spot.URI{spot.URI("spotify:track:" + req.TrackID)}
 	}
-
-	if req.DeviceID != "" {
-		deviceID := spot.ID(req.DeviceID)
-		opts.DeviceID = &deviceID
+	if req.ContextURI != "" {
+		uri := spot.URI(req.ContextURI)
+		opts.PlaybackContext = &uri
+	}
+	if req.Offset != nil {
+		opts.PlaybackOffset = &spot.PlaybackOffset{Position: req.Offset.Position, URI: spot.URI(req.Offset.URI)}
 	}
 
-	if err := client.PlayOpt(ctx, opts); err != nil {
-		h.log.Errorw("Failed to start playback", "error", err, "track_id", req.TrackID)
-		http.Error(w, `{"error":"playback failed: `+err.Error()+`"}`, http.StatusInternalServerError)
+	if err := client.PlayOpt(r.Context(), opts); err != nil {
+		h.fail(w, p, "playback", err)
 		return
 	}
 
-	h.log.Infow("Playback started", "user_id", req.UserID, "track_id", req.TrackID)
+	h.log.Infow("Playback started", "user_id", p.UserID, "track_id", req.TrackID, "context_uri", req.ContextURI)
 
 	json.NewEncoder(w).Encode(PlayResponse{
-		Status:   "playing",
-		TrackID:  req.TrackID,
-		DeviceID: req.DeviceID,
+		Status:     "playing",
+		TrackID:    req.TrackID,
+		ContextURI: req.ContextURI,
+		DeviceID:   req.DeviceID,
 	})
 }
 
@@ -96,26 +277,20 @@ func (h *PlayHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 // PauseHandler pauses the user's current Spotify playback.
 type PauseHandler struct {
-	log *zap.SugaredLogger
-	cfg config.Config
-	fs  *firestore.Client
+	playback
 }
 
 func (*PauseHandler) Pattern() string {
 	return "/spotify/pause"
 }
 
-func NewPauseHandler(log *zap.SugaredLogger, cfg config.Config, fs *firestore.Client) *PauseHandler {
-	return &PauseHandler{log: log, cfg: cfg, fs: fs}
+func NewPauseHandler(log *zap.SugaredLogger, cfg config.Config, tokens spotify.TokenStore) *PauseHandler {
+	return &PauseHandler{playback{log: log, cfg: cfg, tokens: tokens}}
 }
 
-type PauseRequest struct {
-	UserID   string `json:"user_id"`
-	DeviceID string `json:"device_id,omitempty"`
-}
+type PauseRequest = DeviceRequest
 
 func (h *PauseHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	ctx := context.Background()
 	w.Header().Set("Content-Type", "application/json")
 
 	if r.Method != http.MethodPut {
@@ -123,47 +298,437 @@ func (h *PauseHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// The body is optional now that the user comes from the token
 	var req PauseRequest
+	if err := decodeOptional(r, &req); err != nil {
+		http.Error(w, `{"error":"invalid request body"}`, http.StatusBadRequest)
+		return
+	}
+
+	client, p, ok := h.client(w, r)
+	if !ok {
+		return
+	}
+
+	if err := client.PauseOpt(r.Context(), req.options()); err != nil {
+		h.fail(w, p, "pause", err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(PlaybackResponse{Status: "paused", DeviceID: req.DeviceID})
+}
+
+// --- Skip Handlers ---
+
+// NextHandler skips to the next track in the user's queue.
+type NextHandler struct {
+	playback
+}
+
+func (*NextHandler) Pattern() string {
+	return "/spotify/next"
+}
+
+func NewNextHandler(log *zap.SugaredLogger, cfg config.Config, tokens spotify.TokenStore) *NextHandler {
+	return &NextHandler{playback{log: log, cfg: cfg, tokens: tokens}}
+}
+
+func (h *NextHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var req DeviceRequest
+	if err := decodeOptional(r, &req); err != nil {
+		http.Error(w, `{"error":"invalid request body"}`, http.StatusBadRequest)
+		return
+	}
+
+	client, p, ok := h.client(w, r)
+	if !ok {
+		return
+	}
+
+	if err := client.NextOpt(r.Context(), req.options()); err != nil {
+		h.fail(w, p, "skip", err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(PlaybackResponse{Status: "skipped", DeviceID: req.DeviceID})
+}
+
+// PreviousHandler goes back to the previous track.
+type PreviousHandler struct {
+	playback
+}
+
+func (*PreviousHandler) Pattern() string {
+	return "/spotify/previous"
+}
+
+func NewPreviousHandler(log *zap.SugaredLogger, cfg config.Config, tokens spotify.TokenStore) *PreviousHandler {
+	return &PreviousHandler{playback{log: log, cfg: cfg, tokens: tokens}}
+}
+
+func (h *PreviousHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var req DeviceRequest
+	if err := decodeOptional(r, &req); err != nil {
+		http.Error(w, `{"error":"invalid request body"}`, http.StatusBadRequest)
+		return
+	}
+
+	client, p, ok := h.client(w, r)
+	if !ok {
+		return
+	}
+
+	if err := client.PreviousOpt(r.Context(), req.options()); err != nil {
+		h.fail(w, p, "previous", err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(PlaybackResponse{Status: "previous", DeviceID: req.DeviceID})
+}
+
+// --- Seek Handler ---
+
+// SeekHandler moves playback to a position in the current track.
+type SeekHandler struct {
+	playback
+}
+
+func (*SeekHandler) Pattern() string {
+	return "/spotify/seek"
+}
+
+func NewSeekHandler(log *zap.SugaredLogger, cfg config.Config, tokens spotify.TokenStore) *SeekHandler {
+	return &SeekHandler{playback{log: log, cfg: cfg, tokens: tokens}}
+}
+
+type SeekRequest struct {
+	PositionMs *int `json:"position_ms"`
+	DeviceRequest
+}
+
+func (h *SeekHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var req SeekRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, `{"error":"invalid request body"}`, http.StatusBadRequest)
 		return
 	}
+	if req.PositionMs == nil || *req.PositionMs < 0 {
+		writePlaybackError(w, http.StatusBadRequest, "position_ms is required and can't be negative", "invalid_request")
+		return
+	}
+
+	client, p, ok := h.client(w, r)
+	if !ok {
+		return
+	}
 
-	if req.UserID == "" {
-		http.Error(w, `{"error":"user_id is required"}`, http.StatusBadRequest)
+	if err := client.SeekOpt(r.Context(), *req.PositionMs, req.options()); err != nil {
+		h.fail(w, p, "seek", err)
 		return
 	}
 
-	client, err := getUserSpotifyClient(ctx, h.cfg, h.fs, req.UserID)
+	json.NewEncoder(w).Encode(PlaybackResponse{Status: "seeked", DeviceID: req.DeviceID})
+}
+
+// --- Volume Handler ---
+
+// VolumeHandler sets the playback volume.
+type VolumeHandler struct {
+	playback
+}
+
+func (*VolumeHandler) Pattern() string {
+	return "/spotify/volume"
+}
+
+func NewVolumeHandler(log *zap.SugaredLogger, cfg config.Config, tokens spotify.TokenStore) *VolumeHandler {
+	return &VolumeHandler{playback{log: log, cfg: cfg, tokens: tokens}}
+}
+
+type VolumeRequest struct {
+	VolumePercent *int `json:"volume_percent"`
+	DeviceRequest
+}
+
+func (h *VolumeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var req VolumeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error":"invalid request body"}`, http.StatusBadRequest)
+		return
+	}
+	if req.VolumePercent == nil || *req.VolumePercent < 0 || *req.VolumePercent > 100 {
+		writePlaybackError(w, http.StatusBadRequest, "volume_percent must be between 0 and 100", "invalid_request")
+		return
+	}
+
+	client, p, ok := h.client(w, r)
+	if !ok {
+		return
+	}
+
+	if err := client.VolumeOpt(r.Context(), *req.VolumePercent, req.options()); err != nil {
+		h.fail(w, p, "volume", err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(PlaybackResponse{Status: "volume_set", DeviceID: req.DeviceID})
+}
+
+// --- Shuffle Handler ---
+
+// ShuffleHandler turns shuffle on or off.
+type ShuffleHandler struct {
+	playback
+}
+
+func (*ShuffleHandler) Pattern() string {
+	return "/spotify/shuffle"
+}
+
+func NewShuffleHandler(log *zap.SugaredLogger, cfg config.Config, tokens spotify.TokenStore) *ShuffleHandler {
+	return &ShuffleHandler{playback{log: log, cfg: cfg, tokens: tokens}}
+}
+
+type ShuffleRequest struct {
+	State *bool `json:"state"`
+	DeviceRequest
+}
+
+func (h *ShuffleHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var req ShuffleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error":"invalid request body"}`, http.StatusBadRequest)
+		return
+	}
+	if req.State == nil {
+		writePlaybackError(w, http.StatusBadRequest, "state is required", "invalid_request")
+		return
+	}
+
+	client, p, ok := h.client(w, r)
+	if !ok {
+		return
+	}
+
+	if err := client.ShuffleOpt(r.Context(), *req.State, req.options()); err != nil {
+		h.fail(w, p, "shuffle", err)
+		return
+	}
+
+	status := "shuffle_off"
+	if *req.State {
+		status = "shuffle_on"
+	}
+	json.NewEncoder(w).Encode(PlaybackResponse{Status: status, DeviceID: req.DeviceID})
+}
+
+// --- Repeat Handler ---
+
+// RepeatHandler sets the repeat mode to "track", "context" or "off".
+type RepeatHandler struct {
+	playback
+}
+
+func (*RepeatHandler) Pattern() string {
+	return "/spotify/repeat"
+}
+
+func NewRepeatHandler(log *zap.SugaredLogger, cfg config.Config, tokens spotify.TokenStore) *RepeatHandler {
+	return &RepeatHandler{playback{log: log, cfg: cfg, tokens: tokens}}
+}
+
+type RepeatRequest struct {
+	State string `json:"state"`
+	DeviceRequest
+}
+
+func (h *RepeatHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var req RepeatRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error":"invalid request body"}`, http.StatusBadRequest)
+		return
+	}
+	switch req.State {
+	case "track", "context", "off":
+	default:
+		writePlaybackError(w, http.StatusBadRequest, `state must be "track", "context" or "off"`, "invalid_request")
+		return
+	}
+
+	client, p, ok := h.client(w, r)
+	if !ok {
+		return
+	}
+
+	if err := client.RepeatOpt(r.Context(), req.State, req.options()); err != nil {
+		h.fail(w, p, "repeat", err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(PlaybackResponse{Status: "repeat_" + req.State, DeviceID: req.DeviceID})
+}
+
+// --- Transfer Handler ---
+
+// TransferHandler moves playback to another of the user's devices.
+type TransferHandler struct {
+	playback
+}
+
+func (*TransferHandler) Pattern() string {
+	return "/spotify/transfer"
+}
+
+func NewTransferHandler(log *zap.SugaredLogger, cfg config.Config, tokens spotify.TokenStore) *TransferHandler {
+	return &TransferHandler{playback{log: log, cfg: cfg, tokens: tokens}}
+}
+
+type TransferRequest struct {
+	DeviceID string `json:"device_id"`
+	// Play starts playback on the new device; otherwise the current state is kept
+	Play bool `json:"play"`
+}
+
+func (h *TransferHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var req TransferRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error":"invalid request body"}`, http.StatusBadRequest)
+		return
+	}
+	if req.DeviceID == "" {
+		writePlaybackError(w, http.StatusBadRequest, "device_id is required", "invalid_request")
+		return
+	}
+
+	client, p, ok := h.client(w, r)
+	if !ok {
+		return
+	}
+
+	if err := client.TransferPlayback(r.Context(), spot.ID(req.DeviceID), req.Play); err != nil {
+		h.fail(w, p, "transfer", err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(PlaybackResponse{Status: "transferred", DeviceID: req.DeviceID})
+}
+
+// --- Queue Handlers ---
+
+// QueueHandler returns the user's playback queue.
+type QueueHandler struct {
+	playback
+}
+
+func (*QueueHandler) Pattern() string {
+	return "/spotify/queue"
+}
+
+func NewQueueHandler(log *zap.SugaredLogger, cfg config.Config, tokens spotify.TokenStore) *QueueHandler {
+	return &QueueHandler{playback{log: log, cfg: cfg, tokens: tokens}}
+}
+
+type QueueResponse struct {
+	CurrentlyPlaying *occipital.Track   `json:"currently_playing"`
+	Queue            []*occipital.Track `json:"queue"`
+}
+
+func (h *QueueHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	client, p, ok := h.client(w, r)
+	if !ok {
+		return
+	}
+
+	q, err := client.GetQueue(r.Context())
 	if err != nil {
-		http.Error(w, `{"error":"spotify not connected for this user"}`, http.StatusUnauthorized)
+		h.fail(w, p, "get queue", err)
+		return
+	}
+
+	resp := QueueResponse{Queue: make([]*occipital.Track, 0, len(q.Items))}
+	if q.CurrentlyPlaying.ID != "" {
+		resp.CurrentlyPlaying = trackFromSpotify(&q.CurrentlyPlaying)
+	}
+	for i := range q.Items {
+		resp.Queue = append(resp.Queue, trackFromSpotify(&q.Items[i]))
+	}
+
+	json.NewEncoder(w).Encode(resp)
+}
+
+// AddToQueueHandler appends a track to the user's queue.
+type AddToQueueHandler struct {
+	playback
+}
+
+func (*AddToQueueHandler) Pattern() string {
+	return "/spotify/queue"
+}
+
+func NewAddToQueueHandler(log *zap.SugaredLogger, cfg config.Config, tokens spotify.TokenStore) *AddToQueueHandler {
+	return &AddToQueueHandler{playback{log: log, cfg: cfg, tokens: tokens}}
+}
+
+type AddToQueueRequest struct {
+	TrackID string `json:"track_id"`
+	DeviceRequest
+}
+
+func (h *AddToQueueHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var req AddToQueueRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error":"invalid request body"}`, http.StatusBadRequest)
+		return
+	}
+	if req.TrackID == "" {
+		writePlaybackError(w, http.StatusBadRequest, "track_id is required", "invalid_request")
+		return
+	}
+
+	client, p, ok := h.client(w, r)
+	if !ok {
 		return
 	}
 
-	if err := client.Pause(ctx); err != nil {
-		h.log.Errorw("Failed to pause playback", "error", err)
-		http.Error(w, `{"error":"pause failed: `+err.Error()+`"}`, http.StatusInternalServerError)
+	if err := client.QueueSongOpt(r.Context(), spot.ID(req.TrackID), req.options()); err != nil {
+		h.fail(w, p, "add to queue", err)
 		return
 	}
 
-	json.NewEncoder(w).Encode(map[string]string{"status": "paused"})
+	json.NewEncoder(w).Encode(PlaybackResponse{Status: "queued", DeviceID: req.DeviceID})
 }
 
 // --- Devices Handler ---
 
 // DevicesHandler lists the user's available Spotify playback devices.
 type DevicesHandler struct {
-	log *zap.SugaredLogger
-	cfg config.Config
-	fs  *firestore.Client
+	playback
 }
 
 func (*DevicesHandler) Pattern() string {
 	return "/spotify/devices"
 }
 
-func NewDevicesHandler(log *zap.SugaredLogger, cfg config.Config, fs *firestore.Client) *DevicesHandler {
-	return &DevicesHandler{log: log, cfg: cfg, fs: fs}
+func NewDevicesHandler(log *zap.SugaredLogger, cfg config.Config, tokens spotify.TokenStore) *DevicesHandler {
+	return &DevicesHandler{playback{log: log, cfg: cfg, tokens: tokens}}
 }
 
 type DeviceInfo struct {
@@ -175,25 +740,16 @@ type DeviceInfo struct {
 }
 
 func (h *DevicesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	ctx := context.Background()
 	w.Header().Set("Content-Type", "application/json")
 
-	userID := r.URL.Query().Get("user_id")
-	if userID == "" {
-		http.Error(w, `{"error":"missing user_id"}`, http.StatusBadRequest)
-		return
-	}
-
-	client, err := getUserSpotifyClient(ctx, h.cfg, h.fs, userID)
-	if err != nil {
-		http.Error(w, `{"error":"spotify not connected for this user"}`, http.StatusUnauthorized)
+	client, p, ok := h.client(w, r)
+	if !ok {
 		return
 	}
 
-	devices, err := client.PlayerDevices(ctx)
+	devices, err := client.PlayerDevices(r.Context())
 	if err != nil {
-		h.log.Errorw("Failed to get devices", "error", err)
-		http.Error(w, `{"error":"failed to get devices"}`, http.StatusInternalServerError)
+		h.fail(w, p, "get devices", err)
 		return
 	}
 
@@ -2,72 +2,558 @@ package spotify
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
+	"github.com/mager/occipital/auth"
+	"github.com/mager/occipital/config"
+	"github.com/mager/occipital/occipital"
 	"github.com/mager/occipital/spotify"
+	"github.com/mager/occipital/util"
+	spot "github.com/zmb3/spotify/v2"
 	"go.uber.org/zap"
+	"golang.org/x/oauth2"
 )
 
-type PlayerStateUpdate struct {
-	TrackName  string `json:"track_name"`
-	ArtistName string `json:"artist_name"`
-	IsPlaying  bool   `json:"is_playing"`
-	// Add other relevant fields from spotify.PlayerState
+const (
+	// Poll intervals adapt to what the user is doing: fast while a track
+	// plays, slower when paused, slowest when nothing is active.
+	npPlayingInterval = 2 * time.Second
+	npPausedInterval  = 10 * time.Second
+	npIdleInterval    = 30 * time.Second
+	npMaxBackoff      = 2 * time.Minute
+	npPollTimeout     = 10 * time.Second
+
+	npWriteWait  = 10 * time.Second
+	npPongWait   = 60 * time.Second
+	npPingPeriod = npPongWait * 9 / 10
+	npSendBuffer = 16
+)
+
+// TrackResolver returns the enriched track for a Spotify ID.
+type TrackResolver interface {
+	Resolve(ctx context.Context, spotifyID string) (occipital.Track, error)
 }
 
-var upgrader = websocket.Upgrader{
-	ReadBufferSize:  1024,
-	WriteBufferSize: 1024,
-	CheckOrigin: func(r *http.Request) bool {
-		// In production, you should validate the origin of the request
-		return true
-	},
+type NowPlayingDevice struct {
+	ID            string `json:"id"`
+	Name          string `json:"name"`
+	Type          string `json:"type"`
+	VolumePercent int    `json:"volume_percent"`
+}
+
+// NowPlaying is a user's playback state. Timestamp is when Spotify sampled
+// ProgressMs, so clients can interpolate between updates.
+type NowPlaying struct {
+	IsPlaying  bool              `json:"is_playing"`
+	ProgressMs int               `json:"progress_ms"`
+	Timestamp  int64             `json:"timestamp"`
+	Device     *NowPlayingDevice `json:"device"`
+	Shuffle    bool              `json:"shuffle"`
+	Repeat     string            `json:"repeat"`
+	Track      *occipital.Track  `json:"track"`
+}
+
+// NowPlayingMessage is sent over the socket. A connection first receives a
+// "snapshot" with the full state, then "diff" messages carrying only the
+// fields that changed. "error" is sent before the server closes the socket.
+type NowPlayingMessage struct {
+	Type    string         `json:"type"`
+	State   *NowPlaying    `json:"state,omitempty"`
+	Changes map[string]any `json:"changes,omitempty"`
+	Error   string         `json:"error,omitempty"`
+}
+
+// NowPlayingHandler streams the authenticated user's playback over a WebSocket.
+type NowPlayingHandler struct {
+	log      *zap.SugaredLogger
+	tokens   spotify.TokenStore
+	hub      *nowPlayingHub
+	upgrader websocket.Upgrader
 }
 
-// PlayerHandler handles WebSocket connections
-func PlayerHandler(w http.ResponseWriter, r *http.Request, spotifyClient *spotify.SpotifyClient, logger *zap.SugaredLogger) {
-	conn, err := upgrader.Upgrade(w, r, nil)
+func (*NowPlayingHandler) Pattern() string {
+	return "/np"
+}
+
+func NewNowPlayingHandler(log *zap.SugaredLogger, cfg config.Config, tokens spotify.TokenStore, tracks TrackResolver) *NowPlayingHandler {
+	return &NowPlayingHandler{
+		log:    log,
+		tokens: tokens,
+		hub: &nowPlayingHub{
+			log:     log,
+			cfg:     cfg,
+			tokens:  tokens,
+			tracks:  tracks,
+			pollers: make(map[string]*nowPlayingPoller),
+		},
+		upgrader: websocket.Upgrader{
+			ReadBufferSize:  1024,
+			WriteBufferSize: 1024,
+			CheckOrigin:     checkOrigin(cfg.AllowedOrigins),
+		},
+	}
+}
+
+// checkOrigin allows the configured origins. Without any, gorilla's default
+// same-origin check applies.
+func checkOrigin(allowed []string) func(r *http.Request) bool {
+	if len(allowed) == 0 {
+		return nil
+	}
+	return func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			// Not a browser; cross-site WebSocket hijacking needs one
+			return true
+		}
+		u, err := url.Parse(origin)
+		if err != nil {
+			return false
+		}
+		return slices.ContainsFunc(allowed, func(a string) bool {
+			return a == "*" || strings.EqualFold(strings.TrimSuffix(a, "/"), u.Scheme+"://"+u.Host)
+		})
+	}
+}
+
+// @Summary Stream now playing
+// @Description WebSocket that pushes the user's Spotify playback state. Browsers may pass the token as access_token.
+// @Tags Spotify
+// @Security BearerAuth
+// @Param access_token query string false "Bearer token, for clients that can't set headers"
+// @Success 101 {object} NowPlayingMessage
+// @Failure 401 {object} map[string]string
+// @Router /np [get]
+func (h *NowPlayingHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p, ok := auth.FromContext(r.Context())
+	if !ok {
+		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+
+	// Fail before upgrading so clients get a status code they can act on
+	if _, err := h.tokens.Get(r.Context(), p.UserID); err != nil {
+		if !errors.Is(err, spotify.ErrTokenNotFound) {
+			h.log.Errorw("Failed to load Spotify token", "error", err, "user_id", p.UserID)
+		}
+		http.Error(w, `{"error":"spotify not connected for this user"}`, http.StatusUnauthorized)
+		return
+	}
+
+	conn, err := h.upgrader.Upgrade(w, r, nil)
 	if err != nil {
-		logger.Errorw("Error upgrading connection to WebSocket", "error", err)
+		h.log.Warnw("Error upgrading connection to WebSocket", "error", err, "user_id", p.UserID)
 		return
 	}
-	defer conn.Close()
 
-	logger.Info("WebSocket client connected")
+	sub := h.hub.subscribe(p.UserID)
+	h.log.Infow("Now playing client connected", "user_id", p.UserID)
 
-	// Start a ticker to send updates periodically
-	ticker := time.NewTicker(1 * time.Second) // Adjust the interval as needed
-	defer ticker.Stop()
+	go h.writePump(conn, sub)
+	h.readPump(conn)
 
-	for range ticker.C {
-		playerState, err := spotifyClient.Client.PlayerState(context.Background())
-		if err != nil {
-			logger.Errorw("Error fetching Spotify player state", "error", err)
-			return // Consider if you want to close the connection on error
+	h.hub.unsubscribe(sub)
+	h.log.Infow("Now playing client disconnected", "user_id", p.UserID)
+}
+
+// readPump discards client messages and keeps the read deadline moving on
+// pongs. It returns once the peer goes away.
+func (h *NowPlayingHandler) readPump(conn *websocket.Conn) {
+	conn.SetReadLimit(512)
+	conn.SetReadDeadline(time.Now().Add(npPongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(npPongWait))
+	})
+	for {
+		if _, _, err := conn.NextReader(); err != nil {
+			return
 		}
+	}
+}
+
+// writePump is the connection's only writer. It exits and closes the
+// connection when the hub closes the subscriber or a write fails.
+func (h *NowPlayingHandler) writePump(conn *websocket.Conn, sub *npSubscriber) {
+	ticker := time.NewTicker(npPingPeriod)
+	defer func() {
+		ticker.Stop()
+		conn.Close()
+	}()
 
-		if playerState.CurrentlyPlaying.Item == nil {
-			// No track playing
-			err = conn.WriteJSON(PlayerStateUpdate{}) // Send an empty or default state
-			if err != nil {
-				logger.Errorw("Error sending WebSocket message", "error", err)
+	for {
+		select {
+		case msg, ok := <-sub.send:
+			conn.SetWriteDeadline(time.Now().Add(npWriteWait))
+			if !ok {
+				conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+				return
+			}
+			if err := conn.WriteMessage(websocket.TextMessage, msg); err != nil {
+				return
+			}
+		case <-ticker.C:
+			conn.SetWriteDeadline(time.Now().Add(npWriteWait))
+			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
 				return
 			}
-			continue
 		}
+	}
+}
+
+type npSubscriber struct {
+	poller *nowPlayingPoller
+	send   chan []byte
+}
+
+// nowPlayingHub runs one poller per user, shared by all of their sockets.
+type nowPlayingHub struct {
+	log    *zap.SugaredLogger
+	cfg    config.Config
+	tokens spotify.TokenStore
+	tracks TrackResolver
+
+	mu      sync.Mutex
+	pollers map[string]*nowPlayingPoller
+}
+
+func (h *nowPlayingHub) subscribe(userID string) *npSubscriber {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	p, ok := h.pollers[userID]
+	if !ok {
+		ctx, cancel := context.WithCancel(context.Background())
+		p = &nowPlayingPoller{
+			hub:    h,
+			userID: userID,
+			cancel: cancel,
+			wake:   make(chan struct{}, 1),
+			subs:   make(map[*npSubscriber]struct{}),
+		}
+		h.pollers[userID] = p
+		go p.run(ctx)
+	}
+
+	sub := &npSubscriber{poller: p, send: make(chan []byte, npSendBuffer)}
+	p.add(sub)
+	return sub
+}
+
+// unsubscribe detaches sub and stops the user's poller once nobody is listening.
+func (h *nowPlayingHub) unsubscribe(sub *npSubscriber) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	p := sub.poller
+	if p.remove(sub) == 0 && h.pollers[p.userID] == p {
+		p.cancel()
+		delete(h.pollers, p.userID)
+	}
+}
+
+// retire removes a poller that can no longer make progress and closes its
+// subscribers after telling them why.
+func (h *nowPlayingHub) retire(p *nowPlayingPoller, reason string) {
+	h.mu.Lock()
+	if h.pollers[p.userID] == p {
+		delete(h.pollers, p.userID)
+	}
+	h.mu.Unlock()
+
+	p.cancel()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.broadcast(NowPlayingMessage{Type: "error", Error: reason})
+	for sub := range p.subs {
+		delete(p.subs, sub)
+		close(sub.send)
+	}
+}
+
+type nowPlayingPoller struct {
+	hub    *nowPlayingHub
+	userID string
+	cancel context.CancelFunc
+	wake   chan struct{}
+
+	mu   sync.Mutex
+	subs map[*npSubscriber]struct{}
+	last *NowPlaying
+}
+
+// add sends sub the latest snapshot and nudges the poller so a client that
+// joins during a long idle interval isn't left with stale state.
+func (p *nowPlayingPoller) add(sub *npSubscriber) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.subs[sub] = struct{}{}
+	if p.last != nil {
+		p.sendTo(sub, NowPlayingMessage{Type: "snapshot", State: p.last})
+	}
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (p *nowPlayingPoller) remove(sub *npSubscriber) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, ok := p.subs[sub]; ok {
+		delete(p.subs, sub)
+		close(sub.send)
+	}
+	return len(p.subs)
+}
 
-		update := PlayerStateUpdate{
-			TrackName:  playerState.CurrentlyPlaying.Item.Name,
-			ArtistName: playerState.CurrentlyPlaying.Item.Artists[0].Name,
-			IsPlaying:  playerState.CurrentlyPlaying.Playing,
+func (p *nowPlayingPoller) run(ctx context.Context) {
+	log := p.hub.log.With("user_id", p.userID)
+
+	client, err := getUserSpotifyClient(ctx, log, p.hub.cfg, p.hub.tokens, p.userID)
+	if err != nil {
+		log.Warnw("Now playing poller has no Spotify client", "error", err)
+		p.hub.retire(p, "spotify not connected for this user")
+		return
+	}
+
+	var (
+		state    *NowPlaying
+		failures int
+	)
+	enriched := make(chan occipital.Track, 1)
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case t := <-enriched:
+			if state != nil && state.Track != nil && state.Track.SourceID == t.SourceID {
+				next := *state
+				next.Track = &t
+				p.publish(state, &next)
+				state = &next
+			}
+			continue
+		case <-p.wake:
+		case <-timer.C:
 		}
 
-		err = conn.WriteJSON(update)
+		pollCtx, cancel := context.WithTimeout(ctx, npPollTimeout)
+		ps, err := client.PlayerState(pollCtx)
+		cancel()
 		if err != nil {
-			logger.Errorw("Error sending WebSocket message", "error", err)
-			return // Client likely disconnected
+			if ctx.Err() != nil {
+				return
+			}
+			if isRevoked(err) {
+				log.Infow("Spotify authorization revoked", "error", err)
+				p.hub.retire(p, "spotify authorization revoked")
+				return
+			}
+			failures++
+			log.Warnw("Error fetching Spotify player state", "error", err, "failures", failures)
+			resetTimer(timer, min(npPlayingInterval<<min(failures, 6), npMaxBackoff))
+			continue
+		}
+		failures = 0
+
+		next := nowPlayingFromState(ps, state)
+		if next.Track != nil && (state == nil || state.Track == nil || state.Track.SourceID != next.Track.SourceID) {
+			go p.enrich(ctx, log, next.Track.SourceID, enriched)
+		}
+		p.publish(state, next)
+		state = next
+		resetTimer(timer, pollInterval(ps))
+	}
+}
+
+// enrich resolves the full track off the poll loop, since a cold cache
+// can take several seconds of MusicBrainz calls.
+func (p *nowPlayingPoller) enrich(ctx context.Context, log *zap.SugaredLogger, spotifyID string, out chan<- occipital.Track) {
+	track, err := p.hub.tracks.Resolve(ctx, spotifyID)
+	if err != nil {
+		log.Infow("Failed to enrich now playing track", "error", err, "spotify_id", spotifyID)
+		return
+	}
+	track.SourceID = spotifyID
+	select {
+	case out <- track:
+	case <-ctx.Done():
+	}
+}
+
+func (p *nowPlayingPoller) publish(prev, next *NowPlaying) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.last = next
+	if prev == nil {
+		p.broadcast(NowPlayingMessage{Type: "snapshot", State: next})
+		return
+	}
+	if changes := diffNowPlaying(prev, next); len(changes) > 0 {
+		p.broadcast(NowPlayingMessage{Type: "diff", Changes: changes})
+	}
+}
+
+// broadcast must be called with p.mu held.
+func (p *nowPlayingPoller) broadcast(msg NowPlayingMessage) {
+	for sub := range p.subs {
+		p.sendTo(sub, msg)
+	}
+}
+
+// sendTo must be called with p.mu held. Subscribers that fall a full buffer
+// behind are dropped rather than stalling everyone else.
+func (p *nowPlayingPoller) sendTo(sub *npSubscriber, msg NowPlayingMessage) {
+	b, err := json.Marshal(msg)
+	if err != nil {
+		p.hub.log.Errorw("Failed to encode now playing message", "error", err)
+		return
+	}
+	select {
+	case sub.send <- b:
+	default:
+		p.hub.log.Warnw("Dropping slow now playing client", "user_id", p.userID)
+		delete(p.subs, sub)
+		close(sub.send)
+	}
+}
+
+// nowPlayingFromState maps Spotify's player state, keeping the previous
+// (possibly enriched) track while the same one is still playing.
+func nowPlayingFromState(ps *spot.PlayerState, prev *NowPlaying) *NowPlaying {
+	np := &NowPlaying{
+		IsPlaying:  ps.Playing,
+		ProgressMs: int(ps.Progress),
+		Timestamp:  ps.Timestamp,
+		Shuffle:    ps.ShuffleState,
+		Repeat:     ps.RepeatState,
+	}
+	if ps.Device.ID != "" || ps.Device.Name != "" {
+		np.Device = &NowPlayingDevice{
+			ID:            ps.Device.ID.String(),
+			Name:          ps.Device.Name,
+			Type:          ps.Device.Type,
+			VolumePercent: int(ps.Device.Volume),
+		}
+	}
+
+	item := ps.Item
+	if item == nil {
+		return np
+	}
+	if prev != nil && prev.Track != nil && prev.Track.SourceID == item.ID.String() {
+		np.Track = prev.Track
+		return np
+	}
+
+	np.Track = trackFromSpotify(item)
+	return np
+}
+
+// trackFromSpotify is the unenriched track Spotify already gave us.
+func trackFromSpotify(ft *spot.FullTrack) *occipital.Track {
+	track := &occipital.Track{
+		Name:     ft.Name,
+		Artist:   util.GetFirstArtist(ft.Artists),
+		Source:   "spotify",
+		SourceID: ft.ID.String(),
+		ISRC:     ft.ExternalIDs["isrc"],
+		Meta:     &occipital.TrackMeta{DurationMs: int(ft.Duration)},
+	}
+	if len(ft.Album.Images) > 0 {
+		track.Image = ft.Album.Images[0].URL
+	}
+	return track
+}
+
+// diffNowPlaying returns the JSON fields of next that differ from prev.
+func diffNowPlaying(prev, next *NowPlaying) map[string]any {
+	changes := make(map[string]any)
+	if prev.IsPlaying != next.IsPlaying {
+		changes["is_playing"] = next.IsPlaying
+	}
+	if prev.ProgressMs != next.ProgressMs {
+		changes["progress_ms"] = next.ProgressMs
+		changes["timestamp"] = next.Timestamp
+	}
+	if !sameDevice(prev.Device, next.Device) {
+		changes["device"] = next.Device
+	}
+	if prev.Shuffle != next.Shuffle {
+		changes["shuffle"] = next.Shuffle
+	}
+	if prev.Repeat != next.Repeat {
+		changes["repeat"] = next.Repeat
+	}
+	// Tracks are reused while unchanged, so identity is enough
+	if prev.Track != next.Track {
+		changes["track"] = next.Track
+	}
+	return changes
+}
+
+func sameDevice(a, b *NowPlayingDevice) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// pollInterval picks the next delay from the current state, polling just
+// after the track should end so the change shows up promptly.
+func pollInterval(ps *spot.PlayerState) time.Duration {
+	switch {
+	case ps.Item == nil:
+		return npIdleInterval
+	case !ps.Playing:
+		return npPausedInterval
+	}
+	remaining := time.Duration(int(ps.Item.Duration)-int(ps.Progress)) * time.Millisecond
+	if remaining > 0 && remaining < npPlayingInterval {
+		return remaining + 250*time.Millisecond
+	}
+	return npPlayingInterval
+}
+
+// isRevoked reports whether err means the user's grant is gone, so polling
+// again can't succeed. A token endpoint that is down or times out is not a
+// revocation; only its invalid_grant answer is.
+func isRevoked(err error) bool {
+	var spotErr spot.Error
+	if errors.As(err, &spotErr) && spotErr.Status == http.StatusUnauthorized {
+		return true
+	}
+	var retrieveErr *oauth2.RetrieveError
+	if errors.As(err, &retrieveErr) {
+		if retrieveErr.ErrorCode != "" {
+			return retrieveErr.ErrorCode == "invalid_grant"
+		}
+		return retrieveErr.Response != nil &&
+			(retrieveErr.Response.StatusCode == http.StatusBadRequest || retrieveErr.Response.StatusCode == http.StatusUnauthorized)
+	}
+	return errors.Is(err, spotify.ErrTokenNotFound)
+}
+
+func resetTimer(t *time.Timer, d time.Duration) {
+	if !t.Stop() {
+		select {
+		case <-t.C:
+		default:
 		}
 	}
+	t.Reset(d)
 }
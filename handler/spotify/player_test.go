@@ -0,0 +1,50 @@
+package spotify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/mager/occipital/spotify"
+	spot "github.com/zmb3/spotify/v2"
+	"golang.org/x/oauth2"
+)
+
+func TestIsRevoked(t *testing.T) {
+	retrieve := func(status int, code string) error {
+		return &oauth2.RetrieveError{Response: &http.Response{StatusCode: status}, ErrorCode: code}
+	}
+	// The HTTP client wraps token source errors in a *url.Error
+	viaClient := func(err error) error {
+		return &url.Error{Op: "Get", URL: "https://api.spotify.com/v1/me/player", Err: err}
+	}
+
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"invalid_grant", retrieve(http.StatusBadRequest, "invalid_grant"), true},
+		{"invalid_grant through the client", viaClient(retrieve(http.StatusBadRequest, "invalid_grant")), true},
+		{"400 without an error code", retrieve(http.StatusBadRequest, ""), true},
+		{"401 without an error code", retrieve(http.StatusUnauthorized, ""), true},
+		{"other error code", retrieve(http.StatusBadRequest, "invalid_request"), false},
+		{"token endpoint 500", retrieve(http.StatusInternalServerError, ""), false},
+		{"token endpoint 503 through the client", viaClient(retrieve(http.StatusServiceUnavailable, "")), false},
+		{"token endpoint timeout", viaClient(context.DeadlineExceeded), false},
+		{"Spotify API 401", spot.Error{Status: http.StatusUnauthorized}, true},
+		{"Spotify API 502", spot.Error{Status: http.StatusBadGateway}, false},
+		{"no token", fmt.Errorf("load: %w", spotify.ErrTokenNotFound), true},
+		{"other", errors.New("boom"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isRevoked(tt.err); got != tt.want {
+				t.Errorf("isRevoked(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,531 @@
+package spotify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/mager/occipital/auth"
+	"github.com/mager/occipital/config"
+	"github.com/mager/occipital/spotify"
+	spot "github.com/zmb3/spotify/v2"
+	spotifyauth "github.com/zmb3/spotify/v2/auth"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	playlistCollection = "spotify_playlists"
+
+	// playlistBatch is the most items Spotify takes per add or replace
+	playlistBatch = 100
+	// maxPlaylistTracks bounds one export; discover tops out well below it
+	maxPlaylistTracks = 1000
+
+	playlistModeReplace = "replace"
+	playlistModeAppend  = "append"
+
+	// playlistReservationTTL is how long a keyed export holds its key while
+	// it creates the playlist, after which a crashed export's hold lapses
+	playlistReservationTTL = time.Minute
+)
+
+var playlistScopes = []string{spotifyauth.ScopePlaylistModifyPublic, spotifyauth.ScopePlaylistModifyPrivate}
+
+// SnapshotTracks lists the Spotify track IDs of a stored discover chart.
+// It returns no IDs and no error when there is no chart for the date.
+type SnapshotTracks interface {
+	SnapshotTrackIDs(ctx context.Context, date string) ([]string, error)
+}
+
+// GenreTracks lists the Spotify track IDs a genre search returns.
+type GenreTracks interface {
+	GenreTrackIDs(ctx context.Context, genre string, limit int) ([]string, error)
+}
+
+// PlaylistHandler saves tracks to a playlist in the user's Spotify account.
+type PlaylistHandler struct {
+	log       *zap.SugaredLogger
+	cfg       config.Config
+	tokens    spotify.TokenStore
+	keys      playlistKeys
+	snapshots SnapshotTracks
+	genres    GenreTracks
+}
+
+func (*PlaylistHandler) Pattern() string {
+	return "/spotify/playlists"
+}
+
+func NewPlaylistHandler(log *zap.SugaredLogger, cfg config.Config, tokens spotify.TokenStore, fs *firestore.Client, snapshots SnapshotTracks, genres GenreTracks) *PlaylistHandler {
+	h := &PlaylistHandler{log: log, cfg: cfg, tokens: tokens, snapshots: snapshots, genres: genres}
+	if fs != nil {
+		h.keys = firestorePlaylistKeys{fs: fs}
+	}
+	return h
+}
+
+// PlaylistRequest names the tracks to save, by ID or by reference to a
+// discover snapshot or genre search, and where to save them.
+type PlaylistRequest struct {
+	TrackIDs []string          `json:"track_ids,omitempty"`
+	Discover *DiscoverPlaylist `json:"discover,omitempty"`
+	Genre    *GenrePlaylist    `json:"genre,omitempty"`
+
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Public      bool   `json:"public"`
+	// Mode is "replace" (default) or "append"; append skips tracks already
+	// in the playlist
+	Mode string `json:"mode,omitempty"`
+	// Key makes the export idempotent: the same key updates the playlist it
+	// created before instead of making a new one, e.g. "discover-daily".
+	// While one export creates the playlist, others with its key get 409
+	Key string `json:"key,omitempty"`
+	// PlaylistID updates an existing playlist the user owns
+	PlaylistID string `json:"playlist_id,omitempty"`
+}
+
+// DiscoverPlaylist refers to the discover v2 chart for a day.
+type DiscoverPlaylist struct {
+	// Date is YYYY-MM-DD; today when empty
+	Date string `json:"date,omitempty"`
+}
+
+// GenrePlaylist refers to a genre search, as /genre/tracks runs it.
+type GenrePlaylist struct {
+	Genre string `json:"genre"`
+	Limit int    `json:"limit,omitempty"`
+}
+
+type PlaylistResponse struct {
+	PlaylistID string `json:"playlist_id"`
+	URL        string `json:"url"`
+	Created    bool   `json:"created"`
+	Mode       string `json:"mode"`
+	// Added counts tracks written this request
+	Added int `json:"added"`
+}
+
+// validate checks the request and reports what's wrong with it.
+func (req *PlaylistRequest) validate() string {
+	sources := 0
+	if len(req.TrackIDs) > 0 {
+		sources++
+	}
+	if req.Discover != nil {
+		sources++
+	}
+	if req.Genre != nil {
+		sources++
+	}
+	if sources != 1 {
+		return "exactly one of track_ids, discover or genre is required"
+	}
+	if len(req.TrackIDs) > maxPlaylistTracks {
+		return "too many track_ids"
+	}
+	if req.Discover != nil && req.Discover.Date != "" {
+		if _, err := time.Parse("2006-01-02", req.Discover.Date); err != nil {
+			return "discover.date must be YYYY-MM-DD"
+		}
+	}
+	if req.Genre != nil && req.Genre.Genre == "" {
+		return "genre.genre is required"
+	}
+	if req.PlaylistID == "" && strings.TrimSpace(req.Name) == "" {
+		return "name is required to create a playlist"
+	}
+	if req.PlaylistID != "" && req.Key != "" {
+		return "playlist_id and key are mutually exclusive"
+	}
+	switch req.Mode {
+	case "":
+		req.Mode = playlistModeReplace
+	case playlistModeReplace, playlistModeAppend:
+	default:
+		return `mode must be "replace" or "append"`
+	}
+	return ""
+}
+
+// ServeHTTP creates or updates a playlist in the caller's Spotify account.
+//
+// @Summary      Save tracks to a Spotify playlist
+// @Description  Creates or updates a playlist from track IDs, a discover snapshot or a genre search
+// @Tags         Spotify
+// @Accept       json
+// @Produce      json
+// @Param        request  body  PlaylistRequest  true  "Tracks and playlist"
+// @Success      200  {object}  PlaylistResponse
+// @Failure      400  {object}  map[string]string
+// @Failure      401  {object}  map[string]string
+// @Failure      403  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Failure      409  {object}  map[string]string
+// @Failure      502  {object}  map[string]string
+// @Failure      503  {object}  map[string]string
+// @Security     BearerAuth
+// @Router       /spotify/playlists [post]
+func (h *PlaylistHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx := r.Context()
+
+	p, ok := auth.FromContext(ctx)
+	if !ok {
+		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+
+	var req PlaylistRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error":"invalid request body"}`, http.StatusBadRequest)
+		return
+	}
+	if msg := req.validate(); msg != "" {
+		writeJSONError(w, http.StatusBadRequest, msg)
+		return
+	}
+	// Without a store the key can't be honoured, and ignoring it would make
+	// a new playlist on every call
+	if req.Key != "" && h.keys == nil {
+		http.Error(w, `{"error":"playlist keys are unavailable"}`, http.StatusServiceUnavailable)
+		return
+	}
+
+	st, err := h.tokens.Get(ctx, p.UserID)
+	if errors.Is(err, spotify.ErrTokenNotFound) {
+		http.Error(w, `{"error":"spotify not connected for this user"}`, http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		h.log.Errorw("Failed to load Spotify token", "error", err, "user_id", p.UserID)
+		http.Error(w, `{"error":"failed to load spotify connection"}`, http.StatusInternalServerError)
+		return
+	}
+	if len(st.Scopes) > 0 && !st.HasScopes(playlistScopes...) {
+		http.Error(w, `{"error":"reconnect spotify to allow saving playlists"}`, http.StatusForbidden)
+		return
+	}
+
+	ids, err := h.trackIDs(ctx, &req)
+	if err != nil {
+		h.log.Errorw("Failed to load playlist tracks", "error", err, "user_id", p.UserID)
+		http.Error(w, `{"error":"failed to load tracks"}`, http.StatusBadGateway)
+		return
+	}
+	if len(ids) == 0 {
+		http.Error(w, `{"error":"no tracks found"}`, http.StatusNotFound)
+		return
+	}
+
+	client, err := getUserSpotifyClient(ctx, h.log, h.cfg, h.tokens, p.UserID)
+	if err != nil {
+		h.log.Errorw("Failed to get user Spotify client", "error", err, "user_id", p.UserID)
+		http.Error(w, `{"error":"failed to load spotify connection"}`, http.StatusInternalServerError)
+		return
+	}
+
+	resp, err := h.save(ctx, client, p.UserID, &req, ids)
+	if err != nil {
+		var spotErr spot.Error
+		switch {
+		case errors.Is(err, errPlaylistNotOwned):
+			http.Error(w, `{"error":"playlist is not owned by this user"}`, http.StatusForbidden)
+		case errors.Is(err, errPlaylistKeyBusy):
+			http.Error(w, `{"error":"an export with this key is in progress"}`, http.StatusConflict)
+		case errors.As(err, &spotErr) && spotErr.Status == http.StatusNotFound:
+			http.Error(w, `{"error":"playlist not found"}`, http.StatusNotFound)
+		case isRevoked(err):
+			http.Error(w, `{"error":"spotify authorization revoked; reconnect spotify"}`, http.StatusUnauthorized)
+		default:
+			h.log.Errorw("Failed to save playlist", "error", err, "user_id", p.UserID)
+			http.Error(w, `{"error":"failed to save playlist"}`, http.StatusBadGateway)
+		}
+		return
+	}
+
+	h.log.Infow("Saved playlist",
+		"user_id", p.UserID,
+		"playlist_id", resp.PlaylistID,
+		"created", resp.Created,
+		"mode", resp.Mode,
+		"added", resp.Added,
+	)
+	json.NewEncoder(w).Encode(resp)
+}
+
+var (
+	errPlaylistNotOwned = errors.New("playlist not owned by user")
+	// errPlaylistKeyBusy means another export holds the key while it creates
+	// the playlist
+	errPlaylistKeyBusy = errors.New("playlist key reserved by another export")
+)
+
+// trackIDs expands the request's track source, dropping duplicates but
+// keeping order.
+func (h *PlaylistHandler) trackIDs(ctx context.Context, req *PlaylistRequest) ([]string, error) {
+	var ids []string
+	switch {
+	case req.Discover != nil:
+		date := req.Discover.Date
+		if date == "" {
+			date = time.Now().Format("2006-01-02")
+		}
+		var err error
+		if ids, err = h.snapshots.SnapshotTrackIDs(ctx, date); err != nil {
+			return nil, err
+		}
+	case req.Genre != nil:
+		var err error
+		if ids, err = h.genres.GenreTrackIDs(ctx, req.Genre.Genre, req.Genre.Limit); err != nil {
+			return nil, err
+		}
+	default:
+		ids = req.TrackIDs
+	}
+
+	seen := make(map[string]bool, len(ids))
+	out := make([]string, 0, len(ids))
+	for _, id := range ids {
+		id = strings.TrimPrefix(strings.TrimSpace(id), "spotify:track:")
+		if id != "" && !seen[id] {
+			seen[id] = true
+			out = append(out, id)
+		}
+	}
+	return out, nil
+}
+
+// save finds or creates the target playlist and writes ids to it.
+func (h *PlaylistHandler) save(ctx context.Context, client *spot.Client, userID string, req *PlaylistRequest, ids []string) (PlaylistResponse, error) {
+	resp := PlaylistResponse{Mode: req.Mode}
+
+	me, err := client.CurrentUser(ctx)
+	if err != nil {
+		return resp, err
+	}
+
+	playlistID := spot.ID(req.PlaylistID)
+	if req.Key != "" {
+		// Without a playlist this holds the key until the one made below
+		// is recorded, so a concurrent export can't create a second
+		if playlistID, err = h.keyedPlaylist(ctx, client, userID, me.ID, req.Key); err != nil {
+			return resp, err
+		}
+	}
+
+	if playlistID == "" {
+		pl, err := client.CreatePlaylistForUser(ctx, me.ID, req.Name, req.Description, req.Public, false)
+		if err != nil {
+			if req.Key != "" {
+				if err := h.keys.release(context.WithoutCancel(ctx), userID, req.Key); err != nil {
+					h.log.Warnw("Failed to release playlist key", "error", err, "user_id", userID, "key", req.Key)
+				}
+			}
+			return resp, err
+		}
+		playlistID = pl.ID
+		resp.Created = true
+		if req.Key != "" {
+			if err := h.keys.record(context.WithoutCancel(ctx), userID, req.Key, playlistID); err != nil {
+				h.log.Warnw("Failed to store playlist key", "error", err, "user_id", userID, "key", req.Key)
+			}
+		}
+	} else {
+		pl, err := client.GetPlaylist(ctx, playlistID)
+		if err != nil {
+			return resp, err
+		}
+		if pl.Owner.ID != me.ID {
+			return resp, errPlaylistNotOwned
+		}
+		if req.Name != "" {
+			if err := client.ChangePlaylistNameAccessAndDescription(ctx, playlistID, req.Name, req.Description, req.Public); err != nil {
+				return resp, err
+			}
+		}
+	}
+	resp.PlaylistID = playlistID.String()
+	resp.URL = "https://open.spotify.com/playlist/" + resp.PlaylistID
+
+	trackIDs := make([]spot.ID, 0, len(ids))
+	for _, id := range ids {
+		trackIDs = append(trackIDs, spot.ID(id))
+	}
+
+	if req.Mode == playlistModeAppend && !resp.Created {
+		existing, err := playlistTrackIDs(ctx, client, playlistID)
+		if err != nil {
+			return resp, err
+		}
+		trackIDs = slices.DeleteFunc(trackIDs, func(id spot.ID) bool { return existing[id] })
+	}
+
+	// Replace swaps in the first batch, then appends the rest
+	replace := req.Mode == playlistModeReplace && !resp.Created
+	for chunk := range slices.Chunk(trackIDs, playlistBatch) {
+		if replace {
+			err = client.ReplacePlaylistTracks(ctx, playlistID, chunk...)
+			replace = false
+		} else {
+			_, err = client.AddTracksToPlaylist(ctx, playlistID, chunk...)
+		}
+		if err != nil {
+			return resp, err
+		}
+		resp.Added += len(chunk)
+	}
+	return resp, nil
+}
+
+// keyedPlaylist returns the playlist created earlier under key, or reserves
+// the key and returns "" when there is none or the user has since deleted
+// it. Any other failure is an error, since creating a playlist then would
+// leave a duplicate behind.
+func (h *PlaylistHandler) keyedPlaylist(ctx context.Context, client *spot.Client, userID, spotifyUserID, key string) (spot.ID, error) {
+	id, err := h.keys.reserve(ctx, userID, key, "")
+	if err != nil || id == "" {
+		return "", err
+	}
+
+	// Deleting a playlist only unfollows it, so check the user still follows it
+	follows, err := client.UserFollowsPlaylist(ctx, id, spotifyUserID)
+	var spotErr spot.Error
+	switch {
+	case errors.As(err, &spotErr) && spotErr.Status == http.StatusNotFound:
+	case err != nil:
+		return "", fmt.Errorf("check playlist %s is followed: %w", id, err)
+	case len(follows) == 0 || !follows[0]:
+	default:
+		return id, nil
+	}
+	// Gone; take the key over unless another export already has
+	return h.keys.reserve(ctx, userID, key, id)
+}
+
+// playlistKeys records the playlist each export key created. A key is
+// reserved before its playlist is created, so concurrent exports with the
+// same key make one playlist between them.
+type playlistKeys interface {
+	// reserve returns the playlist recorded under key, or reserves the key
+	// and returns "" when there is none or it is gone. It returns
+	// errPlaylistKeyBusy while another export holds the key.
+	reserve(ctx context.Context, userID, key string, gone spot.ID) (spot.ID, error)
+	// record stores the playlist created under a reservation.
+	record(ctx context.Context, userID, key string, id spot.ID) error
+	// release drops a reservation that didn't produce a playlist.
+	release(ctx context.Context, userID, key string) error
+}
+
+type storedPlaylist struct {
+	PlaylistID string    `firestore:"playlist_id"`
+	UpdatedAt  time.Time `firestore:"updated_at"`
+	// ReservedAt is set while an export creates the playlist
+	ReservedAt time.Time `firestore:"reserved_at,omitempty"`
+}
+
+// claim decides a reservation against the stored entry. It returns the
+// recorded playlist, or "" and the entry to store to hold the key.
+func (sp storedPlaylist) claim(gone spot.ID, now time.Time) (spot.ID, storedPlaylist, error) {
+	if sp.PlaylistID != "" && spot.ID(sp.PlaylistID) != gone {
+		return spot.ID(sp.PlaylistID), sp, nil
+	}
+	if sp.PlaylistID == "" && now.Sub(sp.ReservedAt) < playlistReservationTTL {
+		return "", sp, errPlaylistKeyBusy
+	}
+	return "", storedPlaylist{UpdatedAt: now, ReservedAt: now}, nil
+}
+
+// firestorePlaylistKeys keeps keys in Firestore, reserving them in a
+// transaction.
+type firestorePlaylistKeys struct {
+	fs *firestore.Client
+}
+
+func (f firestorePlaylistKeys) doc(userID, key string) *firestore.DocumentRef {
+	return f.fs.Collection(playlistCollection).Doc(userID + ":" + strings.ReplaceAll(key, "/", "_"))
+}
+
+// get reads the entry for ref in tx; a missing entry is the zero value.
+func (f firestorePlaylistKeys) get(tx *firestore.Transaction, ref *firestore.DocumentRef) (storedPlaylist, error) {
+	var sp storedPlaylist
+	snap, err := tx.Get(ref)
+	if status.Code(err) == codes.NotFound {
+		return sp, nil
+	}
+	if err != nil {
+		return sp, err
+	}
+	return sp, snap.DataTo(&sp)
+}
+
+func (f firestorePlaylistKeys) reserve(ctx context.Context, userID, key string, gone spot.ID) (spot.ID, error) {
+	ref := f.doc(userID, key)
+	var id spot.ID
+	err := f.fs.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		sp, err := f.get(tx, ref)
+		if err != nil {
+			return err
+		}
+		var next storedPlaylist
+		if id, next, err = sp.claim(gone, time.Now()); err != nil || id != "" {
+			return err
+		}
+		return tx.Set(ref, next)
+	})
+	if err != nil && !errors.Is(err, errPlaylistKeyBusy) {
+		return "", fmt.Errorf("reserve playlist key %q: %w", key, err)
+	}
+	return id, err
+}
+
+func (f firestorePlaylistKeys) record(ctx context.Context, userID, key string, id spot.ID) error {
+	_, err := f.doc(userID, key).Set(ctx, storedPlaylist{PlaylistID: id.String(), UpdatedAt: time.Now()})
+	return err
+}
+
+func (f firestorePlaylistKeys) release(ctx context.Context, userID, key string) error {
+	ref := f.doc(userID, key)
+	return f.fs.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		sp, err := f.get(tx, ref)
+		if err != nil || sp.PlaylistID != "" {
+			return err
+		}
+		return tx.Delete(ref)
+	})
+}
+
+// playlistTrackIDs returns the IDs of every track in a playlist.
+func playlistTrackIDs(ctx context.Context, client *spot.Client, id spot.ID) (map[spot.ID]bool, error) {
+	out := make(map[spot.ID]bool)
+	page, err := client.GetPlaylistItems(ctx, id, spot.Limit(100))
+	if err != nil {
+		return nil, err
+	}
+	for {
+		for _, item := range page.Items {
+			if item.Track.Track != nil {
+				out[item.Track.Track.ID] = true
+			}
+		}
+		if err := client.NextPage(ctx, page); errors.Is(err, spot.ErrNoMorePages) {
+			return out, nil
+		} else if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func writeJSONError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": msg})
+}
@@ -0,0 +1,240 @@
+package spotify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mager/occipital/auth"
+	"github.com/mager/occipital/config"
+	"github.com/mager/occipital/spotify"
+	spot "github.com/zmb3/spotify/v2"
+	"go.uber.org/zap"
+)
+
+// memoryPlaylistKeys reserves keys the way the Firestore store does, under
+// a mutex instead of a transaction.
+type memoryPlaylistKeys struct {
+	mu   sync.Mutex
+	keys map[string]storedPlaylist
+}
+
+func newMemoryPlaylistKeys() *memoryPlaylistKeys {
+	return &memoryPlaylistKeys{keys: make(map[string]storedPlaylist)}
+}
+
+func (m *memoryPlaylistKeys) reserve(_ context.Context, userID, key string, gone spot.ID) (spot.ID, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	id, next, err := m.keys[userID+":"+key].claim(gone, time.Now())
+	if err == nil && id == "" {
+		m.keys[userID+":"+key] = next
+	}
+	return id, err
+}
+
+func (m *memoryPlaylistKeys) record(_ context.Context, userID, key string, id spot.ID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.keys[userID+":"+key] = storedPlaylist{PlaylistID: id.String(), UpdatedAt: time.Now()}
+	return nil
+}
+
+func (m *memoryPlaylistKeys) release(_ context.Context, userID, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.keys[userID+":"+key].PlaylistID == "" {
+		delete(m.keys, userID+":"+key)
+	}
+	return nil
+}
+
+func TestStoredPlaylistClaim(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name    string
+		stored  storedPlaylist
+		gone    spot.ID
+		want    spot.ID
+		wantErr error
+		held    bool
+	}{
+		{"new key", storedPlaylist{}, "", "", nil, true},
+		{"recorded", storedPlaylist{PlaylistID: "pl-1"}, "", "pl-1", nil, false},
+		{"recorded playlist gone", storedPlaylist{PlaylistID: "pl-1"}, "pl-1", "", nil, true},
+		// Another export replaced the deleted playlist first
+		{"replaced since", storedPlaylist{PlaylistID: "pl-2"}, "pl-1", "pl-2", nil, false},
+		{"reserved", storedPlaylist{ReservedAt: now.Add(-time.Second)}, "", "", errPlaylistKeyBusy, false},
+		{"reserved while replacing", storedPlaylist{ReservedAt: now.Add(-time.Second)}, "pl-1", "", errPlaylistKeyBusy, false},
+		{"reservation lapsed", storedPlaylist{ReservedAt: now.Add(-playlistReservationTTL)}, "", "", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, next, err := tt.stored.claim(tt.gone, now)
+			if id != tt.want || !errors.Is(err, tt.wantErr) {
+				t.Fatalf("claim = %q, %v; want %q, %v", id, err, tt.want, tt.wantErr)
+			}
+			if held := err == nil && id == ""; held != tt.held {
+				t.Fatalf("held = %v, want %v", held, tt.held)
+			}
+			if tt.held && (next.PlaylistID != "" || !next.ReservedAt.Equal(now)) {
+				t.Errorf("reservation = %+v", next)
+			}
+		})
+	}
+}
+
+// fakePlaylistAPI serves the Spotify endpoints an export uses for user
+// "me", counting the playlists it creates.
+type fakePlaylistAPI struct {
+	created    atomic.Int32
+	createFail atomic.Bool
+	// followed is whether the user still follows existing playlists
+	followed atomic.Bool
+}
+
+func (f *fakePlaylistAPI) client(t *testing.T) *spot.Client {
+	t.Helper()
+	f.followed.Store(true)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/me":
+			fmt.Fprint(w, `{"id":"me"}`)
+		case r.Method == http.MethodPost && r.URL.Path == "/users/me/playlists":
+			if f.createFail.Load() {
+				http.Error(w, `{"error":{"status":500,"message":"boom"}}`, http.StatusInternalServerError)
+				return
+			}
+			// Wide enough for concurrent exports to overlap
+			time.Sleep(20 * time.Millisecond)
+			fmt.Fprintf(w, `{"id":"pl-%d"}`, f.created.Add(1))
+		case strings.HasSuffix(r.URL.Path, "/followers/contains"):
+			fmt.Fprintf(w, `[%t]`, f.followed.Load())
+		case strings.HasSuffix(r.URL.Path, "/tracks"):
+			fmt.Fprint(w, `{"snapshot_id":"s"}`)
+		case strings.HasPrefix(r.URL.Path, "/playlists/"):
+			fmt.Fprintf(w, `{"id":%q,"owner":{"id":"me"}}`, strings.TrimPrefix(r.URL.Path, "/playlists/"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return spot.New(srv.Client(), spot.WithBaseURL(srv.URL+"/"))
+}
+
+func newTestPlaylistHandler(keys playlistKeys) *PlaylistHandler {
+	return &PlaylistHandler{log: zap.NewNop().Sugar(), keys: keys}
+}
+
+func keyedRequest() *PlaylistRequest {
+	return &PlaylistRequest{Name: "Daily", Key: "discover-daily", Mode: playlistModeReplace}
+}
+
+func TestKeyedExportsCreateOnePlaylist(t *testing.T) {
+	api := &fakePlaylistAPI{}
+	client := api.client(t)
+	h := newTestPlaylistHandler(newMemoryPlaylistKeys())
+	ctx := context.Background()
+
+	const exports = 5
+	var wg sync.WaitGroup
+	var saved, busy atomic.Int32
+	for range exports {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := h.save(ctx, client, "user-1", keyedRequest(), []string{"t1", "t2"})
+			switch {
+			case err == nil:
+				saved.Add(1)
+			case errors.Is(err, errPlaylistKeyBusy):
+				busy.Add(1)
+			default:
+				t.Errorf("save: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := api.created.Load(); n != 1 {
+		t.Errorf("created %d playlists, want 1", n)
+	}
+	if saved.Load()+busy.Load() != exports || saved.Load() == 0 {
+		t.Errorf("saved %d, busy %d", saved.Load(), busy.Load())
+	}
+
+	// Later exports update it
+	resp, err := h.save(ctx, client, "user-1", keyedRequest(), []string{"t3"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Created || resp.PlaylistID != "pl-1" {
+		t.Errorf("resp = %+v, want pl-1 updated", resp)
+	}
+
+	// Once the user deletes it, the next export makes and records a new one
+	api.followed.Store(false)
+	if resp, err = h.save(ctx, client, "user-1", keyedRequest(), []string{"t3"}); err != nil {
+		t.Fatal(err)
+	}
+	api.followed.Store(true)
+	if !resp.Created || resp.PlaylistID != "pl-2" {
+		t.Errorf("resp = %+v, want pl-2 created", resp)
+	}
+	if resp, _ = h.save(ctx, client, "user-1", keyedRequest(), nil); resp.PlaylistID != "pl-2" {
+		t.Errorf("resp = %+v, want pl-2 updated", resp)
+	}
+}
+
+func TestKeyedExportReleasesKeyOnFailure(t *testing.T) {
+	api := &fakePlaylistAPI{}
+	client := api.client(t)
+	h := newTestPlaylistHandler(newMemoryPlaylistKeys())
+	ctx := context.Background()
+
+	api.createFail.Store(true)
+	if _, err := h.save(ctx, client, "user-1", keyedRequest(), []string{"t1"}); err == nil {
+		t.Fatal("save succeeded with the create failing")
+	}
+	api.createFail.Store(false)
+
+	// Not left reserved until the hold lapses
+	resp, err := h.save(ctx, client, "user-1", keyedRequest(), []string{"t1"})
+	if err != nil {
+		t.Fatalf("save after a failed create: %v", err)
+	}
+	if !resp.Created {
+		t.Errorf("resp = %+v, want a new playlist", resp)
+	}
+}
+
+func TestPlaylistHandlerKeyWithoutStore(t *testing.T) {
+	h := NewPlaylistHandler(zap.NewNop().Sugar(), config.Config{}, spotify.NewMemoryTokenStore(nil), nil, nil, nil)
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{"keyed", `{"track_ids":["t1"],"name":"Daily","key":"discover-daily"}`, http.StatusServiceUnavailable},
+		// Unkeyed requests go on to the Spotify connection, which this user lacks
+		{"unkeyed", `{"track_ids":["t1"],"name":"Daily"}`, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/spotify/playlists", strings.NewReader(tt.body))
+			r = r.WithContext(auth.NewContext(r.Context(), &auth.Principal{UserID: "user-1"}))
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+		})
+	}
+}
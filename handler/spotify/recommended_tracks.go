@@ -1,22 +1,19 @@
 package spotify
 
 import (
-	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 
-	spot "github.com/zmb3/spotify/v2"
-
 	"github.com/mager/occipital/occipital"
-	"github.com/mager/occipital/spotify"
-	"github.com/mager/occipital/util"
+	"github.com/mager/occipital/recommend"
 	"go.uber.org/zap"
 )
 
 // RecommendedTracksHandler is an http.Handler
 type RecommendedTracksHandler struct {
-	log           *zap.SugaredLogger
-	spotifyClient *spotify.SpotifyClient
+	log    *zap.SugaredLogger
+	engine *recommend.Engine
 }
 
 func (*RecommendedTracksHandler) Pattern() string {
@@ -24,99 +21,79 @@ func (*RecommendedTracksHandler) Pattern() string {
 }
 
 // NewRecommendedTracksHandler builds a new RecommendedTracksHandler.
-func NewRecommendedTracksHandler(log *zap.SugaredLogger, spotifyClient *spotify.SpotifyClient) *RecommendedTracksHandler {
+func NewRecommendedTracksHandler(log *zap.SugaredLogger, engine *recommend.Engine) *RecommendedTracksHandler {
 	return &RecommendedTracksHandler{
-		log:           log,
-		spotifyClient: spotifyClient,
+		log:    log,
+		engine: engine,
 	}
 }
 
+// RecommendedTracksRequest takes up to five seeds in total. Genre is the
+// original single-genre form and counts as one genre seed.
 type RecommendedTracksRequest struct {
-	Genre string `json:"genre"`
+	Genre       string   `json:"genre,omitempty"`
+	SeedTracks  []string `json:"seed_tracks,omitempty"`  // Spotify track IDs
+	SeedArtists []string `json:"seed_artists,omitempty"` // Spotify artist IDs
+	SeedGenres  []string `json:"seed_genres,omitempty"`
+	Limit       int      `json:"limit,omitempty"`
 }
 
 type RecommendedTracksResponse struct {
 	Tracks []occipital.Track `json:"tracks"`
+	// Reasons explains each track, keyed by Spotify ID
+	Reasons map[string][]string `json:"reasons,omitempty"`
 }
 
-var (
-	genreMap = map[string]spot.Seeds{
-		// Special genres (combine)
-		"hot": {
-			Genres: []string{
-				"hip-hop",
-				"pop",
-				"rock",
-				"electronic",
-				"indie",
-			},
-		},
-		// Regular genres
-		"pop": {
-			Genres: []string{
-				"pop",
-			},
-		},
-		"country": {
-			Genres: []string{
-				"country",
-			},
-		},
-		"electronic": {
-			Genres: []string{
-				"electronic",
-			},
-		},
-		"hip-hop": {
-			Genres: []string{
-				"hip-hop",
-			},
-		},
-	}
-)
-
-// Get recommended tracks on Spotify
-// @Summary Get recommended tracks on Spotify
-// @Description Get the top featured tracks on Spotify
+// Get recommended tracks
+// @Summary Get recommended tracks
+// @Description Recommends tracks from seed tracks, artists or genres, ranked by audio feature similarity
 // @Tags Spotify
 // @Accept json
 // @Produce json
+// @Param request body RecommendedTracksRequest true "Seeds"
 // @Success 200 {object} RecommendedTracksResponse
+// @Failure 400 {object} map[string]string
 // @Router /spotify/recommended_tracks [post]
 func (h *RecommendedTracksHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	var req RecommendedTracksRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		http.Error(w, `{"error":"invalid request body"}`, http.StatusBadRequest)
 		return
 	}
 
-	ctx := context.Background()
-	seeds := genreMap[req.Genre]
+	seeds := recommend.Seeds{
+		Tracks:  req.SeedTracks,
+		Artists: req.SeedArtists,
+		Genres:  req.SeedGenres,
+	}
+	if req.Genre != "" {
+		seeds.Genres = append(seeds.Genres, req.Genre)
+	}
 
-	recs, err := h.spotifyClient.Client.GetRecommendations(ctx, seeds, nil, spot.Limit(48))
-	if err != nil {
-		http.Error(w, "featured playlist error: "+err.Error(), http.StatusInternalServerError)
+	recs, err := h.engine.Recommend(r.Context(), seeds, req.Limit)
+	switch {
+	case errors.Is(err, recommend.ErrUnknownGenre):
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]any{"error": err.Error(), "genres": recommend.Genres()})
+		return
+	case errors.Is(err, recommend.ErrNoSeeds), errors.Is(err, recommend.ErrTooManySeeds):
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	case err != nil:
+		h.log.Errorw("Failed to build recommendations", "err", err)
+		http.Error(w, `{"error":"failed to build recommendations"}`, http.StatusInternalServerError)
 		return
 	}
 
-	tracks := make([]occipital.Track, 0, 48)
-	for _, track := range recs.Tracks {
-		var t occipital.Track
-		t.Name = track.Name
-		t.Artist = util.GetFirstArtist(track.Artists)
-		t.Source = "SPOTIFY"
-		t.SourceID = string(track.ID)
-		thumb := util.GetThumb(track.Album)
-		if thumb != nil {
-			t.Image = *thumb
-		}
-		tracks = append(tracks, t)
+	resp := RecommendedTracksResponse{
+		Tracks:  make([]occipital.Track, 0, len(recs)),
+		Reasons: make(map[string][]string, len(recs)),
+	}
+	for _, rec := range recs {
+		resp.Tracks = append(resp.Tracks, rec.Track)
+		resp.Reasons[rec.Track.SourceID] = rec.Reasons
 	}
-
-	var resp RecommendedTracksResponse
-
-	resp.Tracks = tracks
 
 	json.NewEncoder(w).Encode(resp)
 }
@@ -0,0 +1,215 @@
+package spotify
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/mager/occipital/config"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// stateTTL is how long a user has to finish the Spotify consent screen.
+const stateTTL = 10 * time.Minute
+
+// oauthStateCollection holds one doc per outstanding login, keyed by nonce.
+// Docs are deleted when the callback consumes them; a Firestore TTL policy
+// on expires_at cleans up abandoned logins.
+const oauthStateCollection = "spotify_oauth_states"
+
+var (
+	// ErrStateForged is returned when the state signature doesn't verify
+	// or its contents don't match what we issued.
+	ErrStateForged = errors.New("oauth state forged")
+	// ErrStateExpired is returned when the state is past its expiry.
+	ErrStateExpired = errors.New("oauth state expired")
+	// ErrStateReplayed is returned when the state was already used.
+	ErrStateReplayed = errors.New("oauth state already used")
+)
+
+// oauthState is the signed payload sent to Spotify as the OAuth state.
+type oauthState struct {
+	UserID string `json:"uid"`
+	Nonce  string `json:"n"`
+	Expiry int64  `json:"exp"`
+}
+
+// pendingLogin is the server-side half of a login, including the PKCE
+// verifier which never leaves the server.
+type pendingLogin struct {
+	UserID    string    `firestore:"user_id"`
+	Verifier  string    `firestore:"verifier"`
+	ExpiresAt time.Time `firestore:"expires_at"`
+}
+
+// fallbackStateKey signs states when no secret is configured. States then
+// only verify on the instance that issued them.
+var fallbackStateKey = sync.OnceValue(func() []byte {
+	key := make([]byte, 32)
+	rand.Read(key)
+	return key
+})
+
+func stateKey(cfg config.Config) []byte {
+	if cfg.SpotifyStateSecret != "" {
+		return []byte(cfg.SpotifyStateSecret)
+	}
+	return fallbackStateKey()
+}
+
+// loginStore holds pending logins by nonce. take deletes the login it
+// returns, so each can only be consumed once.
+type loginStore interface {
+	put(ctx context.Context, nonce string, login pendingLogin) error
+	take(ctx context.Context, nonce string) (*pendingLogin, error)
+}
+
+// newLoginStore keeps pending logins in Firestore so any instance can
+// finish them, or in memory, shared by the login and callback handlers,
+// when Firestore isn't available.
+func newLoginStore(fs *firestore.Client) loginStore {
+	if fs == nil {
+		return fallbackLogins()
+	}
+	return firestoreLogins{fs: fs}
+}
+
+var fallbackLogins = sync.OnceValue(func() *memoryLogins {
+	return &memoryLogins{logins: make(map[string]pendingLogin)}
+})
+
+type firestoreLogins struct {
+	fs *firestore.Client
+}
+
+func (s firestoreLogins) put(ctx context.Context, nonce string, login pendingLogin) error {
+	_, err := s.fs.Collection(oauthStateCollection).Doc(nonce).Set(ctx, login)
+	return err
+}
+
+func (s firestoreLogins) take(ctx context.Context, nonce string) (*pendingLogin, error) {
+	var login pendingLogin
+	ref := s.fs.Collection(oauthStateCollection).Doc(nonce)
+	err := s.fs.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if status.Code(err) == codes.NotFound {
+			return ErrStateReplayed
+		}
+		if err != nil {
+			return err
+		}
+		if err := doc.DataTo(&login); err != nil {
+			return err
+		}
+		return tx.Delete(ref)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &login, nil
+}
+
+// memoryLogins only lets logins finish on the instance that started them.
+type memoryLogins struct {
+	mu     sync.Mutex
+	logins map[string]pendingLogin
+}
+
+func (s *memoryLogins) put(_ context.Context, nonce string, login pendingLogin) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// Drop abandoned logins, as the Firestore TTL policy does
+	now := time.Now()
+	for n, l := range s.logins {
+		if l.ExpiresAt.Before(now) {
+			delete(s.logins, n)
+		}
+	}
+	s.logins[nonce] = login
+	return nil
+}
+
+func (s *memoryLogins) take(_ context.Context, nonce string) (*pendingLogin, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	login, ok := s.logins[nonce]
+	if !ok {
+		return nil, ErrStateReplayed
+	}
+	delete(s.logins, nonce)
+	return &login, nil
+}
+
+// issueState records a pending login for userID and returns the signed state.
+func issueState(ctx context.Context, logins loginStore, key []byte, userID, verifier string) (string, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	st := oauthState{
+		UserID: userID,
+		Nonce:  base64.RawURLEncoding.EncodeToString(nonce),
+		Expiry: time.Now().Add(stateTTL).Unix(),
+	}
+
+	err := logins.put(ctx, st.Nonce, pendingLogin{
+		UserID:    userID,
+		Verifier:  verifier,
+		ExpiresAt: time.Unix(st.Expiry, 0),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	payload, err := json.Marshal(st)
+	if err != nil {
+		return "", err
+	}
+	enc := base64.RawURLEncoding.EncodeToString(payload)
+	return enc + "." + sign(key, enc), nil
+}
+
+// consumeState verifies a state and deletes its pending login so it can't
+// be used twice. It returns the user the login was started for and the
+// PKCE verifier to redeem the code with.
+func consumeState(ctx context.Context, logins loginStore, key []byte, state string) (*pendingLogin, error) {
+	enc, sig, ok := strings.Cut(state, ".")
+	if !ok || !hmac.Equal([]byte(sig), []byte(sign(key, enc))) {
+		return nil, ErrStateForged
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(enc)
+	if err != nil {
+		return nil, ErrStateForged
+	}
+	var st oauthState
+	if err := json.Unmarshal(payload, &st); err != nil || st.Nonce == "" || st.UserID == "" {
+		return nil, ErrStateForged
+	}
+	if time.Now().Unix() > st.Expiry {
+		return nil, ErrStateExpired
+	}
+
+	login, err := logins.take(ctx, st.Nonce)
+	if err != nil {
+		return nil, err
+	}
+	if login.UserID != st.UserID {
+		return nil, ErrStateForged
+	}
+	return login, nil
+}
+
+func sign(key []byte, data string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,166 @@
+package spotify
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mager/occipital/auth"
+	"github.com/mager/occipital/config"
+	"go.uber.org/zap"
+	"golang.org/x/oauth2"
+)
+
+var testStateKey = []byte("state-secret")
+
+func newTestLogins() *memoryLogins {
+	return &memoryLogins{logins: make(map[string]pendingLogin)}
+}
+
+// signedState signs st the way issueState does, without recording a login.
+func signedState(t *testing.T, key []byte, st oauthState) string {
+	t.Helper()
+	payload, err := json.Marshal(st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc := base64.RawURLEncoding.EncodeToString(payload)
+	return enc + "." + sign(key, enc)
+}
+
+func TestConsumeState(t *testing.T) {
+	ctx := context.Background()
+	logins := newTestLogins()
+	state, err := issueState(ctx, logins, testStateKey, "user-1", "verifier-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc, sig, _ := strings.Cut(state, ".")
+	payload, _ := base64.RawURLEncoding.DecodeString(enc)
+	var issued oauthState
+	json.Unmarshal(payload, &issued)
+
+	tampered := issued
+	tampered.UserID = "user-2"
+	// A login user-1 started, presented under a state re-signed for user-2
+	other, _ := issueState(ctx, logins, testStateKey, "user-1", "verifier-2")
+	otherEnc, _, _ := strings.Cut(other, ".")
+	otherPayload, _ := base64.RawURLEncoding.DecodeString(otherEnc)
+	var otherSt oauthState
+	json.Unmarshal(otherPayload, &otherSt)
+	otherSt.UserID = "user-2"
+
+	tests := []struct {
+		name  string
+		state string
+		want  error
+	}{
+		{"no signature", enc, ErrStateForged},
+		{"flipped signature", enc + "." + flipFirst(sig), ErrStateForged},
+		{"wrong key", signedState(t, []byte("other-secret"), issued), ErrStateForged},
+		{"payload swapped under the signature", base64.RawURLEncoding.EncodeToString(mustJSON(t, tampered)) + "." + sig, ErrStateForged},
+		{"not JSON", "bm90IGpzb24." + sign(testStateKey, "bm90IGpzb24"), ErrStateForged},
+		{"no nonce", signedState(t, testStateKey, oauthState{UserID: "user-1", Expiry: issued.Expiry}), ErrStateForged},
+		{"login started by another user", signedState(t, testStateKey, otherSt), ErrStateForged},
+		{"expired", signedState(t, testStateKey, oauthState{UserID: "user-1", Nonce: issued.Nonce, Expiry: time.Now().Add(-time.Second).Unix()}), ErrStateExpired},
+		{"unknown nonce", signedState(t, testStateKey, oauthState{UserID: "user-1", Nonce: "never-issued", Expiry: issued.Expiry}), ErrStateReplayed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := consumeState(ctx, logins, testStateKey, tt.state); !errors.Is(err, tt.want) {
+				t.Errorf("err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	// The valid state survived every rejected attempt, and works once
+	login, err := consumeState(ctx, logins, testStateKey, state)
+	if err != nil {
+		t.Fatalf("consumeState: %v", err)
+	}
+	if login.UserID != "user-1" || login.Verifier != "verifier-1" {
+		t.Errorf("login = %+v", login)
+	}
+	if _, err := consumeState(ctx, logins, testStateKey, state); !errors.Is(err, ErrStateReplayed) {
+		t.Errorf("second use: err = %v, want ErrStateReplayed", err)
+	}
+}
+
+// flipFirst changes the first character of s.
+func flipFirst(s string) string {
+	b := []byte(s)
+	b[0] ^= 1
+	return string(b)
+}
+
+func mustJSON(t *testing.T, v any) []byte {
+	t.Helper()
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestMemoryLoginsDropExpired(t *testing.T) {
+	ctx := context.Background()
+	logins := newTestLogins()
+	logins.put(ctx, "old", pendingLogin{UserID: "u", ExpiresAt: time.Now().Add(-time.Minute)})
+	logins.put(ctx, "new", pendingLogin{UserID: "u", ExpiresAt: time.Now().Add(time.Minute)})
+	if _, ok := logins.logins["old"]; ok {
+		t.Error("expired login kept")
+	}
+	if _, ok := logins.logins["new"]; !ok {
+		t.Error("live login dropped")
+	}
+}
+
+// The verifier behind the login URL's PKCE challenge comes back with the
+// state in the callback.
+func TestLoginPKCERoundTrip(t *testing.T) {
+	h := &AuthLoginHandler{
+		log:    zap.NewNop().Sugar(),
+		auth:   newAuthenticator(config.Config{SpotifyID: "client", SpotifyRedirectURL: "https://example.com/callback"}),
+		logins: newTestLogins(),
+		key:    testStateKey,
+	}
+	r := httptest.NewRequest(http.MethodGet, "/auth/spotify", nil)
+	r.Header.Set("Accept", "application/json")
+	r = r.WithContext(auth.NewContext(r.Context(), &auth.Principal{UserID: "user-1"}))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body)
+	}
+
+	var resp AuthLoginResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(resp.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	if q.Get("code_challenge_method") != "S256" {
+		t.Errorf("code_challenge_method = %q, want S256", q.Get("code_challenge_method"))
+	}
+
+	login, err := consumeState(context.Background(), h.logins, h.key, q.Get("state"))
+	if err != nil {
+		t.Fatalf("consumeState: %v", err)
+	}
+	if login.UserID != "user-1" {
+		t.Errorf("UserID = %q, want user-1", login.UserID)
+	}
+	if got := oauth2.S256ChallengeFromVerifier(login.Verifier); got != q.Get("code_challenge") {
+		t.Errorf("challenge of the stored verifier = %q, want %q", got, q.Get("code_challenge"))
+	}
+}
@@ -0,0 +1,210 @@
+package spotify
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/mager/occipital/cache"
+	"github.com/mager/occipital/config"
+	"github.com/mager/occipital/occipital"
+	"github.com/mager/occipital/spotify"
+	"github.com/mager/occipital/util"
+	spot "github.com/zmb3/spotify/v2"
+	spotifyauth "github.com/zmb3/spotify/v2/auth"
+	"go.uber.org/zap"
+)
+
+const (
+	tasteCacheNamespace  = "spotify_taste"
+	genresCacheNamespace = "spotify_track_genres"
+
+	// recentWeight caps how much recent plays alone say about an artist,
+	// compared to a long-run top artist
+	recentWeight = 0.5
+)
+
+var (
+	tastePolicy = cache.Policy{
+		TTL:                  6 * time.Hour,
+		StaleWhileRevalidate: 18 * time.Hour,
+	}
+	genresPolicy = cache.Policy{
+		TTL:                  24 * time.Hour,
+		StaleWhileRevalidate: 6 * 24 * time.Hour,
+	}
+
+	tasteScopes = []string{spotifyauth.ScopeUserTopRead, spotifyauth.ScopeUserReadRecentlyPlayed}
+)
+
+// TasteSource builds listening profiles for users who connected Spotify.
+type TasteSource struct {
+	log           *zap.SugaredLogger
+	cfg           config.Config
+	tokens        spotify.TokenStore
+	spotifyClient *spotify.SpotifyClient
+	cache         *cache.Loader
+}
+
+func NewTasteSource(log *zap.SugaredLogger, cfg config.Config, tokens spotify.TokenStore, spotifyClient *spotify.SpotifyClient, cache *cache.Loader) *TasteSource {
+	return &TasteSource{log: log, cfg: cfg, tokens: tokens, spotifyClient: spotifyClient, cache: cache}
+}
+
+// Taste returns the user's profile from their medium-term top artists and
+// recently played tracks. It returns spotify.ErrTokenNotFound if they never
+// connected and spotify.ErrInsufficientScope if they connected before
+// listening history was requested.
+func (t *TasteSource) Taste(ctx context.Context, userID string) (occipital.TasteProfile, error) {
+	// Check the connection on every call, so disconnecting takes effect
+	// even while a profile is cached
+	st, err := t.tokens.Get(ctx, userID)
+	if err != nil {
+		return occipital.TasteProfile{}, err
+	}
+	if len(st.Scopes) > 0 && !st.HasScopes(tasteScopes...) {
+		return occipital.TasteProfile{}, spotify.ErrInsufficientScope
+	}
+
+	key := cache.Key(tasteCacheNamespace, userID)
+	return cache.Fetch(ctx, t.cache, key, tastePolicy, func(ctx context.Context) (occipital.TasteProfile, error) {
+		return t.loadTaste(ctx, userID)
+	})
+}
+
+func (t *TasteSource) loadTaste(ctx context.Context, userID string) (occipital.TasteProfile, error) {
+	client, err := getUserSpotifyClient(ctx, t.log, t.cfg, t.tokens, userID)
+	if err != nil {
+		return occipital.TasteProfile{}, err
+	}
+
+	profile := occipital.TasteProfile{
+		Artists: make(map[string]float64),
+		Genres:  make(map[string]float64),
+	}
+
+	top, err := client.CurrentUsersTopArtists(ctx, spot.Timerange(spot.MediumTermRange), spot.Limit(50))
+	if err != nil {
+		return profile, scopeError(err)
+	}
+	for i, a := range top.Artists {
+		// Linear decay by rank: the top artist is 1, the last one close to 0
+		affinity := 1 - float64(i)/float64(len(top.Artists))
+		profile.Artists[a.Name] = max(profile.Artists[a.Name], affinity)
+		for _, g := range a.Genres {
+			profile.Genres[strings.ToLower(g)] += affinity
+		}
+	}
+
+	recent, err := client.PlayerRecentlyPlayedOpt(ctx, &spot.RecentlyPlayedOptions{Limit: 50})
+	if err != nil {
+		return profile, scopeError(err)
+	}
+	plays := make(map[string]int)
+	for _, item := range recent {
+		artist := util.GetFirstArtist(item.Track.Artists)
+		plays[artist]++
+		profile.KnownTracks = append(profile.KnownTracks, occipital.KnownTrack{
+			SpotifyID: item.Track.ID.String(),
+			Artist:    artist,
+			Name:      item.Track.Name,
+		})
+	}
+	for artist, n := range plays {
+		affinity := recentWeight * float64(n) / float64(len(recent))
+		profile.Artists[artist] = max(profile.Artists[artist], affinity)
+	}
+
+	normalize(profile.Genres)
+	t.log.Infow("Built taste profile", "user_id", userID, "artists", len(profile.Artists), "genres", len(profile.Genres), "known_tracks", len(profile.KnownTracks))
+	return profile, nil
+}
+
+// TrackGenres returns the genres of each track's primary artist, keyed by
+// Spotify track ID. The whole set is cached together since discover asks
+// for the same candidates until its sources update.
+func (t *TasteSource) TrackGenres(ctx context.Context, trackIDs []string) (map[string][]string, error) {
+	ids := slices.Clone(trackIDs)
+	slices.Sort(ids)
+	ids = slices.Compact(ids)
+	sum := sha256.Sum256([]byte(strings.Join(ids, ",")))
+
+	key := cache.Key(genresCacheNamespace, hex.EncodeToString(sum[:16]))
+	return cache.Fetch(ctx, t.cache, key, genresPolicy, func(ctx context.Context) (map[string][]string, error) {
+		return t.loadTrackGenres(ctx, ids)
+	})
+}
+
+func (t *TasteSource) loadTrackGenres(ctx context.Context, trackIDs []string) (map[string][]string, error) {
+	trackArtist := make(map[string]spot.ID, len(trackIDs))
+	for chunk := range slices.Chunk(trackIDs, 50) {
+		ids := make([]spot.ID, len(chunk))
+		for i, id := range chunk {
+			ids[i] = spot.ID(id)
+		}
+		tracks, err := t.spotifyClient.Client.GetTracks(ctx, ids)
+		if err != nil {
+			return nil, err
+		}
+		for _, ft := range tracks {
+			// Unknown IDs come back as nulls
+			if ft != nil && len(ft.Artists) > 0 {
+				trackArtist[ft.ID.String()] = ft.Artists[0].ID
+			}
+		}
+	}
+
+	var artistIDs []spot.ID
+	for _, id := range trackArtist {
+		artistIDs = append(artistIDs, id)
+	}
+	slices.Sort(artistIDs)
+	artistIDs = slices.Compact(artistIDs)
+
+	artistGenres := make(map[spot.ID][]string, len(artistIDs))
+	for chunk := range slices.Chunk(artistIDs, 50) {
+		artists, err := t.spotifyClient.Client.GetArtists(ctx, chunk...)
+		if err != nil {
+			return nil, err
+		}
+		for _, a := range artists {
+			if a != nil {
+				artistGenres[a.ID] = a.Genres
+			}
+		}
+	}
+
+	genres := make(map[string][]string, len(trackArtist))
+	for trackID, artistID := range trackArtist {
+		genres[trackID] = artistGenres[artistID]
+	}
+	return genres, nil
+}
+
+// scopeError maps Spotify's 403 for a token missing scopes to
+// spotify.ErrInsufficientScope.
+func scopeError(err error) error {
+	var spotErr spot.Error
+	if errors.As(err, &spotErr) && spotErr.Status == http.StatusForbidden && strings.Contains(strings.ToLower(spotErr.Message), "scope") {
+		return spotify.ErrInsufficientScope
+	}
+	return err
+}
+
+// normalize scales weights so the largest is 1.
+func normalize(weights map[string]float64) {
+	var top float64
+	for _, w := range weights {
+		top = max(top, w)
+	}
+	if top == 0 {
+		return
+	}
+	for k, w := range weights {
+		weights[k] = w / top
+	}
+}
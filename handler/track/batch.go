@@ -0,0 +1,466 @@
+package track
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"sync"
+
+	mb "github.com/mager/musicbrainz-go/musicbrainz"
+	"github.com/mager/occipital/cache"
+	"github.com/mager/occipital/musicbrainz"
+	"github.com/mager/occipital/occipital"
+	spot "github.com/zmb3/spotify/v2"
+	"go.uber.org/zap"
+)
+
+const (
+	maxBatchTracks = 100
+
+	// Spotify multi-get limits
+	spotifyTracksPerRequest   = 50
+	spotifyFeaturesPerRequest = 100
+
+	// isrcsPerSearch keeps bulk ISRC queries well under MusicBrainz's
+	// 100 result page even when an ISRC maps to several recordings.
+	isrcsPerSearch = 50
+
+	// spotifyISRCSearches bounds concurrent Spotify searches by ISRC,
+	// which have no multi-get equivalent.
+	spotifyISRCSearches = 8
+
+	// coverArtLookups bounds concurrent cover art lookups for recordings
+	// Spotify doesn't have.
+	coverArtLookups = 8
+)
+
+var (
+	errSpotifyLookup     = errors.New("spotify lookup failed")
+	errMusicBrainzLookup = errors.New("musicbrainz lookup failed")
+)
+
+// GetTracksBatchHandler is an http.Handler
+type GetTracksBatchHandler struct {
+	log    *zap.SugaredLogger
+	tracks *TrackResolver
+}
+
+func (*GetTracksBatchHandler) Pattern() string {
+	return "/tracks/batch"
+}
+
+// NewGetTracksBatchHandler builds a new GetTracksBatchHandler.
+func NewGetTracksBatchHandler(log *zap.SugaredLogger, tracks *TrackResolver) *GetTracksBatchHandler {
+	return &GetTracksBatchHandler{
+		log:    log,
+		tracks: tracks,
+	}
+}
+
+// BatchTrackID identifies one track. When several IDs are set, spotifyId
+// wins, then mbid, then isrc.
+type BatchTrackID struct {
+	SpotifyID string `json:"spotifyId,omitempty"`
+	ISRC      string `json:"isrc,omitempty"`
+	MBID      string `json:"mbid,omitempty"`
+}
+
+type GetTracksBatchRequest struct {
+	IDs []BatchTrackID `json:"ids"`
+}
+
+// BatchTrackResult holds either the track or the reason it couldn't be resolved.
+type BatchTrackResult struct {
+	Request BatchTrackID     `json:"request"`
+	Track   *occipital.Track `json:"track,omitempty"`
+	Error   string           `json:"error,omitempty"`
+}
+
+type GetTracksBatchResponse struct {
+	Tracks []BatchTrackResult `json:"tracks"`
+}
+
+// Get tracks in batch
+// @Summary Get tracks in batch
+// @Description Resolve up to 100 tracks by Spotify ID, ISRC or MusicBrainz ID. Results are in request order; tracks that can't be resolved carry an error instead.
+// @Accept json
+// @Produce json
+// @Param request body GetTracksBatchRequest true "Track identifiers"
+// @Success 200 {object} GetTracksBatchResponse
+// @Router /tracks/batch [post]
+func (h *GetTracksBatchHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodPost {
+		http.Error(w, `{"error":"method not allowed"}`, http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req GetTracksBatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error":"invalid request body"}`, http.StatusBadRequest)
+		return
+	}
+	if len(req.IDs) == 0 {
+		http.Error(w, `{"error":"ids required"}`, http.StatusBadRequest)
+		return
+	}
+	if len(req.IDs) > maxBatchTracks {
+		http.Error(w, fmt.Sprintf(`{"error":"at most %d ids per request"}`, maxBatchTracks), http.StatusBadRequest)
+		return
+	}
+
+	ids := make([]TrackID, len(req.IDs))
+	for i, id := range req.IDs {
+		ids[i] = TrackID{SpotifyID: id.SpotifyID, MBID: id.MBID, ISRC: id.ISRC}
+	}
+	found := h.tracks.LookupBatch(r.Context(), ids)
+
+	results := make([]BatchTrackResult, len(found))
+	for i, f := range found {
+		results[i].Request = req.IDs[i]
+		if f.Err != nil {
+			results[i].Error = f.Err.Error()
+			continue
+		}
+		track := f.Track
+		results[i].Track = &track
+	}
+	json.NewEncoder(w).Encode(GetTracksBatchResponse{Tracks: results})
+}
+
+// TrackResult is one track from LookupBatch, or why it couldn't be found.
+type TrackResult struct {
+	Track occipital.Track
+	Err   error
+}
+
+// batchItem tracks one requested ID through the lookup stages.
+type batchItem struct {
+	track     occipital.Track
+	spotifyID string
+	full      *spot.FullTrack
+	recording *mb.Recording
+	cached    bool
+	err       error
+}
+
+// LookupBatch looks tracks up in as few upstream calls as possible, for
+// callers with many IDs at once. Results are in the order of ids.
+//
+//	cache       → track_cache_v2 hits for Spotify IDs are returned as-is
+//	mbid        → one MusicBrainz search for all recording IDs
+//	isrc        → Spotify search per ISRC to find the Spotify track
+//	spotify     → GetTracks and GetAudioFeatures in chunks
+//	musicbrainz → bulk ISRC search for anything still without an MBID
+func (r *TrackResolver) LookupBatch(ctx context.Context, ids []TrackID) []TrackResult {
+	items := make([]*batchItem, len(ids))
+	for i, id := range ids {
+		it := &batchItem{}
+		switch {
+		case id.SpotifyID != "":
+			it.spotifyID = id.SpotifyID
+		case id.MBID != "":
+			it.track.ID = id.MBID
+		case id.ISRC != "":
+			it.track.ISRC = id.ISRC
+		default:
+			it.err = errMissingTrackID
+		}
+		items[i] = it
+	}
+
+	r.readCache(ctx, items)
+	r.resolveMBIDs(ctx, items)
+	r.resolveISRCs(ctx, items)
+	r.fetchSpotify(ctx, items)
+	r.enrichMusicBrainz(ctx, items)
+
+	// Recordings without a Spotify track fetch their cover art
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, coverArtLookups)
+	for _, it := range items {
+		if !it.pending() {
+			continue
+		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(it *batchItem) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			r.assemble(ctx, it)
+			if it.track.Name == "" {
+				it.err = ErrTrackNotFound
+			}
+		}(it)
+	}
+	wg.Wait()
+
+	results := make([]TrackResult, len(ids))
+	for i, it := range items {
+		results[i] = TrackResult{Track: it.track, Err: it.err}
+	}
+	return results
+}
+
+// pending reports whether the item still needs upstream lookups.
+func (it *batchItem) pending() bool {
+	return it.err == nil && !it.cached
+}
+
+// readCache serves Spotify IDs from the track cache. Batch results are
+// never written back since they lack the audio analysis the cache holds.
+func (r *TrackResolver) readCache(ctx context.Context, items []*batchItem) {
+	hits := 0
+	for _, it := range items {
+		if it.spotifyID == "" || it.err != nil {
+			continue
+		}
+		if track, ok := cache.Peek[occipital.Track](ctx, r.cache, cache.Key(trackCacheCollection, it.spotifyID)); ok {
+			it.track = track
+			it.cached = true
+			hits++
+		}
+	}
+	r.log.Infow("Batch cache lookup", "hits", hits, "total", len(items))
+}
+
+// resolveMBIDs looks up requested recordings in a single MusicBrainz search.
+func (r *TrackResolver) resolveMBIDs(ctx context.Context, items []*batchItem) {
+	var mbids []string
+	for _, it := range items {
+		if it.pending() && it.spotifyID == "" && it.track.ID != "" {
+			mbids = append(mbids, it.track.ID)
+		}
+	}
+	if len(mbids) == 0 {
+		return
+	}
+
+	recs, err := r.musicbrainzClient.SearchRecordingsByIDs(ctx, mbids)
+	if err != nil {
+		r.log.Warnw("MusicBrainz recording lookup failed", "count", len(mbids), "error", err)
+	}
+	for _, it := range items {
+		if !it.pending() || it.spotifyID != "" || it.track.ID == "" {
+			continue
+		}
+		rec, ok := recs[it.track.ID]
+		if !ok {
+			it.err = ErrTrackNotFound
+			if err != nil {
+				it.err = errMusicBrainzLookup
+			}
+			continue
+		}
+		it.recording = &rec
+		if rec.ISRCs != nil && len(*rec.ISRCs) > 0 {
+			it.track.ISRC = (*rec.ISRCs)[0]
+		}
+	}
+}
+
+// resolveISRCs finds the Spotify track for items known only by ISRC.
+func (r *TrackResolver) resolveISRCs(ctx context.Context, items []*batchItem) {
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, spotifyISRCSearches)
+
+	for _, it := range items {
+		if !it.pending() || it.spotifyID != "" || it.track.ISRC == "" {
+			continue
+		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(it *batchItem) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if ft, _ := r.searchSpotifyByISRC(ctx, it.track.ISRC); ft != nil {
+				it.full = ft
+				it.spotifyID = string(ft.ID)
+			}
+		}(it)
+	}
+	wg.Wait()
+}
+
+// fetchSpotify fills in Spotify tracks and audio features using the
+// multi-get endpoints.
+func (r *TrackResolver) fetchSpotify(ctx context.Context, items []*batchItem) {
+	var trackIDs, featureIDs []spot.ID
+	seenTrack := make(map[string]bool)
+	seenFeature := make(map[string]bool)
+	for _, it := range items {
+		if !it.pending() || it.spotifyID == "" {
+			continue
+		}
+		if it.full == nil && !seenTrack[it.spotifyID] {
+			seenTrack[it.spotifyID] = true
+			trackIDs = append(trackIDs, spot.ID(it.spotifyID))
+		}
+		if !seenFeature[it.spotifyID] {
+			seenFeature[it.spotifyID] = true
+			featureIDs = append(featureIDs, spot.ID(it.spotifyID))
+		}
+	}
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		tracks   = make(map[string]*spot.FullTrack)
+		features = make(map[string]*spot.AudioFeatures)
+		failed   = make(map[string]bool)
+	)
+
+	for start := 0; start < len(trackIDs); start += spotifyTracksPerRequest {
+		chunk := trackIDs[start:min(start+spotifyTracksPerRequest, len(trackIDs))]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			fts, err := r.spotifyClient.Client.GetTracks(ctx, chunk)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				r.log.Warnw("Spotify GetTracks failed", "count", len(chunk), "error", err)
+				for _, id := range chunk {
+					failed[string(id)] = true
+				}
+				return
+			}
+			// Unknown IDs come back as nil entries in request order
+			for i, ft := range fts {
+				if ft != nil && i < len(chunk) {
+					tracks[string(chunk[i])] = ft
+				}
+			}
+		}()
+	}
+
+	for start := 0; start < len(featureIDs); start += spotifyFeaturesPerRequest {
+		chunk := featureIDs[start:min(start+spotifyFeaturesPerRequest, len(featureIDs))]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			afs, err := r.spotifyClient.Client.GetAudioFeatures(ctx, chunk...)
+			if err != nil {
+				r.log.Warnw("Spotify GetAudioFeatures failed", "count", len(chunk), "error", err)
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			for i, af := range afs {
+				if af != nil && i < len(chunk) {
+					features[string(chunk[i])] = af
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	for _, it := range items {
+		if !it.pending() || it.spotifyID == "" {
+			continue
+		}
+		if it.full == nil {
+			it.full = tracks[it.spotifyID]
+		}
+		if af, ok := features[it.spotifyID]; ok {
+			applyAudioFeatures(&it.track, af)
+		}
+		if it.full == nil && it.recording == nil {
+			if failed[it.spotifyID] {
+				it.err = errSpotifyLookup
+			} else {
+				it.err = ErrTrackNotFound
+			}
+		}
+	}
+}
+
+// enrichMusicBrainz attaches MusicBrainz recordings by ISRC to every track
+// that doesn't have one yet.
+func (r *TrackResolver) enrichMusicBrainz(ctx context.Context, items []*batchItem) {
+	var isrcs []string
+	seen := make(map[string]bool)
+	for _, it := range items {
+		if !it.pending() || it.recording != nil {
+			continue
+		}
+		isrc := it.track.ISRC
+		if isrc == "" && it.full != nil {
+			isrc = it.full.ExternalIDs["isrc"]
+		}
+		if isrc != "" && !seen[isrc] {
+			seen[isrc] = true
+			isrcs = append(isrcs, isrc)
+		}
+	}
+	if len(isrcs) == 0 {
+		return
+	}
+
+	var (
+		wg    sync.WaitGroup
+		mu    sync.Mutex
+		cands = make(map[string][]musicbrainz.RecordingCandidate)
+	)
+	for start := 0; start < len(isrcs); start += isrcsPerSearch {
+		chunk := isrcs[start:min(start+isrcsPerSearch, len(isrcs))]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			found, err := r.musicbrainzClient.SearchRecordingCandidatesByBulkISRC(ctx, chunk)
+			if err != nil {
+				r.log.Warnw("MusicBrainz bulk ISRC search failed", "count", len(chunk), "error", err)
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			maps.Copy(cands, found)
+		}()
+	}
+	wg.Wait()
+
+	// Pick among recordings sharing an ISRC the way fetch does, against
+	// each item's own Spotify track
+	for _, it := range items {
+		if !it.pending() || it.recording != nil {
+			continue
+		}
+		isrc := it.track.ISRC
+		if isrc == "" && it.full != nil {
+			isrc = it.full.ExternalIDs["isrc"]
+		}
+		var hint musicbrainz.RecordingHint
+		if it.full != nil {
+			hint = isrcHintFor(isrc, it.full).hint
+		}
+		m, ok := musicbrainz.Disambiguate(cands[isrc], hint)
+		if !ok {
+			continue
+		}
+		for _, c := range cands[isrc] {
+			if c.ID == m.MBID {
+				it.recording = &c.Recording
+				it.track.RecordingMatch = recordingMatchFrom(m)
+				break
+			}
+		}
+	}
+}
+
+// assemble builds the track from whatever the lookups found, the way fetch
+// does. Spotify catalog data wins over MusicBrainz for the display fields.
+func (r *TrackResolver) assemble(ctx context.Context, it *batchItem) {
+	if it.full != nil {
+		applySpotifyTrack(&it.track, it.full)
+		it.track.SourceID = it.spotifyID
+		it.track.Source = "SPOTIFY"
+	}
+	if it.recording != nil {
+		r.applyRecording(ctx, &it.track, *it.recording, it.full != nil, nil)
+	}
+}
@@ -0,0 +1,130 @@
+package track
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mager/occipital/cache"
+	"github.com/mager/occipital/collab"
+	"github.com/mager/occipital/musicbrainz"
+	"github.com/mager/occipital/occipital"
+	"github.com/mager/occipital/spotify"
+	spot "github.com/zmb3/spotify/v2"
+	"go.uber.org/zap"
+)
+
+func TestTracksBatchFromCache(t *testing.T) {
+	log := zap.NewNop().Sugar()
+	mem := cache.NewMemory(10)
+	putTrack(t, mem, cache.Key(trackCacheCollection, "sp1"), occipital.Track{ID: "mbid-1", SourceID: "sp1", Name: "Hey Jude"})
+	// Every ID is cached or invalid, so no upstream client is needed
+	r := NewTrackResolver(log, nil, nil, nil, cache.NewLoader(mem, log), NewSimilarIndex(log), collab.New())
+	h := NewGetTracksBatchHandler(log, r)
+
+	body := `{"ids":[{"spotifyId":"sp1"},{},{"spotifyId":"sp1","isrc":"GBAYE0601498"}]}`
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/tracks/batch", strings.NewReader(body)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d", w.Code)
+	}
+
+	var resp GetTracksBatchResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Tracks) != 3 {
+		t.Fatalf("got %d results, want 3", len(resp.Tracks))
+	}
+	for _, i := range []int{0, 2} {
+		if res := resp.Tracks[i]; res.Track == nil || res.Track.Name != "Hey Jude" {
+			t.Errorf("result %d = %+v, want the cached track", i, res)
+		}
+	}
+	if res := resp.Tracks[2]; res.Request.ISRC != "GBAYE0601498" {
+		t.Errorf("request not echoed: %+v", res.Request)
+	}
+	if res := resp.Tracks[1]; res.Track != nil || res.Error != errMissingTrackID.Error() {
+		t.Errorf("result 1 = %+v, want %q", res, errMissingTrackID)
+	}
+}
+
+// fakeUpstreams serves Spotify under /spotify, MusicBrainz under /mb and the
+// Cover Art Archive under /caa. MusicBrainz searches are answered by the
+// first matching prefix of the query in recordings; everything else is empty.
+func fakeUpstreams(t *testing.T, spotifyRoutes map[string]string, recordings map[string]string) *TrackResolver {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/spotify/"):
+			body, ok := spotifyRoutes[strings.TrimPrefix(r.URL.Path, "/spotify/")]
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			fmt.Fprint(w, body)
+		case r.URL.Path == "/mb/recording":
+			q := r.URL.Query().Get("query")
+			for prefix, body := range recordings {
+				if strings.HasPrefix(q, prefix) {
+					fmt.Fprintf(w, `{"count":1,"recordings":[%s]}`, body)
+					return
+				}
+			}
+			fmt.Fprint(w, `{"count":0,"recordings":[]}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	cfg := musicbrainz.SchedulerConfig{Rate: 100, Burst: 10}
+	mbClient := musicbrainz.NewClient(srv.URL+"/mb", srv.URL+"/caa", srv.Client(), cfg, cfg)
+	t.Cleanup(mbClient.Stop)
+
+	log := zap.NewNop().Sugar()
+	return NewTrackResolver(
+		log,
+		&spotify.SpotifyClient{Client: spot.New(srv.Client(), spot.WithBaseURL(srv.URL+"/spotify/"))},
+		mbClient,
+		nil,
+		cache.NewLoader(cache.NewMemory(10), log),
+		NewSimilarIndex(log),
+		collab.New(),
+	)
+}
+
+// Search results carry no relationships, which every stage after the
+// MusicBrainz lookups has to cope with.
+func TestLookupBatchFromMusicBrainzSearch(t *testing.T) {
+	r := fakeUpstreams(t,
+		map[string]string{
+			"search": `{"tracks":{"items":[]}}`,
+			"tracks": `{"tracks":[{"id":"sp2","name":"Bohemian Rhapsody","duration_ms":354320,
+				"artists":[{"id":"q","name":"Queen"}],"external_ids":{"isrc":"GBUM71029604"}}]}`,
+			"audio-features": `{"audio_features":[null]}`,
+		},
+		map[string]string{
+			"rid:": `{"id":"mbid-1","title":"Hey Jude","isrcs":["GBAYE0601498"],
+				"artist-credit":[{"name":"The Beatles","artist":{"id":"b","name":"The Beatles"}}],
+				"releases":[{"id":"rel-1","title":"Hey Jude","status":"Official"}]}`,
+			"isrc:": `{"id":"mbid-2","title":"Bohemian Rhapsody","length":354320,"isrcs":["GBUM71029604"],
+				"artist-credit":[{"name":"Queen","artist":{"id":"q","name":"Queen"}}]}`,
+		},
+	)
+
+	got := r.LookupBatch(context.Background(), []TrackID{{MBID: "mbid-1"}, {SpotifyID: "sp2"}})
+	if len(got) != 2 {
+		t.Fatalf("got %d results, want 2", len(got))
+	}
+	if res := got[0]; res.Err != nil || res.Track.ID != "mbid-1" || res.Track.Name != "Hey Jude" || res.Track.Artist != "The Beatles" {
+		t.Errorf("mbid result = %+v, %v; want the recording", res.Track, res.Err)
+	}
+	if res := got[1]; res.Err != nil || res.Track.ID != "mbid-2" || res.Track.SourceID != "sp2" || res.Track.Name != "Bohemian Rhapsody" {
+		t.Errorf("spotify result = %+v, %v; want the Spotify track enriched by ISRC", res.Track, res.Err)
+	}
+}
@@ -0,0 +1,32 @@
+package track
+
+import (
+	"context"
+	"time"
+
+	"github.com/mager/occipital/cache"
+	"github.com/mager/occipital/musicbrainz"
+)
+
+const coverArtCacheCollection = "coverart_cache"
+
+// Cover art rarely changes once uploaded, and releases without art are
+// common, so both hits and misses are kept for a long time.
+var coverArtCachePolicy = cache.Policy{
+	TTL:                  30 * 24 * time.Hour,
+	StaleWhileRevalidate: 30 * 24 * time.Hour,
+}
+
+// getCoverArtWithLog returns the Cover Art Archive listing for a release
+// through the shared cache. Lookup failures yield an empty listing and the
+// error, which isn't cached.
+func (r *TrackResolver) getCoverArtWithLog(ctx context.Context, releaseID string) (musicbrainz.CoverArtListing, error) {
+	key := cache.Key(coverArtCacheCollection, releaseID)
+	listing, err := cache.Fetch(ctx, r.cache, key, coverArtCachePolicy, func(ctx context.Context) (musicbrainz.CoverArtListing, error) {
+		return r.musicbrainzClient.GetCoverArt(ctx, releaseID)
+	})
+	if err != nil {
+		r.log.Warnw("Cover Art Archive lookup failed", "release_id", releaseID, "error", err)
+	}
+	return listing, err
+}
@@ -0,0 +1,83 @@
+package track
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/mager/occipital/cache"
+	"github.com/mager/occipital/collab"
+	"github.com/mager/occipital/occipital"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+const (
+	// indexLoadLimit caps the tracks read per namespace at startup; the
+	// indexes pick up the rest as tracks are resolved.
+	indexLoadLimit = 50000
+	// indexLoadTimeout gives up on a load that stalls on the backend.
+	indexLoadTimeout = 5 * time.Minute
+)
+
+var errIndexLoadLimit = errors.New("index load limit reached")
+
+// ProvideCollabGraph returns an empty collaboration graph. LoadIndexes seeds
+// it and the resolver keeps it current as tracks are served.
+func ProvideCollabGraph() *collab.Graph {
+	return collab.New()
+}
+
+// LoadIndexes seeds the similar index and the collaboration graph from the
+// track caches in the background once the app starts. Both are fed from
+// the same scan, so each cached track is read once.
+func LoadIndexes(lc fx.Lifecycle, log *zap.SugaredLogger, loader *cache.Loader, ix *SimilarIndex, g *collab.Graph) {
+	ctx, cancel := context.WithTimeout(context.Background(), indexLoadTimeout)
+	lc.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			go func() {
+				defer cancel()
+				loadIndexes(ctx, log, loader, ix, g, indexLoadLimit)
+			}()
+			return nil
+		},
+		OnStop: func(context.Context) error {
+			cancel()
+			return nil
+		},
+	})
+}
+
+func loadIndexes(ctx context.Context, log *zap.SugaredLogger, loader *cache.Loader, ix *SimilarIndex, g *collab.Graph, limit int) {
+	t0 := time.Now()
+	for _, ns := range []string{trackCacheCollection, mbidCacheCollection} {
+		n := 0
+		err := cache.Scan(ctx, loader, ns, func(key string, t occipital.Track) error {
+			if n == limit {
+				return errIndexLoadLimit
+			}
+			n++
+			// The MBID cache is keyed by recording, not Spotify ID
+			if ns == trackCacheCollection {
+				_, id, _ := strings.Cut(key, "/")
+				ix.Add(id, t)
+			}
+			g.AddTrack(t)
+			return nil
+		})
+		switch {
+		case errors.Is(err, cache.ErrScanUnsupported):
+			log.Infow("Track cache can't be scanned; track indexes fill as tracks resolve")
+			return
+		case errors.Is(err, errIndexLoadLimit):
+			log.Warnw("Track indexes hit the load limit", "namespace", ns, "limit", limit)
+		case err != nil:
+			if ctx.Err() != context.Canceled {
+				log.Warnw("Failed to load track indexes", "namespace", ns, "error", err, "tracks", ix.Len(), "creators", g.Len())
+			}
+			return
+		}
+	}
+	log.Infow("Loaded track indexes", "tracks", ix.Len(), "creators", g.Len(), "ms", time.Since(t0).Milliseconds())
+}
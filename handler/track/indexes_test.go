@@ -0,0 +1,66 @@
+package track
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/mager/occipital/cache"
+	"github.com/mager/occipital/collab"
+	"github.com/mager/occipital/occipital"
+	"go.uber.org/zap"
+)
+
+func putTrack(t *testing.T, c cache.Cache, key string, track occipital.Track) {
+	t.Helper()
+	b, err := json.Marshal(track)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	c.Set(context.Background(), key, &cache.Entry{Value: b, CachedAt: now, ExpiresAt: now.Add(time.Hour)})
+}
+
+func indexedTrackFixture(id, artistID string) occipital.Track {
+	return occipital.Track{
+		ID:       "mbid-" + id,
+		Name:     "Track " + id,
+		Features: &occipital.TrackFeatures{Energy: 0.5},
+		Meta:     &occipital.TrackMeta{Tempo: 120},
+		ArtistCredits: []occipital.CreditArtist{
+			{ID: artistID, Name: artistID},
+			{ID: "shared", Name: "Shared"},
+		},
+	}
+}
+
+func TestLoadIndexes(t *testing.T) {
+	mem := cache.NewMemory(10)
+	putTrack(t, mem, cache.Key(trackCacheCollection, "sp1"), indexedTrackFixture("1", "a"))
+	putTrack(t, mem, cache.Key(trackCacheCollection, "sp2"), indexedTrackFixture("2", "b"))
+	// Recordings only cached by MBID feed the graph but not the index
+	putTrack(t, mem, cache.Key(mbidCacheCollection, "mbid-3"), indexedTrackFixture("3", "c"))
+	loader := cache.NewLoader(mem, zap.NewNop().Sugar())
+
+	tests := []struct {
+		name             string
+		limit            int
+		tracks, creators int
+	}{
+		{name: "unbounded", limit: 100, tracks: 2, creators: 4},
+		{name: "limited per namespace", limit: 1, tracks: 1, creators: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ix, g := NewSimilarIndex(zap.NewNop().Sugar()), collab.New()
+			loadIndexes(context.Background(), zap.NewNop().Sugar(), loader, ix, g, tt.limit)
+			if ix.Len() != tt.tracks {
+				t.Errorf("indexed %d tracks, want %d", ix.Len(), tt.tracks)
+			}
+			if g.Len() != tt.creators {
+				t.Errorf("graph has %d creators, want %d", g.Len(), tt.creators)
+			}
+		})
+	}
+}
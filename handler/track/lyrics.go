@@ -0,0 +1,187 @@
+package track
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mager/occipital/musixmatch"
+	"github.com/mager/occipital/occipital"
+	"go.uber.org/zap"
+)
+
+// lrcTimestamp matches LRC line timestamps like [01:23.45] or [01:23]
+var lrcTimestamp = regexp.MustCompile(`\[(\d+):(\d{2})(?:[.:](\d{1,3}))?\]`)
+
+// GetTrackLyricsHandler is an http.Handler
+type GetTrackLyricsHandler struct {
+	log              *zap.SugaredLogger
+	tracks           *TrackResolver
+	musixmatchClient *musixmatch.MusixmatchClient
+}
+
+func (*GetTrackLyricsHandler) Pattern() string {
+	return "/track/lyrics"
+}
+
+// NewGetTrackLyricsHandler builds a new GetTrackLyricsHandler.
+func NewGetTrackLyricsHandler(
+	log *zap.SugaredLogger,
+	tracks *TrackResolver,
+	musixmatchClient *musixmatch.MusixmatchClient,
+) *GetTrackLyricsHandler {
+	return &GetTrackLyricsHandler{
+		log:              log,
+		tracks:           tracks,
+		musixmatchClient: musixmatchClient,
+	}
+}
+
+type GetTrackLyricsResponse struct {
+	Lyrics occipital.TrackLyrics `json:"lyrics"`
+}
+
+// LyricsErrorResponse is returned when lyrics can't be served.
+// Code is stable and safe for clients to switch on.
+type LyricsErrorResponse struct {
+	Error string `json:"error"`
+	Code  string `json:"code"`
+}
+
+// Get track lyrics
+// @Summary Get track lyrics
+// @Description Get plain and synced lyrics for a track from Musixmatch
+// @Produce json
+// @Success 200 {object} GetTrackLyricsResponse
+// @Failure 404 {object} LyricsErrorResponse
+// @Failure 502 {object} LyricsErrorResponse
+// @Failure 503 {object} LyricsErrorResponse
+// @Router /track/lyrics [get]
+// @Param spotifyId query string false "Spotify track ID"
+// @Param isrc query string false "ISRC"
+// @Param mbid query string false "MusicBrainz recording ID"
+func (h *GetTrackLyricsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx := r.Context()
+	q := r.URL.Query()
+
+	// Don't spend Spotify and MusicBrainz calls on a lookup that can't succeed
+	if !h.musixmatchClient.Configured() {
+		writeLyricsError(w, musixmatch.ErrMissingAPIKey)
+		return
+	}
+
+	id := TrackID{
+		SpotifyID: q.Get("spotifyId"),
+		MBID:      q.Get("mbid"),
+		ISRC:      q.Get("isrc"),
+	}
+	lyrics, err := h.tracks.Lyrics(ctx, id)
+	if err != nil {
+		h.log.Warnw("Failed to fetch lyrics", "spotify_id", id.SpotifyID, "mbid", id.MBID, "isrc", id.ISRC, "error", err)
+		writeLyricsError(w, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(GetTrackLyricsResponse{Lyrics: *lyrics})
+}
+
+// applyLyrics copies Musixmatch lyrics onto out, keeping any name and
+// artist already known.
+func applyLyrics(out *occipital.TrackLyrics, l *musixmatch.Lyrics) {
+	if out.Name == "" {
+		out.Name = l.TrackName
+	}
+	if out.Artist == "" {
+		out.Artist = l.ArtistName
+	}
+	out.Lyrics = l.Body
+	out.Copyright = l.Copyright
+	out.Explicit = l.Explicit
+	out.LRC = l.Subtitle
+	out.Language = l.SubtitleLanguage
+	out.Synced = parseLRC(l.Subtitle)
+}
+
+var (
+	errMissingTrackID = errors.New("one of spotifyId, isrc or mbid is required")
+	// ErrTrackNotFound means no source has the track
+	ErrTrackNotFound = errors.New("track not found")
+	// ErrTrackUpstream means the source that would find the track failed, so
+	// whether it exists isn't known
+	ErrTrackUpstream = errors.New("track source unavailable")
+)
+
+func writeLyricsError(w http.ResponseWriter, err error) {
+	status := http.StatusBadGateway
+	resp := LyricsErrorResponse{Error: "lyrics provider error", Code: "provider_error"}
+
+	switch {
+	case errors.Is(err, errMissingTrackID):
+		status = http.StatusBadRequest
+		resp = LyricsErrorResponse{Error: err.Error(), Code: "missing_track_id"}
+	case errors.Is(err, ErrTrackNotFound), errors.Is(err, musixmatch.ErrTrackNotFound):
+		status = http.StatusNotFound
+		resp = LyricsErrorResponse{Error: "track not found", Code: "track_not_found"}
+	case errors.Is(err, ErrTrackUpstream):
+		resp = LyricsErrorResponse{Error: "track source unavailable", Code: "track_source_unavailable"}
+	case errors.Is(err, musixmatch.ErrLyricsUnavailable):
+		status = http.StatusNotFound
+		resp = LyricsErrorResponse{Error: "lyrics unavailable for this track", Code: "lyrics_unavailable"}
+	case errors.Is(err, musixmatch.ErrMissingAPIKey):
+		status = http.StatusServiceUnavailable
+		resp = LyricsErrorResponse{Error: "lyrics provider not configured", Code: "provider_not_configured"}
+	case errors.Is(err, musixmatch.ErrUnauthorized):
+		status = http.StatusServiceUnavailable
+		resp = LyricsErrorResponse{Error: "lyrics provider rejected the API key", Code: "provider_unauthorized"}
+	}
+
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// parseLRC converts an LRC body into timed lines. Lines without a timestamp
+// (metadata tags, blank lines) are skipped.
+func parseLRC(body string) []occipital.LyricsLine {
+	if body == "" {
+		return nil
+	}
+
+	var lines []occipital.LyricsLine
+	for _, raw := range strings.Split(body, "\n") {
+		raw = strings.TrimSpace(raw)
+		matches := lrcTimestamp.FindAllStringSubmatchIndex(raw, -1)
+		if len(matches) == 0 || matches[0][0] != 0 {
+			continue
+		}
+		text := strings.TrimSpace(raw[matches[len(matches)-1][1]:])
+
+		// A line may carry several timestamps when it repeats
+		for _, m := range matches {
+			minutes, _ := strconv.Atoi(raw[m[2]:m[3]])
+			seconds, _ := strconv.Atoi(raw[m[4]:m[5]])
+			ms := 0
+			if m[6] >= 0 {
+				frac := raw[m[6]:m[7]]
+				ms, _ = strconv.Atoi(frac)
+				// Normalize hundredths/tenths to milliseconds
+				for i := len(frac); i < 3; i++ {
+					ms *= 10
+				}
+			}
+			lines = append(lines, occipital.LyricsLine{
+				TimeMs: (minutes*60+seconds)*1000 + ms,
+				Text:   text,
+			})
+		}
+	}
+
+	sort.SliceStable(lines, func(i, j int) bool {
+		return lines[i].TimeMs < lines[j].TimeMs
+	})
+	return lines
+}
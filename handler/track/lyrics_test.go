@@ -0,0 +1,166 @@
+package track
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	mxm "github.com/mager/go-musixmatch"
+	"github.com/mager/occipital/cache"
+	"github.com/mager/occipital/collab"
+	"github.com/mager/occipital/musixmatch"
+	"github.com/mager/occipital/occipital"
+	"go.uber.org/zap"
+)
+
+func TestParseLRC(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want []occipital.LyricsLine
+	}{
+		{name: "empty", body: "", want: nil},
+		{
+			name: "hundredths",
+			body: "[00:12.34]Hey Jude\n[01:02.50]Don't make it bad",
+			want: []occipital.LyricsLine{
+				{TimeMs: 12340, Text: "Hey Jude"},
+				{TimeMs: 62500, Text: "Don't make it bad"},
+			},
+		},
+		{
+			name: "milliseconds, tenths and no fraction",
+			body: "[00:01.005]a\n[00:02.5]b\n[00:03]c\n[00:04:20]d",
+			want: []occipital.LyricsLine{
+				{TimeMs: 1005, Text: "a"},
+				{TimeMs: 2500, Text: "b"},
+				{TimeMs: 3000, Text: "c"},
+				{TimeMs: 4200, Text: "d"},
+			},
+		},
+		{
+			name: "metadata, blank and untimed lines are skipped",
+			body: "[ar:The Beatles]\n[ti:Hey Jude]\n\nno timestamp\n  [00:05.00]  padded  \r\n",
+			want: []occipital.LyricsLine{{TimeMs: 5000, Text: "padded"}},
+		},
+		{
+			name: "repeated line is expanded and sorted",
+			body: "[00:30.00][00:10.00]Na na na\n[00:20.00]Hey Jude",
+			want: []occipital.LyricsLine{
+				{TimeMs: 10000, Text: "Na na na"},
+				{TimeMs: 20000, Text: "Hey Jude"},
+				{TimeMs: 30000, Text: "Na na na"},
+			},
+		},
+		{
+			name: "instrumental break",
+			body: "[00:10.00]\n[00:15.00]back",
+			want: []occipital.LyricsLine{
+				{TimeMs: 10000, Text: ""},
+				{TimeMs: 15000, Text: "back"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseLRC(tt.body); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseLRC() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteLyricsError(t *testing.T) {
+	tests := []struct {
+		err    error
+		status int
+		code   string
+	}{
+		{errMissingTrackID, http.StatusBadRequest, "missing_track_id"},
+		{ErrTrackNotFound, http.StatusNotFound, "track_not_found"},
+		{musixmatch.ErrTrackNotFound, http.StatusNotFound, "track_not_found"},
+		{fmt.Errorf("%w: spotify timeout", ErrTrackUpstream), http.StatusBadGateway, "track_source_unavailable"},
+		{musixmatch.ErrLyricsUnavailable, http.StatusNotFound, "lyrics_unavailable"},
+		{musixmatch.ErrMissingAPIKey, http.StatusServiceUnavailable, "provider_not_configured"},
+		{musixmatch.ErrUnauthorized, http.StatusServiceUnavailable, "provider_unauthorized"},
+		{fmt.Errorf("wrapped: %w", musixmatch.ErrUnauthorized), http.StatusServiceUnavailable, "provider_unauthorized"},
+		{errors.New("musixmatch: track.get returned status 500"), http.StatusBadGateway, "provider_error"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			writeLyricsError(w, tt.err)
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d", w.Code, tt.status)
+			}
+			var resp LyricsErrorResponse
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			if resp.Code != tt.code {
+				t.Errorf("code = %q, want %q", resp.Code, tt.code)
+			}
+		})
+	}
+}
+
+func TestLyricsWithoutAPIKeySkipsLookup(t *testing.T) {
+	// No Spotify or MusicBrainz client: a lookup would panic
+	h := &GetTrackLyricsHandler{
+		log:              zap.NewNop().Sugar(),
+		musixmatchClient: &musixmatch.MusixmatchClient{},
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/track/lyrics?spotifyId=4uLU6hMCjMI75M1A2tKUQC", nil))
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusServiceUnavailable)
+	}
+	var resp LyricsErrorResponse
+	json.NewDecoder(w.Body).Decode(&resp)
+	if resp.Code != "provider_not_configured" {
+		t.Errorf("code = %q, want provider_not_configured", resp.Code)
+	}
+}
+
+func TestLyricsUsesResolvedTrack(t *testing.T) {
+	var gotISRC string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/track.get":
+			gotISRC = r.URL.Query().Get("track_isrc")
+			fmt.Fprint(w, `{"message":{"header":{"status_code":200},"body":{"track":{"track_id":42,"has_lyrics":1}}}}`)
+		case "/track.lyrics.get":
+			fmt.Fprint(w, `{"message":{"header":{"status_code":200},"body":{"lyrics":{"lyrics_body":"Hey Jude"}}}}`)
+		default:
+			fmt.Fprint(w, `{"message":{"header":{"status_code":404},"body":[]}}`)
+		}
+	}))
+	defer srv.Close()
+
+	mx := mxm.New("test-key", srv.Client())
+	mx.BaseURL = srv.URL
+	log := zap.NewNop().Sugar()
+	mem := cache.NewMemory(10)
+	// Served from the cache, so no Spotify or MusicBrainz client is needed
+	putTrack(t, mem, cache.Key(trackCacheCollection, "sp1"), occipital.Track{
+		ID: "mbid-1", SourceID: "sp1", Name: "Hey Jude", Artist: "The Beatles", ISRC: "GBAYE0601498",
+	})
+	r := NewTrackResolver(log, nil, nil, &musixmatch.MusixmatchClient{Client: mx}, cache.NewLoader(mem, log), NewSimilarIndex(log), collab.New())
+
+	l, err := r.Lyrics(context.Background(), TrackID{SpotifyID: "sp1"})
+	if err != nil {
+		t.Fatalf("Lyrics: %v", err)
+	}
+	if gotISRC != "GBAYE0601498" {
+		t.Errorf("looked up ISRC %q, want the resolved track's", gotISRC)
+	}
+	if l.ID != "mbid-1" || l.Name != "Hey Jude" || l.Lyrics != "Hey Jude" {
+		t.Errorf("lyrics = %+v", l)
+	}
+}
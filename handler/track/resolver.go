@@ -0,0 +1,714 @@
+package track
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	mb "github.com/mager/musicbrainz-go/musicbrainz"
+	"github.com/mager/occipital/cache"
+	"github.com/mager/occipital/collab"
+	"github.com/mager/occipital/musicbrainz"
+	"github.com/mager/occipital/musixmatch"
+	"github.com/mager/occipital/occipital"
+	"github.com/mager/occipital/spotify"
+	"github.com/mager/occipital/util"
+	spot "github.com/zmb3/spotify/v2"
+	"go.uber.org/zap"
+)
+
+// recordingIncludes is everything a track takes from a MusicBrainz recording.
+var recordingIncludes = []mb.Include{
+	"artist-credits",
+	"artist-rels",
+	"genres",
+	"isrcs",
+	"releases",
+	"work-rels",
+	"url-rels",
+}
+
+// Include selects the optional stages of a lookup.
+type Include uint8
+
+const (
+	// IncludeCredits keeps instrument, production and song credits.
+	IncludeCredits Include = 1 << iota
+	// IncludeAnalysis keeps the Spotify audio analysis.
+	IncludeAnalysis
+	// IncludeReleases adds official releases with their cover art.
+	IncludeReleases
+	// IncludeLyrics adds lyrics from Musixmatch.
+	IncludeLyrics
+
+	includeAll = IncludeCredits | IncludeAnalysis | IncludeReleases | IncludeLyrics
+)
+
+var includeNames = []struct {
+	name    string
+	include Include
+}{
+	{"credits", IncludeCredits},
+	{"analysis", IncludeAnalysis},
+	{"releases", IncludeReleases},
+	{"lyrics", IncludeLyrics},
+}
+
+// ParseInclude reads a comma-separated ?include= list. Empty means def,
+// "none" means the core track only and "all" every stage.
+func ParseInclude(raw string, def Include) (Include, error) {
+	if strings.TrimSpace(raw) == "" {
+		return def, nil
+	}
+	var in Include
+	for _, name := range strings.Split(raw, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		switch name {
+		case "", "none":
+			continue
+		case "all":
+			in |= includeAll
+			continue
+		}
+		found := false
+		for _, n := range includeNames {
+			if n.name == name {
+				in |= n.include
+				found = true
+			}
+		}
+		if !found {
+			return 0, fmt.Errorf("unknown include %q; use credits, analysis, releases or lyrics", name)
+		}
+	}
+	return in, nil
+}
+
+func (in Include) Has(stage Include) bool {
+	return in&stage != 0
+}
+
+// TrackID identifies a track. When several IDs are set, SpotifyID wins,
+// then MBID, then ISRC.
+type TrackID struct {
+	SpotifyID string
+	MBID      string
+	ISRC      string
+}
+
+// TrackResolver is the one track lookup pipeline:
+//
+//	identify → fetch Spotify and MusicBrainz in parallel → merge → cache → enrich
+//
+// The cached track carries credits and analysis, so any request can be
+// served from it; releases' cover art and lyrics are fetched per request
+// when included.
+type TrackResolver struct {
+	log               *zap.SugaredLogger
+	spotifyClient     *spotify.SpotifyClient
+	musicbrainzClient *musicbrainz.MusicbrainzClient
+	musixmatchClient  *musixmatch.MusixmatchClient
+	cache             *cache.Loader
+	similar           *SimilarIndex
+	graph             *collab.Graph
+}
+
+// NewTrackResolver builds a new TrackResolver.
+func NewTrackResolver(
+	log *zap.SugaredLogger,
+	spotifyClient *spotify.SpotifyClient,
+	musicbrainzClient *musicbrainz.MusicbrainzClient,
+	musixmatchClient *musixmatch.MusixmatchClient,
+	cache *cache.Loader,
+	similar *SimilarIndex,
+	graph *collab.Graph,
+) *TrackResolver {
+	return &TrackResolver{
+		log:               log,
+		spotifyClient:     spotifyClient,
+		musicbrainzClient: musicbrainzClient,
+		musixmatchClient:  musixmatchClient,
+		cache:             cache,
+		similar:           similar,
+		graph:             graph,
+	}
+}
+
+// Resolve returns the cached track for a Spotify ID with credits and
+// analysis, for callers inside the service.
+func (r *TrackResolver) Resolve(ctx context.Context, spotifyId string) (occipital.Track, error) {
+	return r.core(ctx, TrackID{SpotifyID: spotifyId})
+}
+
+// cachedFeatureReads bounds concurrent track cache reads in CachedFeatures.
+const cachedFeatureReads = 16
+
+// CachedFeatures returns the audio features of tracks already resolved, from
+// the similar index or, failing that, the track cache. It never calls
+// Spotify, so tracks nobody has resolved are left out.
+func (r *TrackResolver) CachedFeatures(ctx context.Context, spotifyIDs []string) map[string]*occipital.TrackFeatures {
+	out := r.similar.Features(spotifyIDs)
+
+	var (
+		mu  sync.Mutex
+		wg  sync.WaitGroup
+		sem = make(chan struct{}, cachedFeatureReads)
+	)
+	for _, id := range spotifyIDs {
+		if _, ok := out[id]; ok || id == "" {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			// Written by another instance since the index loaded
+			t, ok := cache.Peek[occipital.Track](ctx, r.cache, cache.Key(trackCacheCollection, id))
+			if !ok || t.Features == nil {
+				return
+			}
+			r.index(t)
+			mu.Lock()
+			out[id] = t.Features
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	return out
+}
+
+// Lookup runs the pipeline for id and returns the stages in include.
+func (r *TrackResolver) Lookup(ctx context.Context, id TrackID, include Include) (occipital.Track, error) {
+	id, err := r.identify(ctx, id)
+	if err != nil {
+		return occipital.Track{}, err
+	}
+	track, err := r.core(ctx, id)
+	if err != nil {
+		return track, err
+	}
+
+	if !include.Has(IncludeCredits) {
+		track.Instruments = nil
+		track.ProductionCredits = nil
+		track.SongCredits = nil
+	}
+	if !include.Has(IncludeAnalysis) {
+		track.Analysis = nil
+		track.Structure = nil
+	}
+	src := newSourceSet(track.Sources)
+	if include.Has(IncludeReleases) {
+		track.Releases = r.releaseImages(ctx, track.Releases, src)
+	} else {
+		track.Releases = nil
+	}
+	if include.Has(IncludeLyrics) {
+		track.Lyrics = r.lyrics(ctx, track, src)
+	}
+	track.Sources = src.statuses()
+	return track, nil
+}
+
+// identify narrows id to a Spotify ID or MBID. ISRCs go to Spotify first
+// and MusicBrainz when Spotify doesn't know them.
+func (r *TrackResolver) identify(ctx context.Context, id TrackID) (TrackID, error) {
+	switch {
+	case id.SpotifyID != "", id.MBID != "":
+		return id, nil
+	case id.ISRC == "":
+		return id, errMissingTrackID
+	}
+
+	if ft, _ := r.searchSpotifyByISRC(ctx, id.ISRC); ft != nil {
+		id.SpotifyID = string(ft.ID)
+		return id, nil
+	}
+	m, _, err := r.matchRecording(ctx, id.ISRC, musicbrainz.RecordingHint{}, nil)
+	if err != nil {
+		r.log.Warnw("MB ISRC search failed or empty", "isrc", id.ISRC, "error", err)
+		return id, lookupError(err)
+	}
+	id.MBID = m.MBID
+	return id, nil
+}
+
+// searchSpotifyByISRC returns the first Spotify track with isrc, or nil if
+// there is none.
+func (r *TrackResolver) searchSpotifyByISRC(ctx context.Context, isrc string) (*spot.FullTrack, error) {
+	results, err := r.spotifyClient.Client.Search(ctx, "isrc:"+isrc, spot.SearchTypeTrack, spot.Limit(1))
+	if err != nil {
+		r.log.Warnw("Spotify ISRC search failed", "isrc", isrc, "error", err)
+		return nil, err
+	}
+	if results.Tracks == nil || len(results.Tracks.Tracks) == 0 {
+		return nil, nil
+	}
+	return &results.Tracks.Tracks[0], nil
+}
+
+// core returns the cached track, keyed by Spotify ID or, for recordings
+// Spotify doesn't have, by MBID. Every track served is added to the
+// similar index and collaboration graph. Tracks built while an upstream failed are cached briefly;
+// see degradedTrack.
+func (r *TrackResolver) core(ctx context.Context, id TrackID) (occipital.Track, error) {
+	key := cache.Key(mbidCacheCollection, id.MBID)
+	policy := mbidCachePolicy
+	if id.SpotifyID != "" {
+		key = cache.Key(trackCacheCollection, id.SpotifyID)
+		policy = trackCachePolicy
+	}
+
+	track, err := cache.Fetch(ctx, r.cache, key, policy, func(ctx context.Context) (occipital.Track, error) {
+		r.log.Infow("Cache miss — fetching", "spotify_id", id.SpotifyID, "mbid", id.MBID)
+		var (
+			track occipital.Track
+			err   error
+			src   = newSourceSet(nil)
+		)
+		if id.SpotifyID != "" {
+			track = r.fetch(ctx, id.SpotifyID, nil, src)
+		} else {
+			track, err = r.fetchByMBID(ctx, id.MBID, src)
+		}
+		if err != nil {
+			return track, err
+		}
+		track.Sources = src.statuses()
+		if track.Name == "" {
+			// Don't cache an empty shell when nothing could find the track.
+			// If Spotify failed rather than answered, the track may exist.
+			if src.failed(sourceSpotifyTrack) {
+				return track, fmt.Errorf("%w: spotify %s", ErrTrackUpstream, track.Sources[sourceSpotifyTrack].Error)
+			}
+			return track, ErrTrackNotFound
+		}
+		// Index on write so background revalidations refresh it too
+		r.index(track)
+		return track, nil
+	})
+	if err != nil {
+		return track, err
+	}
+	// Hits too, since another instance may have written the entry
+	r.index(track)
+	return track, nil
+}
+
+// index adds a served track to the similar index and collaboration graph.
+func (r *TrackResolver) index(track occipital.Track) {
+	r.similar.Add(track.SourceID, track)
+	r.graph.AddTrack(track)
+}
+
+// fetchByMBID fetches the recording, finds it on Spotify by its link or
+// ISRC, and builds the track from both.
+func (r *TrackResolver) fetchByMBID(ctx context.Context, mbid string, src *sourceSet) (occipital.Track, error) {
+	t0 := time.Now()
+	rec, err := r.musicbrainzClient.GetRecording(ctx, mb.GetRecordingRequest{
+		ID:       mbid,
+		Includes: recordingIncludes,
+	})
+	src.record(sourceMBRecording, t0, err, false)
+	if err != nil {
+		return occipital.Track{}, lookupError(err)
+	}
+	if rec.ID == "" || rec.ArtistCredits == nil {
+		return occipital.Track{}, ErrTrackNotFound
+	}
+
+	spotifyID := spotifyIDFromRecording(rec.Recording)
+	if spotifyID == "" && rec.ISRCs != nil && len(*rec.ISRCs) > 0 {
+		t0 := time.Now()
+		ft, err := r.searchSpotifyByISRC(ctx, (*rec.ISRCs)[0])
+		src.record(sourceSpotifySearch, t0, err, ft == nil)
+		if ft != nil {
+			spotifyID = string(ft.ID)
+		}
+	}
+	return r.fetch(ctx, spotifyID, &rec.Recording, src), nil
+}
+
+// spotifyIDFromRecording returns the Spotify track linked from a recording.
+func spotifyIDFromRecording(rec mb.Recording) string {
+	for _, link := range getExternalLinksForRecording(rec) {
+		if link.Type != "spotify" {
+			continue
+		}
+		if _, id, ok := strings.Cut(link.URL, "/track/"); ok {
+			id, _, _ = strings.Cut(id, "?")
+			return id
+		}
+	}
+	return ""
+}
+
+// fetch fans out all external calls optimally:
+//
+//	t=0 → Spotify: GetTrack, GetAudioFeatures, GetAudioAnalysis (all concurrent)
+//	t=ISRC → MusicBrainz: SearchByISRC → GetRecording → GetWork (starts as soon as GetTrack returns ISRC)
+//
+// With no Spotify ID only MusicBrainz is used, and a recording passed in
+// skips the MusicBrainz search. Each call's outcome is recorded in src.
+func (r *TrackResolver) fetch(ctx context.Context, spotifyId string, recording *mb.Recording, src *sourceSet) occipital.Track {
+	l := r.log
+	sid := spot.ID(spotifyId)
+
+	// isrcCh carries the ISRC from GetTrack to the MB goroutine.
+	// Buffered so the Spotify goroutine never blocks.
+	isrcCh := make(chan isrcHint, 1)
+
+	var (
+		mu         sync.Mutex
+		fullTrack  *spot.FullTrack
+		audioFeats []*spot.AudioFeatures
+		audioAnal  *spot.AudioAnalysis
+		mbWork     *mb.Work
+		mbMatch    *occipital.RecordingMatch
+	)
+
+	var wg sync.WaitGroup
+
+	// Only search MusicBrainz by ISRC if we weren't handed the recording
+	searchMB := recording == nil
+	if spotifyId == "" || !searchMB {
+		close(isrcCh)
+	}
+
+	if spotifyId != "" {
+		// --- Spotify: GetTrack ---
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if searchMB {
+				defer close(isrcCh) // always unblock MB goroutine
+			}
+			t0 := time.Now()
+			ft, err := r.spotifyClient.Client.GetTrack(ctx, sid)
+			src.record(sourceSpotifyTrack, t0, err, false)
+			if err != nil {
+				l.Warnw("GetTrack failed", "error", err)
+				return
+			}
+			l.Infow("GetTrack", "ms", time.Since(t0).Milliseconds())
+			mu.Lock()
+			fullTrack = ft
+			mu.Unlock()
+			if isrc, ok := ft.ExternalIDs["isrc"]; ok && isrc != "" && searchMB {
+				isrcCh <- isrcHintFor(isrc, ft)
+			}
+		}()
+
+		// --- Spotify: GetAudioFeatures ---
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			t0 := time.Now()
+			f, err := r.spotifyClient.Client.GetAudioFeatures(ctx, sid)
+			src.record(sourceSpotifyFeatures, t0, err, len(f) == 0 || f[0] == nil)
+			if err != nil {
+				l.Warnw("GetAudioFeatures failed", "error", err)
+				return
+			}
+			l.Infow("GetAudioFeatures", "ms", time.Since(t0).Milliseconds())
+			mu.Lock()
+			audioFeats = f
+			mu.Unlock()
+		}()
+
+		// --- Spotify: GetAudioAnalysis ---
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			t0 := time.Now()
+			a, err := r.spotifyClient.Client.GetAudioAnalysis(ctx, sid)
+			src.record(sourceSpotifyAnalysis, t0, err, false)
+			if err != nil {
+				l.Warnw("GetAudioAnalysis failed", "error", err)
+				return
+			}
+			l.Infow("GetAudioAnalysis", "ms", time.Since(t0).Milliseconds())
+			mu.Lock()
+			audioAnal = a
+			mu.Unlock()
+		}()
+	}
+
+	// --- MusicBrainz: starts as soon as ISRC arrives ---
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		rec := recording
+		if searchMB {
+			var match *occipital.RecordingMatch
+			rec, match = r.recordingForISRC(ctx, isrcCh, src)
+			if rec == nil {
+				return
+			}
+			mu.Lock()
+			recording = rec
+			mbMatch = match
+			mu.Unlock()
+		}
+
+		// Work lookup — serial dep on recording, but concurrent with Spotify analysis
+		work := r.getWorkFromRecordingWithLog(ctx, *rec, src)
+		if work != nil {
+			mu.Lock()
+			mbWork = work
+			mu.Unlock()
+		}
+	}()
+
+	wg.Wait()
+
+	// --- Merge: Spotify wins the display fields ---
+	var track occipital.Track
+	if spotifyId != "" {
+		track.SourceID = spotifyId
+		track.Source = "SPOTIFY"
+	}
+	if fullTrack != nil {
+		applySpotifyTrack(&track, fullTrack)
+	}
+	if len(audioFeats) > 0 && audioFeats[0] != nil {
+		applyAudioFeatures(&track, audioFeats[0])
+	}
+	if audioAnal != nil {
+		track.Analysis = analysisFrom(audioAnal)
+		track.Structure = structureFrom(audioAnal, track.Analysis)
+	}
+	if recording != nil {
+		r.applyRecording(ctx, &track, *recording, fullTrack != nil, src)
+	}
+	if mbWork != nil {
+		track.SongCredits = getSongCreditsForWork(*mbWork)
+	}
+	track.RecordingMatch = mbMatch
+
+	return track
+}
+
+// isrcHint is the ISRC from Spotify with what helps pick its recording.
+type isrcHint struct {
+	isrc string
+	hint musicbrainz.RecordingHint
+}
+
+func isrcHintFor(isrc string, ft *spot.FullTrack) isrcHint {
+	h := isrcHint{
+		isrc: isrc,
+		hint: musicbrainz.RecordingHint{
+			DurationMs: int(ft.Duration),
+			Title:      ft.Name,
+		},
+	}
+	for _, a := range ft.Artists {
+		h.hint.Artists = append(h.hint.Artists, a.Name)
+	}
+	return h
+}
+
+// recordingForISRC waits for the ISRC from Spotify and fetches the
+// recording that best matches the Spotify track.
+func (r *TrackResolver) recordingForISRC(ctx context.Context, isrcCh <-chan isrcHint, src *sourceSet) (*mb.Recording, *occipital.RecordingMatch) {
+	l := r.log
+	h, ok := <-isrcCh
+	if !ok || h.isrc == "" {
+		return nil, nil
+	}
+	t0 := time.Now()
+	m, rec, err := r.matchRecording(ctx, h.isrc, h.hint, src)
+	if err != nil {
+		l.Warnw("MB ISRC search failed or empty", "isrc", h.isrc, "error", err)
+		return nil, nil
+	}
+	l.Infow("MB ISRC resolved", "mbid", m.MBID, "confidence", m.Confidence, "alternates", len(m.Alternates), "ms", time.Since(t0).Milliseconds())
+
+	if rec == nil {
+		t1 := time.Now()
+		resp, err := r.musicbrainzClient.GetRecording(ctx, mb.GetRecordingRequest{
+			ID:       m.MBID,
+			Includes: recordingIncludes,
+		})
+		src.record(sourceMBRecording, t1, err, false)
+		if err != nil {
+			l.Warnw("MB GetRecording failed", "mbid", m.MBID, "error", err)
+			return nil, nil
+		}
+		l.Infow("MB GetRecording", "mbid", m.MBID, "ms", time.Since(t1).Milliseconds())
+		rec = &resp.Recording
+	}
+	return rec, recordingMatchFrom(m)
+}
+
+// matchRecording picks among the recordings sharing an ISRC. When the top
+// two score too close to call, both are looked up and rescored with their
+// relations, and the chosen one is returned in full. src may be nil.
+func (r *TrackResolver) matchRecording(ctx context.Context, isrc string, hint musicbrainz.RecordingHint, src *sourceSet) (musicbrainz.Match, *mb.Recording, error) {
+	t0 := time.Now()
+	cands, err := r.musicbrainzClient.SearchRecordingCandidatesByISRC(ctx, isrc)
+	src.record(sourceMBSearch, t0, err, len(cands) == 0)
+	if err != nil {
+		return musicbrainz.Match{}, nil, err
+	}
+	m, ok := musicbrainz.Disambiguate(cands, hint)
+	if !ok {
+		return m, nil, ErrTrackNotFound
+	}
+	if !m.Ambiguous() {
+		return m, nil, nil
+	}
+
+	t1 := time.Now()
+	full := make(map[string]*mb.Recording, 2)
+	for _, mbid := range []string{m.MBID, m.Alternates[0].MBID} {
+		resp, err := r.musicbrainzClient.GetRecording(ctx, mb.GetRecordingRequest{
+			ID:       mbid,
+			Includes: recordingIncludes,
+		})
+		if err != nil {
+			r.log.Warnw("MB GetRecording failed", "mbid", mbid, "error", err)
+			continue
+		}
+		full[mbid] = &resp.Recording
+		for i := range cands {
+			if cands[i].ID == mbid {
+				cands[i].Recording = resp.Recording
+			}
+		}
+	}
+	m, _ = musicbrainz.Disambiguate(cands, hint)
+	rec := full[m.MBID]
+	if rec != nil {
+		src.record(sourceMBRecording, t1, nil, false)
+	}
+	return m, rec, nil
+}
+
+func recordingMatchFrom(m musicbrainz.Match) *occipital.RecordingMatch {
+	out := &occipital.RecordingMatch{
+		MBID:       m.MBID,
+		Confidence: math.Round(m.Confidence*1000) / 1000,
+	}
+	for _, a := range m.Alternates {
+		out.Alternates = append(out.Alternates, occipital.RecordingAlternate{
+			MBID:  a.MBID,
+			Score: math.Round(a.Score*1000) / 1000,
+		})
+	}
+	return out
+}
+
+// applyRecording copies MusicBrainz data onto track. Without Spotify the
+// recording also supplies the display fields and cover art.
+func (r *TrackResolver) applyRecording(ctx context.Context, track *occipital.Track, rec mb.Recording, hasSpotify bool, src *sourceSet) {
+	track.ID = rec.ID
+	track.ArtistCredits = getArtistCreditsForRecording(rec)
+	track.Instruments = getArtistInstrumentsForRecording(rec)
+	track.ProductionCredits = getProductionCreditsForRecording(rec)
+	track.Genres = getGenresForRecording(rec)
+	track.Releases = releasesFromRecording(rec)
+
+	if hasSpotify {
+		for _, link := range getExternalLinksForRecording(rec) {
+			if link.Type != "spotify" {
+				track.Links = append(track.Links, link)
+			}
+		}
+		return
+	}
+
+	track.Name = rec.Title
+	track.ReleaseDate = rec.FirstReleaseDate
+	if rec.ArtistCredits != nil {
+		track.Artist = util.GetArtistCreditsFromRecording(*rec.ArtistCredits)
+	}
+	if track.ISRC == "" && rec.ISRCs != nil && len(*rec.ISRCs) > 0 {
+		track.ISRC = (*rec.ISRCs)[0]
+	}
+	t0 := time.Now()
+	image, err := r.getLatestReleaseImageURLWithLog(ctx, rec)
+	src.record(sourceCoverArt, t0, err, image == "")
+	track.Image = image
+	track.Links = getExternalLinksForRecording(rec)
+}
+
+func (r *TrackResolver) getWorkFromRecordingWithLog(ctx context.Context, rec mb.Recording, src *sourceSet) *mb.Work {
+	if rec.Relations == nil {
+		return nil
+	}
+	for _, relation := range *rec.Relations {
+		if relation.TargetType == "work" {
+			t0 := time.Now()
+			work, err := r.musicbrainzClient.GetWork(ctx, mb.GetWorkRequest{
+				ID:       relation.Work.ID,
+				Includes: []mb.Include{"artist-rels", "url-rels"},
+			})
+			src.record(sourceMBWork, t0, err, false)
+			if err != nil {
+				r.log.Errorf("error fetching work: %v", err)
+				return nil
+			}
+			return &work.Work
+		}
+	}
+	return nil
+}
+
+// Lyrics identifies the track and fetches its lyrics. An ISRC neither
+// Spotify nor MusicBrainz knows is still tried on Musixmatch, which matches
+// ISRCs itself.
+func (r *TrackResolver) Lyrics(ctx context.Context, id TrackID) (*occipital.TrackLyrics, error) {
+	track, err := r.Lookup(ctx, id, 0)
+	switch {
+	case errors.Is(err, ErrTrackNotFound) && id.ISRC != "":
+		track = occipital.Track{ISRC: id.ISRC}
+	case err != nil:
+		return nil, err
+	}
+	// An explicitly requested ISRC wins over the one from the recording
+	if id.SpotifyID == "" && id.ISRC != "" {
+		track.ISRC = id.ISRC
+	}
+	return r.fetchLyrics(ctx, track, nil)
+}
+
+// lyrics fetches lyrics for the track, or nil if Musixmatch has none.
+func (r *TrackResolver) lyrics(ctx context.Context, track occipital.Track, src *sourceSet) *occipital.TrackLyrics {
+	out, err := r.fetchLyrics(ctx, track, src)
+	if err != nil {
+		r.log.Warnw("Failed to fetch lyrics", "isrc", track.ISRC, "error", err)
+		return nil
+	}
+	return out
+}
+
+// fetchLyrics looks the track up on Musixmatch by ISRC, then title and
+// artist. src may be nil.
+func (r *TrackResolver) fetchLyrics(ctx context.Context, track occipital.Track, src *sourceSet) (*occipital.TrackLyrics, error) {
+	t0 := time.Now()
+	l, err := r.musixmatchClient.GetLyrics(ctx, musixmatch.LyricsQuery{
+		ISRC:   track.ISRC,
+		Title:  track.Name,
+		Artist: track.Artist,
+	})
+	src.record(sourceLyrics, t0, err, false)
+	if err != nil {
+		return nil, err
+	}
+	out := &occipital.TrackLyrics{
+		ID:       track.ID,
+		SourceID: track.SourceID,
+		ISRC:     track.ISRC,
+		Name:     track.Name,
+		Artist:   track.Artist,
+	}
+	applyLyrics(out, l)
+	return out, nil
+}
@@ -0,0 +1,64 @@
+package track
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mager/occipital/cache"
+	"github.com/mager/occipital/collab"
+	"github.com/mager/occipital/spotify"
+	spot "github.com/zmb3/spotify/v2"
+	"go.uber.org/zap"
+)
+
+// fakeSpotifyResolver returns a resolver whose Spotify calls all answer
+// with status.
+func fakeSpotifyResolver(t *testing.T, status int) *TrackResolver {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		fmt.Fprintf(w, `{"error":{"status":%d,"message":"fake"}}`, status)
+	}))
+	t.Cleanup(srv.Close)
+
+	log := zap.NewNop().Sugar()
+	return NewTrackResolver(
+		log,
+		&spotify.SpotifyClient{Client: spot.New(srv.Client(), spot.WithBaseURL(srv.URL+"/"))},
+		nil,
+		nil,
+		cache.NewLoader(cache.NewMemory(10), log),
+		NewSimilarIndex(log),
+		collab.New(),
+	)
+}
+
+func TestResolveMapsSpotifyFailures(t *testing.T) {
+	tests := []struct {
+		status int
+		want   error
+	}{
+		{http.StatusNotFound, ErrTrackNotFound},
+		{http.StatusInternalServerError, ErrTrackUpstream},
+		{http.StatusServiceUnavailable, ErrTrackUpstream},
+	}
+	for _, tt := range tests {
+		t.Run(http.StatusText(tt.status), func(t *testing.T) {
+			r := fakeSpotifyResolver(t, tt.status)
+			_, err := r.Resolve(context.Background(), "4uLU6hMCjMI75M1A2tKUQC")
+			if !errors.Is(err, tt.want) {
+				t.Errorf("err = %v, want %v", err, tt.want)
+			}
+
+			w := httptest.NewRecorder()
+			writeTrackError(w, r.log, TrackID{SpotifyID: "4uLU6hMCjMI75M1A2tKUQC"}, err)
+			if want := map[error]int{ErrTrackNotFound: http.StatusNotFound, ErrTrackUpstream: http.StatusBadGateway}[tt.want]; w.Code != want {
+				t.Errorf("status = %d, want %d", w.Code, want)
+			}
+		})
+	}
+}
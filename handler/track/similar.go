@@ -0,0 +1,173 @@
+package track
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/mager/occipital/harmonic"
+	"github.com/mager/occipital/occipital"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultSimilarK = 10
+	maxSimilarK     = 50
+)
+
+// SimilarTracksHandler finds cached tracks that sound like a given one.
+type SimilarTracksHandler struct {
+	log   *zap.SugaredLogger
+	track *TrackResolver
+	index *SimilarIndex
+}
+
+func (*SimilarTracksHandler) Pattern() string {
+	return "/track/similar"
+}
+
+func NewSimilarTracksHandler(log *zap.SugaredLogger, track *TrackResolver, index *SimilarIndex) *SimilarTracksHandler {
+	return &SimilarTracksHandler{
+		log:   log,
+		track: track,
+		index: index,
+	}
+}
+
+type SimilarTracksResponse struct {
+	Track   occipital.Track `json:"track"`
+	Camelot string          `json:"camelot,omitempty"`
+	Tracks  []SimilarTrack  `json:"tracks"`
+	// Indexed is how many tracks were searched
+	Indexed int `json:"indexed"`
+}
+
+// parseSimilarQuery reads k and the filters. key is "compatible" for keys
+// that mix with the seed track, or a Camelot code such as "8A"; the seed
+// isn't resolved yet, so "compatible" is reported for the caller to fill in.
+func parseSimilarQuery(q url.Values) (k int, f similarFilter, compatible bool, err error) {
+	k = defaultSimilarK
+	if raw := q.Get("k"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > maxSimilarK {
+			return 0, f, false, fmt.Errorf("k must be between 1 and %d", maxSimilarK)
+		}
+		k = n
+	}
+
+	for _, b := range []struct {
+		name    string
+		lo, hi  *float64
+		ceiling float64
+	}{
+		{"tempo", &f.minTempo, &f.maxTempo, 300},
+		{"energy", &f.minEnergy, &f.maxEnergy, 1},
+		{"valence", &f.minValence, &f.maxValence, 1},
+	} {
+		if *b.lo, err = parseBound(q, "min_"+b.name, b.ceiling); err != nil {
+			return 0, f, false, err
+		}
+		if *b.hi, err = parseBound(q, "max_"+b.name, b.ceiling); err != nil {
+			return 0, f, false, err
+		}
+		if *b.hi != 0 && *b.lo > *b.hi {
+			return 0, f, false, fmt.Errorf("min_%s is above max_%s", b.name, b.name)
+		}
+	}
+
+	switch raw := strings.TrimSpace(q.Get("key")); {
+	case raw == "":
+	case strings.EqualFold(raw, "compatible"):
+		compatible = true
+	default:
+		c, err := harmonic.ParseCamelot(raw)
+		if err != nil {
+			return 0, f, false, err
+		}
+		f.keys = []harmonic.Key{c}
+	}
+
+	return k, f, compatible, nil
+}
+
+// parseBound reads an optional bound in [0, ceiling]; absent is 0, i.e. open.
+func parseBound(q url.Values, param string, ceiling float64) (float64, error) {
+	raw := q.Get(param)
+	if raw == "" {
+		return 0, nil
+	}
+	v, err := strconv.ParseFloat(raw, 64)
+	if err != nil || v < 0 || v > ceiling {
+		return 0, fmt.Errorf("%s must be between 0 and %g", param, ceiling)
+	}
+	return v, nil
+}
+
+// Get similar tracks
+// @Summary Get similar tracks
+// @Description Finds cached tracks with the closest audio features to a Spotify track
+// @Tags Track
+// @Produce json
+// @Param spotifyId query string true "Spotify track ID"
+// @Param k query int false "Number of results (1-50, default 10)"
+// @Param min_tempo query number false "Minimum BPM"
+// @Param max_tempo query number false "Maximum BPM"
+// @Param key query string false "compatible, or a Camelot key such as 8A"
+// @Param min_energy query number false "Minimum energy (0-1)"
+// @Param max_energy query number false "Maximum energy (0-1)"
+// @Param min_valence query number false "Minimum valence (0-1)"
+// @Param max_valence query number false "Maximum valence (0-1)"
+// @Success 200 {object} SimilarTracksResponse
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 422 {object} map[string]string
+// @Failure 502 {object} map[string]string
+// @Router /track/similar [get]
+func (h *SimilarTracksHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	q := r.URL.Query()
+	spotifyId := q.Get("spotifyId")
+	if spotifyId == "" {
+		http.Error(w, `{"error":"spotifyId required"}`, http.StatusBadRequest)
+		return
+	}
+
+	k, filter, compatible, err := parseSimilarQuery(q)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	track, err := h.track.Resolve(r.Context(), spotifyId)
+	if err != nil {
+		writeTrackError(w, h.log, TrackID{SpotifyID: spotifyId}, err)
+		return
+	}
+	if track.Features == nil || track.Meta == nil {
+		http.Error(w, `{"error":"track has no audio features"}`, http.StatusUnprocessableEntity)
+		return
+	}
+
+	seed := harmonic.FromPitch(track.Meta.Key, track.Meta.Mode)
+	if compatible {
+		if !seed.Known() {
+			http.Error(w, `{"error":"track has no detected key"}`, http.StatusUnprocessableEntity)
+			return
+		}
+		filter.keys = []harmonic.Key{seed}
+	}
+
+	track.SourceID = spotifyId
+	results := h.index.Search(track, k, filter)
+	h.log.Infow("Similar tracks", "spotify_id", spotifyId, "k", k, "results", len(results))
+
+	json.NewEncoder(w).Encode(SimilarTracksResponse{
+		Track:   track,
+		Camelot: seed.Camelot(),
+		Tracks:  results,
+		Indexed: h.index.Len(),
+	})
+}
@@ -0,0 +1,159 @@
+package track
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/mager/occipital/harmonic"
+	"github.com/mager/occipital/occipital"
+	"go.uber.org/zap"
+)
+
+// similarFilter narrows a similarity search. Zero bounds are open.
+type similarFilter struct {
+	minTempo, maxTempo     float64
+	minEnergy, maxEnergy   float64
+	minValence, maxValence float64
+	// keys, when set, restricts results to keys compatible with any of them
+	keys []harmonic.Key
+}
+
+func (f similarFilter) match(e *indexedTrack) bool {
+	if !inRange(e.tempo, f.minTempo, f.maxTempo) ||
+		!inRange(e.energy, f.minEnergy, f.maxEnergy) ||
+		!inRange(e.valence, f.minValence, f.maxValence) {
+		return false
+	}
+	if len(f.keys) == 0 {
+		return true
+	}
+	for _, k := range f.keys {
+		if harmonic.Compatible(k, e.key) {
+			return true
+		}
+	}
+	return false
+}
+
+func inRange(v, lo, hi float64) bool {
+	return (lo == 0 || v >= lo) && (hi == 0 || v <= hi)
+}
+
+type indexedTrack struct {
+	track   occipital.Track
+	vec     occipital.FeatureVector
+	tempo   float64
+	energy  float64
+	valence float64
+	key     harmonic.Key
+}
+
+// SimilarTrack is a search result.
+type SimilarTrack struct {
+	Track      occipital.Track `json:"track"`
+	Similarity float64         `json:"similarity"`
+	Camelot    string          `json:"camelot,omitempty"`
+}
+
+// SimilarIndex holds the feature vectors of every cached track with audio
+// features, keyed by Spotify ID. It is seeded from the track cache at
+// startup and updated as tracks are resolved. Searches scan every entry,
+// which is fast enough at the size of the track cache.
+type SimilarIndex struct {
+	log    *zap.SugaredLogger
+	mu     sync.RWMutex
+	tracks map[string]*indexedTrack
+}
+
+// NewSimilarIndex returns an empty index.
+func NewSimilarIndex(log *zap.SugaredLogger) *SimilarIndex {
+	return &SimilarIndex{log: log, tracks: make(map[string]*indexedTrack)}
+}
+
+// Add indexes or replaces a track. Tracks without audio features are ignored.
+func (ix *SimilarIndex) Add(spotifyID string, t occipital.Track) {
+	if spotifyID == "" || t.Features == nil || t.Meta == nil {
+		return
+	}
+	e := &indexedTrack{
+		// Keep what a result needs; analysis and credits are large
+		track: occipital.Track{
+			ID:          t.ID,
+			Name:        t.Name,
+			Artist:      t.Artist,
+			Image:       t.Image,
+			Source:      t.Source,
+			SourceID:    spotifyID,
+			ISRC:        t.ISRC,
+			ReleaseDate: t.ReleaseDate,
+			Genres:      t.Genres,
+			Popularity:  t.Popularity,
+			Meta:        t.Meta,
+			Features:    t.Features,
+		},
+		vec:     t.Features.Vector().WithTempo(t.Meta.Tempo),
+		tempo:   float64(t.Meta.Tempo),
+		energy:  float64(t.Features.Energy),
+		valence: float64(t.Features.Happiness),
+		key:     harmonic.FromPitch(t.Meta.Key, t.Meta.Mode),
+	}
+
+	ix.mu.Lock()
+	ix.tracks[spotifyID] = e
+	ix.mu.Unlock()
+}
+
+// Features returns the audio features of the indexed tracks among ids,
+// keyed by Spotify ID.
+func (ix *SimilarIndex) Features(ids []string) map[string]*occipital.TrackFeatures {
+	out := make(map[string]*occipital.TrackFeatures, len(ids))
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	for _, id := range ids {
+		if e, ok := ix.tracks[id]; ok && e.track.Features != nil {
+			out[id] = e.track.Features
+		}
+	}
+	return out
+}
+
+// Len reports the number of indexed tracks.
+func (ix *SimilarIndex) Len() int {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	return len(ix.tracks)
+}
+
+// Search returns the k indexed tracks most similar to t that pass f,
+// excluding t itself.
+func (ix *SimilarIndex) Search(t occipital.Track, k int, f similarFilter) []SimilarTrack {
+	if t.Features == nil || t.Meta == nil || k <= 0 {
+		return nil
+	}
+	q := t.Features.Vector().WithTempo(t.Meta.Tempo)
+
+	ix.mu.RLock()
+	out := make([]SimilarTrack, 0, min(k, len(ix.tracks)))
+	for id, e := range ix.tracks {
+		if id == t.SourceID || !f.match(e) {
+			continue
+		}
+		out = append(out, SimilarTrack{
+			Track:      e.track,
+			Similarity: q.Similarity(e.vec),
+			Camelot:    e.key.Camelot(),
+		})
+	}
+	ix.mu.RUnlock()
+
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Similarity != out[j].Similarity {
+			return out[i].Similarity > out[j].Similarity
+		}
+		return out[i].Track.SourceID < out[j].Track.SourceID
+	})
+	if len(out) > k {
+		out = out[:k]
+	}
+	return out
+}
@@ -0,0 +1,58 @@
+package track
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestParseSimilarQuery(t *testing.T) {
+	tests := []struct {
+		query      string
+		k          int
+		compatible bool
+		keys       int
+		wantErr    bool
+	}{
+		{query: "", k: defaultSimilarK},
+		{query: "k=5&min_tempo=90&max_tempo=130&min_energy=0.4", k: 5},
+		{query: "key=compatible", k: defaultSimilarK, compatible: true},
+		{query: "key=8A", k: defaultSimilarK, keys: 1},
+		{query: "k=0", wantErr: true},
+		{query: "k=51", wantErr: true},
+		{query: "k=ten", wantErr: true},
+		{query: "min_energy=1.5", wantErr: true},
+		{query: "min_tempo=140&max_tempo=120", wantErr: true},
+		{query: "key=13Z", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			q, _ := url.ParseQuery(tt.query)
+			k, f, compatible, err := parseSimilarQuery(q)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if k != tt.k || compatible != tt.compatible || len(f.keys) != tt.keys {
+				t.Errorf("k = %d, compatible = %v, keys = %v", k, compatible, f.keys)
+			}
+		})
+	}
+}
+
+func TestSimilarRejectsBadQueryBeforeResolving(t *testing.T) {
+	// No resolver: resolving the seed would panic
+	h := &SimilarTracksHandler{log: zap.NewNop().Sugar()}
+	for _, query := range []string{"k=500", "max_valence=2", "key=nope"} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/track/similar?spotifyId=4uLU6hMCjMI75M1A2tKUQC&"+query, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want %d", query, w.Code, http.StatusBadRequest)
+		}
+	}
+}
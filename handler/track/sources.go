@@ -0,0 +1,156 @@
+package track
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/mager/occipital/musicbrainz"
+	"github.com/mager/occipital/musixmatch"
+	"github.com/mager/occipital/occipital"
+	spot "github.com/zmb3/spotify/v2"
+)
+
+// Upstreams reported in a track's sources block
+const (
+	sourceSpotifyTrack    = "spotify_track"
+	sourceSpotifyFeatures = "spotify_features"
+	sourceSpotifyAnalysis = "spotify_analysis"
+	sourceSpotifySearch   = "spotify_search"
+	sourceMBSearch        = "musicbrainz_search"
+	sourceMBRecording     = "musicbrainz_recording"
+	sourceMBWork          = "musicbrainz_work"
+	sourceCoverArt        = "coverart"
+	sourceLyrics          = "lyrics"
+)
+
+const (
+	statusOK    = "ok"
+	statusEmpty = "empty"
+	statusError = "error"
+)
+
+// degradedTrackTTL is how long a track built while an upstream failed is
+// served before it is refetched.
+const degradedTrackTTL = 15 * time.Minute
+
+// sourceSet collects upstream statuses from concurrent fetches.
+type sourceSet struct {
+	mu sync.Mutex
+	m  map[string]occipital.SourceStatus
+}
+
+// newSourceSet starts from a copy of from, e.g. a cached track's sources.
+func newSourceSet(from map[string]occipital.SourceStatus) *sourceSet {
+	m := maps.Clone(from)
+	if m == nil {
+		m = make(map[string]occipital.SourceStatus)
+	}
+	return &sourceSet{m: m}
+}
+
+// record notes the outcome of a call to name that started at t0. Not-found
+// errors count as empty, since the upstream answered. A nil set records
+// nothing.
+func (s *sourceSet) record(name string, t0 time.Time, err error, empty bool) {
+	if s == nil {
+		return
+	}
+	st := occipital.SourceStatus{
+		Status:    statusOK,
+		LatencyMs: time.Since(t0).Milliseconds(),
+	}
+	switch {
+	case err != nil && !notFound(err):
+		st.Status = statusError
+		st.Error = errorClass(err)
+	case err != nil, empty:
+		st.Status = statusEmpty
+	}
+
+	s.mu.Lock()
+	s.m[name] = st
+	s.mu.Unlock()
+}
+
+// failed reports whether the call to name errored, as opposed to answering
+// with nothing.
+func (s *sourceSet) failed(name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.m[name].Status == statusError
+}
+
+func (s *sourceSet) statuses() map[string]occipital.SourceStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.m) == 0 {
+		return nil
+	}
+	return maps.Clone(s.m)
+}
+
+// degradedTrack reports whether a track was built while an upstream failed.
+// It is the Degraded hook of the track cache policies.
+func degradedTrack(v any) bool {
+	t, ok := v.(occipital.Track)
+	if !ok {
+		return false
+	}
+	for _, st := range t.Sources {
+		if st.Status == statusError {
+			return true
+		}
+	}
+	return false
+}
+
+// lookupError maps a failed lookup to ErrTrackNotFound when the upstream
+// answered that it has no such track, and ErrTrackUpstream otherwise.
+func lookupError(err error) error {
+	if errors.Is(err, ErrTrackNotFound) || notFound(err) {
+		return ErrTrackNotFound
+	}
+	return fmt.Errorf("%w: %w", ErrTrackUpstream, err)
+}
+
+func notFound(err error) bool {
+	var se spot.Error
+	return errors.Is(err, musicbrainz.ErrNotFound) ||
+		errors.Is(err, musixmatch.ErrTrackNotFound) ||
+		errors.Is(err, musixmatch.ErrLyricsUnavailable) ||
+		errors.As(err, &se) && se.Status == http.StatusNotFound
+}
+
+// errorClass buckets an upstream error into something clients can act on.
+func errorClass(err error) string {
+	var (
+		se spot.Error
+		ne net.Error
+	)
+	switch {
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &ne) && ne.Timeout():
+		return "timeout"
+	case errors.Is(err, musicbrainz.ErrQueueFull):
+		return "rate_limited"
+	case errors.Is(err, musicbrainz.ErrServiceUnavailable):
+		return "unavailable"
+	case errors.Is(err, musixmatch.ErrUnauthorized), errors.Is(err, musixmatch.ErrMissingAPIKey):
+		return "unauthorized"
+	case errors.As(err, &se):
+		switch {
+		case se.Status == http.StatusTooManyRequests:
+			return "rate_limited"
+		case se.Status == http.StatusUnauthorized, se.Status == http.StatusForbidden:
+			return "unauthorized"
+		case se.Status >= 500:
+			return "unavailable"
+		}
+	}
+	return "error"
+}
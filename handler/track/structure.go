@@ -0,0 +1,186 @@
+package track
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"strconv"
+
+	"github.com/mager/occipital/harmonic"
+	"github.com/mager/occipital/occipital"
+	spot "github.com/zmb3/spotify/v2"
+)
+
+const maxWaveform = 2000
+
+// Values for ?analysis=
+const (
+	analysisFull    = "full"
+	analysisSummary = "summary"
+	analysisNone    = "none"
+)
+
+// analysisOptions controls how much of a track's analysis a response carries.
+type analysisOptions struct {
+	// mode is full (raw analysis and structure), summary (structure only) or
+	// none
+	mode string
+	// waveform is the number of waveform buckets; 0 leaves it out
+	waveform int
+}
+
+// parseAnalysisOptions reads ?analysis= and ?waveform=, with mode as the
+// default analysis.
+func parseAnalysisOptions(q url.Values, mode string) (analysisOptions, error) {
+	opts := analysisOptions{mode: mode}
+	switch mode := q.Get("analysis"); mode {
+	case "":
+	case analysisFull, analysisSummary, analysisNone:
+		opts.mode = mode
+	default:
+		return opts, fmt.Errorf("analysis must be %s, %s or %s", analysisFull, analysisSummary, analysisNone)
+	}
+	if raw := q.Get("waveform"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > maxWaveform {
+			return opts, fmt.Errorf("waveform must be between 1 and %d", maxWaveform)
+		}
+		opts.waveform = n
+	}
+	return opts, nil
+}
+
+// apply trims t's analysis per the options and adds the waveform. t is a
+// copy, but its structure is shared, so it is copied before being changed.
+func (o analysisOptions) apply(t *occipital.Track) {
+	if o.mode == analysisNone || t.Analysis == nil {
+		t.Analysis = nil
+		t.Structure = nil
+		return
+	}
+	var s occipital.TrackStructure
+	if t.Structure != nil {
+		s = *t.Structure
+	} else {
+		// Cached before the structure was; no grids until it is refreshed
+		s = occipital.TrackStructure{Duration: t.Analysis.Duration, Sections: sectionsFrom(t.Analysis.Sections)}
+	}
+	if o.waveform > 0 {
+		s.Waveform = waveform(t.Analysis, o.waveform)
+	}
+	t.Structure = &s
+	if o.mode == analysisSummary {
+		t.Analysis = nil
+	}
+}
+
+// analysisFrom copies a Spotify audio analysis into our model. Bars, beats
+// and tatums run to thousands of markers, so they aren't kept; see
+// structureFrom for the grids.
+func analysisFrom(a *spot.AudioAnalysis) *occipital.TrackAnalysis {
+	ta := &occipital.TrackAnalysis{
+		Duration: a.Track.Duration,
+		Segments: make([]occipital.TrackAnalysisSegment, 0, len(a.Segments)),
+		Sections: make([]occipital.TrackAnalysisSection, 0, len(a.Sections)),
+	}
+	for _, seg := range a.Segments {
+		ta.Segments = append(ta.Segments, occipital.TrackAnalysisSegment{
+			Start:         seg.Start,
+			Duration:      seg.Duration,
+			Confidence:    seg.Confidence,
+			LoudnessStart: seg.LoudnessStart,
+			LoudnessEnd:   seg.LoudnessEnd,
+			LoudnessMax:   seg.LoudnessMax,
+			Pitches:       seg.Pitches,
+			Timbres:       seg.Timbre,
+		})
+	}
+	for _, sec := range a.Sections {
+		ta.Sections = append(ta.Sections, occipital.TrackAnalysisSection{
+			Start:         sec.Start,
+			Duration:      sec.Duration,
+			Confidence:    sec.Confidence,
+			Loudness:      sec.Loudness,
+			Tempo:         sec.Tempo,
+			Key:           int(sec.Key),
+			Mode:          int(sec.Mode),
+			TimeSignature: int(sec.TimeSignature),
+		})
+	}
+	return ta
+}
+
+// structureFrom derives the sections and the bar and beat grids, which are
+// cached with the track in place of the raw markers. The waveform depends
+// on the request and is added by apply.
+func structureFrom(a *spot.AudioAnalysis, ta *occipital.TrackAnalysis) *occipital.TrackStructure {
+	return &occipital.TrackStructure{
+		Duration: ta.Duration,
+		Sections: sectionsFrom(ta.Sections),
+		Bars:     markerStarts(a.Bars),
+		Beats:    markerStarts(a.Beats),
+	}
+}
+
+// sectionsFrom labels sections with their Camelot key and flags key changes.
+func sectionsFrom(secs []occipital.TrackAnalysisSection) []occipital.TrackSection {
+	out := make([]occipital.TrackSection, 0, len(secs))
+	var prev harmonic.Key
+	for i, sec := range secs {
+		key := harmonic.FromPitch(sec.Key, sec.Mode)
+		out = append(out, occipital.TrackSection{
+			Start:     sec.Start,
+			Duration:  sec.Duration,
+			Loudness:  sec.Loudness,
+			Tempo:     sec.Tempo,
+			Camelot:   key.Camelot(),
+			KeyName:   key.Name(),
+			KeyChange: i > 0 && key.Known() && prev.Known() && key != prev,
+		})
+		if key.Known() {
+			prev = key
+		}
+	}
+	return out
+}
+
+func markerStarts(ms []spot.Marker) []float64 {
+	out := make([]float64, len(ms))
+	for i, m := range ms {
+		out[i] = m.Start
+	}
+	return out
+}
+
+// waveform buckets the segments' peak loudness over the track and scales it
+// from -60 dB (0) to 0 dB (1). Buckets no segment starts in, e.g. inside a
+// long sustained note, repeat the bucket before.
+func waveform(a *occipital.TrackAnalysis, buckets int) []float64 {
+	duration := a.Duration
+	if n := len(a.Segments); n > 0 {
+		duration = max(duration, a.Segments[n-1].Start+a.Segments[n-1].Duration)
+	}
+	if duration <= 0 || len(a.Segments) == 0 {
+		return nil
+	}
+
+	peak := make([]float64, buckets)
+	seen := make([]bool, buckets)
+	for _, seg := range a.Segments {
+		b := min(int(seg.Start/duration*float64(buckets)), buckets-1)
+		if b < 0 {
+			continue
+		}
+		v := math.Round(min(max((seg.LoudnessMax+60)/60, 0), 1)*1000) / 1000
+		if !seen[b] || v > peak[b] {
+			peak[b] = v
+			seen[b] = true
+		}
+	}
+	for i := 1; i < buckets; i++ {
+		if !seen[i] {
+			peak[i] = peak[i-1]
+		}
+	}
+	return peak
+}
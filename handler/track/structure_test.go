@@ -0,0 +1,91 @@
+package track
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/mager/occipital/occipital"
+	spot "github.com/zmb3/spotify/v2"
+)
+
+func testAnalysis() *spot.AudioAnalysis {
+	a := &spot.AudioAnalysis{
+		Bars:   []spot.Marker{{Start: 0, Duration: 2}, {Start: 2, Duration: 2}},
+		Beats:  []spot.Marker{{Start: 0}, {Start: 0.5}, {Start: 1}, {Start: 1.5}},
+		Tatums: []spot.Marker{{Start: 0}, {Start: 0.25}, {Start: 0.5}},
+		Sections: []spot.Section{
+			{Marker: spot.Marker{Start: 0, Duration: 2}, Tempo: 120, Key: 0, Mode: 1},
+			{Marker: spot.Marker{Start: 2, Duration: 2}, Tempo: 120, Key: 7, Mode: 1},
+		},
+		Segments: []spot.Segment{
+			{Marker: spot.Marker{Start: 0, Duration: 2}, LoudnessMax: -30},
+			{Marker: spot.Marker{Start: 2, Duration: 2}, LoudnessMax: 0},
+		},
+	}
+	a.Track.Duration = 4
+	return a
+}
+
+func TestStructureFrom(t *testing.T) {
+	a := testAnalysis()
+	s := structureFrom(a, analysisFrom(a))
+	if !reflect.DeepEqual(s.Bars, []float64{0, 2}) || !reflect.DeepEqual(s.Beats, []float64{0, 0.5, 1, 1.5}) {
+		t.Errorf("grids = %v, %v", s.Bars, s.Beats)
+	}
+	if len(s.Sections) != 2 || s.Sections[0].Camelot != "8B" || !s.Sections[1].KeyChange {
+		t.Errorf("sections = %+v", s.Sections)
+	}
+	if s.Waveform != nil {
+		t.Errorf("waveform cached: %v", s.Waveform)
+	}
+}
+
+func TestAnalysisOptionsApply(t *testing.T) {
+	a := testAnalysis()
+	cached := occipital.Track{Analysis: analysisFrom(a), Structure: structureFrom(a, analysisFrom(a))}
+
+	tests := []struct {
+		query     string
+		def       string
+		analysis  bool
+		structure bool
+		waveform  int
+	}{
+		{query: "", def: analysisSummary, structure: true},
+		{query: "", def: analysisFull, analysis: true, structure: true},
+		{query: "analysis=full&waveform=4", def: analysisSummary, analysis: true, structure: true, waveform: 4},
+		{query: "analysis=summary&waveform=2", def: analysisFull, structure: true, waveform: 2},
+		{query: "analysis=none", def: analysisSummary},
+	}
+	for _, tt := range tests {
+		t.Run(tt.def+"?"+tt.query, func(t *testing.T) {
+			q, _ := url.ParseQuery(tt.query)
+			opts, err := parseAnalysisOptions(q, tt.def)
+			if err != nil {
+				t.Fatal(err)
+			}
+			track := cached
+			opts.apply(&track)
+			if (track.Analysis != nil) != tt.analysis || (track.Structure != nil) != tt.structure {
+				t.Fatalf("analysis = %v, structure = %v", track.Analysis != nil, track.Structure != nil)
+			}
+			if track.Structure != nil && len(track.Structure.Waveform) != tt.waveform {
+				t.Errorf("waveform = %v, want %d buckets", track.Structure.Waveform, tt.waveform)
+			}
+		})
+	}
+	if cached.Structure.Waveform != nil {
+		t.Error("apply changed the cached structure")
+	}
+}
+
+func TestApplyWithoutCachedStructure(t *testing.T) {
+	// Tracks cached before the structure was get sections but no grids
+	track := occipital.Track{Analysis: analysisFrom(testAnalysis())}
+	analysisOptions{mode: analysisSummary, waveform: 2}.apply(&track)
+	s := track.Structure
+	if s == nil || len(s.Sections) != 2 || len(s.Bars) != 0 || !reflect.DeepEqual(s.Waveform, []float64{0.5, 1}) {
+		t.Errorf("structure = %+v", s)
+	}
+}
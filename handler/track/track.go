@@ -1,7 +1,9 @@
 package track
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
@@ -10,13 +12,9 @@ import (
 	"sync"
 	"time"
 
-	spot "github.com/zmb3/spotify/v2"
-
 	mb "github.com/mager/musicbrainz-go/musicbrainz"
-	"github.com/mager/occipital/musicbrainz"
+	"github.com/mager/occipital/cache"
 	"github.com/mager/occipital/occipital"
-	"github.com/mager/occipital/spotify"
-	"github.com/mager/occipital/util"
 	"go.uber.org/zap"
 )
 
@@ -53,11 +51,19 @@ var (
 	}
 )
 
+const mbidCacheCollection = "track_cache_mbid"
+
+var mbidCachePolicy = cache.Policy{
+	TTL:                  7 * 24 * time.Hour,
+	StaleWhileRevalidate: 7 * 24 * time.Hour,
+	Degraded:             degradedTrack,
+	DegradedTTL:          degradedTrackTTL,
+}
+
 // GetTrackHandler is an http.Handler
 type GetTrackHandler struct {
-	log               *zap.SugaredLogger
-	spotifyClient     *spotify.SpotifyClient
-	musicbrainzClient *musicbrainz.MusicbrainzClient
+	log    *zap.SugaredLogger
+	tracks *TrackResolver
 }
 
 func (*GetTrackHandler) Pattern() string {
@@ -65,15 +71,10 @@ func (*GetTrackHandler) Pattern() string {
 }
 
 // NewGetTrackHandler builds a new GetTrackHandler.
-func NewGetTrackHandler(
-	log *zap.SugaredLogger,
-	spotifyClient *spotify.SpotifyClient,
-	musicbrainzClient *musicbrainz.MusicbrainzClient,
-) *GetTrackHandler {
+func NewGetTrackHandler(log *zap.SugaredLogger, tracks *TrackResolver) *GetTrackHandler {
 	return &GetTrackHandler{
-		log:               log,
-		spotifyClient:     spotifyClient,
-		musicbrainzClient: musicbrainzClient,
+		log:    log,
+		tracks: tracks,
 	}
 }
 
@@ -87,270 +88,92 @@ type GetTrackResponse struct {
 	Track occipital.Track `json:"track"`
 }
 
+// defaultTrackInclude is what /track returned before ?include= existed.
+const defaultTrackInclude = IncludeCredits | IncludeAnalysis | IncludeReleases
+
 // Get track
 // @Summary Get track
-// @Description Get track
+// @Description Get track by Spotify ID, MusicBrainz recording ID or ISRC
 // @Accept json
 // @Produce json
 // @Success 200 {object} GetTrackResponse
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 502 {object} map[string]string
 // @Router /track [get]
-// @Param sourceId query string true "Source ID"
-// @Param source query string true "Source"
+// @Param spotifyId query string false "Spotify track ID"
+// @Param mbid query string false "MusicBrainz recording ID"
+// @Param isrc query string false "ISRC"
+// @Param sourceId query string false "Spotify track ID (deprecated, use spotifyId)"
+// @Param include query string false "Comma-separated stages: credits, analysis, releases, lyrics (default credits,analysis,releases)"
+// @Param analysis query string false "full (default), summary or none"
+// @Param waveform query int false "Number of waveform buckets (1-2000)"
 func (h *GetTrackHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	q := r.URL.Query()
-	isrc := q.Get("isrc")
-	mbid := q.Get("mbid")
-	spotifyId := q.Get("spotifyId")
-
-	l := h.log
 
-	var resp GetTrackResponse
-
-	// V4: Spotify-first flow
-	if spotifyId != "" {
-		h.handleSpotifyFirst(w, r, spotifyId)
-		return
+	id := TrackID{
+		SpotifyID: q.Get("spotifyId"),
+		MBID:      q.Get("mbid"),
+		ISRC:      q.Get("isrc"),
 	}
-
-	// V3 Version based on MBID, MusicBrainz recording ID
-	if mbid != "" {
-		l.Infow("Fetching MusicBrainz recording", "mbid", mbid)
-		recording, err := h.musicbrainzClient.Client.GetRecording(mb.GetRecordingRequest{
-			ID: mbid,
-			Includes: []mb.Include{
-				"artist-credits",
-				"artist-rels",
-				"genres",
-				"isrcs",
-				"releases",
-				"work-rels",
-				"url-rels",
-			},
-		})
-		if err != nil {
-			l.Errorf("error fetching recording: %v", err)
-		}
-
-		track := occipital.Track{
-			ID:                mbid,
-			ISRC:              isrc,
-			Name:              recording.Recording.Title,
-			Artist:            util.GetArtistCreditsFromRecording(*recording.Recording.ArtistCredits),
-			ReleaseDate:       recording.Recording.FirstReleaseDate,
-			Image:             getLatestReleaseImageURLWithLog(h.log, recording.Recording),
-			Instruments:       getArtistInstrumentsForRecording(recording.Recording),
-			ProductionCredits: getProductionCreditsForRecording(recording.Recording),
-			Genres:            getGenresForRecording(recording.Recording),
-			Links:             getExternalLinksForRecording(recording.Recording),
-			Releases:          getReleasesFromRecordingWithLog(h.log, recording.Recording),
-		}
-
-		// If no ISRC was passed in the query, try to get one from the recording
-		if track.ISRC == "" && recording.Recording.ISRCs != nil && len(*recording.Recording.ISRCs) > 0 {
-			track.ISRC = (*recording.Recording.ISRCs)[0]
-		}
-
-		// Enrich with Spotify: if we have an ISRC and no Spotify link from MB relations,
-		// search Spotify by ISRC to get the source_id and guarantee the link
-		hasSpotifyLink := false
-		for _, link := range track.Links {
-			if link.Type == "spotify" {
-				hasSpotifyLink = true
-				break
-			}
-		}
-		if track.ISRC != "" && !hasSpotifyLink {
-			l.Infow("Enriching with Spotify via ISRC", "isrc", track.ISRC)
-			ctx := r.Context()
-			results, err := h.spotifyClient.Client.Search(ctx, fmt.Sprintf("isrc:%s", track.ISRC), spot.SearchTypeTrack)
-			if err != nil {
-				l.Warnw("Spotify ISRC search failed", "error", err)
-			} else if results.Tracks != nil && len(results.Tracks.Tracks) > 0 {
-				spotTrack := results.Tracks.Tracks[0]
-				spotURL := fmt.Sprintf("https://open.spotify.com/track/%s", spotTrack.ID)
-				track.SourceID = string(spotTrack.ID)
-				track.Source = "SPOTIFY"
-				track.Links = append(track.Links, occipital.ExternalLink{
-					Type: "spotify",
-					URL:  spotURL,
-				})
-				l.Infow("Spotify enrichment successful", "spotify_id", spotTrack.ID)
-
-				// Use Spotify image if MB didn't provide one
-				if track.Image == "" && len(spotTrack.Album.Images) > 0 {
-					track.Image = spotTrack.Album.Images[0].URL
-				}
-			}
-		}
-
-		work := h.getWorkFromRecordingWithLog(recording.Recording)
-		if work != nil {
-			track.SongCredits = getSongCreditsForWork(*work)
-		}
-
-		resp.Track = track
-		json.NewEncoder(w).Encode(resp)
-		return
+	if id.SpotifyID == "" {
+		id.SpotifyID = q.Get("sourceId")
 	}
 
-	// V2 Version based on ISRC, start wtih Musicbrainz, then Spotify
-	if isrc != "" {
-		h.GetTrackV2(w, isrc)
+	include, err := ParseInclude(q.Get("include"), defaultTrackInclude)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), http.StatusBadRequest)
 		return
 	}
-
-	// V1 Version
-	h.GetTrackV1(w, r)
-}
-
-// handleSpotifyFirst implements the Spotify-first flow:
-// 1. Fetch Spotify track → name, artist, image, ISRC
-// 2. Fetch audio features → danceability, energy, tempo, key, etc.
-// 3. Fetch audio analysis → segments with loudness data
-// 4. Use ISRC to search MusicBrainz → hydrate with credits, genres, releases, links
-func (h *GetTrackHandler) handleSpotifyFirst(w http.ResponseWriter, r *http.Request, spotifyId string) {
-	ctx := r.Context()
-	l := h.log
-	l.Infow("Spotify-first track lookup", "spotify_id", spotifyId)
-
-	sid := spot.ID(spotifyId)
-
-	// Step 1: Fetch the Spotify track
-	fullTrack, err := h.spotifyClient.Client.GetTrack(ctx, sid)
+	opts, err := parseAnalysisOptions(q, analysisFull)
 	if err != nil {
-		l.Errorf("error fetching Spotify track: %v", err)
-		http.Error(w, "Track not found", http.StatusNotFound)
+		http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), http.StatusBadRequest)
 		return
 	}
 
-	// Build initial track from Spotify data
-	track := occipital.Track{
-		SourceID: spotifyId,
-		Source:   "SPOTIFY",
-		Name:     fullTrack.Name,
-		Artist:   util.GetFirstArtist(fullTrack.Artists),
-	}
-
-	// Image
-	if len(fullTrack.Album.Images) > 0 {
-		track.Image = fullTrack.Album.Images[0].URL
+	track, err := h.tracks.Lookup(r.Context(), id, include)
+	if err != nil {
+		writeTrackError(w, h.log, id, err)
+		return
 	}
 
-	// ISRC
-	if isrcVal, ok := fullTrack.ExternalIDs["isrc"]; ok {
-		track.ISRC = isrcVal
+	// An explicitly requested ISRC wins over the one from the recording
+	if id.SpotifyID == "" && id.ISRC != "" {
+		track.ISRC = id.ISRC
 	}
 
-	// Release date
-	track.ReleaseDate = fullTrack.Album.ReleaseDate
-
-	// Spotify link
-	track.Links = []occipital.ExternalLink{
-		{Type: "spotify", URL: fmt.Sprintf("https://open.spotify.com/track/%s", spotifyId)},
-	}
+	opts.apply(&track)
+	json.NewEncoder(w).Encode(GetTrackResponse{Track: track})
+}
 
-	// Step 2: Fetch audio features
-	features, err := h.spotifyClient.Client.GetAudioFeatures(ctx, sid)
-	if err != nil {
-		l.Warnw("Failed to fetch audio features", "error", err)
-	} else if len(features) > 0 && features[0] != nil {
-		af := features[0]
-		track.Meta = &occipital.TrackMeta{
-			DurationMs:    int(af.Duration),
-			Key:           int(af.Key),
-			Mode:          int(af.Mode),
-			Tempo:         af.Tempo,
-			TimeSignature: int(af.TimeSignature),
-		}
-		track.Features = &occipital.TrackFeatures{
-			Acousticness:     af.Acousticness,
-			Danceability:     af.Danceability,
-			Energy:           af.Energy,
-			Happiness:        af.Valence,
-			Instrumentalness: af.Instrumentalness,
-			Liveness:         af.Liveness,
-			Loudness:         af.Loudness,
-			Speechiness:      af.Speechiness,
-		}
+// writeTrackError maps a Lookup error to a response.
+func writeTrackError(w http.ResponseWriter, log *zap.SugaredLogger, id TrackID, err error) {
+	switch {
+	case errors.Is(err, errMissingTrackID):
+		http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), http.StatusBadRequest)
+	case errors.Is(err, ErrTrackNotFound):
+		http.Error(w, `{"error":"track not found"}`, http.StatusNotFound)
+	case errors.Is(err, ErrTrackUpstream):
+		log.Warnw("Track source unavailable", "spotify_id", id.SpotifyID, "mbid", id.MBID, "isrc", id.ISRC, "error", err)
+		http.Error(w, `{"error":"track source unavailable"}`, http.StatusBadGateway)
+	default:
+		log.Errorw("Track lookup failed", "spotify_id", id.SpotifyID, "mbid", id.MBID, "isrc", id.ISRC, "error", err)
+		http.Error(w, `{"error":"track lookup failed"}`, http.StatusBadGateway)
 	}
+}
 
-	// Step 3: Fetch audio analysis
-	analysis, err := h.spotifyClient.Client.GetAudioAnalysis(ctx, sid)
-	if err != nil {
-		l.Warnw("Failed to fetch audio analysis", "error", err)
-	} else if analysis != nil {
-		trackAnalysis := occipital.TrackAnalysis{
-			Duration: analysis.Track.Duration,
-		}
-		for _, seg := range analysis.Segments {
-			trackAnalysis.Segments = append(trackAnalysis.Segments, occipital.TrackAnalysisSegment{
-				Start:         seg.Start,
-				Duration:      seg.Duration,
-				Confidence:    seg.Confidence,
-				LoudnessStart: seg.LoudnessStart,
-				LoudnessEnd:   seg.LoudnessEnd,
-				LoudnessMax:   seg.LoudnessMax,
-				Pitches:       seg.Pitches,
-				Timbres:       seg.Timbre,
-			})
-		}
-		track.Analysis = &trackAnalysis
+func getArtistCreditsForRecording(rec mb.Recording) []occipital.CreditArtist {
+	if rec.ArtistCredits == nil {
+		return nil
 	}
-
-	// Step 4: Use ISRC to find MusicBrainz recording and hydrate
-	if track.ISRC != "" {
-		l.Infow("Searching MusicBrainz by ISRC", "isrc", track.ISRC)
-		searchResp, err := h.musicbrainzClient.Client.SearchRecordingsByISRC(mb.SearchRecordingsByISRCRequest{
-			ISRC: track.ISRC,
-		})
-		if err != nil {
-			l.Warnw("MusicBrainz ISRC search failed", "error", err)
-		} else if searchResp.Count > 0 {
-			// Get full recording with all includes
-			mbid := searchResp.Recordings[0].ID
-			track.ID = mbid
-			l.Infow("Found MusicBrainz recording", "mbid", mbid)
-
-			recording, err := h.musicbrainzClient.Client.GetRecording(mb.GetRecordingRequest{
-				ID: mbid,
-				Includes: []mb.Include{
-					"artist-credits",
-					"artist-rels",
-					"genres",
-					"isrcs",
-					"releases",
-					"work-rels",
-					"url-rels",
-				},
-			})
-			if err != nil {
-				l.Warnw("Failed to fetch MusicBrainz recording details", "error", err)
-			} else {
-				// Step 5: Hydrate with MusicBrainz data
-				track.Instruments = getArtistInstrumentsForRecording(recording.Recording)
-				track.ProductionCredits = getProductionCreditsForRecording(recording.Recording)
-				track.Genres = getGenresForRecording(recording.Recording)
-				track.Releases = getReleasesFromRecordingWithLog(l, recording.Recording)
-
-				// Add external links from MB (genius, etc.) - skip spotify since we already have it
-				for _, link := range getExternalLinksForRecording(recording.Recording) {
-					if link.Type != "spotify" {
-						track.Links = append(track.Links, link)
-					}
-				}
-
-				// Get song credits from the work
-				work := h.getWorkFromRecordingWithLog(recording.Recording)
-				if work != nil {
-					track.SongCredits = getSongCreditsForWork(*work)
-				}
-			}
+	var artists []occipital.CreditArtist
+	for _, ac := range *rec.ArtistCredits {
+		if ac.Artist != nil && ac.Artist.ID != "" {
+			artists = append(artists, occipital.CreditArtist{ID: ac.Artist.ID, Name: ac.Artist.Name})
 		}
 	}
-
-	resp := GetTrackResponse{Track: track}
-	json.NewEncoder(w).Encode(resp)
+	return artists
 }
 
 func getArtistInstrumentsForRecording(rec mb.Recording) []*occipital.TrackInstrumentArtists {
@@ -537,6 +360,9 @@ func uniqueStrings(strs []string) []string {
 }
 
 func getSongCreditsForWork(rec mb.Work) []*occipital.TrackSongCredit {
+	if rec.Relations == nil {
+		return nil
+	}
 	creditMap := make(map[string]map[string]occipital.CreditArtist)
 
 	supportedTypes := []string{"composer", "lyricist", "writer"}
@@ -570,134 +396,31 @@ func getSongCreditsForWork(rec mb.Work) []*occipital.TrackSongCredit {
 	return songCredits
 }
 
-func (h *GetTrackHandler) getWorkFromRecordingWithLog(rec mb.Recording) *mb.Work {
-	for _, relation := range *rec.Relations {
-		if relation.TargetType == "work" {
-			work, err := h.musicbrainzClient.Client.GetWork(mb.GetWorkRequest{
-				ID:       relation.Work.ID,
-				Includes: []mb.Include{"artist-rels", "url-rels"},
-			})
-			if err != nil {
-				h.log.Errorf("error fetching work: %v", err)
-				return nil
-			}
-			return &work.Work
-		}
-	}
-	return nil
-}
-
-func mapInitialTrack(r *http.Request, ft *spot.FullTrack) occipital.Track {
-	var track occipital.Track
-	q := r.URL.Query()
-	sourceId := q.Get("sourceId")
-	source := q.Get("source")
-
-	track.Name = ft.Name
-	track.Artist = util.GetFirstArtist(ft.Artists)
-	track.SourceID = sourceId
-	track.Source = source
-	track.Image = *util.GetThumb(ft.Album)
-	track.ReleaseDate = *util.GetReleaseDate(ft.Album)
-	track.ISRC = *util.GetISRC(ft)
-	return track
-}
-
-func getLatestReleaseImageURLWithLog(l *zap.SugaredLogger, recording mb.Recording) string {
+func (r *TrackResolver) getLatestReleaseImageURLWithLog(ctx context.Context, recording mb.Recording) (string, error) {
 	if recording.Releases == nil || len(*recording.Releases) == 0 {
-		return ""
+		return "", nil
 	}
 	firstRelease := (*recording.Releases)[0]
 	if firstRelease.ID == "" {
-		return ""
-	}
-	url := fmt.Sprintf("https://coverartarchive.org/release/%s", firstRelease.ID)
-	resp, err := http.Get(url)
-	if err != nil || resp.StatusCode != http.StatusOK {
-		return ""
-	}
-	defer resp.Body.Close()
-	var caaResp struct {
-		Images []struct {
-			Front      bool              `json:"front"`
-			Thumbnails map[string]string `json:"thumbnails"`
-		} `json:"images"`
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&caaResp); err != nil {
-		return ""
+		return "", nil
 	}
-	for _, img := range caaResp.Images {
+	listing, err := r.getCoverArtWithLog(ctx, firstRelease.ID)
+	for _, img := range listing.Images {
 		if img.Front {
 			if url500, ok := img.Thumbnails["500"]; ok {
-				return url500
-			}
-		}
-	}
-	return ""
-}
-
-func getLatestReleaseMBIDV0(recording mb.Recording) string {
-	// Return early if there are no releases to check.
-	if recording.Releases == nil || len(*recording.Releases) == 0 {
-		return ""
-	}
-
-	var bestReleaseID string
-	var bestTime time.Time
-	var hasFoundReleaseWithImage bool
-
-	// Iterate through each release associated with the recording.
-	for _, release := range *recording.Releases {
-		// A release must have an ID to be useful for cover art
-		if release.ID == "" {
-			continue
-		}
-
-		// Try parsing the date in different formats
-		var parsedTime time.Time
-		var err error
-		dateFormats := []string{"2006-01-02", "2006-01", "2006"}
-
-		for _, format := range dateFormats {
-			parsedTime, err = time.Parse(format, release.Date)
-			if err == nil {
-				break
-			}
-		}
-
-		if err != nil {
-			// Skip releases with invalid dates
-			continue
-		}
-
-		// Check if this release has an image by making a HEAD request to Cover Art Archive
-		imageURL := getCoverArtArchiveImageURL(release.ID, "front", 500)
-
-		// Use OPTIONS to check if the resource exists and supports GET/HEAD
-		resp, err := http.DefaultClient.Do(&http.Request{
-			Method: "OPTIONS",
-			URL:    imageURL,
-		})
-		hasImage := err == nil && resp != nil && resp.StatusCode == http.StatusOK
-		if resp != nil {
-			resp.Body.Close()
-		}
-
-		// If we haven't found a release with an image yet, or this one has an image
-		if !hasFoundReleaseWithImage || hasImage {
-			// If this is the first valid release found, or it's newer than the current best
-			if bestReleaseID == "" || parsedTime.After(bestTime) {
-				bestReleaseID = release.ID
-				bestTime = parsedTime
-				hasFoundReleaseWithImage = hasImage
+				return url500, nil
 			}
 		}
 	}
-
-	return bestReleaseID
+	return "", err
 }
 
+// getExternalLinksForRecording lists the recording's Spotify and Genius
+// links. Search results carry no relationships, so they have none.
 func getExternalLinksForRecording(rec mb.Recording) []occipital.ExternalLink {
+	if rec.Relations == nil {
+		return nil
+	}
 	var links []occipital.ExternalLink
 	for _, rel := range *rec.Relations {
 		if rel.TargetType == "url" {
@@ -718,7 +441,9 @@ func getExternalLinksForRecording(rec mb.Recording) []occipital.ExternalLink {
 	return links
 }
 
-func getReleasesFromRecordingWithLog(l *zap.SugaredLogger, rec mb.Recording) *[]occipital.Release {
+// releasesFromRecording lists the recording's official releases by its own
+// artists. Images are filled in by releaseImages.
+func releasesFromRecording(rec mb.Recording) *[]occipital.Release {
 	if rec.Releases == nil || rec.ArtistCredits == nil || len(*rec.ArtistCredits) == 0 {
 		return nil
 	}
@@ -729,11 +454,7 @@ func getReleasesFromRecordingWithLog(l *zap.SugaredLogger, rec mb.Recording) *[]
 			artistIDs[ac.Artist.ID] = struct{}{}
 		}
 	}
-	var releasesMu sync.Mutex
 	releases := make([]occipital.Release, 0, len(*rec.Releases))
-	var wg sync.WaitGroup
-	sem := make(chan struct{}, 5) // limit to 5 concurrent requests
-
 	for _, mbRelease := range *rec.Releases {
 		if mbRelease.Status != "Official" {
 			continue
@@ -753,28 +474,51 @@ func getReleasesFromRecordingWithLog(l *zap.SugaredLogger, rec mb.Recording) *[]
 		if !hasMatchingArtist {
 			continue
 		}
+		releases = append(releases, occipital.Release{
+			ID:             mbRelease.ID,
+			Date:           mbRelease.Date,
+			Country:        mbRelease.Country,
+			Title:          mbRelease.Title,
+			Disambiguation: mbRelease.Disambiguation,
+			Image:          getCoverArtArchiveImageURL(mbRelease.ID, "front", 250).String(),
+		})
+	}
+	return &releases
+}
+
+// releaseImages returns a copy of releases with each one's Cover Art
+// Archive images. The input may be shared with other requests, so it isn't
+// modified. The lookups are recorded in src as one coverart source.
+func (r *TrackResolver) releaseImages(ctx context.Context, releases *[]occipital.Release, src *sourceSet) *[]occipital.Release {
+	if releases == nil {
+		return nil
+	}
+	out := make([]occipital.Release, len(*releases))
+	copy(out, *releases)
+	errs := make([]error, len(out))
+
+	// Cover Art Archive calls are paced by the musicbrainz client's scheduler
+	t0 := time.Now()
+	var wg sync.WaitGroup
+	for i := range out {
 		wg.Add(1)
-		sem <- struct{}{}
-		mbReleaseCopy := mbRelease
-		go func() {
+		go func(i int) {
 			defer wg.Done()
-			defer func() { <-sem }()
-			release := occipital.Release{
-				ID:             mbReleaseCopy.ID,
-				Date:           mbReleaseCopy.Date,
-				Country:        mbReleaseCopy.Country,
-				Title:          mbRelease.Title,
-				Disambiguation: mbReleaseCopy.Disambiguation,
-				Image:          getCoverArtArchiveImageURL(mbReleaseCopy.ID, "front", 250).String(),
-				Images:         getReleaseImagesForReleaseWithLog(l, mbReleaseCopy.ID),
-			}
-			releasesMu.Lock()
-			releases = append(releases, release)
-			releasesMu.Unlock()
-		}()
+			out[i].Images, errs[i] = r.getReleaseImagesForReleaseWithLog(ctx, out[i].ID)
+		}(i)
 	}
 	wg.Wait()
-	return &releases
+
+	empty := true
+	for _, rel := range out {
+		if rel.Images != nil {
+			empty = false
+		}
+	}
+	if len(out) > 0 {
+		src.record(sourceCoverArt, t0, errors.Join(errs...), empty)
+	}
+	return &out
 }
 
 // getCoverArtArchiveImageURL returns the URL for a release image from Cover Art Archive.
@@ -794,26 +538,14 @@ func getCoverArtArchiveImageURL(releaseID string, style string, size int) *url.U
 	return parsedURL
 }
 
-// getReleaseImagesForReleaseWithLog fetches all images for a given release from the Cover Art Archive.
-func getReleaseImagesForReleaseWithLog(l *zap.SugaredLogger, releaseID string) *[]occipital.ReleaseImage {
-	url := fmt.Sprintf("https://coverartarchive.org/release/%s", releaseID)
-	resp, err := http.Get(url)
-	if err != nil || resp.StatusCode != http.StatusOK {
-		return nil
-	}
-	defer resp.Body.Close()
-	var caaResp struct {
-		Images []struct {
-			ID         int64             `json:"id"`
-			Types      []string          `json:"types"`
-			Thumbnails map[string]string `json:"thumbnails"`
-		} `json:"images"`
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&caaResp); err != nil {
-		return nil
+// getReleaseImagesForReleaseWithLog returns all images for a given release from the Cover Art Archive.
+func (r *TrackResolver) getReleaseImagesForReleaseWithLog(ctx context.Context, releaseID string) (*[]occipital.ReleaseImage, error) {
+	listing, err := r.getCoverArtWithLog(ctx, releaseID)
+	if len(listing.Images) == 0 {
+		return nil, err
 	}
 	var images []occipital.ReleaseImage
-	for _, img := range caaResp.Images {
+	for _, img := range listing.Images {
 		imgType := ""
 		if len(img.Types) > 0 {
 			imgType = img.Types[0]
@@ -824,5 +556,5 @@ func getReleaseImagesForReleaseWithLog(l *zap.SugaredLogger, releaseID string) *
 			Image: fmt.Sprintf("https://coverartarchive.org/release/%s/%d-250.jpg", releaseID, img.ID),
 		})
 	}
-	return &images
+	return &images, nil
 }
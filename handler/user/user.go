@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"strconv"
 
+	"github.com/mager/occipital/auth"
 	"github.com/mager/occipital/database"
 	"go.uber.org/zap"
 )
@@ -35,41 +36,40 @@ type UserResponse struct {
 }
 
 // GetUser godoc
-// @Summary Get user by ID
-// @Description Get user details by user ID
+// @Summary Get current user
+// @Description Get the authenticated user
 // @Accept json
 // @Produce json
-// @Param id query string true "User ID"
+// @Security BearerAuth
 // @Success 200 {object} UserResponse
 // @Router /user [get]
 
 // PutUser godoc
-// @Summary Update user by ID
-// @Description Update user details by user ID
+// @Summary Update current user
+// @Description Update the authenticated user
 // @Accept json
 // @Produce json
-// @Param id query string true "User ID"
+// @Security BearerAuth
 // @Param user body database.User true "Updated user information"
 // @Success 200 {object} UserResponse
 // @Router /user [put]
 func (h *UserHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	userID := r.URL.Query().Get("id")
-	if userID == "" {
-		w.WriteHeader(http.StatusBadRequest)
+	p, ok := auth.FromContext(r.Context())
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
 		return
 	}
 
 	if r.Method == http.MethodGet {
-		h.getUser(w, r)
+		h.getUser(w, p.UserID)
 	} else if r.Method == http.MethodPut {
-		h.updateUser(w, r)
+		h.updateUser(w, r, p.UserID)
 	} else {
 		w.WriteHeader(http.StatusMethodNotAllowed)
 	}
 }
 
-func (h *UserHandler) getUser(w http.ResponseWriter, r *http.Request) {
-	userID := r.URL.Query().Get("id")
+func (h *UserHandler) getUser(w http.ResponseWriter, userID string) {
 	query := `
         SELECT id, username
         FROM users
@@ -96,9 +96,7 @@ func (h *UserHandler) getUser(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func (h *UserHandler) updateUser(w http.ResponseWriter, r *http.Request) {
-	userID := r.URL.Query().Get("id")
-
+func (h *UserHandler) updateUser(w http.ResponseWriter, r *http.Request, userID string) {
 	// Read the request body
 	var user database.User
 	if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
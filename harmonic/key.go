@@ -0,0 +1,177 @@
+// Package harmonic converts Spotify keys and tempos into the notations DJs
+// mix with and scores how well two tracks blend.
+package harmonic
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Key is a position on the Camelot wheel: Number 1-12, A for minor and B
+// for major. The zero value is an unknown key.
+type Key struct {
+	Number int
+	Minor  bool
+}
+
+var (
+	majorNames = [12]string{"C", "Db", "D", "Eb", "E", "F", "F#", "G", "Ab", "A", "Bb", "B"}
+	minorNames = [12]string{"C", "C#", "D", "Eb", "E", "F", "F#", "G", "G#", "A", "Bb", "B"}
+)
+
+// FromPitch maps a Spotify pitch class (0 = C, -1 = none) and mode
+// (1 = major, 0 = minor) to the wheel. Each step around the wheel is a
+// fifth, i.e. 7 semitones, with C major at 8B and C minor at 5A.
+func FromPitch(pitch, mode int) Key {
+	if pitch < 0 || pitch > 11 {
+		return Key{}
+	}
+	offset := 8
+	if mode == 0 {
+		offset = 5
+	}
+	return Key{Number: wheel(pitch*7 + offset), Minor: mode == 0}
+}
+
+// ParseCamelot reads Camelot notation such as "8A" or "12b".
+func ParseCamelot(s string) (Key, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	if len(s) < 2 {
+		return Key{}, fmt.Errorf("invalid camelot key %q", s)
+	}
+	n, err := strconv.Atoi(s[:len(s)-1])
+	if err != nil || n < 1 || n > 12 {
+		return Key{}, fmt.Errorf("invalid camelot key %q", s)
+	}
+	switch s[len(s)-1] {
+	case 'A':
+		return Key{Number: n, Minor: true}, nil
+	case 'B':
+		return Key{Number: n}, nil
+	}
+	return Key{}, fmt.Errorf("invalid camelot key %q", s)
+}
+
+// wheel folds n onto 1-12.
+func wheel(n int) int {
+	n %= 12
+	if n <= 0 {
+		n += 12
+	}
+	return n
+}
+
+func (k Key) Known() bool {
+	return k.Number != 0
+}
+
+// Pitch returns the Spotify pitch class of the key's tonic.
+func (k Key) Pitch() int {
+	offset := 8
+	if k.Minor {
+		offset = 5
+	}
+	// 7 is its own inverse mod 12, so this undoes FromPitch
+	return ((k.Number-offset)*7%12 + 12) % 12
+}
+
+// Camelot returns Camelot notation, e.g. "8A" for A minor.
+func (k Key) Camelot() string {
+	if !k.Known() {
+		return ""
+	}
+	if k.Minor {
+		return strconv.Itoa(k.Number) + "A"
+	}
+	return strconv.Itoa(k.Number) + "B"
+}
+
+// OpenKey returns Open Key notation, e.g. "1m" for A minor. It is the
+// Camelot wheel turned so C major is 1d.
+func (k Key) OpenKey() string {
+	if !k.Known() {
+		return ""
+	}
+	if k.Minor {
+		return strconv.Itoa(wheel(k.Number-7)) + "m"
+	}
+	return strconv.Itoa(wheel(k.Number-7)) + "d"
+}
+
+// Name spells the key out, e.g. "A minor".
+func (k Key) Name() string {
+	if !k.Known() {
+		return ""
+	}
+	if k.Minor {
+		return minorNames[k.Pitch()] + " minor"
+	}
+	return majorNames[k.Pitch()] + " major"
+}
+
+func (k Key) String() string {
+	return k.Camelot()
+}
+
+// Relation describes how two keys sit on the wheel.
+type Relation string
+
+const (
+	// Same is the same key.
+	Same Relation = "same"
+	// Adjacent is one step around the wheel, same mode.
+	Adjacent Relation = "adjacent"
+	// Relative is the relative major or minor.
+	Relative Relation = "relative"
+	// Diagonal is one step around and a change of mode; usable but audible.
+	Diagonal Relation = "diagonal"
+	// Clash is anything further apart.
+	Clash Relation = "clash"
+	// Unknown means either key wasn't detected.
+	Unknown Relation = "unknown"
+)
+
+// Relate classifies the move between two keys. It is symmetric.
+func Relate(a, b Key) Relation {
+	if !a.Known() || !b.Known() {
+		return Unknown
+	}
+	step := wheel(a.Number-b.Number) % 12 // 0 for the same number
+	near := step == 1 || step == 11
+	switch {
+	case step == 0 && a.Minor == b.Minor:
+		return Same
+	case step == 0:
+		return Relative
+	case near && a.Minor == b.Minor:
+		return Adjacent
+	case near:
+		return Diagonal
+	}
+	return Clash
+}
+
+// Compatible reports whether the keys mix without a clash: the same key,
+// an adjacent key or the relative major/minor.
+func Compatible(a, b Key) bool {
+	switch Relate(a, b) {
+	case Same, Adjacent, Relative:
+		return true
+	}
+	return false
+}
+
+var relationScores = map[Relation]float64{
+	Same:     1,
+	Adjacent: 0.9,
+	Relative: 0.8,
+	Diagonal: 0.5,
+	Clash:    0,
+	Unknown:  0.5,
+}
+
+// KeyScore rates a key change from 0 (clash) to 1 (same key).
+func KeyScore(a, b Key) float64 {
+	return relationScores[Relate(a, b)]
+}
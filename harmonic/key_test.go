@@ -0,0 +1,105 @@
+package harmonic
+
+import "testing"
+
+func TestFromPitch(t *testing.T) {
+	tests := []struct {
+		pitch, mode int
+		camelot     string
+		openKey     string
+		name        string
+	}{
+		{0, 1, "8B", "1d", "C major"},
+		{9, 0, "8A", "1m", "A minor"},
+		{0, 0, "5A", "10m", "C minor"},
+		{7, 1, "9B", "2d", "G major"},
+		{4, 0, "9A", "2m", "E minor"},
+		{5, 1, "7B", "12d", "F major"},
+		{6, 1, "2B", "7d", "F# major"},
+		{8, 0, "1A", "6m", "G# minor"},
+		{-1, 1, "", "", ""},
+		{12, 0, "", "", ""},
+	}
+	for _, tt := range tests {
+		k := FromPitch(tt.pitch, tt.mode)
+		if k.Camelot() != tt.camelot || k.OpenKey() != tt.openKey || k.Name() != tt.name {
+			t.Errorf("FromPitch(%d, %d) = %s / %s / %s, want %s / %s / %s",
+				tt.pitch, tt.mode, k.Camelot(), k.OpenKey(), k.Name(), tt.camelot, tt.openKey, tt.name)
+		}
+	}
+}
+
+func TestPitchRoundTrip(t *testing.T) {
+	for pitch := range 12 {
+		for _, mode := range []int{0, 1} {
+			k := FromPitch(pitch, mode)
+			if got := k.Pitch(); got != pitch {
+				t.Errorf("FromPitch(%d, %d).Pitch() = %d", pitch, mode, got)
+			}
+			parsed, err := ParseCamelot(k.Camelot())
+			if err != nil || parsed != k {
+				t.Errorf("ParseCamelot(%q) = %v, %v; want %v", k.Camelot(), parsed, err, k)
+			}
+		}
+	}
+}
+
+func TestParseCamelot(t *testing.T) {
+	for _, s := range []string{"", "8", "B", "0A", "13B", "8C", "xA"} {
+		if _, err := ParseCamelot(s); err == nil {
+			t.Errorf("ParseCamelot(%q) succeeded", s)
+		}
+	}
+	if k, err := ParseCamelot(" 12b "); err != nil || k != (Key{Number: 12}) {
+		t.Errorf("ParseCamelot(\" 12b \") = %v, %v", k, err)
+	}
+}
+
+func TestRelate(t *testing.T) {
+	key := func(s string) Key {
+		k, err := ParseCamelot(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return k
+	}
+	tests := []struct {
+		a, b string
+		want Relation
+	}{
+		{"8A", "8A", Same},
+		{"8A", "9A", Adjacent},
+		{"12B", "1B", Adjacent},
+		{"8A", "8B", Relative},
+		{"8A", "9B", Diagonal},
+		{"1A", "12B", Diagonal},
+		{"8A", "10A", Clash},
+		{"8A", "2B", Clash},
+	}
+	for _, tt := range tests {
+		a, b := key(tt.a), key(tt.b)
+		if got := Relate(a, b); got != tt.want {
+			t.Errorf("Relate(%s, %s) = %s, want %s", tt.a, tt.b, got, tt.want)
+		}
+		if got := Relate(b, a); got != tt.want {
+			t.Errorf("Relate(%s, %s) = %s, want %s", tt.b, tt.a, got, tt.want)
+		}
+	}
+	if got := Relate(Key{}, key("8A")); got != Unknown {
+		t.Errorf("Relate with an unknown key = %s, want unknown", got)
+	}
+
+	// Symmetric across the whole wheel
+	for pa := range 12 {
+		for pb := range 12 {
+			for _, ma := range []int{0, 1} {
+				for _, mb := range []int{0, 1} {
+					a, b := FromPitch(pa, ma), FromPitch(pb, mb)
+					if Relate(a, b) != Relate(b, a) {
+						t.Errorf("Relate(%s, %s) != Relate(%s, %s)", a, b, b, a)
+					}
+				}
+			}
+		}
+	}
+}
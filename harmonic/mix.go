@@ -0,0 +1,196 @@
+package harmonic
+
+import (
+	"math"
+)
+
+const (
+	// maxTempoShift is the tempo change, as a fraction, beyond which a
+	// transition scores zero for tempo; most decks pitch about ±8%.
+	maxTempoShift = 0.08
+	// halfTimePenalty discounts matches that only work at half or double time.
+	halfTimePenalty = 0.9
+
+	keyWeight   = 0.6
+	tempoWeight = 0.4
+)
+
+// HalfTime and DoubleTime are the tempos a track can be mixed against at
+// half or double time.
+func HalfTime(bpm float64) float64   { return bpm / 2 }
+func DoubleTime(bpm float64) float64 { return bpm * 2 }
+
+// TempoShift returns how far b is from a as a fraction of a, trying b at
+// half, normal and double time, and whether the closest match needed one of
+// those. It is symmetric and ok is false if either tempo is unknown.
+func TempoShift(a, b float64) (shift float64, halfOrDouble bool, ok bool) {
+	if a <= 0 || b <= 0 {
+		return 0, false, false
+	}
+	// Compare on a log scale so a→b and b→a agree
+	best := math.Inf(1)
+	for _, f := range []float64{0.5, 1, 2} {
+		if d := math.Abs(math.Log(b * f / a)); d < best {
+			best = d
+			halfOrDouble = f != 1
+		}
+	}
+	return math.Exp(best) - 1, halfOrDouble, true
+}
+
+// TempoScore rates a tempo change from 0 (too far to beatmatch) to 1.
+func TempoScore(a, b float64) float64 {
+	shift, halfOrDouble, ok := TempoShift(a, b)
+	if !ok {
+		return 0.5
+	}
+	score := max(0, 1-shift/maxTempoShift)
+	if halfOrDouble {
+		score *= halfTimePenalty
+	}
+	return score
+}
+
+// Track is what ordering needs to know about a track.
+type Track struct {
+	Key   Key
+	Tempo float64
+}
+
+// Transition scores moving from one track to the next.
+type Transition struct {
+	Relation   Relation
+	KeyScore   float64
+	TempoScore float64
+	// TempoShift is the tempo change as a fraction, after any half or
+	// double time; 0 when a tempo is unknown.
+	TempoShift float64
+	Score      float64
+}
+
+// Transit scores the move from a to b.
+func Transit(a, b Track) Transition {
+	t := Transition{
+		Relation:   Relate(a.Key, b.Key),
+		KeyScore:   KeyScore(a.Key, b.Key),
+		TempoScore: TempoScore(a.Tempo, b.Tempo),
+	}
+	t.TempoShift, _, _ = TempoShift(a.Tempo, b.Tempo)
+	t.Score = keyWeight*t.KeyScore + tempoWeight*t.TempoScore
+	return t
+}
+
+// Order returns the indexes of tracks in a mix order that maximizes the
+// total transition score. If start is a valid index the mix opens with it.
+// It builds a nearest-neighbour path from each candidate opener, keeps the
+// best, and then improves it with 2-opt, which is plenty for a set list.
+func Order(tracks []Track, start int) []int {
+	n := len(tracks)
+	if n < 3 {
+		order := make([]int, n)
+		for i := range order {
+			order[i] = i
+		}
+		if n == 2 && start == 1 {
+			order[0], order[1] = 1, 0
+		}
+		return order
+	}
+
+	score := make([][]float64, n)
+	for i := range score {
+		score[i] = make([]float64, n)
+		for j := range score[i] {
+			if i != j {
+				score[i][j] = Transit(tracks[i], tracks[j]).Score
+			}
+		}
+	}
+
+	openers := []int{start}
+	if start < 0 || start >= n {
+		openers = make([]int, n)
+		for i := range openers {
+			openers[i] = i
+		}
+	}
+
+	var best []int
+	bestTotal := math.Inf(-1)
+	for _, o := range openers {
+		path := greedy(score, o)
+		if t := total(score, path); t > bestTotal {
+			best, bestTotal = path, t
+		}
+	}
+
+	twoOpt(score, best, start >= 0 && start < n)
+	return best
+}
+
+func greedy(score [][]float64, from int) []int {
+	n := len(score)
+	used := make([]bool, n)
+	path := make([]int, 0, n)
+	cur := from
+	for {
+		used[cur] = true
+		path = append(path, cur)
+		if len(path) == n {
+			return path
+		}
+		next, nextScore := -1, math.Inf(-1)
+		for j := range n {
+			if !used[j] && score[cur][j] > nextScore {
+				next, nextScore = j, score[cur][j]
+			}
+		}
+		cur = next
+	}
+}
+
+func total(score [][]float64, path []int) float64 {
+	var sum float64
+	for i := 1; i < len(path); i++ {
+		sum += score[path[i-1]][path[i]]
+	}
+	return sum
+}
+
+// twoOpt reverses segments of path while that raises the total. Scores are
+// symmetric, so only the edges at either end of a segment change.
+func twoOpt(score [][]float64, path []int, pinFirst bool) {
+	n := len(path)
+	first := 0
+	if pinFirst {
+		first = 1
+	}
+	edge := func(a, b int) float64 {
+		if a < 0 || b >= n {
+			return 0
+		}
+		return score[path[a]][path[b]]
+	}
+	const epsilon = 1e-9
+	for improved := true; improved; {
+		improved = false
+		for i := first; i < n-1; i++ {
+			for j := i + 1; j < n; j++ {
+				before := edge(i-1, i) + edge(j, j+1)
+				after := 0.0
+				if i > 0 {
+					after += score[path[i-1]][path[j]]
+				}
+				if j < n-1 {
+					after += score[path[i]][path[j+1]]
+				}
+				if after > before+epsilon {
+					for a, b := i, j; a < b; a, b = a+1, b-1 {
+						path[a], path[b] = path[b], path[a]
+					}
+					improved = true
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package harmonic
+
+import (
+	"math"
+	"slices"
+	"testing"
+)
+
+func TestTempoShift(t *testing.T) {
+	tests := []struct {
+		name         string
+		a, b         float64
+		shift        float64
+		halfOrDouble bool
+		ok           bool
+	}{
+		{"same", 120, 120, 0, false, true},
+		{"half time", 120, 60, 0, true, true},
+		{"double time", 60, 120, 0, true, true},
+		{"5% faster", 120, 126, 0.05, false, true},
+		{"near double", 70, 147, 0.05, true, true},
+		{"unknown", 0, 120, 0, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, pair := range [][2]float64{{tt.a, tt.b}, {tt.b, tt.a}} {
+				shift, hd, ok := TempoShift(pair[0], pair[1])
+				if math.Abs(shift-tt.shift) > 1e-9 || hd != tt.halfOrDouble || ok != tt.ok {
+					t.Errorf("TempoShift(%v, %v) = %v, %v, %v; want %v, %v, %v",
+						pair[0], pair[1], shift, hd, ok, tt.shift, tt.halfOrDouble, tt.ok)
+				}
+			}
+		})
+	}
+
+	if s := TempoScore(120, 60); s != halfTimePenalty {
+		t.Errorf("TempoScore at half time = %v, want %v", s, halfTimePenalty)
+	}
+	if s := TempoScore(120, 140); s != 0 {
+		t.Errorf("TempoScore beyond the pitch range = %v, want 0", s)
+	}
+}
+
+func TestOrder(t *testing.T) {
+	key := func(s string) Key {
+		k, _ := ParseCamelot(s)
+		return k
+	}
+	// A walk around the wheel, shuffled
+	tracks := []Track{
+		{key("10A"), 124},
+		{key("7A"), 124},
+		{key("9A"), 124},
+		{key("11A"), 124},
+		{key("8A"), 124},
+	}
+
+	tests := []struct {
+		name  string
+		start int
+	}{
+		{"free", -1},
+		{"out of range", len(tracks)},
+		{"opens with the middle of the walk", 2},
+		{"opens with an end", 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order := Order(tracks, tt.start)
+			sorted := slices.Clone(order)
+			slices.Sort(sorted)
+			if !slices.Equal(sorted, []int{0, 1, 2, 3, 4}) {
+				t.Fatalf("Order = %v, not a permutation", order)
+			}
+			if tt.start >= 0 && tt.start < len(tracks) && order[0] != tt.start {
+				t.Errorf("Order = %v, want it to open with %d", order, tt.start)
+			}
+			if tt.start == 2 {
+				return
+			}
+			// Otherwise every step can be to an adjacent key
+			for i := 1; i < len(order); i++ {
+				if r := Relate(tracks[order[i-1]].Key, tracks[order[i]].Key); r != Adjacent {
+					t.Errorf("Order = %v, step %d is %s", order, i, r)
+				}
+			}
+		})
+	}
+
+	if got := Order(tracks[:2], 1); !slices.Equal(got, []int{1, 0}) {
+		t.Errorf("Order of two starting at 1 = %v", got)
+	}
+}
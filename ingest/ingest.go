@@ -0,0 +1,88 @@
+// Package ingest fills the Firestore collections discover reads from. Each
+// Source fetches and parses one chart or feed; the Ingester resolves what it
+// found to Spotify IDs, ISRCs and MBIDs and writes the day's TracksDoc.
+package ingest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	fsClient "github.com/mager/occipital/firestore"
+	"go.uber.org/zap"
+)
+
+// ErrNoTracks is returned when a source parsed nothing. The day's doc is
+// left alone rather than overwritten with an empty chart.
+var ErrNoTracks = errors.New("ingest: source returned no tracks")
+
+// Source is one chart or feed discover ranks.
+type Source interface {
+	// Name is the Firestore collection the source writes to, e.g. "hnhh".
+	Name() string
+	// Fetch downloads and parses the source, best entry first.
+	Fetch(ctx context.Context) ([]Candidate, error)
+}
+
+// Candidate is a track as a source lists it. Sources fill in whatever IDs
+// they have; the Resolver looks up the rest.
+type Candidate struct {
+	Artist    string
+	Title     string
+	SpotifyID string
+	ISRC      string
+	MBID      string
+	// Thumb is the i.scdn.co image ID, as discover stores it
+	Thumb string
+}
+
+// Result summarizes one ingestion run.
+type Result struct {
+	Source   string
+	Date     string
+	Fetched  int
+	Written  int
+	Resolved int
+}
+
+// Ingester runs sources end to end.
+type Ingester struct {
+	log      *zap.SugaredLogger
+	fs       *firestore.Client
+	resolver *Resolver
+}
+
+func NewIngester(log *zap.SugaredLogger, fs *firestore.Client, resolver *Resolver) *Ingester {
+	return &Ingester{log: log, fs: fs, resolver: resolver}
+}
+
+// Run fetches src, resolves its tracks and writes them as the doc for now's
+// date, replacing any earlier run from the same day.
+func (in *Ingester) Run(ctx context.Context, src Source, now time.Time) (Result, error) {
+	res := Result{Source: src.Name(), Date: now.Format("2006-01-02")}
+
+	candidates, err := src.Fetch(ctx)
+	if err != nil {
+		return res, fmt.Errorf("fetch %s: %w", src.Name(), err)
+	}
+	res.Fetched = len(candidates)
+	if len(candidates) == 0 {
+		return res, ErrNoTracks
+	}
+
+	tracks := in.resolver.Resolve(ctx, candidates)
+	for _, t := range tracks {
+		if t.SpotifyID != "" {
+			res.Resolved++
+		}
+	}
+	res.Written = len(tracks)
+
+	doc := fsClient.TracksDoc{Tracks: tracks}
+	if _, err := in.fs.Collection(src.Name()).Doc(res.Date).Set(ctx, doc); err != nil {
+		return res, fmt.Errorf("write %s/%s: %w", src.Name(), res.Date, err)
+	}
+	return res, nil
+}
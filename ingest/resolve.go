@@ -0,0 +1,185 @@
+package ingest
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	fsClient "github.com/mager/occipital/firestore"
+	"github.com/mager/occipital/musicbrainz"
+	"github.com/mager/occipital/spotify"
+	spot "github.com/zmb3/spotify/v2"
+	"go.uber.org/zap"
+)
+
+const (
+	spotifyImagePrefix = "https://i.scdn.co/image/"
+
+	// mbISRCBatch keeps bulk ISRC queries well under MusicBrainz's URL limit
+	mbISRCBatch = 25
+)
+
+// Resolver fills in the IDs and artwork a source didn't provide. It's best
+// effort: a track that can't be resolved is still written with what it has.
+type Resolver struct {
+	log           *zap.SugaredLogger
+	spotifyClient *spotify.SpotifyClient
+	musicbrainz   *musicbrainz.MusicbrainzClient
+}
+
+func NewResolver(log *zap.SugaredLogger, spotifyClient *spotify.SpotifyClient, musicbrainz *musicbrainz.MusicbrainzClient) *Resolver {
+	return &Resolver{log: log, spotifyClient: spotifyClient, musicbrainz: musicbrainz}
+}
+
+// Resolve turns candidates into ranked Firestore tracks, in the order given.
+func (r *Resolver) Resolve(ctx context.Context, candidates []Candidate) []fsClient.Track {
+	cs := slices.Clone(candidates)
+
+	// Search Spotify for anything the source only named
+	for i := range cs {
+		if cs[i].SpotifyID == "" {
+			r.searchSpotify(ctx, &cs[i])
+		}
+	}
+
+	// Look up ISRCs and artwork for tracks we have an ID for
+	var missing []int
+	for i, c := range cs {
+		if c.SpotifyID != "" && (c.ISRC == "" || c.Thumb == "") {
+			missing = append(missing, i)
+		}
+	}
+	for chunk := range slices.Chunk(missing, 50) {
+		ids := make([]spot.ID, len(chunk))
+		for j, i := range chunk {
+			ids[j] = spot.ID(cs[i].SpotifyID)
+		}
+		tracks, err := r.spotifyClient.Client.GetTracks(ctx, ids)
+		if err != nil {
+			r.log.Warnw("Failed to fetch Spotify tracks", "count", len(ids), "err", err)
+			continue
+		}
+		for j, ft := range tracks {
+			if ft != nil {
+				fillFromSpotify(&cs[chunk[j]], ft)
+			}
+		}
+	}
+
+	r.resolveMBIDs(ctx, cs)
+
+	out := make([]fsClient.Track, len(cs))
+	for i, c := range cs {
+		out[i] = fsClient.Track{
+			Rank:      i + 1,
+			Artist:    c.Artist,
+			Title:     c.Title,
+			SpotifyID: c.SpotifyID,
+			Thumb:     c.Thumb,
+			MBID:      c.MBID,
+			ISRC:      c.ISRC,
+		}
+	}
+	return out
+}
+
+// searchSpotify takes the top search hit if its primary artist matches the
+// candidate's, so a vague title doesn't pick up someone else's song.
+func (r *Resolver) searchSpotify(ctx context.Context, c *Candidate) {
+	query := fmt.Sprintf("track:%s artist:%s", c.Title, c.Artist)
+	res, err := r.spotifyClient.Client.Search(ctx, query, spot.SearchTypeTrack, spot.Limit(5))
+	if err != nil {
+		r.log.Warnw("Spotify search failed", "artist", c.Artist, "title", c.Title, "err", err)
+		return
+	}
+	if res.Tracks == nil {
+		return
+	}
+	for i := range res.Tracks.Tracks {
+		ft := &res.Tracks.Tracks[i]
+		if len(ft.Artists) > 0 && sameArtist(c.Artist, ft.Artists[0].Name) {
+			c.SpotifyID = ft.ID.String()
+			fillFromSpotify(c, ft)
+			return
+		}
+	}
+	r.log.Debugw("No Spotify match", "artist", c.Artist, "title", c.Title)
+}
+
+// resolveMBIDs looks recordings up by ISRC in batches, at background
+// priority so interactive MusicBrainz lookups go first.
+func (r *Resolver) resolveMBIDs(ctx context.Context, cs []Candidate) {
+	var isrcs []string
+	hints := make(map[string]musicbrainz.RecordingHint)
+	for _, c := range cs {
+		if c.MBID == "" && c.ISRC != "" {
+			isrcs = append(isrcs, c.ISRC)
+			hints[c.ISRC] = musicbrainz.RecordingHint{Artists: []string{c.Artist}, Title: c.Title}
+		}
+	}
+	if len(isrcs) == 0 {
+		return
+	}
+
+	ctx = musicbrainz.WithPriority(ctx, musicbrainz.PriorityBackground)
+	mbids := make(map[string]string, len(isrcs))
+	for chunk := range slices.Chunk(isrcs, mbISRCBatch) {
+		found, err := r.musicbrainz.SearchRecordingCandidatesByBulkISRC(ctx, chunk)
+		if err != nil {
+			r.log.Warnw("MusicBrainz ISRC lookup failed", "count", len(chunk), "err", err)
+			continue
+		}
+		for isrc, cands := range found {
+			if m, ok := musicbrainz.Disambiguate(cands, hints[isrc]); ok {
+				mbids[isrc] = m.MBID
+			}
+		}
+	}
+	for i := range cs {
+		if cs[i].MBID == "" {
+			cs[i].MBID = mbids[cs[i].ISRC]
+		}
+	}
+}
+
+func fillFromSpotify(c *Candidate, ft *spot.FullTrack) {
+	if c.ISRC == "" {
+		c.ISRC = ft.ExternalIDs["isrc"]
+	}
+	if c.Thumb == "" {
+		c.Thumb = albumThumb(ft.Album)
+	}
+	if c.Artist == "" && len(ft.Artists) > 0 {
+		c.Artist = ft.Artists[0].Name
+	}
+	if c.Title == "" {
+		c.Title = ft.Name
+	}
+}
+
+// albumThumb returns the image ID of the 300px cover, or of the first
+// cover when there's no 300px one.
+func albumThumb(a spot.SimpleAlbum) string {
+	if len(a.Images) == 0 {
+		return ""
+	}
+	url := a.Images[0].URL
+	for _, img := range a.Images {
+		if img.Height == 300 && img.Width == 300 {
+			url = img.URL
+			break
+		}
+	}
+	return strings.TrimPrefix(url, spotifyImagePrefix)
+}
+
+// sameArtist compares primary artists loosely, so "JAY-Z" and "Jay-Z feat.
+// Kanye West" agree.
+func sameArtist(a, b string) bool {
+	a, b = strings.ToLower(strings.TrimSpace(a)), strings.ToLower(strings.TrimSpace(b))
+	if a == "" || b == "" {
+		return false
+	}
+	return strings.HasPrefix(a, b) || strings.HasPrefix(b, a)
+}
@@ -0,0 +1,202 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/mager/occipital/config"
+	"github.com/mager/occipital/musicbrainz"
+	"github.com/mager/occipital/spotify"
+	"go.uber.org/zap"
+)
+
+const (
+	retryBackoff    = 30 * time.Second
+	maxRetryBackoff = 10 * time.Minute
+)
+
+// Job schedules a source. Each job retries on its own, so one broken site
+// doesn't hold up the rest.
+type Job struct {
+	Source   Source
+	Interval time.Duration
+	// Retries is how many times a failed run is retried before waiting for
+	// the next interval
+	Retries int
+}
+
+// Task is recurring work that follows the sources rather than feeding them,
+// e.g. snapshotting the chart they make up.
+type Task struct {
+	Name     string
+	Interval time.Duration
+	Run      func(ctx context.Context, now time.Time) error
+}
+
+// Scheduler runs ingestion jobs on their intervals, and tasks after them.
+type Scheduler struct {
+	log      *zap.SugaredLogger
+	ingester *Ingester
+	jobs     []Job
+	tasks    []Task
+}
+
+func NewScheduler(log *zap.SugaredLogger, ingester *Ingester, jobs []Job) *Scheduler {
+	return &Scheduler{log: log, ingester: ingester, jobs: jobs}
+}
+
+// ProvideScheduler wires the built-in sources.
+func ProvideScheduler(cfg config.Config, log *zap.SugaredLogger, fs *firestore.Client, spotifyClient *spotify.SpotifyClient, mb *musicbrainz.MusicbrainzClient) *Scheduler {
+	ingester := NewIngester(log, fs, NewResolver(log, spotifyClient, mb))
+	return NewScheduler(log, ingester, []Job{
+		{Source: NewSpotifyNewReleases(spotifyClient, cfg.IngestSpotifyCountry), Interval: 6 * time.Hour, Retries: 3},
+	})
+}
+
+var Options = ProvideScheduler
+
+// AddTask schedules t alongside the jobs. It must be called before Start or
+// RunOnce.
+func (s *Scheduler) AddTask(t Task) {
+	s.tasks = append(s.tasks, t)
+}
+
+// Jobs returns the jobs whose source is named, or all of them when no
+// names are given.
+func (s *Scheduler) Jobs(names ...string) ([]Job, error) {
+	if len(names) == 0 {
+		return s.jobs, nil
+	}
+	var out []Job
+	for _, name := range names {
+		found := false
+		for _, j := range s.jobs {
+			if j.Source.Name() == name {
+				out = append(out, j)
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown source %q", name)
+		}
+	}
+	return out, nil
+}
+
+// RunOnce runs each job once, with retries, then each task once, and
+// returns every failure.
+func (s *Scheduler) RunOnce(ctx context.Context, jobs []Job) error {
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []error
+	)
+	for _, j := range jobs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := s.run(ctx, j); err != nil {
+				mu.Lock()
+				errs = append(errs, err)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	for _, t := range s.tasks {
+		if err := s.runTask(ctx, t); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Start runs every job now and then on its interval until ctx is done.
+// Tasks start once the first run of every job has finished, so they see
+// what it wrote.
+func (s *Scheduler) Start(ctx context.Context, jobs []Job) {
+	var first sync.WaitGroup
+	for _, j := range jobs {
+		first.Add(1)
+		go func() {
+			ticker := time.NewTicker(j.Interval)
+			defer ticker.Stop()
+			for i := 0; ; i++ {
+				if err := s.run(ctx, j); err != nil && ctx.Err() == nil {
+					s.log.Errorw("Ingestion failed", "source", j.Source.Name(), "err", err, "next", time.Now().Add(j.Interval))
+				}
+				if i == 0 {
+					first.Done()
+				}
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+				}
+			}
+		}()
+	}
+
+	for _, t := range s.tasks {
+		go func() {
+			first.Wait()
+			ticker := time.NewTicker(t.Interval)
+			defer ticker.Stop()
+			for {
+				if err := s.runTask(ctx, t); err != nil && ctx.Err() == nil {
+					s.log.Errorw("Task failed", "task", t.Name, "err", err, "next", time.Now().Add(t.Interval))
+				}
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+				}
+			}
+		}()
+	}
+}
+
+func (s *Scheduler) runTask(ctx context.Context, t Task) error {
+	start := time.Now()
+	if err := t.Run(ctx, start); err != nil {
+		return fmt.Errorf("%s: %w", t.Name, err)
+	}
+	s.log.Infow("Ran task", "task", t.Name, "duration", time.Since(start))
+	return nil
+}
+
+// run ingests j.Source, retrying with exponential backoff.
+func (s *Scheduler) run(ctx context.Context, j Job) error {
+	name := j.Source.Name()
+	for attempt := 0; ; attempt++ {
+		start := time.Now()
+		res, err := s.ingester.Run(ctx, j.Source, start)
+		if err == nil {
+			s.log.Infow("Ingested source",
+				"source", name,
+				"date", res.Date,
+				"fetched", res.Fetched,
+				"written", res.Written,
+				"resolved", res.Resolved,
+				"duration", time.Since(start),
+			)
+			return nil
+		}
+		if attempt >= j.Retries || ctx.Err() != nil {
+			return err
+		}
+
+		backoff := min(retryBackoff<<attempt, maxRetryBackoff)
+		s.log.Warnw("Ingestion attempt failed, retrying", "source", name, "attempt", attempt+1, "backoff", backoff, "err", err)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestRunOnceRunsTasks(t *testing.T) {
+	s := NewScheduler(zap.NewNop().Sugar(), nil, nil)
+	boom := errors.New("boom")
+
+	var ran []string
+	s.AddTask(Task{Name: "ok", Interval: time.Hour, Run: func(context.Context, time.Time) error {
+		ran = append(ran, "ok")
+		return nil
+	}})
+	s.AddTask(Task{Name: "failing", Interval: time.Hour, Run: func(context.Context, time.Time) error {
+		ran = append(ran, "failing")
+		return boom
+	}})
+
+	err := s.RunOnce(context.Background(), nil)
+	if !errors.Is(err, boom) {
+		t.Errorf("RunOnce err = %v, want %v", err, boom)
+	}
+	if len(ran) != 2 || ran[0] != "ok" || ran[1] != "failing" {
+		t.Errorf("ran = %v, want [ok failing]", ran)
+	}
+}
+
+func TestStartRunsTasksWithoutJobs(t *testing.T) {
+	s := NewScheduler(zap.NewNop().Sugar(), nil, nil)
+	done := make(chan struct{})
+	s.AddTask(Task{Name: "snapshot", Interval: time.Hour, Run: func(context.Context, time.Time) error {
+		close(done)
+		return nil
+	}})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s.Start(ctx, nil)
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("task never ran")
+	}
+}
@@ -0,0 +1,69 @@
+package ingest
+
+import (
+	"context"
+	"slices"
+
+	"github.com/mager/occipital/spotify"
+	"github.com/mager/occipital/util"
+	spot "github.com/zmb3/spotify/v2"
+)
+
+const (
+	newReleasesCollection = "spotify_new_releases"
+	newReleasesLimit      = 50
+	// spotifyAlbumBatch is the most albums GetAlbums accepts at once
+	spotifyAlbumBatch = 20
+)
+
+// SpotifyNewReleases lists the lead track of each album on Spotify's new
+// releases page, in Spotify's order.
+type SpotifyNewReleases struct {
+	spotifyClient *spotify.SpotifyClient
+	country       string
+}
+
+func NewSpotifyNewReleases(spotifyClient *spotify.SpotifyClient, country string) *SpotifyNewReleases {
+	return &SpotifyNewReleases{spotifyClient: spotifyClient, country: country}
+}
+
+func (s *SpotifyNewReleases) Name() string {
+	return newReleasesCollection
+}
+
+func (s *SpotifyNewReleases) Fetch(ctx context.Context) ([]Candidate, error) {
+	opts := []spot.RequestOption{spot.Limit(newReleasesLimit)}
+	if s.country != "" {
+		opts = append(opts, spot.Country(s.country))
+	}
+	page, err := s.spotifyClient.Client.NewReleases(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]spot.ID, len(page.Albums))
+	for i, a := range page.Albums {
+		ids[i] = a.ID
+	}
+
+	var out []Candidate
+	for chunk := range slices.Chunk(ids, spotifyAlbumBatch) {
+		albums, err := s.spotifyClient.Client.GetAlbums(ctx, chunk)
+		if err != nil {
+			return nil, err
+		}
+		for _, a := range albums {
+			if a == nil || len(a.Tracks.Tracks) == 0 {
+				continue
+			}
+			lead := a.Tracks.Tracks[0]
+			out = append(out, Candidate{
+				Artist:    util.GetFirstArtist(lead.Artists),
+				Title:     lead.Name,
+				SpotifyID: lead.ID.String(),
+				Thumb:     albumThumb(a.SimpleAlbum),
+			})
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,65 @@
+package ingest
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/mager/occipital/spotify"
+	spot "github.com/zmb3/spotify/v2"
+)
+
+func TestSpotifyNewReleases(t *testing.T) {
+	fixtures := map[string]string{
+		"/browse/new-releases": "testdata/spotify_new_releases.json",
+		"/albums":              "testdata/spotify_albums.json",
+	}
+	var country string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/browse/new-releases" {
+			country = r.URL.Query().Get("country")
+		}
+		b, err := os.ReadFile(fixtures[r.URL.Path])
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(b)
+	}))
+	defer srv.Close()
+
+	client := &spotify.SpotifyClient{Client: spot.New(srv.Client(), spot.WithBaseURL(srv.URL+"/"))}
+	src := NewSpotifyNewReleases(client, "GB")
+	if src.Name() != "spotify_new_releases" {
+		t.Errorf("Name() = %q", src.Name())
+	}
+
+	got, err := src.Fetch(context.Background())
+	if err != nil {
+		t.Fatalf("Fetch: %v", err)
+	}
+	if country != "GB" {
+		t.Errorf("country = %q, want GB", country)
+	}
+	// Lead tracks in release order, with the 300px cover; unknown albums skipped
+	want := []Candidate{
+		{
+			Artist:    "Tyler, The Creator",
+			Title:     "St. Chroma (feat. Daniel Caesar)",
+			SpotifyID: "2AJaZvmJm5EeDdOCA7aXpA",
+			Thumb:     "ab67616d00001e02124e9249fada4ff3c3a0739c",
+		},
+		{
+			Artist:    "Doechii",
+			Title:     "Anxiety",
+			SpotifyID: "3yoy6lW3uVL2ROmk8pAKWh",
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Fetch() = %+v\nwant %+v", got, want)
+	}
+}
@@ -0,0 +1,253 @@
+package ingest
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/charset"
+)
+
+const (
+	userAgent = "beatbrain/occipital/1.0.0 (+https://github.com/mager/occipital)"
+
+	// maxPageBytes bounds what a misbehaving site can make us read
+	maxPageBytes = 5 << 20
+)
+
+var (
+	httpClient = &http.Client{Timeout: 20 * time.Second}
+
+	// leadingTags matches prefixes like "[FRESH]" or "(Video)"
+	leadingTags = regexp.MustCompile(`^\s*(?:[\[(][^\])]*[\])]\s*)+`)
+
+	// quotedTitle matches `Artist "Title"` and `Artist: “Title”`
+	quotedTitle = regexp.MustCompile(`^(.+?):?\s+["“”](.+?)["“”]`)
+)
+
+// FeedItem is one RSS item or Atom entry.
+type FeedItem struct {
+	Title       string
+	Link        string
+	Description string
+	Categories  []string
+}
+
+// FeedSource is the base for sources published as RSS or Atom. Parse maps
+// each item to a candidate and reports false to skip it.
+type FeedSource struct {
+	name  string
+	url   string
+	parse func(FeedItem) (Candidate, bool)
+}
+
+func NewFeedSource(name, url string, parse func(FeedItem) (Candidate, bool)) *FeedSource {
+	return &FeedSource{name: name, url: url, parse: parse}
+}
+
+func (s *FeedSource) Name() string {
+	return s.name
+}
+
+func (s *FeedSource) Fetch(ctx context.Context) ([]Candidate, error) {
+	body, err := get(ctx, s.url)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	items, err := ParseFeed(body)
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", s.url, err)
+	}
+	var out []Candidate
+	for _, item := range items {
+		if c, ok := s.parse(item); ok {
+			out = append(out, c)
+		}
+	}
+	return out, nil
+}
+
+// ParseFeed reads RSS 2.0 or Atom, whichever r holds.
+func ParseFeed(r io.Reader) ([]FeedItem, error) {
+	var doc struct {
+		XMLName xml.Name
+		// RSS
+		Items []struct {
+			Title       string   `xml:"title"`
+			Link        string   `xml:"link"`
+			Description string   `xml:"description"`
+			Categories  []string `xml:"category"`
+		} `xml:"channel>item"`
+		// Atom
+		Entries []struct {
+			Title string `xml:"title"`
+			Links []struct {
+				Href string `xml:"href,attr"`
+				Rel  string `xml:"rel,attr"`
+			} `xml:"link"`
+			Content    string `xml:"content"`
+			Summary    string `xml:"summary"`
+			Categories []struct {
+				Term string `xml:"term,attr"`
+			} `xml:"category"`
+		} `xml:"entry"`
+	}
+	dec := xml.NewDecoder(r)
+	// Feeds in the wild declare all sorts of charsets, e.g. ISO-8859-1 or windows-1252
+	dec.CharsetReader = charset.NewReaderLabel
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+
+	var items []FeedItem
+	switch doc.XMLName.Local {
+	case "rss":
+		for _, it := range doc.Items {
+			items = append(items, FeedItem{
+				Title:       html.UnescapeString(strings.TrimSpace(it.Title)),
+				Link:        strings.TrimSpace(it.Link),
+				Description: it.Description,
+				Categories:  it.Categories,
+			})
+		}
+	case "feed":
+		for _, e := range doc.Entries {
+			item := FeedItem{
+				Title:       html.UnescapeString(strings.TrimSpace(e.Title)),
+				Description: e.Content,
+			}
+			if item.Description == "" {
+				item.Description = e.Summary
+			}
+			for _, l := range e.Links {
+				if l.Rel == "" || l.Rel == "alternate" {
+					item.Link = l.Href
+					break
+				}
+			}
+			for _, c := range e.Categories {
+				item.Categories = append(item.Categories, c.Term)
+			}
+			items = append(items, item)
+		}
+	default:
+		return nil, fmt.Errorf("unknown feed type %q", doc.XMLName.Local)
+	}
+	return items, nil
+}
+
+// PageSource is the base for sources scraped from HTML. Parse receives the
+// parsed document and returns candidates best first.
+type PageSource struct {
+	name  string
+	url   string
+	parse func(*html.Node) ([]Candidate, error)
+}
+
+func NewPageSource(name, url string, parse func(*html.Node) ([]Candidate, error)) *PageSource {
+	return &PageSource{name: name, url: url, parse: parse}
+}
+
+func (s *PageSource) Name() string {
+	return s.name
+}
+
+func (s *PageSource) Fetch(ctx context.Context) ([]Candidate, error) {
+	body, err := get(ctx, s.url)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	doc, err := html.Parse(body)
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", s.url, err)
+	}
+	return s.parse(doc)
+}
+
+func get(ctx context.Context, url string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", userAgent)
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s returned status %d", url, resp.StatusCode)
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(resp.Body, maxPageBytes), resp.Body}, nil
+}
+
+// SplitArtistTitle splits a post title like "[FRESH] Artist - Title" or
+// `Artist: "Title"` into its parts.
+func SplitArtistTitle(s string) (artist, title string, ok bool) {
+	s = strings.TrimSpace(leadingTags.ReplaceAllString(s, ""))
+	for _, sep := range []string{" - ", " – ", " — "} {
+		if a, t, found := strings.Cut(s, sep); found {
+			artist, title = strings.TrimSpace(a), strings.Trim(strings.TrimSpace(t), `"“”`)
+			return artist, title, artist != "" && title != ""
+		}
+	}
+	if m := quotedTitle.FindStringSubmatch(s); m != nil {
+		return strings.TrimSpace(m[1]), strings.TrimSpace(m[2]), true
+	}
+	return "", "", false
+}
+
+// FindAll returns every node under n, in document order, that match accepts.
+func FindAll(n *html.Node, match func(*html.Node) bool) []*html.Node {
+	var out []*html.Node
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if match(n) {
+			out = append(out, n)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return out
+}
+
+// HasClass reports whether n is an element with the given class.
+func HasClass(n *html.Node, class string) bool {
+	return n.Type == html.ElementNode && strings.Contains(" "+Attr(n, "class")+" ", " "+class+" ")
+}
+
+// Attr returns n's attribute key, or "".
+func Attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+// Text returns the text under n with whitespace collapsed.
+func Text(n *html.Node) string {
+	var b strings.Builder
+	for _, t := range FindAll(n, func(n *html.Node) bool { return n.Type == html.TextNode }) {
+		b.WriteString(t.Data)
+		b.WriteByte(' ')
+	}
+	return strings.Join(strings.Fields(b.String()), " ")
+}
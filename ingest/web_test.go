@@ -0,0 +1,242 @@
+package ingest
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+func openFixture(t *testing.T, name string) *os.File {
+	t.Helper()
+	f, err := os.Open("testdata/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { f.Close() })
+	return f
+}
+
+func TestParseFeedRSS(t *testing.T) {
+	items, err := ParseFeed(openFixture(t, "rss.xml"))
+	if err != nil {
+		t.Fatalf("ParseFeed: %v", err)
+	}
+	if len(items) != 4 {
+		t.Fatalf("got %d items, want 4", len(items))
+	}
+
+	first := items[0]
+	if first.Title != "[FRESH] Kendrick Lamar - Not Like Us" {
+		t.Errorf("title = %q", first.Title)
+	}
+	if first.Link != "https://www.example.com/songs/kendrick-lamar-not-like-us" {
+		t.Errorf("link = %q", first.Link)
+	}
+	if !reflect.DeepEqual(first.Categories, []string{"Songs", "Kendrick Lamar"}) {
+		t.Errorf("categories = %q", first.Categories)
+	}
+	if !strings.Contains(first.Description, "i.scdn.co/image/") {
+		t.Errorf("description lost its CDATA: %q", first.Description)
+	}
+
+	// Entities escaped twice by the CMS come out as text, and links are trimmed
+	if items[1].Title != "Tyler, The Creator – “Sticky”" {
+		t.Errorf("double-escaped title = %q", items[1].Title)
+	}
+	if items[1].Link != "https://www.example.com/songs/tyler-the-creator-sticky" {
+		t.Errorf("link = %q", items[1].Link)
+	}
+	if items[2].Title != "Doechii: “Anxiety” (Video)" {
+		t.Errorf("title = %q", items[2].Title)
+	}
+}
+
+func TestParseFeedAtom(t *testing.T) {
+	items, err := ParseFeed(openFixture(t, "atom.xml"))
+	if err != nil {
+		t.Fatalf("ParseFeed: %v", err)
+	}
+	want := []FeedItem{
+		{
+			Title:      "[FRESH] Clipse ft. Kendrick Lamar & Pusha T - Chains & Whips",
+			Link:       "https://www.reddit.com/r/hiphopheads/comments/1o6abcd/fresh_clipse_ft_kendrick_lamar_chains_whips/",
+			Categories: []string{"hiphopheads"},
+		},
+		{
+			Title:       "[FRESH VIDEO] [DEBUT] JID — “WRONG”",
+			Link:        "https://www.reddit.com/r/hiphopheads/comments/1o6efgh/fresh_video_jid_wrong/",
+			Description: "Off the new tape",
+			Categories:  []string{"hiphopheads"},
+		},
+	}
+	if len(items) != len(want) {
+		t.Fatalf("got %d items, want %d", len(items), len(want))
+	}
+	// Content wins over summary
+	if !strings.Contains(items[0].Description, "open.spotify.com/track/2u8uxgMKl2lYVRa8HDkQuN") {
+		t.Errorf("content = %q", items[0].Description)
+	}
+	items[0].Description = ""
+	if !reflect.DeepEqual(items, want) {
+		t.Errorf("items = %+v\nwant %+v", items, want)
+	}
+}
+
+func TestParseFeedCharset(t *testing.T) {
+	items, err := ParseFeed(openFixture(t, "rss_latin1.xml"))
+	if err != nil {
+		t.Fatalf("ParseFeed: %v", err)
+	}
+	if len(items) != 1 || items[0].Title != "Beyoncé - Café Crème" {
+		t.Errorf("items = %+v, want the title decoded from ISO-8859-1", items)
+	}
+}
+
+func TestParseFeedErrors(t *testing.T) {
+	for name, body := range map[string]string{
+		"not a feed": `<?xml version="1.0"?><html><body/></html>`,
+		"truncated":  `<rss version="2.0"><channel><item><title>cut off`,
+		"charset":    `<?xml version="1.0" encoding="x-unknown"?><rss/>`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := ParseFeed(strings.NewReader(body)); err == nil {
+				t.Error("ParseFeed succeeded, want an error")
+			}
+		})
+	}
+}
+
+func TestSplitArtistTitle(t *testing.T) {
+	tests := []struct {
+		in            string
+		artist, title string
+		ok            bool
+	}{
+		{"Kendrick Lamar - Not Like Us", "Kendrick Lamar", "Not Like Us", true},
+		{"[FRESH] Kendrick Lamar - Not Like Us", "Kendrick Lamar", "Not Like Us", true},
+		{"[FRESH VIDEO] [DEBUT] JID — “WRONG”", "JID", "WRONG", true},
+		{"(Video) Doechii – Anxiety", "Doechii", "Anxiety", true},
+		{"[FRESH] Clipse ft. Kendrick Lamar & Pusha T - Chains & Whips", "Clipse ft. Kendrick Lamar & Pusha T", "Chains & Whips", true},
+		// Only the first separator splits, so titles can contain one
+		{"Charli xcx - 360 - Remix", "Charli xcx", "360 - Remix", true},
+		{`Tyler, The Creator "Sticky"`, "Tyler, The Creator", "Sticky", true},
+		{"Doechii: “Anxiety” (Video)", "Doechii", "Anxiety", true},
+		{"Weekly roundup: the 10 best songs this week", "", "", false},
+		{"[FRESH] - Untitled", "", "", false},
+		{"", "", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			artist, title, ok := SplitArtistTitle(tt.in)
+			if artist != tt.artist || title != tt.title || ok != tt.ok {
+				t.Errorf("SplitArtistTitle(%q) = %q, %q, %v; want %q, %q, %v", tt.in, artist, title, ok, tt.artist, tt.title, tt.ok)
+			}
+		})
+	}
+}
+
+// parseChart is a PageSource parser for the chart in testdata/page.html.
+func parseChart(doc *html.Node) ([]Candidate, error) {
+	var out []Candidate
+	for _, row := range FindAll(doc, func(n *html.Node) bool { return HasClass(n, "chart-row") }) {
+		c := Candidate{}
+		for _, n := range FindAll(row, func(n *html.Node) bool { return n.Type == html.ElementNode }) {
+			switch {
+			case HasClass(n, "track-title"):
+				c.Title = Text(n)
+			case HasClass(n, "artist-list"):
+				c.Artist = Text(n)
+			case HasClass(n, "cover"):
+				c.Thumb = strings.TrimPrefix(Attr(n, "src"), spotifyImagePrefix)
+			case HasClass(n, "listen"):
+				if _, id, ok := strings.Cut(Attr(n, "href"), "/track/"); ok {
+					c.SpotifyID, _, _ = strings.Cut(id, "?")
+				}
+			}
+		}
+		if rank, _ := strconv.Atoi(Attr(row, "data-rank")); rank > 0 {
+			out = append(out, c)
+		}
+	}
+	return out, nil
+}
+
+func TestPageSource(t *testing.T) {
+	page, err := os.ReadFile("testdata/page.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var gotAgent string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAgent = r.Header.Get("User-Agent")
+		if r.URL.Path != "/best-new-tracks" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(page)
+	}))
+	defer srv.Close()
+
+	src := NewPageSource("example_bnt", srv.URL+"/best-new-tracks", parseChart)
+	if src.Name() != "example_bnt" {
+		t.Errorf("Name() = %q", src.Name())
+	}
+	got, err := src.Fetch(context.Background())
+	if err != nil {
+		t.Fatalf("Fetch: %v", err)
+	}
+	if gotAgent != userAgent {
+		t.Errorf("User-Agent = %q, want %q", gotAgent, userAgent)
+	}
+	want := []Candidate{
+		{Artist: "Chappell Roan", Title: "Good Luck, Babe!", SpotifyID: "0WbMK4wrZ1wFSty9F7FCgu", Thumb: "ab67616d00001e02f2d2adaa21ad616df6241e7d"},
+		{Artist: "Charli xcx", Title: "360", Thumb: "ab67616d00001e024c8f092adc59b4bf4212389d"},
+		{Artist: "The Last Dinner Party", Title: "Nothing Matters"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Fetch() = %+v\nwant %+v", got, want)
+	}
+
+	missing := NewPageSource("example_bnt", srv.URL+"/gone", parseChart)
+	if _, err := missing.Fetch(context.Background()); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("Fetch of a missing page: err = %v, want a 404", err)
+	}
+}
+
+func TestFeedSource(t *testing.T) {
+	feed, err := os.ReadFile("testdata/rss.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(feed)
+	}))
+	defer srv.Close()
+
+	// Keep songs only, as a blog source would
+	src := NewFeedSource("example_fresh", srv.URL, func(item FeedItem) (Candidate, bool) {
+		if len(item.Categories) == 0 || item.Categories[0] != "Songs" {
+			return Candidate{}, false
+		}
+		artist, title, ok := SplitArtistTitle(item.Title)
+		return Candidate{Artist: artist, Title: title}, ok
+	})
+	got, err := src.Fetch(context.Background())
+	if err != nil {
+		t.Fatalf("Fetch: %v", err)
+	}
+	want := []Candidate{
+		{Artist: "Kendrick Lamar", Title: "Not Like Us"},
+		{Artist: "Tyler, The Creator", Title: "Sticky"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Fetch() = %+v, want %+v", got, want)
+	}
+}
@@ -3,21 +3,22 @@ package main
 import (
 	"context"
 	"database/sql"
-	"log"
 	"net"
 	"net/http"
-	"os"
-	"strings"
 
 	"cloud.google.com/go/firestore"
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/gorilla/mux"
+	"github.com/mager/occipital/auth"
+	"github.com/mager/occipital/cache"
+	"github.com/mager/occipital/collab"
 	"github.com/mager/occipital/config"
 	"github.com/mager/occipital/database"
 	fs "github.com/mager/occipital/firestore"
 	discoverHandler "github.com/mager/occipital/handler/discover"
 	"github.com/mager/occipital/handler/genre"
+	graphHandler "github.com/mager/occipital/handler/graph"
 	"github.com/mager/occipital/handler/health"
+	mixHandler "github.com/mager/occipital/handler/mix"
 	podcastHandler "github.com/mager/occipital/handler/podcast"
 	profileHandler "github.com/mager/occipital/handler/profile"
 	spotHandler "github.com/mager/occipital/handler/spotify"
@@ -26,6 +27,8 @@ import (
 	userHandler "github.com/mager/occipital/handler/user"
 	"github.com/mager/occipital/logger"
 	"github.com/mager/occipital/musicbrainz"
+	"github.com/mager/occipital/musixmatch"
+	"github.com/mager/occipital/recommend"
 	"github.com/mager/occipital/spotify"
 	"go.uber.org/fx"
 	"go.uber.org/zap"
@@ -49,14 +52,25 @@ type Route interface {
 
 // @host		localhost:8080
 // @BasePath	/
+
+// @securityDefinitions.apikey	BearerAuth
+// @in							header
+// @name						Authorization
 func main() {
 	fx.New(
 		fx.Provide(NewHTTPServer,
 			config.Options,
+			auth.Options,
 			database.Options,
 			fs.Options,
+			cache.Options,
 			spotify.Options,
+			spotify.ProvideTokenStore,
 			musicbrainz.Options,
+			musixmatch.Options,
+			discoverHandler.ProvideConfigStore,
+			trackHandler.NewSimilarIndex,
+			trackHandler.ProvideCollabGraph,
 			logger.Options,
 
 			AsRoute(health.NewHealthHandler),
@@ -65,12 +79,21 @@ func main() {
 			AsRoute(spotHandler.NewSearchHandler),
 			AsRoute(spotHandler.NewRecommendedTracksHandler),
 			AsRoute(trackHandler.NewGetTrackHandler),
+			AsRoute(trackHandler.NewGetTrackLyricsHandler),
+			AsRoute(trackHandler.NewGetTracksBatchHandler),
 			AsRoute(discoverHandler.NewDiscoverV2Handler),
+			AsRoute(discoverHandler.NewHistoryHandler),
+			AsRoute(discoverHandler.NewTrendingHandler),
 			AsRoute(genre.NewGenreHandler),
 			AsRoute(podcastHandler.NewCategoriesHandler),
 			AsRoute(podcastHandler.NewShowsHandler),
 			AsRoute(creatorHandler.NewGetCreatorHandler),
+			AsRoute(creatorHandler.NewGetCreatorCreditsHandler),
+			AsRoute(creatorHandler.NewGetCreatorReleasesHandler),
+			AsRoute(creatorHandler.NewGetCreatorCollaboratorsHandler),
+			AsRoute(graphHandler.NewPathHandler),
 		),
+		fx.Invoke(trackHandler.LoadIndexes),
 		fx.Invoke(func(*http.Server) {}),
 	).Run()
 }
@@ -78,15 +101,23 @@ func main() {
 func NewHTTPServer(
 	lc fx.Lifecycle,
 	cfg config.Config,
+	verifier *auth.Verifier,
 	db *sql.DB,
 	fs *firestore.Client,
+	cacheLoader *cache.Loader,
 	spotifyClient *spotify.SpotifyClient,
+	spotifyTokens spotify.TokenStore,
 	musicbrainzClient *musicbrainz.MusicbrainzClient,
+	musixmatchClient *musixmatch.MusixmatchClient,
+	discoverConfig *discoverHandler.ConfigStore,
+	similarIndex *trackHandler.SimilarIndex,
+	collabGraph *collab.Graph,
 	logger *zap.SugaredLogger,
 ) *http.Server {
 	router := mux.NewRouter()
 
 	router.Use(jsonMiddleware)
+	requireUser := verifier.Require()
 	srv := &http.Server{Addr: ":8080", Handler: router}
 	lc.Append(fx.Hook{
 		OnStart: func(ctx context.Context) error {
@@ -108,32 +139,61 @@ func NewHTTPServer(
 	router.Handle(healthHandler.Pattern(), healthHandler)
 
 	userHandler := userHandler.NewUserHandler(logger, db)
-	router.Handle(userHandler.Pattern(), authNMiddleware(userHandler, logger))
+	router.Handle(userHandler.Pattern(), requireUser(userHandler))
 
 	profileHandler := profileHandler.NewProfileHandler(logger, db)
-	router.Handle(profileHandler.Pattern(), profileHandler)
+	router.Handle(profileHandler.Pattern(), requireUser(profileHandler))
 
 	spotifySearchHandler := spotHandler.NewSearchHandler(logger, spotifyClient)
 	router.Handle(spotifySearchHandler.Pattern(), spotifySearchHandler)
 
-	spotifyRecommendedTracksHandler := spotHandler.NewRecommendedTracksHandler(logger, spotifyClient)
-	router.Handle(spotifyRecommendedTracksHandler.Pattern(), spotifyRecommendedTracksHandler)
+	// Every track lookup goes through the one resolver
+	trackResolver := trackHandler.NewTrackResolver(logger, spotifyClient, musicbrainzClient, musixmatchClient, cacheLoader, similarIndex, collabGraph)
 
-	spotifyGetTrackHandler := trackHandler.NewGetTrackHandler(logger, spotifyClient, musicbrainzClient)
+	spotifyGetTrackHandler := trackHandler.NewGetTrackHandler(logger, trackResolver)
 	router.Handle(spotifyGetTrackHandler.Pattern(), spotifyGetTrackHandler)
 
+	trackLyricsHandler := trackHandler.NewGetTrackLyricsHandler(logger, trackResolver, musixmatchClient)
+	router.Handle(trackLyricsHandler.Pattern(), trackLyricsHandler)
+
+	tracksBatchHandler := trackHandler.NewGetTracksBatchHandler(logger, trackResolver)
+	router.Handle(tracksBatchHandler.Pattern(), tracksBatchHandler)
+
 	// v2: parallel + cached track handler
-	trackV2Handler := trackHandler.NewGetTrackV2Handler(logger, spotifyClient, musicbrainzClient, fs)
+	trackV2Handler := trackHandler.NewGetTrackV2Handler(logger, trackResolver)
 	router.Handle(trackV2Handler.Pattern(), trackV2Handler)
+	similarTracksHandler := trackHandler.NewSimilarTracksHandler(logger, trackResolver, similarIndex)
+	router.Handle(similarTracksHandler.Pattern(), similarTracksHandler).Methods(http.MethodGet)
+	mixOrderHandler := mixHandler.NewOrderHandler(logger, trackResolver)
+	router.Handle(mixOrderHandler.Pattern(), mixOrderHandler).Methods(http.MethodPost)
 
-	discoverV2Handler := discoverHandler.NewDiscoverV2Handler(logger, fs)
-	router.Handle(discoverV2Handler.Pattern(), discoverV2Handler)
+	tasteSource := spotHandler.NewTasteSource(logger, cfg, spotifyTokens, spotifyClient, cacheLoader)
+	discoverV2Handler := discoverHandler.NewDiscoverV2Handler(logger, fs, discoverConfig, tasteSource)
+	router.Handle(discoverV2Handler.Pattern(), verifier.Optional()(discoverV2Handler))
 
-	genreHandler := genre.NewGenreHandler(logger, spotifyClient, musicbrainzClient)
+	discoverHistoryHandler := discoverHandler.NewHistoryHandler(logger, fs)
+	router.Handle(discoverHistoryHandler.Pattern(), discoverHistoryHandler)
+
+	discoverTrendingHandler := discoverHandler.NewTrendingHandler(logger, fs)
+	router.Handle(discoverTrendingHandler.Pattern(), discoverTrendingHandler)
+
+	genreHandler := genre.NewGenreHandler(logger, spotifyClient, musicbrainzClient, cacheLoader)
 	router.Handle(genreHandler.Pattern(), genreHandler)
 
-	getCreatorHandler := creatorHandler.NewGetCreatorHandler(logger, musicbrainzClient, spotifyClient)
+	getCreatorHandler := creatorHandler.NewGetCreatorHandler(logger, musicbrainzClient, spotifyClient, cacheLoader)
 	router.Handle(getCreatorHandler.Pattern(), getCreatorHandler)
+	creatorCreditsHandler := creatorHandler.NewGetCreatorCreditsHandler(logger, musicbrainzClient, cacheLoader)
+	router.Handle(creatorCreditsHandler.Pattern(), creatorCreditsHandler).Methods(http.MethodGet)
+	creatorReleasesHandler := creatorHandler.NewGetCreatorReleasesHandler(logger, musicbrainzClient, cacheLoader)
+	router.Handle(creatorReleasesHandler.Pattern(), creatorReleasesHandler).Methods(http.MethodGet)
+	creatorCollaboratorsHandler := creatorHandler.NewGetCreatorCollaboratorsHandler(logger, collabGraph)
+	router.Handle(creatorCollaboratorsHandler.Pattern(), creatorCollaboratorsHandler).Methods(http.MethodGet)
+	graphPathHandler := graphHandler.NewPathHandler(logger, collabGraph)
+	router.Handle(graphPathHandler.Pattern(), graphPathHandler).Methods(http.MethodGet)
+
+	recommender := recommend.NewEngine(logger, spotifyClient, trackResolver, getCreatorHandler, discoverHistoryHandler)
+	spotifyRecommendedTracksHandler := spotHandler.NewRecommendedTracksHandler(logger, recommender)
+	router.Handle(spotifyRecommendedTracksHandler.Pattern(), spotifyRecommendedTracksHandler)
 
 	// Podcast handlers
 	podcastCategoriesHandler := podcastHandler.NewCategoriesHandler(logger, fs)
@@ -143,26 +203,61 @@ func NewHTTPServer(
 	router.Handle(podcastShowsHandler.Pattern(), podcastShowsHandler)
 
 	// Spotify OAuth handlers
-	authLoginHandler := spotHandler.NewAuthLoginHandler(logger, cfg)
-	router.Handle(authLoginHandler.Pattern(), authLoginHandler)
+	authLoginHandler := spotHandler.NewAuthLoginHandler(logger, cfg, fs)
+	router.Handle(authLoginHandler.Pattern(), requireUser(authLoginHandler)).Methods(http.MethodGet)
+
+	disconnectHandler := spotHandler.NewDisconnectHandler(logger, spotifyTokens)
+	router.Handle(disconnectHandler.Pattern(), requireUser(disconnectHandler)).Methods(http.MethodDelete)
 
-	authCallbackHandler := spotHandler.NewAuthCallbackHandler(logger, cfg, fs)
+	authStatusHandler := spotHandler.NewAuthStatusHandler(logger, spotifyTokens)
+	router.Handle(authStatusHandler.Pattern(), requireUser(authStatusHandler)).Methods(http.MethodGet)
+
+	authCallbackHandler := spotHandler.NewAuthCallbackHandler(logger, cfg, fs, spotifyTokens)
 	router.Handle(authCallbackHandler.Pattern(), authCallbackHandler)
 
 	// Spotify playback handlers
-	playHandler := spotHandler.NewPlayHandler(logger, cfg, fs)
-	router.Handle(playHandler.Pattern(), playHandler)
+	playHandler := spotHandler.NewPlayHandler(logger, cfg, spotifyTokens)
+	router.Handle(playHandler.Pattern(), requireUser(playHandler))
+
+	pauseHandler := spotHandler.NewPauseHandler(logger, cfg, spotifyTokens)
+	router.Handle(pauseHandler.Pattern(), requireUser(pauseHandler))
+
+	devicesHandler := spotHandler.NewDevicesHandler(logger, cfg, spotifyTokens)
+	router.Handle(devicesHandler.Pattern(), requireUser(devicesHandler))
+
+	nextHandler := spotHandler.NewNextHandler(logger, cfg, spotifyTokens)
+	router.Handle(nextHandler.Pattern(), requireUser(nextHandler)).Methods(http.MethodPost)
+
+	previousHandler := spotHandler.NewPreviousHandler(logger, cfg, spotifyTokens)
+	router.Handle(previousHandler.Pattern(), requireUser(previousHandler)).Methods(http.MethodPost)
+
+	seekHandler := spotHandler.NewSeekHandler(logger, cfg, spotifyTokens)
+	router.Handle(seekHandler.Pattern(), requireUser(seekHandler)).Methods(http.MethodPut)
+
+	volumeHandler := spotHandler.NewVolumeHandler(logger, cfg, spotifyTokens)
+	router.Handle(volumeHandler.Pattern(), requireUser(volumeHandler)).Methods(http.MethodPut)
+
+	shuffleHandler := spotHandler.NewShuffleHandler(logger, cfg, spotifyTokens)
+	router.Handle(shuffleHandler.Pattern(), requireUser(shuffleHandler)).Methods(http.MethodPut)
 
-	pauseHandler := spotHandler.NewPauseHandler(logger, cfg, fs)
-	router.Handle(pauseHandler.Pattern(), pauseHandler)
+	repeatHandler := spotHandler.NewRepeatHandler(logger, cfg, spotifyTokens)
+	router.Handle(repeatHandler.Pattern(), requireUser(repeatHandler)).Methods(http.MethodPut)
 
-	devicesHandler := spotHandler.NewDevicesHandler(logger, cfg, fs)
-	router.Handle(devicesHandler.Pattern(), devicesHandler)
+	transferHandler := spotHandler.NewTransferHandler(logger, cfg, spotifyTokens)
+	router.Handle(transferHandler.Pattern(), requireUser(transferHandler)).Methods(http.MethodPut)
+
+	queueHandler := spotHandler.NewQueueHandler(logger, cfg, spotifyTokens)
+	router.Handle(queueHandler.Pattern(), requireUser(queueHandler)).Methods(http.MethodGet)
+
+	addToQueueHandler := spotHandler.NewAddToQueueHandler(logger, cfg, spotifyTokens)
+	router.Handle(addToQueueHandler.Pattern(), requireUser(addToQueueHandler)).Methods(http.MethodPost)
+
+	playlistHandler := spotHandler.NewPlaylistHandler(logger, cfg, spotifyTokens, fs, discoverHistoryHandler, genreHandler)
+	router.Handle(playlistHandler.Pattern(), requireUser(playlistHandler)).Methods(http.MethodPost)
 
 	// websocket handler
-	router.HandleFunc("/np", func(w http.ResponseWriter, r *http.Request) {
-		spotHandler.PlayerHandler(w, r, spotifyClient, logger)
-	})
+	nowPlayingHandler := spotHandler.NewNowPlayingHandler(logger, cfg, spotifyTokens, trackResolver)
+	router.Handle(nowPlayingHandler.Pattern(), requireUser(nowPlayingHandler)).Methods(http.MethodGet)
 
 	return srv
 }
@@ -183,50 +278,3 @@ func jsonMiddleware(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
-
-var (
-	nextSecret = os.Getenv("OCCIPITAL_NEXTAUTHSECRET")
-)
-
-// authNMiddleware authenticates the request
-func authNMiddleware(next http.Handler, logger *zap.SugaredLogger) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		secret := nextSecret
-		tokenString := r.Header.Get("Authorization")
-		if tokenString == "" {
-			logger.Info("Error: No token")
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
-			return
-		}
-		tokenString = extractTokenFromHeader(tokenString)
-
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			return []byte(secret), nil
-		})
-		if err != nil {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
-			return
-		}
-
-		if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-			logger.Infow("Successful authentication", "email", claims["email"])
-		} else {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
-			return
-		}
-
-		next.ServeHTTP(w, r)
-	})
-}
-
-// Extracts the token value from the Authorization header
-func extractTokenFromHeader(header string) string {
-	// Split the header value by whitespace
-	split := strings.SplitN(header, " ", 2)
-
-	if len(split) != 2 || strings.ToLower(split[0]) != "bearer" {
-		log.Fatal("Invalid Authorization header format")
-	}
-
-	return split[1]
-}
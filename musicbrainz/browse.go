@@ -0,0 +1,73 @@
+package musicbrainz
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+
+	mb "github.com/mager/musicbrainz-go/musicbrainz"
+)
+
+// MaxBrowseLimit is the largest page MusicBrainz returns from a browse.
+const MaxBrowseLimit = 100
+
+// BrowseRecordingsResponse is a page of the recordings an artist is credited on.
+type BrowseRecordingsResponse struct {
+	Count      int            `json:"recording-count"`
+	Offset     int            `json:"recording-offset"`
+	Recordings []mb.Recording `json:"recordings"`
+}
+
+// ReleaseGroup is the subset of a MusicBrainz release group we use.
+type ReleaseGroup struct {
+	ID               string   `json:"id"`
+	Title            string   `json:"title"`
+	PrimaryType      string   `json:"primary-type"`
+	SecondaryTypes   []string `json:"secondary-types"`
+	FirstReleaseDate string   `json:"first-release-date"`
+}
+
+// BrowseReleaseGroupsResponse is a page of an artist's release groups.
+type BrowseReleaseGroupsResponse struct {
+	Count         int            `json:"release-group-count"`
+	Offset        int            `json:"release-group-offset"`
+	ReleaseGroups []ReleaseGroup `json:"release-groups"`
+}
+
+// BrowseRecordingsByArtist lists the recordings credited to an artist,
+// limit at a time from offset. Unlike the artist's recording-rels, browsing
+// pages through every recording.
+func (c *MusicbrainzClient) BrowseRecordingsByArtist(ctx context.Context, artistID string, offset, limit int) (BrowseRecordingsResponse, error) {
+	var resp BrowseRecordingsResponse
+	err := c.get(ctx, "recording", browseParams(artistID, offset, limit, "artist-credits"), &resp)
+	return resp, err
+}
+
+// BrowseRecordingRelationsByArtist is BrowseRecordingsByArtist with each
+// recording's artist relationships, so the roles the artist holds on their
+// own recordings can be paged too.
+func (c *MusicbrainzClient) BrowseRecordingRelationsByArtist(ctx context.Context, artistID string, offset, limit int) (BrowseRecordingsResponse, error) {
+	var resp BrowseRecordingsResponse
+	err := c.get(ctx, "recording", browseParams(artistID, offset, limit, "artist-credits+artist-rels"), &resp)
+	return resp, err
+}
+
+// BrowseReleaseGroupsByArtist lists an artist's release groups, limit at a
+// time from offset.
+func (c *MusicbrainzClient) BrowseReleaseGroupsByArtist(ctx context.Context, artistID string, offset, limit int) (BrowseReleaseGroupsResponse, error) {
+	var resp BrowseReleaseGroupsResponse
+	err := c.get(ctx, "release-group", browseParams(artistID, offset, limit, ""), &resp)
+	return resp, err
+}
+
+func browseParams(artistID string, offset, limit int, inc string) url.Values {
+	params := url.Values{
+		"artist": {artistID},
+		"offset": {strconv.Itoa(offset)},
+		"limit":  {strconv.Itoa(min(max(limit, 1), MaxBrowseLimit))},
+	}
+	if inc != "" {
+		params.Set("inc", inc)
+	}
+	return params
+}
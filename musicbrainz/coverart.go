@@ -0,0 +1,53 @@
+package musicbrainz
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+const coverArtBaseURL = "https://coverartarchive.org"
+
+// CoverArtListing is the subset of a Cover Art Archive release listing we use.
+type CoverArtListing struct {
+	Images []CoverArtImage `json:"images"`
+}
+
+type CoverArtImage struct {
+	ID         int64             `json:"id"`
+	Front      bool              `json:"front"`
+	Types      []string          `json:"types"`
+	Thumbnails map[string]string `json:"thumbnails"`
+}
+
+// GetCoverArt fetches the Cover Art Archive listing for a release. A 404
+// means the release has no art, which is a valid answer rather than an error.
+func (c *MusicbrainzClient) GetCoverArt(ctx context.Context, releaseID string) (CoverArtListing, error) {
+	var listing CoverArtListing
+
+	u := fmt.Sprintf("%s/release/%s", c.CoverArtBaseURL, releaseID)
+	err := c.coverArt.Do(ctx, func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		switch resp.StatusCode {
+		case http.StatusOK:
+		case http.StatusNotFound:
+			return nil
+		case http.StatusServiceUnavailable, http.StatusTooManyRequests:
+			return &unavailableError{retryAfter: parseRetryAfter(resp.Header.Get("Retry-After"))}
+		default:
+			return fmt.Errorf("cover art archive returned status %d", resp.StatusCode)
+		}
+		return json.NewDecoder(resp.Body).Decode(&listing)
+	})
+	return listing, err
+}
@@ -0,0 +1,236 @@
+package musicbrainz
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	mb "github.com/mager/musicbrainz-go/musicbrainz"
+)
+
+// Weights of each signal in a candidate's score; they sum to 1.
+const (
+	durationWeight = 0.35
+	artistWeight   = 0.25
+	statusWeight   = 0.15
+	relationWeight = 0.15
+	dateWeight     = 0.10
+)
+
+const (
+	// Lengths within durationExact of the hint score 1, falling to 0 at
+	// durationMax; MusicBrainz and Spotify often differ by a second or two.
+	durationExact = 2000
+	durationMax   = 15000
+	// richRelations is the relation count that earns the full relation score.
+	richRelations = 8
+	// dateSpanYears is how much later than the earliest candidate a first
+	// release can be before it scores 0.
+	dateSpanYears = 10.0
+	// ambiguityMargin is the lead below which the top two candidates are
+	// worth looking up in full; see Match.Ambiguous.
+	ambiguityMargin = 0.1
+	// confidentLead is the lead over the runner-up that earns full confidence.
+	confidentLead = 0.15
+)
+
+// versionWords mark recordings that are a variant of the studio original.
+var versionWords = []string{"live", "demo", "remix", "acoustic", "instrumental", "karaoke", "edit", "mix"}
+
+// RecordingCandidate is a recording search result, with the length and
+// disambiguation comment that mb.Recording leaves out. Search results carry
+// no relations; Relations is only set once the recording is looked up.
+type RecordingCandidate struct {
+	mb.Recording
+	// Length is the recording's length in milliseconds, 0 if unknown
+	Length         int    `json:"length"`
+	Disambiguation string `json:"disambiguation"`
+}
+
+// RecordingHint is what the caller knows about the track an ISRC came from,
+// usually the Spotify track. Zero fields are ignored.
+type RecordingHint struct {
+	DurationMs int
+	Artists    []string
+	Title      string
+}
+
+// Match is the recording Disambiguate chose for an ISRC.
+type Match struct {
+	MBID string
+	// Score is the chosen recording's score, from 0 to 1
+	Score float64
+	// Confidence is Score discounted by how close the runner-up came: half
+	// when they tie, full once the lead reaches confidentLead
+	Confidence float64
+	// Alternates are the other candidates, best first
+	Alternates []Alternate
+}
+
+type Alternate struct {
+	MBID  string
+	Score float64
+}
+
+// Ambiguous reports whether the runner-up is close enough that looking up
+// both recordings' relations could change the answer.
+func (m Match) Ambiguous() bool {
+	return len(m.Alternates) > 0 && m.Score-m.Alternates[0].Score < ambiguityMargin
+}
+
+// Disambiguate ranks the recordings an ISRC maps to, which are often a
+// studio original alongside live takes, remasters and duplicates, by
+// duration and artist match against hint, release status, relation
+// richness and first-release date. ok is false if there are no candidates.
+func Disambiguate(cands []RecordingCandidate, hint RecordingHint) (m Match, ok bool) {
+	if len(cands) == 0 {
+		return m, false
+	}
+
+	earliest := 0.0
+	for _, c := range cands {
+		if y, ok := releaseYear(c.FirstReleaseDate); ok && (earliest == 0 || y < earliest) {
+			earliest = y
+		}
+	}
+
+	scored := make([]Alternate, len(cands))
+	for i, c := range cands {
+		scored[i] = Alternate{
+			MBID: c.ID,
+			Score: durationWeight*durationScore(c.Length, hint.DurationMs) +
+				artistWeight*artistScore(c.ArtistCredits, hint.Artists) +
+				statusWeight*statusScore(c, hint.Title) +
+				relationWeight*relationScore(c.Relations) +
+				dateWeight*dateScore(c.FirstReleaseDate, earliest),
+		}
+	}
+	// Stable, so MusicBrainz's own order breaks ties
+	sort.SliceStable(scored, func(i, j int) bool {
+		return scored[i].Score > scored[j].Score
+	})
+
+	m = Match{
+		MBID:       scored[0].MBID,
+		Score:      scored[0].Score,
+		Confidence: scored[0].Score,
+		Alternates: scored[1:],
+	}
+	if len(m.Alternates) > 0 {
+		lead := m.Score - m.Alternates[0].Score
+		m.Confidence *= 0.5 + 0.5*min(lead/confidentLead, 1)
+	}
+	return m, true
+}
+
+func durationScore(length, hint int) float64 {
+	if length <= 0 || hint <= 0 {
+		return 0.5
+	}
+	d := length - hint
+	if d < 0 {
+		d = -d
+	}
+	if d <= durationExact {
+		return 1
+	}
+	return max(0, 1-float64(d-durationExact)/float64(durationMax-durationExact))
+}
+
+// artistScore is the fraction of hinted artists credited on the recording.
+func artistScore(credits *[]mb.ArtistCredit, hint []string) float64 {
+	if len(hint) == 0 {
+		return 0.5
+	}
+	if credits == nil || len(*credits) == 0 {
+		return 0
+	}
+	names := make(map[string]bool)
+	for _, ac := range *credits {
+		names[normalizeName(ac.Name)] = true
+		if ac.Artist != nil {
+			names[normalizeName(ac.Artist.Name)] = true
+		}
+	}
+	var found int
+	for _, a := range hint {
+		if names[normalizeName(a)] {
+			found++
+		}
+	}
+	return float64(found) / float64(len(hint))
+}
+
+func normalizeName(s string) string {
+	return strings.Join(strings.Fields(strings.ToLower(s)), " ")
+}
+
+// statusScore favours recordings on official releases, and halves for a
+// live, demo or other variant the hinted title doesn't also name.
+func statusScore(c RecordingCandidate, title string) float64 {
+	var score float64
+	if c.Releases != nil {
+		for _, r := range *c.Releases {
+			if strings.EqualFold(r.Status, "official") {
+				score = 1
+				break
+			}
+			score = 0.4
+		}
+	}
+
+	comment := strings.ToLower(c.Disambiguation)
+	title = strings.ToLower(title)
+	for _, w := range versionWords {
+		if containsWord(comment, w) && !containsWord(title, w) {
+			return score / 2
+		}
+	}
+	return score
+}
+
+func containsWord(s, word string) bool {
+	for _, f := range strings.FieldsFunc(s, func(r rune) bool {
+		return !('a' <= r && r <= 'z' || '0' <= r && r <= '9')
+	}) {
+		if f == word {
+			return true
+		}
+	}
+	return false
+}
+
+// relationScore rewards credits, works and links. Unknown relations, as in
+// search results, earn nothing rather than guessing.
+func relationScore(rels *[]mb.Relation) float64 {
+	if rels == nil {
+		return 0
+	}
+	return min(float64(len(*rels))/richRelations, 1)
+}
+
+// dateScore favours the earliest release, i.e. the original over reissues
+// and compilations.
+func dateScore(date string, earliest float64) float64 {
+	y, ok := releaseYear(date)
+	if !ok || earliest == 0 {
+		return 0.5
+	}
+	return max(0, 1-(y-earliest)/dateSpanYears)
+}
+
+// releaseYear reads a YYYY, YYYY-MM or YYYY-MM-DD date as a fractional year.
+func releaseYear(date string) (float64, bool) {
+	parts := strings.SplitN(date, "-", 3)
+	y, err := strconv.Atoi(parts[0])
+	if err != nil || y <= 0 {
+		return 0, false
+	}
+	year := float64(y)
+	if len(parts) > 1 {
+		if m, err := strconv.Atoi(parts[1]); err == nil && m >= 1 && m <= 12 {
+			year += float64(m-1) / 12
+		}
+	}
+	return year, true
+}
@@ -0,0 +1,176 @@
+package musicbrainz
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	mb "github.com/mager/musicbrainz-go/musicbrainz"
+)
+
+// fixtureClient returns a client whose recording searches are answered
+// from testdata/<name>, where name is the ISRC query's fixture.
+func fixtureClient(t *testing.T, fixtures map[string]string) *MusicbrainzClient {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name, ok := fixtures[r.URL.Query().Get("query")]
+		if !ok {
+			t.Errorf("unexpected query %q", r.URL.Query().Get("query"))
+			http.NotFound(w, r)
+			return
+		}
+		body, err := os.ReadFile("testdata/" + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(body)
+	}))
+	t.Cleanup(srv.Close)
+
+	s := NewScheduler(SchedulerConfig{Rate: 100, Burst: 10, MaxQueue: 10})
+	t.Cleanup(s.Stop)
+	return &MusicbrainzClient{
+		Client:     mb.NewMusicbrainzClient(),
+		BaseURL:    srv.URL,
+		httpClient: srv.Client(),
+		scheduler:  s,
+	}
+}
+
+func TestDisambiguate(t *testing.T) {
+	tests := []struct {
+		name    string
+		fixture string
+		hint    RecordingHint
+		want    string
+		// ambiguous also means Confidence is half of Score
+		ambiguous bool
+	}{
+		{
+			name:    "studio over live",
+			fixture: "isrc_live_studio.json",
+			hint:    RecordingHint{DurationMs: 354320, Artists: []string{"Queen"}, Title: "Bohemian Rhapsody - Remastered 2011"},
+			want:    "ebf79ba5-085e-48d2-9eb8-2d992fbf0f6d",
+		},
+		{
+			name:    "original over remaster duplicate",
+			fixture: "isrc_remaster.json",
+			hint:    RecordingHint{DurationMs: 185000, Artists: []string{"The Beatles"}, Title: "Here Comes The Sun - Remastered 2009"},
+			want:    "c4d5e6f7-a8b9-4c0d-8e1f-2a3b4c5d6e7f",
+		},
+		{
+			name:    "duration mismatch",
+			fixture: "isrc_duration.json",
+			hint:    RecordingHint{DurationMs: 242000, Artists: []string{"New Order"}, Title: "Blue Monday"},
+			want:    "6e7f8a9b-0c1d-4e2f-9a3b-4c5d6e7f8a91",
+		},
+		{
+			name:    "credited artist over a mislabelled cover",
+			fixture: "isrc_cover.json",
+			hint:    RecordingHint{DurationMs: 413000, Artists: []string{"jeff  buckley"}},
+			want:    "7f8a9b0c-1d2e-4f3a-8b4c-5d6e7f8a9b02",
+		},
+		{
+			name:      "no artist match",
+			fixture:   "isrc_cover.json",
+			hint:      RecordingHint{DurationMs: 413000, Artists: []string{"Rufus Wainwright"}},
+			want:      "7f8a9b0c-1d2e-4f3a-8b4c-5d6e7f8a9b02",
+			ambiguous: true,
+		},
+		{
+			name:      "tie keeps MusicBrainz order",
+			fixture:   "isrc_tie.json",
+			hint:      RecordingHint{DurationMs: 243000, Artists: []string{"M83"}, Title: "Midnight City"},
+			want:      "9b0c1d2e-3f4a-4b5c-8d6e-7f8a9b0c1d24",
+			ambiguous: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := fixtureClient(t, map[string]string{"isrc:X": tt.fixture})
+			cands, err := c.SearchRecordingCandidatesByISRC(context.Background(), "X")
+			if err != nil {
+				t.Fatalf("search: %v", err)
+			}
+
+			m, ok := Disambiguate(cands, tt.hint)
+			if !ok {
+				t.Fatal("Disambiguate found nothing")
+			}
+			if m.MBID != tt.want {
+				t.Errorf("MBID = %s, want %s (alternates %+v)", m.MBID, tt.want, m.Alternates)
+			}
+			if len(m.Alternates) != len(cands)-1 {
+				t.Errorf("got %d alternates, want %d", len(m.Alternates), len(cands)-1)
+			}
+			if m.Ambiguous() != tt.ambiguous {
+				t.Errorf("Ambiguous() = %v, want %v (score %.3f, runner-up %.3f)", m.Ambiguous(), tt.ambiguous, m.Score, m.Alternates[0].Score)
+			}
+			switch {
+			case tt.ambiguous && m.Alternates[0].Score == m.Score:
+				if math.Abs(m.Confidence-m.Score/2) > 1e-9 {
+					t.Errorf("tied Confidence = %.3f, want half of %.3f", m.Confidence, m.Score)
+				}
+			case m.Confidence > m.Score:
+				t.Errorf("Confidence %.3f above Score %.3f", m.Confidence, m.Score)
+			}
+		})
+	}
+}
+
+func TestDisambiguateNoArtistMatchCostsTheArtistWeight(t *testing.T) {
+	c := fixtureClient(t, map[string]string{"isrc:X": "isrc_cover.json"})
+	cands, err := c.SearchRecordingCandidatesByISRC(context.Background(), "X")
+	if err != nil {
+		t.Fatal(err)
+	}
+	matched, _ := Disambiguate(cands, RecordingHint{DurationMs: 413000, Artists: []string{"Jeff Buckley"}})
+	unmatched, _ := Disambiguate(cands, RecordingHint{DurationMs: 413000, Artists: []string{"Rufus Wainwright"}})
+	if d := matched.Score - unmatched.Score; math.Abs(d-artistWeight) > 1e-9 {
+		t.Errorf("score drop = %.3f, want the artist weight %.2f", d, artistWeight)
+	}
+}
+
+func TestDisambiguateEmpty(t *testing.T) {
+	c := fixtureClient(t, map[string]string{"isrc:X": "isrc_empty.json"})
+	cands, err := c.SearchRecordingCandidatesByISRC(context.Background(), "X")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m, ok := Disambiguate(cands, RecordingHint{Artists: []string{"Anyone"}}); ok {
+		t.Errorf("Disambiguate(no candidates) = %+v, want not ok", m)
+	}
+	if _, ok := Disambiguate(nil, RecordingHint{}); ok {
+		t.Error("Disambiguate(nil) ok")
+	}
+}
+
+func TestSearchRecordingCandidatesByBulkISRC(t *testing.T) {
+	c := fixtureClient(t, map[string]string{
+		"isrc:(isrc:GBUM71029604 OR isrc:GBAYE0601690 OR isrc:XX0000000000)": "isrc_bulk.json",
+	})
+	got, err := c.SearchRecordingCandidatesByBulkISRC(context.Background(), []string{"GBUM71029604", "", "GBAYE0601690", "XX0000000000"})
+	if err != nil {
+		t.Fatalf("search: %v", err)
+	}
+	if len(got["GBUM71029604"]) != 2 || len(got["GBAYE0601690"]) != 1 || len(got["XX0000000000"]) != 0 {
+		t.Fatalf("candidates by ISRC = %v", got)
+	}
+	live := got["GBUM71029604"][0]
+	if live.Length != 358000 || !strings.HasPrefix(live.Disambiguation, "live") {
+		t.Errorf("candidate lost its length or comment: %+v", live)
+	}
+
+	m, _ := Disambiguate(got["GBUM71029604"], RecordingHint{DurationMs: 354320, Artists: []string{"Queen"}, Title: "Bohemian Rhapsody"})
+	if m.MBID != "ebf79ba5-085e-48d2-9eb8-2d992fbf0f6d" {
+		t.Errorf("bulk match = %s, want the studio recording", m.MBID)
+	}
+
+	if empty, err := c.SearchRecordingCandidatesByBulkISRC(context.Background(), []string{""}); err != nil || len(empty) != 0 {
+		t.Errorf("search with no ISRCs = %v, %v; want no request", empty, err)
+	}
+}
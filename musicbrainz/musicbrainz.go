@@ -1,19 +1,76 @@
 package musicbrainz
 
 import (
+	"context"
+	"net/http"
+	"time"
+
 	"github.com/mager/musicbrainz-go/musicbrainz"
+	"go.uber.org/fx"
 )
 
+const baseURL = "https://musicbrainz.org/ws/2"
+
+// MusicbrainzClient wraps the MusicBrainz API. Every request goes through a
+// process-wide scheduler that enforces MusicBrainz's 1 req/s policy, and
+// Cover Art Archive lookups go through a scheduler of their own.
 type MusicbrainzClient struct {
 	Client *musicbrainz.MusicbrainzClient
+
+	BaseURL         string
+	CoverArtBaseURL string
+
+	httpClient *http.Client
+	scheduler  *Scheduler
+	coverArt   *Scheduler
 }
 
-func ProvideMusicbrainz() *MusicbrainzClient {
-	var c MusicbrainzClient
-	c.Client = musicbrainz.NewMusicbrainzClient().
-		WithUserAgent("beatbrain/occipital", "1.0.0", "https://github.com/mager/occipital")
+func ProvideMusicbrainz(lc fx.Lifecycle) *MusicbrainzClient {
+	c := NewClient(baseURL, coverArtBaseURL, &http.Client{Timeout: 10 * time.Second},
+		SchedulerConfig{
+			Rate:       1,
+			Burst:      1,
+			MaxQueue:   200,
+			MaxRetries: 3,
+		},
+		// The Cover Art Archive has no published limit; keep it polite anyway
+		SchedulerConfig{
+			Rate:       5,
+			Burst:      5,
+			MaxQueue:   500,
+			MaxRetries: 2,
+		},
+	)
+
+	lc.Append(fx.Hook{
+		OnStop: func(ctx context.Context) error {
+			c.Stop()
+			return nil
+		},
+	})
+
+	return c
+}
+
+// NewClient builds a client for the MusicBrainz API at baseURL and the Cover
+// Art Archive at coverArtBaseURL, each behind a scheduler of its own. Call
+// Stop to release the schedulers.
+func NewClient(baseURL, coverArtBaseURL string, httpClient *http.Client, requests, coverArt SchedulerConfig) *MusicbrainzClient {
+	return &MusicbrainzClient{
+		Client: musicbrainz.NewMusicbrainzClient().
+			WithUserAgent("beatbrain/occipital", "1.0.0", "https://github.com/mager/occipital"),
+		BaseURL:         baseURL,
+		CoverArtBaseURL: coverArtBaseURL,
+		httpClient:      httpClient,
+		scheduler:       NewScheduler(requests),
+		coverArt:        NewScheduler(coverArt),
+	}
+}
 
-	return &c
+// Stop halts the client's schedulers.
+func (c *MusicbrainzClient) Stop() {
+	c.scheduler.Stop()
+	c.coverArt.Stop()
 }
 
 var Options = ProvideMusicbrainz
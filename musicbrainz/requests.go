@@ -0,0 +1,203 @@
+package musicbrainz
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	mb "github.com/mager/musicbrainz-go/musicbrainz"
+)
+
+// ErrNotFound is returned when MusicBrainz has no entity for the requested ID.
+var ErrNotFound = errors.New("musicbrainz: not found")
+
+// GetRecording fetches a recording by MBID.
+func (c *MusicbrainzClient) GetRecording(ctx context.Context, req mb.GetRecordingRequest) (mb.GetRecordingResponse, error) {
+	var resp mb.GetRecordingResponse
+	err := c.get(ctx, "recording/"+req.ID, includes(req.Includes), &resp)
+	return resp, err
+}
+
+// GetWork fetches a work by MBID.
+func (c *MusicbrainzClient) GetWork(ctx context.Context, req mb.GetWorkRequest) (mb.GetWorkResponse, error) {
+	var resp mb.GetWorkResponse
+	err := c.get(ctx, "work/"+req.ID, includes(req.Includes), &resp)
+	return resp, err
+}
+
+// GetArtist fetches an artist by MBID.
+func (c *MusicbrainzClient) GetArtist(ctx context.Context, req mb.GetArtistRequest) (mb.GetArtistResponse, error) {
+	var resp mb.GetArtistResponse
+	err := c.get(ctx, "artist/"+req.ID, includes(req.Includes), &resp)
+	return resp, err
+}
+
+// SearchArtists runs a Lucene artist search.
+func (c *MusicbrainzClient) SearchArtists(ctx context.Context, req mb.SearchArtistsRequest) (mb.SearchArtistsResponse, error) {
+	var resp mb.SearchArtistsResponse
+	err := c.get(ctx, "artist", url.Values{"query": {req.Query}}, &resp)
+	return resp, err
+}
+
+// SearchRecordingsByISRC finds recordings carrying an ISRC.
+func (c *MusicbrainzClient) SearchRecordingsByISRC(ctx context.Context, req mb.SearchRecordingsByISRCRequest) (mb.SearchRecordingsByISRCResponse, error) {
+	var resp mb.SearchRecordingsByISRCResponse
+	err := c.get(ctx, "recording", url.Values{"query": {"isrc:" + req.ISRC}}, &resp)
+	return resp, err
+}
+
+// SearchRecordingCandidatesByISRC finds recordings carrying an ISRC, with
+// the length and disambiguation comment Disambiguate scores them on.
+func (c *MusicbrainzClient) SearchRecordingCandidatesByISRC(ctx context.Context, isrc string) ([]RecordingCandidate, error) {
+	var resp struct {
+		Recordings []RecordingCandidate `json:"recordings"`
+	}
+	err := c.get(ctx, "recording", url.Values{"query": {"isrc:" + isrc}}, &resp)
+	return resp.Recordings, err
+}
+
+// SearchRecordingCandidatesByArtistAndTrack finds recordings by artist name
+// and title, as candidates for Disambiguate.
+func (c *MusicbrainzClient) SearchRecordingCandidatesByArtistAndTrack(ctx context.Context, artist, track string) ([]RecordingCandidate, error) {
+	var resp struct {
+		Recordings []RecordingCandidate `json:"recordings"`
+	}
+	err := c.get(ctx, "recording", url.Values{
+		"query": {fmt.Sprintf("artist:%q AND recording:%q", artist, track)},
+		"limit": {"25"},
+	}, &resp)
+	return resp.Recordings, err
+}
+
+// SearchRecordingCandidatesByBulkISRC finds recordings for several ISRCs in
+// one request and indexes them by ISRC, as candidates for Disambiguate.
+func (c *MusicbrainzClient) SearchRecordingCandidatesByBulkISRC(ctx context.Context, isrcs []string) (map[string][]RecordingCandidate, error) {
+	out := make(map[string][]RecordingCandidate)
+
+	var terms []string
+	for _, isrc := range isrcs {
+		if isrc != "" {
+			terms = append(terms, "isrc:"+isrc)
+		}
+	}
+	if len(terms) == 0 {
+		return out, nil
+	}
+
+	var resp struct {
+		Recordings []RecordingCandidate `json:"recordings"`
+	}
+	err := c.get(ctx, "recording", url.Values{
+		"query": {fmt.Sprintf("isrc:(%s)", strings.Join(terms, " OR "))},
+		"limit": {"100"},
+		"inc":   {"isrcs"},
+	}, &resp)
+	if err != nil {
+		return out, err
+	}
+
+	for _, rec := range resp.Recordings {
+		if rec.ISRCs == nil {
+			continue
+		}
+		for _, isrc := range *rec.ISRCs {
+			out[isrc] = append(out[isrc], rec)
+		}
+	}
+	return out, nil
+}
+
+// SearchRecordingsByIDs fetches several recordings by MBID in one search
+// request. Search results carry ISRCs, artist credits and releases but not
+// relationships. Recordings MusicBrainz doesn't know are absent from the map.
+func (c *MusicbrainzClient) SearchRecordingsByIDs(ctx context.Context, ids []string) (map[string]mb.Recording, error) {
+	out := make(map[string]mb.Recording, len(ids))
+
+	var terms []string
+	for _, id := range ids {
+		if id != "" {
+			terms = append(terms, "rid:"+id)
+		}
+	}
+	if len(terms) == 0 {
+		return out, nil
+	}
+
+	var resp mb.SearchRecordingsByISRCResponse
+	err := c.get(ctx, "recording", url.Values{
+		"query": {strings.Join(terms, " OR ")},
+		"limit": {"100"},
+	}, &resp)
+	if err != nil {
+		return out, err
+	}
+	for _, rec := range resp.Recordings {
+		out[rec.ID] = rec
+	}
+	return out, nil
+}
+
+func includes(inc mb.Includes) url.Values {
+	if len(inc) == 0 {
+		return url.Values{}
+	}
+	incs := make([]string, len(inc))
+	for i, v := range inc {
+		incs[i] = string(v)
+	}
+	return url.Values{"inc": {strings.Join(incs, "+")}}
+}
+
+// get queues a request on the MusicBrainz scheduler and decodes the JSON
+// response into out. A 503 is handed back to the scheduler so it backs off.
+func (c *MusicbrainzClient) get(ctx context.Context, path string, params url.Values, out interface{}) error {
+	params.Set("fmt", "json")
+	u, err := url.Parse(fmt.Sprintf("%s/%s?%s", c.BaseURL, path, params.Encode()))
+	if err != nil {
+		return err
+	}
+
+	return c.scheduler.Do(ctx, func(ctx context.Context) error {
+		req := c.Client.GetRequest(u).WithContext(ctx)
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		switch resp.StatusCode {
+		case http.StatusOK:
+		case http.StatusNotFound:
+			return ErrNotFound
+		case http.StatusServiceUnavailable, http.StatusTooManyRequests:
+			return &unavailableError{retryAfter: parseRetryAfter(resp.Header.Get("Retry-After"))}
+		default:
+			return fmt.Errorf("musicbrainz: %s returned status %d", path, resp.StatusCode)
+		}
+
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return fmt.Errorf("musicbrainz: decode %s: %w", path, err)
+		}
+		return nil
+	})
+}
+
+// parseRetryAfter reads a Retry-After header given in seconds or as an HTTP date.
+func parseRetryAfter(v string) time.Duration {
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return time.Until(t)
+	}
+	return 0
+}
@@ -0,0 +1,274 @@
+package musicbrainz
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mager/occipital/cache"
+	"golang.org/x/time/rate"
+)
+
+// Priority orders queued requests. Lower values are dispatched first.
+type Priority int
+
+const (
+	// PriorityInteractive is for lookups a user is waiting on.
+	PriorityInteractive Priority = iota
+	// PriorityBackground is for enrichment and refresh work that can wait.
+	PriorityBackground
+
+	numPriorities
+)
+
+var (
+	// ErrQueueFull is returned when the scheduler has no room for more requests.
+	ErrQueueFull = errors.New("musicbrainz: request queue full")
+	// ErrServiceUnavailable is returned when the upstream answers 503, which
+	// is how MusicBrainz signals that we are over its rate limit.
+	ErrServiceUnavailable = errors.New("musicbrainz: service unavailable")
+)
+
+type priorityKey struct{}
+
+// WithPriority returns a context whose requests are scheduled at p.
+func WithPriority(ctx context.Context, p Priority) context.Context {
+	return context.WithValue(ctx, priorityKey{}, p)
+}
+
+// PriorityFrom returns the priority stored in ctx, defaulting to interactive.
+// Cache revalidations always run in the background, since nobody waits on them.
+func PriorityFrom(ctx context.Context) Priority {
+	if cache.IsBackground(ctx) {
+		return PriorityBackground
+	}
+	if p, ok := ctx.Value(priorityKey{}).(Priority); ok && p >= 0 && p < numPriorities {
+		return p
+	}
+	return PriorityInteractive
+}
+
+// SchedulerConfig configures a Scheduler.
+type SchedulerConfig struct {
+	// Rate is the sustained number of requests per second.
+	Rate float64
+	// Burst is how many requests may be sent back to back.
+	Burst int
+	// MaxQueue bounds the number of requests waiting for a token.
+	MaxQueue int
+	// MaxRetries is how many times a 503 is retried before giving up.
+	MaxRetries int
+	// MaxBackoff caps the pause after repeated 503s.
+	MaxBackoff time.Duration
+}
+
+// Scheduler sends requests through a token bucket, highest priority first,
+// and pauses all dispatch when the upstream reports it is overloaded.
+type Scheduler struct {
+	cfg     SchedulerConfig
+	limiter *rate.Limiter
+
+	mu          sync.Mutex
+	queues      [numPriorities][]*job
+	queued      int
+	pausedUntil time.Time
+	failures    int
+
+	wake   chan struct{}
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// Job states. A queued job may be canceled by its caller; once running it
+// is always seen through to done, since fn may be writing the caller's
+// result.
+const (
+	jobQueued int32 = iota
+	jobRunning
+	jobCanceled
+)
+
+type job struct {
+	ctx      context.Context
+	fn       func(ctx context.Context) error
+	done     chan error
+	attempts int
+	state    atomic.Int32
+}
+
+// NewScheduler starts a scheduler. Call Stop to release its dispatcher.
+func NewScheduler(cfg SchedulerConfig) *Scheduler {
+	if cfg.Burst <= 0 {
+		cfg.Burst = 1
+	}
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = 30 * time.Second
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &Scheduler{
+		cfg:     cfg,
+		limiter: rate.NewLimiter(rate.Limit(cfg.Rate), cfg.Burst),
+		wake:    make(chan struct{}, 1),
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+	go s.run()
+	return s
+}
+
+// Do queues fn at the priority carried by ctx and waits for it to complete.
+// fn may return ErrServiceUnavailable to have the scheduler back off and retry.
+func (s *Scheduler) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	j := &job{ctx: ctx, fn: fn, done: make(chan error, 1)}
+	p := PriorityFrom(ctx)
+
+	s.mu.Lock()
+	if s.cfg.MaxQueue > 0 && s.queued >= s.cfg.MaxQueue {
+		s.mu.Unlock()
+		return ErrQueueFull
+	}
+	s.queues[p] = append(s.queues[p], j)
+	s.queued++
+	s.mu.Unlock()
+	s.signal()
+
+	select {
+	case err := <-j.done:
+		return err
+	case <-ctx.Done():
+		if j.state.CompareAndSwap(jobQueued, jobCanceled) {
+			return ctx.Err()
+		}
+		// Already running on ctx, so it finishes promptly
+		<-j.done
+		return ctx.Err()
+	}
+}
+
+// Stop halts dispatching. Queued requests are left waiting on their contexts.
+func (s *Scheduler) Stop() {
+	s.cancel()
+}
+
+// QueueLen reports how many requests are waiting to be dispatched.
+func (s *Scheduler) QueueLen() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.queued
+}
+
+func (s *Scheduler) signal() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *Scheduler) run() {
+	for {
+		// Wait out any 503 backoff before spending a token
+		s.mu.Lock()
+		pause := time.Until(s.pausedUntil)
+		s.mu.Unlock()
+		if pause > 0 {
+			select {
+			case <-time.After(pause):
+			case <-s.ctx.Done():
+				return
+			}
+			continue
+		}
+
+		// Wait for work, then for a token. The job is picked only once the
+		// token is in hand so a late interactive request can jump the queue.
+		if s.QueueLen() == 0 {
+			select {
+			case <-s.wake:
+			case <-s.ctx.Done():
+				return
+			}
+			continue
+		}
+		if err := s.limiter.Wait(s.ctx); err != nil {
+			return
+		}
+
+		if j := s.pop(); j != nil {
+			go s.execute(j)
+		}
+	}
+}
+
+// pop removes the oldest live job at the highest priority.
+func (s *Scheduler) pop() *job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for p := range s.queues {
+		for len(s.queues[p]) > 0 {
+			j := s.queues[p][0]
+			s.queues[p] = s.queues[p][1:]
+			s.queued--
+			if j.state.CompareAndSwap(jobQueued, jobRunning) {
+				return j
+			}
+		}
+	}
+	return nil
+}
+
+func (s *Scheduler) execute(j *job) {
+	err := j.fn(j.ctx)
+
+	s.mu.Lock()
+	if errors.Is(err, ErrServiceUnavailable) && j.attempts < s.cfg.MaxRetries && j.ctx.Err() == nil {
+		// Back off globally and put the job back at the head of its queue
+		s.failures++
+		backoff := time.Second << min(s.failures-1, 5)
+		if ra := retryAfter(err); ra > backoff {
+			backoff = ra
+		}
+		if backoff > s.cfg.MaxBackoff {
+			backoff = s.cfg.MaxBackoff
+		}
+		if until := time.Now().Add(backoff); until.After(s.pausedUntil) {
+			s.pausedUntil = until
+		}
+		j.attempts++
+		j.state.Store(jobQueued)
+		p := PriorityFrom(j.ctx)
+		s.queues[p] = append([]*job{j}, s.queues[p]...)
+		s.queued++
+		s.mu.Unlock()
+		s.signal()
+		return
+	}
+	if err == nil {
+		s.failures = 0
+	}
+	s.mu.Unlock()
+
+	j.done <- err
+}
+
+// unavailableError carries the upstream Retry-After hint with ErrServiceUnavailable.
+type unavailableError struct {
+	retryAfter time.Duration
+}
+
+func (e *unavailableError) Error() string {
+	return ErrServiceUnavailable.Error()
+}
+
+func (e *unavailableError) Unwrap() error {
+	return ErrServiceUnavailable
+}
+
+func retryAfter(err error) time.Duration {
+	var ue *unavailableError
+	if errors.As(err, &ue) {
+		return ue.retryAfter
+	}
+	return 0
+}
@@ -0,0 +1,129 @@
+package musicbrainz
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mager/occipital/cache"
+	"go.uber.org/zap"
+)
+
+// A caller that gives up while its request is running must not get control
+// back until the request stops writing its result. Run with -race.
+func TestSchedulerDoWaitsForRunningJob(t *testing.T) {
+	s := NewScheduler(SchedulerConfig{Rate: 100, Burst: 1})
+	defer s.Stop()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	started := make(chan struct{})
+	var out int
+	go func() {
+		<-started
+		cancel()
+	}()
+
+	err := s.Do(ctx, func(ctx context.Context) error {
+		close(started)
+		<-ctx.Done()
+		// Like a decoder finishing with the body it already read
+		time.Sleep(20 * time.Millisecond)
+		out = 1
+		return ctx.Err()
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want context.Canceled", err)
+	}
+	if out != 1 {
+		t.Error("Do returned before the running job finished")
+	}
+}
+
+func TestSchedulerDoSkipsCanceledJob(t *testing.T) {
+	// One token, spent by the first job, so the second stays queued
+	s := NewScheduler(SchedulerConfig{Rate: 0.1, Burst: 1})
+	defer s.Stop()
+
+	if err := s.Do(context.Background(), func(context.Context) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	ran := make(chan struct{}, 1)
+	err := s.Do(ctx, func(context.Context) error {
+		ran <- struct{}{}
+		return nil
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, want context.DeadlineExceeded", err)
+	}
+
+	s.mu.Lock()
+	j := s.queues[PriorityInteractive][0]
+	s.mu.Unlock()
+	if got := j.state.Load(); got != jobCanceled {
+		t.Errorf("state = %d, want canceled", got)
+	}
+	if s.pop() != nil {
+		t.Error("pop returned a canceled job")
+	}
+	select {
+	case <-ran:
+		t.Error("canceled job ran")
+	default:
+	}
+}
+
+func TestSchedulerRetriesUnavailable(t *testing.T) {
+	s := NewScheduler(SchedulerConfig{Rate: 100, Burst: 1, MaxRetries: 1, MaxBackoff: time.Millisecond})
+	defer s.Stop()
+
+	calls := 0
+	err := s.Do(context.Background(), func(context.Context) error {
+		calls++
+		if calls == 1 {
+			return &unavailableError{}
+		}
+		return nil
+	})
+	if err != nil || calls != 2 {
+		t.Errorf("err = %v after %d calls, want success on the retry", err, calls)
+	}
+}
+
+func TestPriorityFrom(t *testing.T) {
+	ctx := context.Background()
+	if p := PriorityFrom(ctx); p != PriorityInteractive {
+		t.Errorf("default = %v, want interactive", p)
+	}
+	if p := PriorityFrom(WithPriority(ctx, PriorityBackground)); p != PriorityBackground {
+		t.Errorf("explicit = %v, want background", p)
+	}
+
+	// A stale entry is refreshed in the background, even from an
+	// interactive request
+	mem := cache.NewMemory(10)
+	l := cache.NewLoader(mem, zap.NewNop().Sugar())
+	now := time.Now()
+	mem.Set(ctx, "ns/key", &cache.Entry{
+		Value:      []byte(`"stale"`),
+		CachedAt:   now.Add(-2 * time.Hour),
+		ExpiresAt:  now.Add(-time.Hour),
+		StaleUntil: now.Add(time.Hour),
+	})
+	got := make(chan Priority, 1)
+	cache.Fetch(WithPriority(ctx, PriorityInteractive), l, "ns/key", cache.Policy{TTL: time.Hour}, func(ctx context.Context) (string, error) {
+		got <- PriorityFrom(ctx)
+		return "fresh", nil
+	})
+	select {
+	case p := <-got:
+		if p != PriorityBackground {
+			t.Errorf("revalidation = %v, want background", p)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("revalidation never ran")
+	}
+}
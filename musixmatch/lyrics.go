@@ -0,0 +1,196 @@
+package musixmatch
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	mxm "github.com/mager/go-musixmatch"
+)
+
+var (
+	// ErrMissingAPIKey is returned when no Musixmatch API key is configured.
+	ErrMissingAPIKey = errors.New("musixmatch: missing API key")
+	// ErrTrackNotFound is returned when Musixmatch has no matching track.
+	ErrTrackNotFound = errors.New("musixmatch: track not found")
+	// ErrLyricsUnavailable is returned when the track exists but has no lyrics
+	// we are allowed to show (missing, instrumental or restricted).
+	ErrLyricsUnavailable = errors.New("musixmatch: lyrics unavailable")
+	// ErrUnauthorized is returned when Musixmatch rejects the API key.
+	ErrUnauthorized = errors.New("musixmatch: unauthorized")
+)
+
+// LyricsQuery identifies a track to look up lyrics for.
+// ISRC is preferred; Title and Artist are used by the matcher fallback.
+type LyricsQuery struct {
+	ISRC   string
+	Title  string
+	Artist string
+}
+
+// Lyrics holds plain and synced lyrics for a single Musixmatch track.
+type Lyrics struct {
+	TrackID       int
+	CommonTrackID int
+	TrackName     string
+	ArtistName    string
+	Body          string
+	Copyright     string
+	Explicit      bool
+	Instrumental  bool
+	// Subtitle is the synced lyrics body in LRC format, empty if Musixmatch
+	// has no timing for this track.
+	Subtitle         string
+	SubtitleLanguage string
+}
+
+type response struct {
+	Message struct {
+		Header struct {
+			StatusCode int `json:"status_code"`
+		} `json:"header"`
+		Body json.RawMessage `json:"body"`
+	} `json:"message"`
+}
+
+type trackBody struct {
+	Track mxm.Track `json:"track"`
+}
+
+type lyricsBody struct {
+	Lyrics mxm.Lyrics `json:"lyrics"`
+}
+
+type subtitleBody struct {
+	Subtitle struct {
+		ID       int    `json:"subtitle_id"`
+		Body     string `json:"subtitle_body"`
+		Language string `json:"subtitle_language"`
+	} `json:"subtitle"`
+}
+
+// GetLyrics resolves a track on Musixmatch and fetches its lyrics and, when
+// available, its LRC subtitle.
+func (c *MusixmatchClient) GetLyrics(ctx context.Context, q LyricsQuery) (*Lyrics, error) {
+	if !c.Configured() {
+		return nil, ErrMissingAPIKey
+	}
+
+	track, err := c.matchTrack(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &Lyrics{
+		TrackID:       track.ID,
+		CommonTrackID: track.CommontrackID,
+		TrackName:     track.Name,
+		ArtistName:    track.ArtistName,
+		Explicit:      track.Explicit == 1,
+		Instrumental:  track.Instrumental == 1,
+	}
+	if out.Instrumental || track.HasLyrics == 0 {
+		return nil, ErrLyricsUnavailable
+	}
+
+	var lb lyricsBody
+	if err := c.get(ctx, "track.lyrics.get", url.Values{"track_id": {fmt.Sprint(track.ID)}}, &lb); err != nil {
+		if errors.Is(err, ErrTrackNotFound) {
+			return nil, ErrLyricsUnavailable
+		}
+		return nil, err
+	}
+	if lb.Lyrics.Body == "" {
+		return nil, ErrLyricsUnavailable
+	}
+	out.Body = lb.Lyrics.Body
+	out.Copyright = lb.Lyrics.LyricsCopyright
+
+	// Synced lyrics are best-effort; plain lyrics are still useful without them.
+	if track.HasSubtitles == 1 {
+		var sb subtitleBody
+		err := c.get(ctx, "track.subtitle.get", url.Values{
+			"track_id":        {fmt.Sprint(track.ID)},
+			"subtitle_format": {"lrc"},
+		}, &sb)
+		if err == nil {
+			out.Subtitle = sb.Subtitle.Body
+			out.SubtitleLanguage = sb.Subtitle.Language
+		}
+	}
+
+	return out, nil
+}
+
+// matchTrack finds the Musixmatch track by ISRC, falling back to the
+// title/artist matcher.
+func (c *MusixmatchClient) matchTrack(ctx context.Context, q LyricsQuery) (*mxm.Track, error) {
+	if q.ISRC != "" {
+		var tb trackBody
+		err := c.get(ctx, "track.get", url.Values{"track_isrc": {q.ISRC}}, &tb)
+		if err == nil && tb.Track.ID != 0 {
+			return &tb.Track, nil
+		}
+		if err != nil && !errors.Is(err, ErrTrackNotFound) {
+			return nil, err
+		}
+	}
+
+	if q.Title == "" || q.Artist == "" {
+		return nil, ErrTrackNotFound
+	}
+
+	var tb trackBody
+	err := c.get(ctx, "matcher.track.get", url.Values{
+		"q_track":  {q.Title},
+		"q_artist": {q.Artist},
+	}, &tb)
+	if err != nil {
+		return nil, err
+	}
+	if tb.Track.ID == 0 {
+		return nil, ErrTrackNotFound
+	}
+	return &tb.Track, nil
+}
+
+// get calls a Musixmatch endpoint and decodes the message body into out.
+// Musixmatch reports errors in the envelope header rather than the HTTP status.
+func (c *MusixmatchClient) get(ctx context.Context, endpoint string, params url.Values, out interface{}) error {
+	params.Set("apikey", c.Client.ApiKey)
+	u := fmt.Sprintf("%s/%s?%s", c.Client.BaseURL, endpoint, params.Encode())
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	httpClient := c.Client.HttpClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var r response
+	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return fmt.Errorf("musixmatch: decode %s: %w", endpoint, err)
+	}
+
+	switch r.Message.Header.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound, http.StatusNoContent:
+		return ErrTrackNotFound
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return ErrUnauthorized
+	default:
+		return fmt.Errorf("musixmatch: %s returned status %d", endpoint, r.Message.Header.StatusCode)
+	}
+
+	return json.Unmarshal(r.Message.Body, out)
+}
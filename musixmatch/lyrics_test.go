@@ -0,0 +1,205 @@
+package musixmatch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	mxm "github.com/mager/go-musixmatch"
+)
+
+// envelope wraps a body the way Musixmatch does, with the status in the
+// header rather than the HTTP response.
+func envelope(status int, body string) string {
+	if body == "" {
+		body = "[]"
+	}
+	return fmt.Sprintf(`{"message":{"header":{"status_code":%d},"body":%s}}`, status, body)
+}
+
+const (
+	trackJSON = `{"track":{"track_id":42,"commontrack_id":7,"track_name":"Hey Jude","artist_name":"The Beatles",
+		"explicit":0,"instrumental":0,"has_lyrics":1,"has_subtitles":1}}`
+	lyricsJSON   = `{"lyrics":{"lyrics_id":1,"lyrics_body":"Hey Jude, don't make it bad","lyrics_copyright":"(c) Sony/ATV"}}`
+	subtitleJSON = `{"subtitle":{"subtitle_id":3,"subtitle_body":"[00:01.00]Hey Jude","subtitle_language":"en"}}`
+)
+
+// fakeMusixmatch serves canned envelopes by endpoint and records the
+// endpoints called.
+func fakeMusixmatch(t *testing.T, routes map[string]string) (*MusixmatchClient, *[]string) {
+	t.Helper()
+	var calls []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		endpoint := strings.TrimPrefix(r.URL.Path, "/")
+		calls = append(calls, endpoint)
+		if got := r.URL.Query().Get("apikey"); got != "test-key" {
+			t.Errorf("%s: apikey = %q, want test-key", endpoint, got)
+		}
+		body, ok := routes[endpoint]
+		if !ok {
+			body = envelope(http.StatusNotFound, "")
+		}
+		fmt.Fprint(w, body)
+	}))
+	t.Cleanup(srv.Close)
+
+	c := mxm.New("test-key", srv.Client())
+	c.BaseURL = srv.URL
+	return &MusixmatchClient{Client: c}, &calls
+}
+
+func TestGetLyrics(t *testing.T) {
+	c, calls := fakeMusixmatch(t, map[string]string{
+		"track.get":          envelope(http.StatusOK, trackJSON),
+		"track.lyrics.get":   envelope(http.StatusOK, lyricsJSON),
+		"track.subtitle.get": envelope(http.StatusOK, subtitleJSON),
+	})
+
+	l, err := c.GetLyrics(context.Background(), LyricsQuery{ISRC: "GBAYE0601498"})
+	if err != nil {
+		t.Fatalf("GetLyrics: %v", err)
+	}
+	if l.TrackID != 42 || l.CommonTrackID != 7 || l.TrackName != "Hey Jude" || l.ArtistName != "The Beatles" {
+		t.Errorf("track fields = %+v", l)
+	}
+	if l.Body != "Hey Jude, don't make it bad" || l.Copyright != "(c) Sony/ATV" {
+		t.Errorf("lyrics = %q, copyright = %q", l.Body, l.Copyright)
+	}
+	if l.Subtitle != "[00:01.00]Hey Jude" || l.SubtitleLanguage != "en" {
+		t.Errorf("subtitle = %q (%q)", l.Subtitle, l.SubtitleLanguage)
+	}
+	if want := "track.get,track.lyrics.get,track.subtitle.get"; strings.Join(*calls, ",") != want {
+		t.Errorf("calls = %v, want %s", *calls, want)
+	}
+}
+
+func TestGetLyricsFallsBackToMatcher(t *testing.T) {
+	c, calls := fakeMusixmatch(t, map[string]string{
+		"track.get":         envelope(http.StatusNotFound, ""),
+		"matcher.track.get": envelope(http.StatusOK, strings.Replace(trackJSON, `"has_subtitles":1`, `"has_subtitles":0`, 1)),
+		"track.lyrics.get":  envelope(http.StatusOK, lyricsJSON),
+	})
+
+	l, err := c.GetLyrics(context.Background(), LyricsQuery{ISRC: "XX0000000000", Title: "Hey Jude", Artist: "The Beatles"})
+	if err != nil {
+		t.Fatalf("GetLyrics: %v", err)
+	}
+	if l.Subtitle != "" {
+		t.Errorf("subtitle = %q, want none", l.Subtitle)
+	}
+	if want := "track.get,matcher.track.get,track.lyrics.get"; strings.Join(*calls, ",") != want {
+		t.Errorf("calls = %v, want %s", *calls, want)
+	}
+}
+
+func TestGetLyricsSubtitleIsBestEffort(t *testing.T) {
+	c, _ := fakeMusixmatch(t, map[string]string{
+		"track.get":          envelope(http.StatusOK, trackJSON),
+		"track.lyrics.get":   envelope(http.StatusOK, lyricsJSON),
+		"track.subtitle.get": envelope(http.StatusInternalServerError, ""),
+	})
+
+	l, err := c.GetLyrics(context.Background(), LyricsQuery{ISRC: "GBAYE0601498"})
+	if err != nil {
+		t.Fatalf("GetLyrics: %v", err)
+	}
+	if l.Body == "" || l.Subtitle != "" {
+		t.Errorf("body = %q, subtitle = %q; want plain lyrics only", l.Body, l.Subtitle)
+	}
+}
+
+func TestGetLyricsErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		routes map[string]string
+		query  LyricsQuery
+		want   error
+	}{
+		{
+			name:   "unknown ISRC without title",
+			routes: map[string]string{"track.get": envelope(http.StatusNotFound, "")},
+			query:  LyricsQuery{ISRC: "XX0000000000"},
+			want:   ErrTrackNotFound,
+		},
+		{
+			name:   "no ISRC and no match",
+			routes: map[string]string{"matcher.track.get": envelope(http.StatusOK, `{"track":{"track_id":0}}`)},
+			query:  LyricsQuery{Title: "Nope", Artist: "Nobody"},
+			want:   ErrTrackNotFound,
+		},
+		{
+			name:   "instrumental",
+			routes: map[string]string{"track.get": envelope(http.StatusOK, strings.Replace(trackJSON, `"instrumental":0`, `"instrumental":1`, 1))},
+			query:  LyricsQuery{ISRC: "GBAYE0601498"},
+			want:   ErrLyricsUnavailable,
+		},
+		{
+			name:   "no lyrics",
+			routes: map[string]string{"track.get": envelope(http.StatusOK, strings.Replace(trackJSON, `"has_lyrics":1`, `"has_lyrics":0`, 1))},
+			query:  LyricsQuery{ISRC: "GBAYE0601498"},
+			want:   ErrLyricsUnavailable,
+		},
+		{
+			name: "lyrics restricted",
+			routes: map[string]string{
+				"track.get":        envelope(http.StatusOK, trackJSON),
+				"track.lyrics.get": envelope(http.StatusNotFound, ""),
+			},
+			query: LyricsQuery{ISRC: "GBAYE0601498"},
+			want:  ErrLyricsUnavailable,
+		},
+		{
+			name: "empty lyrics body",
+			routes: map[string]string{
+				"track.get":        envelope(http.StatusOK, trackJSON),
+				"track.lyrics.get": envelope(http.StatusOK, `{"lyrics":{"lyrics_body":""}}`),
+			},
+			query: LyricsQuery{ISRC: "GBAYE0601498"},
+			want:  ErrLyricsUnavailable,
+		},
+		{
+			name:   "bad key",
+			routes: map[string]string{"track.get": envelope(http.StatusUnauthorized, "")},
+			query:  LyricsQuery{ISRC: "GBAYE0601498"},
+			want:   ErrUnauthorized,
+		},
+		{
+			name:   "forbidden",
+			routes: map[string]string{"track.get": envelope(http.StatusForbidden, "")},
+			query:  LyricsQuery{ISRC: "GBAYE0601498"},
+			want:   ErrUnauthorized,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := fakeMusixmatch(t, tt.routes)
+			_, err := c.GetLyrics(context.Background(), tt.query)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetLyricsUpstreamError(t *testing.T) {
+	c, _ := fakeMusixmatch(t, map[string]string{"track.get": envelope(http.StatusServiceUnavailable, "")})
+	_, err := c.GetLyrics(context.Background(), LyricsQuery{ISRC: "GBAYE0601498"})
+	if err == nil || errors.Is(err, ErrTrackNotFound) || errors.Is(err, ErrUnauthorized) {
+		t.Errorf("err = %v, want a generic provider error", err)
+	}
+}
+
+func TestGetLyricsMissingAPIKey(t *testing.T) {
+	for _, c := range []*MusixmatchClient{{}, {Client: mxm.New("", http.DefaultClient)}} {
+		if c.Configured() {
+			t.Errorf("Configured() = true for %+v", c.Client)
+		}
+		if _, err := c.GetLyrics(context.Background(), LyricsQuery{ISRC: "GBAYE0601498"}); !errors.Is(err, ErrMissingAPIKey) {
+			t.Errorf("err = %v, want ErrMissingAPIKey", err)
+		}
+	}
+}
@@ -18,4 +18,10 @@ func ProvideMusixmatch(cfg config.Config, l *zap.SugaredLogger) *MusixmatchClien
 	return &c
 }
 
+// Configured reports whether an API key is set, so callers can skip
+// identifying a track when lyrics can't be fetched anyway.
+func (c *MusixmatchClient) Configured() bool {
+	return c.Client != nil && c.Client.ApiKey != ""
+}
+
 var Options = ProvideMusixmatch
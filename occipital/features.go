@@ -0,0 +1,45 @@
+package occipital
+
+import "math"
+
+// FeatureVector is a track's audio features with every dimension on a 0-1
+// scale, so tracks can be compared by how alike they sound.
+type FeatureVector []float64
+
+// Vector returns f as a FeatureVector.
+func (f *TrackFeatures) Vector() FeatureVector {
+	// Loudness runs about -60 to 0 dB
+	loudness := min(max((float64(f.Loudness)+60)/60, 0), 1)
+	return FeatureVector{
+		float64(f.Acousticness),
+		float64(f.Danceability),
+		float64(f.Energy),
+		float64(f.Happiness),
+		float64(f.Instrumentalness),
+		float64(f.Liveness),
+		float64(f.Speechiness),
+		loudness,
+	}
+}
+
+// WithTempo returns v with tempo added as a dimension. Only compare it with
+// vectors that have one too.
+func (v FeatureVector) WithTempo(bpm float32) FeatureVector {
+	// Tempo runs about 50 to 200 BPM
+	tempo := min(max((float64(bpm)-50)/150, 0), 1)
+	return append(v[:len(v):len(v)], tempo)
+}
+
+// Similarity is 1 minus the RMS distance between v and o, so identical
+// vectors score 1 and opposite corners 0. Both must have the same dimensions.
+func (v FeatureVector) Similarity(o FeatureVector) float64 {
+	if len(v) == 0 || len(v) != len(o) {
+		return 0
+	}
+	var sum float64
+	for i := range v {
+		d := v[i] - o[i]
+		sum += d * d
+	}
+	return 1 - math.Sqrt(sum/float64(len(v)))
+}
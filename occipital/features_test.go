@@ -0,0 +1,40 @@
+package occipital
+
+import (
+	"math"
+	"testing"
+)
+
+func TestFeatureVectorSimilarity(t *testing.T) {
+	quiet := &TrackFeatures{Loudness: -60}
+	loud := &TrackFeatures{
+		Acousticness: 1, Danceability: 1, Energy: 1, Happiness: 1,
+		Instrumentalness: 1, Liveness: 1, Speechiness: 1, Loudness: 0,
+	}
+
+	tests := []struct {
+		name string
+		a, b FeatureVector
+		want float64
+	}{
+		{"identical", loud.Vector(), loud.Vector(), 1},
+		{"opposite corners", quiet.Vector(), loud.Vector(), 0},
+		{"same features, tempo apart", loud.Vector().WithTempo(50), loud.Vector().WithTempo(200), 1 - math.Sqrt(1/9.0)},
+		{"tempo on one side only", loud.Vector().WithTempo(120), loud.Vector(), 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.a.Similarity(tt.b); got != tt.want {
+				t.Errorf("Similarity = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithTempoKeepsVector(t *testing.T) {
+	v := make(FeatureVector, 8, 16)
+	a, b := v.WithTempo(50), v.WithTempo(200)
+	if len(v) != 8 || a[8] != 0 || b[8] != 1 {
+		t.Errorf("WithTempo shared storage: v = %v, a = %v, b = %v", v, a, b)
+	}
+}
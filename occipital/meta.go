@@ -0,0 +1,24 @@
+package occipital
+
+import (
+	"encoding/json"
+
+	"github.com/mager/occipital/harmonic"
+)
+
+// MarshalJSON fills in the derived key and tempo fields, so tracks cached
+// before they existed get them too.
+func (m TrackMeta) MarshalJSON() ([]byte, error) {
+	type plain TrackMeta
+	p := plain(m)
+	// A zero tempo means audio features weren't fetched, so Key 0 isn't C
+	if m.Tempo > 0 {
+		key := harmonic.FromPitch(m.Key, m.Mode)
+		p.Camelot = key.Camelot()
+		p.OpenKey = key.OpenKey()
+		p.KeyName = key.Name()
+		p.HalfTimeTempo = float32(harmonic.HalfTime(float64(m.Tempo)))
+		p.DoubleTimeTempo = float32(harmonic.DoubleTime(float64(m.Tempo)))
+	}
+	return json.Marshal(p)
+}
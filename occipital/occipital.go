@@ -12,20 +12,57 @@ type Track struct {
 	Meta     *TrackMeta     `json:"meta"`
 	Features *TrackFeatures `json:"features"`
 	Analysis *TrackAnalysis `json:"analysis"`
-	Links    []ExternalLink `json:"links"`
+	// Structure is derived from Spotify's analysis when the track is cached;
+	// see ?analysis= on the track endpoints
+	Structure *TrackStructure `json:"structure,omitempty"`
+	Links     []ExternalLink  `json:"links"`
 
-	Releases          *[]Release                `json:"releases"`
-	ReleaseDate       string                    `json:"release_date"`
-	Genres            []string                  `json:"genres"`
-	ISRC              string                    `json:"isrc"`
+	Releases    *[]Release `json:"releases"`
+	ReleaseDate string     `json:"release_date"`
+	Genres      []string   `json:"genres"`
+	ISRC        string     `json:"isrc"`
+	// ArtistCredits are the credited artists with their MusicBrainz IDs
+	ArtistCredits     []CreditArtist            `json:"artist_credits,omitempty"`
 	Instruments       []*TrackInstrumentArtists `json:"instruments"`
 	ProductionCredits []*TrackProductionCredit  `json:"production_credits"`
 	SongCredits       []*TrackSongCredit        `json:"song_credits"`
+	// Lyrics is only set when requested with ?include=lyrics
+	Lyrics *TrackLyrics `json:"lyrics,omitempty"`
+	// Sources reports each upstream called while building the track, keyed
+	// by name, so missing fields can be told apart from failed lookups
+	Sources map[string]SourceStatus `json:"sources,omitempty"`
+	// RecordingMatch is how the MusicBrainz recording was chosen from those
+	// sharing the track's ISRC
+	RecordingMatch *RecordingMatch `json:"recording_match,omitempty"`
 
 	Rank       int `json:"rank,omitempty"`
 	Popularity int `json:"popularity,omitempty"`
 }
 
+// RecordingMatch is the MusicBrainz recording picked for an ISRC.
+type RecordingMatch struct {
+	MBID string `json:"mbid"`
+	// Confidence runs from 0 to 1 and is low when another recording scored
+	// nearly as well
+	Confidence float64              `json:"confidence"`
+	Alternates []RecordingAlternate `json:"alternates,omitempty"`
+}
+
+type RecordingAlternate struct {
+	MBID  string  `json:"mbid"`
+	Score float64 `json:"score"`
+}
+
+// SourceStatus is how one upstream fared while a track was built.
+type SourceStatus struct {
+	// Status is ok, empty (the upstream had nothing) or error
+	Status    string `json:"status"`
+	LatencyMs int64  `json:"latency_ms"`
+	// Error classifies a failure: timeout, rate_limited, unavailable,
+	// unauthorized or error
+	Error string `json:"error,omitempty"`
+}
+
 type TrackMeta struct {
 	// DurationMs is the duration of the track in milliseconds.
 	// Example: 237040
@@ -46,6 +83,22 @@ type TrackMeta struct {
 	// Range: 3 - 7
 	// Example: 4
 	TimeSignature int `json:"time_signature"`
+
+	// The fields below are derived from Key, Mode and Tempo when the track is encoded.
+
+	// Camelot is the key in Camelot wheel notation.
+	// Example: 8A
+	Camelot string `json:"camelot,omitempty"`
+	// OpenKey is the key in Open Key notation.
+	// Example: 1m
+	OpenKey string `json:"open_key,omitempty"`
+	// KeyName is the key spelled out.
+	// Example: A minor
+	KeyName string `json:"key_name,omitempty"`
+	// HalfTimeTempo and DoubleTimeTempo are the BPMs the track mixes against at half or double time.
+	// Example: 59.106, 236.422
+	HalfTimeTempo   float32 `json:"half_time_tempo,omitempty"`
+	DoubleTimeTempo float32 `json:"double_time_tempo,omitempty"`
 }
 
 type TrackFeatures struct {
@@ -129,6 +182,48 @@ type TrackSongCredit struct {
 type TrackAnalysis struct {
 	Duration float64                `json:"duration"`
 	Segments []TrackAnalysisSegment `json:"segments"`
+	Sections []TrackAnalysisSection `json:"sections,omitempty"`
+}
+
+// TrackAnalysisSection is a large variation in rhythm or timbre, e.g. a chorus or verse
+type TrackAnalysisSection struct {
+	Start      float64 `json:"start"`
+	Duration   float64 `json:"duration"`
+	Confidence float64 `json:"confidence"`
+	// Loudness is the overall loudness of the section in decibels (dB).
+	Loudness float64 `json:"loudness"`
+	// Tempo is the estimated tempo of the section in beats per minute (BPM).
+	Tempo float64 `json:"tempo"`
+	// Key and Mode use the same notation as TrackMeta.
+	Key           int `json:"key"`
+	Mode          int `json:"mode"`
+	TimeSignature int `json:"time_signature"`
+}
+
+// TrackStructure is a compact view of a track's analysis for drawing and
+// navigating it.
+type TrackStructure struct {
+	Duration float64        `json:"duration"`
+	Sections []TrackSection `json:"sections"`
+	// Bars and Beats are start times in seconds.
+	Bars  []float64 `json:"bars"`
+	Beats []float64 `json:"beats"`
+	// Waveform is the loudness of the track from 0 to 1 in evenly spaced buckets.
+	Waveform []float64 `json:"waveform,omitempty"`
+}
+
+// TrackSection is a section of a track, e.g. a verse or chorus.
+type TrackSection struct {
+	Start    float64 `json:"start"`
+	Duration float64 `json:"duration"`
+	// Loudness is in decibels (dB).
+	Loudness float64 `json:"loudness"`
+	Tempo    float64 `json:"tempo"`
+	// Camelot and KeyName describe the section's key; empty if none was detected.
+	Camelot string `json:"camelot,omitempty"`
+	KeyName string `json:"key_name,omitempty"`
+	// KeyChange is true when the key differs from the section before.
+	KeyChange bool `json:"key_change,omitempty"`
 }
 
 // TrackAnalysisSegment is a segment of a song
@@ -206,6 +301,22 @@ type CreatorRecording struct {
 	ID     string `json:"id"`
 	Title  string `json:"title"`
 	Artist string `json:"artist,omitempty"`
+	// Year and Image come from the recording's earliest release; see
+	// /creator/credits
+	Year  int    `json:"year,omitempty"`
+	Image string `json:"image,omitempty"`
+}
+
+// CreatorReleaseGroup is an album, single or other release in a creator's
+// discography.
+type CreatorReleaseGroup struct {
+	ID    string `json:"id"`
+	Title string `json:"title"`
+	// Type is the primary type with any secondary types, e.g. "Album + Live"
+	Type             string `json:"type"`
+	FirstReleaseDate string `json:"first_release_date,omitempty"`
+	Year             int    `json:"year,omitempty"`
+	Image            string `json:"image"`
 }
 
 // CreatorHighlight represents a popular track associated with a creator
@@ -215,3 +326,44 @@ type CreatorHighlight struct {
 	Artist string `json:"artist"`
 	Image  string `json:"image"`
 }
+
+// TrackLyrics represents the lyrics of a track, with synced lines when available
+type TrackLyrics struct {
+	// ID is based on the MusicBrainz recording ID
+	ID        string `json:"id,omitempty"`
+	SourceID  string `json:"source_id,omitempty"`
+	ISRC      string `json:"isrc,omitempty"`
+	Name      string `json:"name"`
+	Artist    string `json:"artist"`
+	Lyrics    string `json:"lyrics"`
+	Copyright string `json:"copyright,omitempty"`
+	Explicit  bool   `json:"explicit"`
+	// LRC is the raw synced lyrics in LRC format, e.g. "[00:12.34] line"
+	LRC      string       `json:"lrc,omitempty"`
+	Language string       `json:"language,omitempty"`
+	Synced   []LyricsLine `json:"synced,omitempty"`
+}
+
+// LyricsLine is a single timed line of synced lyrics
+type LyricsLine struct {
+	// TimeMs is the offset from the start of the track in milliseconds
+	TimeMs int    `json:"time_ms"`
+	Text   string `json:"text"`
+}
+
+// TasteProfile summarizes what a user listens to, for personalized ranking
+type TasteProfile struct {
+	// Artists maps artist names to an affinity from 0 to 1
+	Artists map[string]float64 `json:"artists"`
+	// Genres maps Spotify genres to an affinity from 0 to 1
+	Genres map[string]float64 `json:"genres"`
+	// KnownTracks are tracks the user played recently
+	KnownTracks []KnownTrack `json:"known_tracks"`
+}
+
+// KnownTrack is a track from a user's listening history
+type KnownTrack struct {
+	SpotifyID string `json:"spotify_id"`
+	Artist    string `json:"artist"`
+	Name      string `json:"name"`
+}
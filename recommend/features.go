@@ -0,0 +1,35 @@
+package recommend
+
+import (
+	"github.com/mager/occipital/occipital"
+)
+
+// neutralSimilarity stands in when either side has no audio features, so
+// those candidates rank on provenance alone.
+const neutralSimilarity = 0.5
+
+// centroid averages the features of the tracks that have them.
+func centroid(features []*occipital.TrackFeatures) (occipital.FeatureVector, bool) {
+	var c occipital.FeatureVector
+	n := 0
+	for _, f := range features {
+		if f == nil {
+			continue
+		}
+		v := f.Vector()
+		if c == nil {
+			c = make(occipital.FeatureVector, len(v))
+		}
+		for i := range c {
+			c[i] += v[i]
+		}
+		n++
+	}
+	if n == 0 {
+		return nil, false
+	}
+	for i := range c {
+		c[i] /= float64(n)
+	}
+	return c, true
+}
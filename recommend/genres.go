@@ -0,0 +1,69 @@
+package recommend
+
+import (
+	"slices"
+	"strings"
+)
+
+// genreQueries maps the genres we recommend for to the Spotify search that
+// finds their tracks.
+var genreQueries = map[string]string{
+	"afrobeats":   `genre:afrobeats`,
+	"alternative": `genre:alternative`,
+	"blues":       `genre:blues`,
+	"classical":   `genre:classical`,
+	"country":     `genre:country`,
+	"dance":       `genre:dance`,
+	"electronic":  `genre:electronic`,
+	"folk":        `genre:folk`,
+	"hip-hop":     `genre:"hip hop"`,
+	"house":       `genre:house`,
+	"indie":       `genre:indie`,
+	"jazz":        `genre:jazz`,
+	"k-pop":       `genre:k-pop`,
+	"latin":       `genre:latin`,
+	"metal":       `genre:metal`,
+	"pop":         `genre:pop`,
+	"punk":        `genre:punk`,
+	"r-n-b":       `genre:"r&b"`,
+	"rap":         `genre:rap`,
+	"reggae":      `genre:reggae`,
+	"rock":        `genre:rock`,
+	"soul":        `genre:soul`,
+	"techno":      `genre:techno`,
+}
+
+var genreAliases = map[string][]string{
+	// "hot" is the cross-genre mix the old recommendations page offered
+	"hot":      {"hip-hop", "pop", "rock", "electronic", "indie"},
+	"hip hop":  {"hip-hop"},
+	"hiphop":   {"hip-hop"},
+	"r&b":      {"r-n-b"},
+	"rnb":      {"r-n-b"},
+	"edm":      {"electronic"},
+	"kpop":     {"k-pop"},
+	"afrobeat": {"afrobeats"},
+}
+
+// ExpandGenre returns the genres a requested name stands for, or false if
+// we don't know it.
+func ExpandGenre(name string) ([]string, bool) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if _, ok := genreQueries[name]; ok {
+		return []string{name}, true
+	}
+	if gs, ok := genreAliases[name]; ok {
+		return gs, true
+	}
+	return nil, false
+}
+
+// Genres lists the genres ExpandGenre accepts, aliases excluded.
+func Genres() []string {
+	out := make([]string, 0, len(genreQueries))
+	for g := range genreQueries {
+		out = append(out, g)
+	}
+	slices.Sort(out)
+	return out
+}
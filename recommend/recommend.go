@@ -0,0 +1,615 @@
+// Package recommend builds track recommendations from seed tracks, artists
+// and genres without Spotify's recommendations endpoint. Candidates come from
+// the people credited on the seeds, the seed artists' top tracks, genre
+// searches and recent discover charts, and are ranked by how close their
+// audio features sit to the seeds'.
+package recommend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mager/occipital/occipital"
+	"github.com/mager/occipital/spotify"
+	"github.com/mager/occipital/util"
+	spot "github.com/zmb3/spotify/v2"
+	"go.uber.org/zap"
+)
+
+const (
+	// MaxSeeds matches what Spotify's own endpoint allowed
+	MaxSeeds     = 5
+	DefaultLimit = 48
+	MaxLimit     = 100
+
+	maxCreditArtists  = 6
+	maxCreditSearches = 12
+	// creditsBudget bounds the wait on MusicBrainz, which is paced at 1 req/s
+	creditsBudget = 6 * time.Second
+
+	historyDays          = 7
+	maxHistoryCandidates = 100
+	maxTracksPerArtist   = 2
+	topTracksCountry     = "US"
+)
+
+// How much each way of finding a candidate says about it. A shared
+// producer or writer is the strongest signal; being on the chart the weakest.
+const (
+	weightCredit  = 1.0
+	weightArtist  = 0.6
+	weightGenre   = 0.5
+	weightHistory = 0.3
+)
+
+var (
+	ErrNoSeeds      = errors.New("at least one seed track, artist or genre is required")
+	ErrTooManySeeds = fmt.Errorf("at most %d seeds are allowed", MaxSeeds)
+	ErrUnknownGenre = errors.New("unknown genre")
+)
+
+// Seeds are what recommendations start from. Tracks and Artists are
+// Spotify IDs; Genres are names ExpandGenre knows.
+type Seeds struct {
+	Tracks  []string
+	Artists []string
+	Genres  []string
+}
+
+// Recommendation is a ranked candidate and why it was picked.
+type Recommendation struct {
+	Track occipital.Track
+	Score float64
+	// Similarity is 0-1 closeness to the seeds' audio features, 0.5 when
+	// either side has none
+	Similarity float64
+	Reasons    []string
+}
+
+// TrackResolver returns an enriched track, with credits and features.
+// CachedFeatures returns the features of tracks it has already resolved,
+// keyed by Spotify ID, without calling Spotify.
+type TrackResolver interface {
+	Resolve(ctx context.Context, spotifyID string) (occipital.Track, error)
+	CachedFeatures(ctx context.Context, spotifyIDs []string) map[string]*occipital.TrackFeatures
+}
+
+// CreatorResolver returns a MusicBrainz artist with their credits and
+// Spotify highlights.
+type CreatorResolver interface {
+	Creator(ctx context.Context, mbid string) (occipital.Creator, error)
+}
+
+// History lists the Spotify IDs charted on discover over recent days,
+// newest first.
+type History interface {
+	RecentTrackIDs(ctx context.Context, days int) ([]string, error)
+}
+
+// Engine produces recommendations.
+type Engine struct {
+	log           *zap.SugaredLogger
+	spotifyClient *spotify.SpotifyClient
+	tracks        TrackResolver
+	creators      CreatorResolver
+	history       History
+}
+
+func NewEngine(log *zap.SugaredLogger, spotifyClient *spotify.SpotifyClient, tracks TrackResolver, creators CreatorResolver, history History) *Engine {
+	return &Engine{log: log, spotifyClient: spotifyClient, tracks: tracks, creators: creators, history: history}
+}
+
+// validate checks seed counts and expands genre names. Errors wrap
+// ErrNoSeeds, ErrTooManySeeds or ErrUnknownGenre.
+func (s Seeds) validate() ([]string, error) {
+	n := len(s.Tracks) + len(s.Artists) + len(s.Genres)
+	if n == 0 {
+		return nil, ErrNoSeeds
+	}
+	if n > MaxSeeds {
+		return nil, ErrTooManySeeds
+	}
+	var genres []string
+	for _, g := range s.Genres {
+		expanded, ok := ExpandGenre(g)
+		if !ok {
+			return nil, fmt.Errorf("%w %q", ErrUnknownGenre, g)
+		}
+		for _, e := range expanded {
+			if !slices.Contains(genres, e) {
+				genres = append(genres, e)
+			}
+		}
+	}
+	return genres, nil
+}
+
+// Recommend returns up to limit tracks for seeds, best first.
+func (e *Engine) Recommend(ctx context.Context, seeds Seeds, limit int) ([]Recommendation, error) {
+	genres, err := seeds.validate()
+	if err != nil {
+		return nil, err
+	}
+	if limit <= 0 {
+		limit = DefaultLimit
+	}
+	limit = min(limit, MaxLimit)
+
+	p := newPool(seeds.Tracks)
+
+	// Seed tracks give us features and credits (enriched, cached) and
+	// their artists (from the catalog)
+	seedTracks := e.resolveSeeds(ctx, seeds.Tracks)
+	artistIDs := slices.Clone(seeds.Artists)
+	if len(seeds.Tracks) > 0 {
+		fts, err := e.spotifyClient.Client.GetTracks(ctx, toIDs(seeds.Tracks))
+		if err != nil {
+			e.log.Warnw("Failed to fetch seed tracks", "err", err)
+		}
+		for _, ft := range fts {
+			if ft != nil && len(ft.Artists) > 0 && !slices.Contains(artistIDs, ft.Artists[0].ID.String()) {
+				artistIDs = append(artistIDs, ft.Artists[0].ID.String())
+			}
+		}
+	}
+
+	var wg sync.WaitGroup
+	run := func(f func()) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			f()
+		}()
+	}
+	run(func() { e.fromCredits(ctx, p, seedTracks) })
+	run(func() { e.fromArtists(ctx, p, artistIDs) })
+	run(func() { e.fromGenres(ctx, p, genres) })
+	if e.history != nil {
+		run(func() { e.fromHistory(ctx, p) })
+	}
+	wg.Wait()
+
+	candidates := p.list()
+	e.hydrate(ctx, candidates)
+	features := e.features(ctx, candidates)
+
+	var seedFeatures []*occipital.TrackFeatures
+	for _, t := range seedTracks {
+		seedFeatures = append(seedFeatures, t.Features)
+	}
+	center, hasCenter := centroid(seedFeatures)
+
+	var recs []Recommendation
+	for _, c := range candidates {
+		if c.track == nil {
+			continue
+		}
+		sim := neutralSimilarity
+		f := features[c.id]
+		if hasCenter && f != nil {
+			sim = center.Similarity(f.Vector())
+		}
+		// Corroboration by more than one source adds a little on top of
+		// the strongest one
+		provenance := min(c.weight+0.1*float64(len(c.reasons)-1), 1.2)
+		recs = append(recs, Recommendation{
+			Track:      trackFromSpotify(c.track, f),
+			Score:      0.6*sim + 0.4*provenance,
+			Similarity: sim,
+			Reasons:    c.reasons,
+		})
+	}
+
+	sort.SliceStable(recs, func(i, j int) bool {
+		if recs[i].Score != recs[j].Score {
+			return recs[i].Score > recs[j].Score
+		}
+		return recs[i].Track.Popularity > recs[j].Track.Popularity
+	})
+
+	// Keep any one artist from taking over the list
+	out := recs[:0]
+	perArtist := make(map[string]int)
+	for _, r := range recs {
+		artist := strings.ToLower(r.Track.Artist)
+		if perArtist[artist] >= maxTracksPerArtist {
+			continue
+		}
+		perArtist[artist]++
+		out = append(out, r)
+		if len(out) == limit {
+			break
+		}
+	}
+
+	e.log.Infow("Built recommendations",
+		"seed_tracks", len(seeds.Tracks),
+		"seed_artists", len(seeds.Artists),
+		"genres", genres,
+		"candidates", len(candidates),
+		"with_features", len(features),
+		"returned", len(out),
+	)
+	return out, nil
+}
+
+// resolveSeeds enriches the seed tracks concurrently. Seeds that fail to
+// resolve are skipped.
+func (e *Engine) resolveSeeds(ctx context.Context, ids []string) []occipital.Track {
+	tracks := make([]occipital.Track, len(ids))
+	ok := make([]bool, len(ids))
+	var wg sync.WaitGroup
+	for i, id := range ids {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			t, err := e.tracks.Resolve(ctx, id)
+			if err != nil {
+				e.log.Warnw("Failed to resolve seed track", "spotify_id", id, "err", err)
+				return
+			}
+			tracks[i], ok[i] = t, true
+		}()
+	}
+	wg.Wait()
+
+	var out []occipital.Track
+	for i, t := range tracks {
+		if ok[i] {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+type creditedArtist struct {
+	mbid   string
+	name   string
+	credit string
+	count  int
+}
+
+// seedCredits ranks the people credited on the seeds, most often credited
+// first.
+func seedCredits(seeds []occipital.Track) []creditedArtist {
+	byID := make(map[string]*creditedArtist)
+	var order []string
+	add := func(credit string, artists []occipital.CreditArtist) {
+		for _, a := range artists {
+			if a.ID == "" {
+				continue
+			}
+			if ca, ok := byID[a.ID]; ok {
+				ca.count++
+				continue
+			}
+			byID[a.ID] = &creditedArtist{mbid: a.ID, name: a.Name, credit: credit, count: 1}
+			order = append(order, a.ID)
+		}
+	}
+	for _, t := range seeds {
+		for _, c := range t.ProductionCredits {
+			add(c.Credit, c.Artists)
+		}
+		for _, c := range t.SongCredits {
+			add(c.Credit, c.Artists)
+		}
+		for _, c := range t.Instruments {
+			add(c.Instrument, c.Artists)
+		}
+	}
+
+	out := make([]creditedArtist, 0, len(order))
+	for _, id := range order {
+		out = append(out, *byID[id])
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].count > out[j].count })
+	return out
+}
+
+// fromCredits adds the Spotify highlights and credited recordings of the
+// producers, writers and players on the seeds.
+func (e *Engine) fromCredits(ctx context.Context, p *pool, seeds []occipital.Track) {
+	credited := seedCredits(seeds)
+	if len(credited) > maxCreditArtists {
+		credited = credited[:maxCreditArtists]
+	}
+	if len(credited) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, creditsBudget)
+	defer cancel()
+
+	var (
+		mu       sync.Mutex
+		searches int
+		wg       sync.WaitGroup
+	)
+	for _, ca := range credited {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			creator, err := e.creators.Creator(ctx, ca.mbid)
+			if err != nil {
+				e.log.Debugw("Failed to load credited artist", "mbid", ca.mbid, "err", err)
+				return
+			}
+			reason := fmt.Sprintf("%s credit: %s", ca.credit, ca.name)
+			for _, hl := range creator.Highlights {
+				p.add(spot.ID(hl.ID), nil, weightCredit, reason)
+			}
+
+			// Recordings they're credited on only have names; search
+			// Spotify for a few of them
+			for _, credit := range creator.Credits {
+				for _, rec := range credit.Recordings {
+					mu.Lock()
+					if searches >= maxCreditSearches {
+						mu.Unlock()
+						return
+					}
+					searches++
+					mu.Unlock()
+
+					if ft := e.search(ctx, rec.Title, rec.Artist); ft != nil {
+						p.add(ft.ID, ft, weightCredit, reason)
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// featuredArtists matches the join phrase MusicBrainz puts before featured
+// artists in a credit, like "Drake feat. Future".
+var featuredArtists = regexp.MustCompile(`(?i)\s(feat\.?|ft\.?|featuring)\s`)
+
+// primaryArtist returns the credited artist before any featured ones.
+func primaryArtist(credit string) string {
+	if loc := featuredArtists.FindStringIndex(credit); loc != nil {
+		credit = credit[:loc[0]]
+	}
+	return strings.TrimSpace(credit)
+}
+
+// search returns the first Spotify hit for a recording whose primary
+// artist matches.
+func (e *Engine) search(ctx context.Context, title, artist string) *spot.FullTrack {
+	if title == "" || artist == "" {
+		return nil
+	}
+	res, err := e.spotifyClient.Client.Search(ctx, fmt.Sprintf("track:%s artist:%s", title, artist), spot.SearchTypeTrack, spot.Limit(3))
+	if err != nil || res.Tracks == nil {
+		return nil
+	}
+	artist = primaryArtist(artist)
+	for i := range res.Tracks.Tracks {
+		ft := &res.Tracks.Tracks[i]
+		if len(ft.Artists) > 0 && strings.EqualFold(ft.Artists[0].Name, artist) {
+			return ft
+		}
+	}
+	return nil
+}
+
+// fromArtists adds each seed artist's top tracks.
+func (e *Engine) fromArtists(ctx context.Context, p *pool, artistIDs []string) {
+	var wg sync.WaitGroup
+	for _, id := range artistIDs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			top, err := e.spotifyClient.Client.GetArtistsTopTracks(ctx, spot.ID(id), topTracksCountry)
+			if err != nil {
+				e.log.Warnw("Failed to fetch artist top tracks", "artist_id", id, "err", err)
+				return
+			}
+			for i := range top {
+				ft := &top[i]
+				p.add(ft.ID, ft, weightArtist, "top track by "+util.GetFirstArtist(ft.Artists))
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// fromGenres adds the top search results for each genre.
+func (e *Engine) fromGenres(ctx context.Context, p *pool, genres []string) {
+	var wg sync.WaitGroup
+	for _, g := range genres {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res, err := e.spotifyClient.Client.Search(ctx, genreQueries[g], spot.SearchTypeTrack, spot.Limit(50))
+			if err != nil || res.Tracks == nil {
+				e.log.Warnw("Genre search failed", "genre", g, "err", err)
+				return
+			}
+			for i := range res.Tracks.Tracks {
+				ft := &res.Tracks.Tracks[i]
+				p.add(ft.ID, ft, weightGenre, "genre: "+g)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// fromHistory adds tracks from recent discover charts.
+func (e *Engine) fromHistory(ctx context.Context, p *pool) {
+	ids, err := e.history.RecentTrackIDs(ctx, historyDays)
+	if err != nil {
+		e.log.Warnw("Failed to load discover history", "err", err)
+		return
+	}
+	if len(ids) > maxHistoryCandidates {
+		ids = ids[:maxHistoryCandidates]
+	}
+	for _, id := range ids {
+		p.add(spot.ID(id), nil, weightHistory, "on the discover chart")
+	}
+}
+
+// hydrate fetches catalog data for candidates that were found by ID only.
+func (e *Engine) hydrate(ctx context.Context, cs []*candidate) {
+	var missing []*candidate
+	for _, c := range cs {
+		if c.track == nil {
+			missing = append(missing, c)
+		}
+	}
+	for chunk := range slices.Chunk(missing, 50) {
+		ids := make([]spot.ID, len(chunk))
+		for i, c := range chunk {
+			ids[i] = c.id
+		}
+		fts, err := e.spotifyClient.Client.GetTracks(ctx, ids)
+		if err != nil {
+			e.log.Warnw("Failed to fetch candidate tracks", "count", len(ids), "err", err)
+			continue
+		}
+		for i, ft := range fts {
+			if i < len(chunk) && ft != nil {
+				chunk[i].track = ft
+			}
+		}
+	}
+}
+
+// features looks up audio features for the candidates, from tracks already
+// resolved first. Spotify restricts its audio features endpoint for newer
+// apps, so it is only asked for the rest. Missing features aren't an
+// error: those candidates get neutral similarity.
+func (e *Engine) features(ctx context.Context, cs []*candidate) map[spot.ID]*occipital.TrackFeatures {
+	ids := make([]string, len(cs))
+	for i, c := range cs {
+		ids[i] = c.id.String()
+	}
+	out := make(map[spot.ID]*occipital.TrackFeatures, len(cs))
+	for id, f := range e.tracks.CachedFeatures(ctx, ids) {
+		out[spot.ID(id)] = f
+	}
+
+	var missing []spot.ID
+	for _, c := range cs {
+		if out[c.id] == nil {
+			missing = append(missing, c.id)
+		}
+	}
+	for chunk := range slices.Chunk(missing, 100) {
+		afs, err := e.spotifyClient.Client.GetAudioFeatures(ctx, chunk...)
+		if err != nil {
+			// Usually the app lacks access; later batches would fail the same way
+			e.log.Warnw("Failed to fetch audio features", "missing", len(missing), "err", err)
+			return out
+		}
+		for _, af := range afs {
+			if af != nil {
+				out[af.ID] = &occipital.TrackFeatures{
+					Acousticness:     af.Acousticness,
+					Danceability:     af.Danceability,
+					Energy:           af.Energy,
+					Happiness:        af.Valence,
+					Instrumentalness: af.Instrumentalness,
+					Liveness:         af.Liveness,
+					Loudness:         af.Loudness,
+					Speechiness:      af.Speechiness,
+				}
+			}
+		}
+	}
+	return out
+}
+
+func trackFromSpotify(ft *spot.FullTrack, f *occipital.TrackFeatures) occipital.Track {
+	t := occipital.Track{
+		Name:       ft.Name,
+		Artist:     util.GetFirstArtist(ft.Artists),
+		Source:     "SPOTIFY",
+		SourceID:   ft.ID.String(),
+		ISRC:       ft.ExternalIDs["isrc"],
+		Popularity: int(ft.Popularity),
+		Features:   f,
+	}
+	if thumb := util.GetThumb(ft.Album); thumb != nil {
+		t.Image = *thumb
+	} else if len(ft.Album.Images) > 0 {
+		t.Image = ft.Album.Images[0].URL
+	}
+	return t
+}
+
+func toIDs(ids []string) []spot.ID {
+	out := make([]spot.ID, len(ids))
+	for i, id := range ids {
+		out[i] = spot.ID(id)
+	}
+	return out
+}
+
+// candidate is a track some source suggested.
+type candidate struct {
+	id      spot.ID
+	track   *spot.FullTrack
+	weight  float64
+	reasons []string
+}
+
+// pool collects candidates from concurrent sources, merging repeats.
+type pool struct {
+	mu      sync.Mutex
+	exclude map[spot.ID]bool
+	byID    map[spot.ID]*candidate
+	order   []spot.ID
+}
+
+func newPool(exclude []string) *pool {
+	p := &pool{exclude: make(map[spot.ID]bool), byID: make(map[spot.ID]*candidate)}
+	for _, id := range exclude {
+		p.exclude[spot.ID(id)] = true
+	}
+	return p
+}
+
+func (p *pool) add(id spot.ID, ft *spot.FullTrack, weight float64, reason string) {
+	if id == "" {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.exclude[id] {
+		return
+	}
+	c, ok := p.byID[id]
+	if !ok {
+		c = &candidate{id: id}
+		p.byID[id] = c
+		p.order = append(p.order, id)
+	}
+	if c.track == nil {
+		c.track = ft
+	}
+	c.weight = max(c.weight, weight)
+	if !slices.Contains(c.reasons, reason) {
+		c.reasons = append(c.reasons, reason)
+	}
+}
+
+// list returns the candidates in the order they were first found.
+func (p *pool) list() []*candidate {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	out := make([]*candidate, len(p.order))
+	for i, id := range p.order {
+		out[i] = p.byID[id]
+	}
+	return out
+}
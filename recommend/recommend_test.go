@@ -0,0 +1,169 @@
+package recommend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/mager/occipital/occipital"
+	"github.com/mager/occipital/spotify"
+	spot "github.com/zmb3/spotify/v2"
+	"go.uber.org/zap"
+)
+
+func TestSeedsValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		seeds   Seeds
+		genres  []string
+		wantErr error
+	}{
+		{"none", Seeds{}, nil, ErrNoSeeds},
+		{"at the limit", Seeds{Tracks: []string{"t1", "t2"}, Artists: []string{"a1", "a2"}, Genres: []string{"rock"}}, []string{"rock"}, nil},
+		{"over the limit", Seeds{Tracks: []string{"t1", "t2", "t3"}, Artists: []string{"a1", "a2"}, Genres: []string{"rock"}}, nil, ErrTooManySeeds},
+		{"unknown genre", Seeds{Genres: []string{"rock", "polka"}}, nil, ErrUnknownGenre},
+		{"alias", Seeds{Genres: []string{" R&B "}}, []string{"r-n-b"}, nil},
+		// "hot" already covers hip-hop, so the alias adds nothing
+		{"overlapping aliases", Seeds{Genres: []string{"hip hop", "hot"}}, []string{"hip-hop", "pop", "rock", "electronic", "indie"}, nil},
+		{"tracks only", Seeds{Tracks: []string{"t1"}}, nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			genres, err := tt.seeds.validate()
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(genres, tt.genres) {
+				t.Errorf("genres = %q, want %q", genres, tt.genres)
+			}
+		})
+	}
+}
+
+func TestSeedCredits(t *testing.T) {
+	producer := occipital.CreditArtist{ID: "p", Name: "Producer"}
+	writer := occipital.CreditArtist{ID: "w", Name: "Writer"}
+	guitarist := occipital.CreditArtist{ID: "g", Name: "Guitarist"}
+	seeds := []occipital.Track{
+		{
+			ProductionCredits: []*occipital.TrackProductionCredit{{Credit: "producer", Artists: []occipital.CreditArtist{producer, {Name: "No MBID"}}}},
+			SongCredits:       []*occipital.TrackSongCredit{{Credit: "writer", Artists: []occipital.CreditArtist{writer}}},
+			Instruments:       []*occipital.TrackInstrumentArtists{{Instrument: "guitar", Artists: []occipital.CreditArtist{guitarist}}},
+		},
+		{
+			SongCredits: []*occipital.TrackSongCredit{{Credit: "composer", Artists: []occipital.CreditArtist{guitarist}}},
+		},
+	}
+
+	want := []creditedArtist{
+		// Credited twice, so first; keeps the credit it was first seen with
+		{mbid: "g", name: "Guitarist", credit: "guitar", count: 2},
+		// Ties keep the order they were found in
+		{mbid: "p", name: "Producer", credit: "producer", count: 1},
+		{mbid: "w", name: "Writer", credit: "writer", count: 1},
+	}
+	if got := seedCredits(seeds); !reflect.DeepEqual(got, want) {
+		t.Errorf("seedCredits() = %+v, want %+v", got, want)
+	}
+}
+
+func TestPoolAdd(t *testing.T) {
+	p := newPool([]string{"seed"})
+	ft := &spot.FullTrack{SimpleTrack: spot.SimpleTrack{ID: "b", Name: "B"}}
+
+	p.add("seed", nil, weightCredit, "excluded")
+	p.add("", nil, weightCredit, "no id")
+	p.add("a", nil, weightHistory, "on the discover chart")
+	p.add("b", nil, weightGenre, "genre: rock")
+	p.add("a", nil, weightCredit, "producer credit: P")
+	p.add("b", ft, weightArtist, "top track by B")
+	p.add("a", nil, weightHistory, "on the discover chart")
+
+	got := p.list()
+	if len(got) != 2 || got[0].id != "a" || got[1].id != "b" {
+		t.Fatalf("list() = %+v, want a then b", got)
+	}
+	a, b := got[0], got[1]
+	if a.weight != weightCredit || !reflect.DeepEqual(a.reasons, []string{"on the discover chart", "producer credit: P"}) {
+		t.Errorf("a = %+v, want the strongest weight and each reason once", a)
+	}
+	if b.track != ft || b.weight != weightArtist {
+		t.Errorf("b = %+v, want the catalog track from the later source", b)
+	}
+}
+
+func TestCentroid(t *testing.T) {
+	if _, ok := centroid([]*occipital.TrackFeatures{nil}); ok {
+		t.Error("centroid of no features reported ok")
+	}
+
+	low := &occipital.TrackFeatures{Energy: 0.25, Loudness: -60}
+	high := &occipital.TrackFeatures{Energy: 0.75, Loudness: 0}
+	c, ok := centroid([]*occipital.TrackFeatures{low, nil, high})
+	if !ok {
+		t.Fatal("centroid reported no features")
+	}
+	mid := &occipital.TrackFeatures{Energy: 0.5, Loudness: -30}
+	for i, want := range mid.Vector() {
+		if math.Abs(c[i]-want) > 1e-9 {
+			t.Errorf("centroid = %v, want %v", c, mid.Vector())
+			break
+		}
+	}
+	if s := c.Similarity(mid.Vector()); math.Abs(s-1) > 1e-9 {
+		t.Errorf("similarity to the midpoint = %v, want 1", s)
+	}
+	if c.Similarity(low.Vector()) != c.Similarity(high.Vector()) {
+		t.Error("centroid closer to one side")
+	}
+	if c.Similarity(low.Vector()) >= c.Similarity(mid.Vector()) {
+		t.Error("an outer track scored at least as close as the midpoint")
+	}
+}
+
+func TestSearchMatchesPrimaryArtist(t *testing.T) {
+	tests := []struct {
+		name   string
+		artist string
+		hits   []string
+		want   string
+	}{
+		{"exact", "Drake", []string{"Drake"}, "0"},
+		{"case and featured artists", "DRAKE feat. Future", []string{"Drake"}, "0"},
+		{"skips other artists", "Drake", []string{"Drake Bell", "Drake"}, "1"},
+		// A credit that merely starts with the hit's artist isn't theirs
+		{"prefix", "The Weeknd", []string{"The"}, ""},
+		{"band name with a separator", "Simon & Garfunkel", []string{"Simon", "Simon & Garfunkel"}, "1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var items string
+				for i, a := range tt.hits {
+					if i > 0 {
+						items += ","
+					}
+					items += fmt.Sprintf(`{"id":"%d","name":"Song","artists":[{"id":"x","name":%q}]}`, i, a)
+				}
+				fmt.Fprintf(w, `{"tracks":{"items":[%s]}}`, items)
+			}))
+			defer srv.Close()
+			e := NewEngine(zap.NewNop().Sugar(),
+				&spotify.SpotifyClient{Client: spot.New(srv.Client(), spot.WithBaseURL(srv.URL+"/"))},
+				nil, nil, nil)
+
+			var got string
+			if ft := e.search(context.Background(), "Song", tt.artist); ft != nil {
+				got = ft.ID.String()
+			}
+			if got != tt.want {
+				t.Errorf("search(%q) = %q, want %q", tt.artist, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package spotify
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+// ErrKeyMismatch is returned when a record was sealed under a different key.
+var ErrKeyMismatch = errors.New("spotify: token sealed with unknown key")
+
+// sealed is an envelope-encrypted value. The value is encrypted with a
+// random per-record data key, and the data key is encrypted (wrapped) with
+// the key-encryption key from config.
+type sealed struct {
+	KeyID      string
+	WrappedKey []byte
+	Ciphertext []byte
+}
+
+// Sealer envelope-encrypts values with AES-256-GCM.
+type Sealer struct {
+	keyID string
+	kek   cipher.AEAD
+}
+
+// NewSealer returns a Sealer for a 32-byte key-encryption key.
+func NewSealer(kek []byte) (*Sealer, error) {
+	if len(kek) != 32 {
+		return nil, fmt.Errorf("spotify: token key must be 32 bytes, got %d", len(kek))
+	}
+	aead, err := newGCM(kek)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(kek)
+	return &Sealer{keyID: hex.EncodeToString(sum[:4]), kek: aead}, nil
+}
+
+// parseKey accepts a base64 (standard or URL) encoded key.
+func parseKey(s string) ([]byte, error) {
+	for _, enc := range []*base64.Encoding{base64.StdEncoding, base64.RawStdEncoding, base64.URLEncoding, base64.RawURLEncoding} {
+		if b, err := enc.DecodeString(s); err == nil {
+			return b, nil
+		}
+	}
+	return nil, errors.New("spotify: token key is not valid base64")
+}
+
+// Seal encrypts plaintext. aad is authenticated but not stored, binding the
+// record to its owner so it can't be replayed under another user.
+func (s *Sealer) Seal(plaintext, aad []byte) (*sealed, error) {
+	dek := make([]byte, 32)
+	if _, err := rand.Read(dek); err != nil {
+		return nil, err
+	}
+	data, err := newGCM(dek)
+	if err != nil {
+		return nil, err
+	}
+
+	ciphertext, err := seal(data, plaintext, aad)
+	if err != nil {
+		return nil, err
+	}
+	wrapped, err := seal(s.kek, dek, []byte(s.keyID))
+	if err != nil {
+		return nil, err
+	}
+	return &sealed{KeyID: s.keyID, WrappedKey: wrapped, Ciphertext: ciphertext}, nil
+}
+
+// Open decrypts a record produced by Seal with the same aad.
+func (s *Sealer) Open(e *sealed, aad []byte) ([]byte, error) {
+	if e.KeyID != s.keyID {
+		return nil, ErrKeyMismatch
+	}
+	dek, err := open(s.kek, e.WrappedKey, []byte(s.keyID))
+	if err != nil {
+		return nil, fmt.Errorf("spotify: unwrap data key: %w", err)
+	}
+	data, err := newGCM(dek)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := open(data, e.Ciphertext, aad)
+	if err != nil {
+		return nil, fmt.Errorf("spotify: decrypt token: %w", err)
+	}
+	return plaintext, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal returns nonce||ciphertext.
+func seal(aead cipher.AEAD, plaintext, aad []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, aad), nil
+}
+
+func open(aead cipher.AEAD, sealed, aad []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, aad)
+}
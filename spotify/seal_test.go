@@ -0,0 +1,206 @@
+package spotify
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/oauth2"
+)
+
+func testSealer(t *testing.T, fill byte) *Sealer {
+	t.Helper()
+	s, err := NewSealer(bytes.Repeat([]byte{fill}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestSealRoundTrip(t *testing.T) {
+	s := testSealer(t, 1)
+	plaintext := []byte("refresh-token-secret")
+
+	e, err := s.Seal(plaintext, []byte("user-1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(e.Ciphertext, plaintext) || bytes.Contains(e.WrappedKey, plaintext) {
+		t.Error("plaintext visible in the sealed record")
+	}
+	got, err := s.Open(e, []byte("user-1"))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if !bytes.Equal(got, plaintext) {
+		t.Errorf("Open = %q, want %q", got, plaintext)
+	}
+
+	// Each seal uses a fresh data key and nonce
+	again, _ := s.Seal(plaintext, []byte("user-1"))
+	if bytes.Equal(again.Ciphertext, e.Ciphertext) || bytes.Equal(again.WrappedKey, e.WrappedKey) {
+		t.Error("sealing twice produced the same record")
+	}
+}
+
+func TestOpenDetectsTampering(t *testing.T) {
+	s := testSealer(t, 1)
+	flip := func(b []byte, i int) []byte {
+		out := bytes.Clone(b)
+		out[i] ^= 0x80
+		return out
+	}
+
+	tests := []struct {
+		name   string
+		sealer *Sealer
+		aad    string
+		edit   func(e sealed) sealed
+		want   error
+	}{
+		{
+			name: "flipped ciphertext byte",
+			edit: func(e sealed) sealed { e.Ciphertext = flip(e.Ciphertext, len(e.Ciphertext)-1); return e },
+		},
+		{
+			name: "flipped nonce byte",
+			edit: func(e sealed) sealed { e.Ciphertext = flip(e.Ciphertext, 0); return e },
+		},
+		{
+			name: "flipped wrapped key byte",
+			edit: func(e sealed) sealed { e.WrappedKey = flip(e.WrappedKey, len(e.WrappedKey)/2); return e },
+		},
+		{
+			name: "truncated",
+			edit: func(e sealed) sealed { e.Ciphertext = e.Ciphertext[:4]; return e },
+		},
+		{
+			name: "another user's record",
+			aad:  "user-2",
+		},
+		{
+			name:   "wrong key",
+			sealer: testSealer(t, 2),
+			want:   ErrKeyMismatch,
+		},
+		{
+			name:   "wrong key under the right key ID",
+			sealer: &Sealer{keyID: s.keyID, kek: testSealer(t, 2).kek},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := s.Seal([]byte("refresh-token-secret"), []byte("user-1"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.edit != nil {
+				*e = tt.edit(*e)
+			}
+			opener, aad := tt.sealer, tt.aad
+			if opener == nil {
+				opener = s
+			}
+			if aad == "" {
+				aad = "user-1"
+			}
+
+			got, err := opener.Open(e, []byte(aad))
+			if err == nil {
+				t.Fatalf("Open = %q, want an error", got)
+			}
+			if tt.want != nil && !errors.Is(err, tt.want) {
+				t.Errorf("err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewSealerKeyLength(t *testing.T) {
+	if _, err := NewSealer(make([]byte, 16)); err == nil {
+		t.Error("NewSealer accepted a 16-byte key")
+	}
+}
+
+func TestMigrateLegacyToken(t *testing.T) {
+	f := NewFirestoreTokenStore(nil, testSealer(t, 1), zap.NewNop().Sugar())
+	updated := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	legacy := legacyToken{
+		AccessToken:  "access-plaintext",
+		RefreshToken: "refresh-plaintext",
+		TokenType:    "Bearer",
+		Expiry:       updated.Add(time.Hour).Unix(),
+	}
+
+	tok, ok := legacy.token(updated)
+	if !ok {
+		t.Fatal("legacy token not read")
+	}
+	doc, err := f.record("user-1", tok)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc.KeyID == "" || len(doc.WrappedKey) == 0 || len(doc.Ciphertext) == 0 {
+		t.Fatalf("record = %+v, want a sealed document", doc)
+	}
+	for _, secret := range []string{legacy.AccessToken, legacy.RefreshToken} {
+		if bytes.Contains(doc.Ciphertext, []byte(secret)) {
+			t.Errorf("%q stored in plaintext", secret)
+		}
+	}
+
+	got, err := f.open("user-1", doc)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	want := &oauth2.Token{
+		AccessToken:  legacy.AccessToken,
+		RefreshToken: legacy.RefreshToken,
+		TokenType:    legacy.TokenType,
+		Expiry:       time.Unix(legacy.Expiry, 0),
+	}
+	if got.Token.AccessToken != want.AccessToken || got.Token.RefreshToken != want.RefreshToken ||
+		got.Token.TokenType != want.TokenType || !got.Token.Expiry.Equal(want.Expiry) {
+		t.Errorf("token = %+v, want %+v", got.Token, want)
+	}
+	if _, err := f.open("user-2", doc); err == nil {
+		t.Error("another user opened the migrated token")
+	}
+
+	if _, ok := (legacyToken{TokenType: "Bearer"}).token(updated); ok {
+		t.Error("empty legacy document read as a token")
+	}
+}
+
+func TestMemoryTokenStore(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemoryTokenStore(testSealer(t, 1))
+	st := &StoredToken{
+		Token:  &oauth2.Token{AccessToken: "a", RefreshToken: "r", TokenType: "Bearer"},
+		Scopes: []string{"user-top-read"},
+	}
+	if err := m.Put(ctx, "user-1", st); err != nil {
+		t.Fatal(err)
+	}
+	got, err := m.Get(ctx, "user-1")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if got.Token.RefreshToken != "r" || !got.HasScopes("user-top-read") || got.UpdatedAt.IsZero() {
+		t.Errorf("Get = %+v", got)
+	}
+
+	// A record moved to another user doesn't open
+	m.records["user-2"] = m.records["user-1"]
+	if _, err := m.Get(ctx, "user-2"); err == nil {
+		t.Error("record opened under another user")
+	}
+
+	m.Delete(ctx, "user-1")
+	if _, err := m.Get(ctx, "user-1"); !errors.Is(err, ErrTokenNotFound) {
+		t.Errorf("after Delete: err = %v, want ErrTokenNotFound", err)
+	}
+}
@@ -0,0 +1,185 @@
+package spotify
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"slices"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/mager/occipital/config"
+	"go.uber.org/zap"
+	"golang.org/x/oauth2"
+)
+
+var (
+	// ErrTokenNotFound is returned when a user hasn't connected Spotify.
+	ErrTokenNotFound = errors.New("spotify: no token for user")
+	// ErrInsufficientScope is returned when a user connected Spotify before
+	// a feature needed scopes they haven't granted yet.
+	ErrInsufficientScope = errors.New("spotify: token lacks required scope")
+)
+
+// StoredToken is a user's Spotify OAuth token and the scopes it was granted.
+type StoredToken struct {
+	Token     *oauth2.Token
+	Scopes    []string
+	UpdatedAt time.Time
+}
+
+// HasScopes reports whether every one of scopes was granted.
+func (t *StoredToken) HasScopes(scopes ...string) bool {
+	for _, s := range scopes {
+		if !slices.Contains(t.Scopes, s) {
+			return false
+		}
+	}
+	return true
+}
+
+// TokenStore persists per-user Spotify tokens. Implementations encrypt
+// tokens before they leave the process.
+type TokenStore interface {
+	Get(ctx context.Context, userID string) (*StoredToken, error)
+	Put(ctx context.Context, userID string, t *StoredToken) error
+	Delete(ctx context.Context, userID string) error
+}
+
+// ProvideTokenStore provides the Firestore token store, or an in-memory one
+// when Firestore isn't available. Without OCCIPITAL_SPOTIFYTOKENKEY tokens
+// are sealed with a random key and only last as long as the process.
+func ProvideTokenStore(cfg config.Config, log *zap.SugaredLogger, fs *firestore.Client) (TokenStore, error) {
+	var key []byte
+	if cfg.SpotifyTokenKey == "" {
+		log.Warn("No Spotify token key configured, connected accounts will not survive a restart")
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+	} else {
+		var err error
+		if key, err = parseKey(cfg.SpotifyTokenKey); err != nil {
+			return nil, err
+		}
+	}
+
+	sealer, err := NewSealer(key)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.SpotifyTokenKey == "" || fs == nil {
+		return NewMemoryTokenStore(sealer), nil
+	}
+	return NewFirestoreTokenStore(fs, sealer, log), nil
+}
+
+// tokenRecord is the plaintext that gets sealed.
+type tokenRecord struct {
+	AccessToken  string    `json:"access_token"`
+	RefreshToken string    `json:"refresh_token"`
+	TokenType    string    `json:"token_type"`
+	Expiry       time.Time `json:"expiry"`
+	Scopes       []string  `json:"scopes,omitempty"`
+}
+
+func sealToken(s *Sealer, userID string, t *StoredToken) (*sealed, error) {
+	b, err := json.Marshal(tokenRecord{
+		AccessToken:  t.Token.AccessToken,
+		RefreshToken: t.Token.RefreshToken,
+		TokenType:    t.Token.TokenType,
+		Expiry:       t.Token.Expiry,
+		Scopes:       t.Scopes,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.Seal(b, []byte(userID))
+}
+
+func openToken(s *Sealer, userID string, e *sealed) (*StoredToken, error) {
+	b, err := s.Open(e, []byte(userID))
+	if err != nil {
+		return nil, err
+	}
+	var rec tokenRecord
+	if err := json.Unmarshal(b, &rec); err != nil {
+		return nil, err
+	}
+	return &StoredToken{
+		Token: &oauth2.Token{
+			AccessToken:  rec.AccessToken,
+			RefreshToken: rec.RefreshToken,
+			TokenType:    rec.TokenType,
+			Expiry:       rec.Expiry,
+		},
+		Scopes: rec.Scopes,
+	}, nil
+}
+
+// persistingTokenSource refreshes a user's token and writes every new token
+// back to the store, so refreshes done by one request are seen by the next.
+type persistingTokenSource struct {
+	ctx     context.Context
+	log     *zap.SugaredLogger
+	store   TokenStore
+	userID  string
+	scopes  []string
+	refresh func(context.Context, *oauth2.Token) (*oauth2.Token, error)
+
+	mu  sync.Mutex
+	tok *oauth2.Token
+}
+
+// NewPersistingTokenSource returns a TokenSource for a stored token.
+// refresh is called when the access token has expired and should return
+// a new token, e.g. spotifyauth.Authenticator.RefreshToken.
+func NewPersistingTokenSource(
+	ctx context.Context,
+	log *zap.SugaredLogger,
+	store TokenStore,
+	userID string,
+	st *StoredToken,
+	refresh func(context.Context, *oauth2.Token) (*oauth2.Token, error),
+) oauth2.TokenSource {
+	return &persistingTokenSource{
+		ctx:     ctx,
+		log:     log,
+		store:   store,
+		userID:  userID,
+		scopes:  st.Scopes,
+		refresh: refresh,
+		tok:     st.Token,
+	}
+}
+
+func (s *persistingTokenSource) Token() (*oauth2.Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.tok.Valid() {
+		return s.tok, nil
+	}
+
+	t, err := s.refresh(s.ctx, s.tok)
+	if err != nil {
+		return nil, err
+	}
+	// Spotify doesn't always rotate the refresh token
+	if t.RefreshToken == "" {
+		t.RefreshToken = s.tok.RefreshToken
+	}
+
+	if t.AccessToken != s.tok.AccessToken {
+		err := s.store.Put(s.ctx, s.userID, &StoredToken{Token: t, Scopes: s.scopes})
+		if err != nil {
+			// The new token still works for this request; the next one
+			// will refresh again from the stored refresh token.
+			s.log.Warnw("Failed to persist refreshed Spotify token", "user_id", s.userID, "error", err)
+		}
+	}
+	s.tok = t
+	return t, nil
+}
@@ -0,0 +1,143 @@
+package spotify
+
+import (
+	"context"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"go.uber.org/zap"
+	"golang.org/x/oauth2"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const tokenCollection = "spotify_tokens"
+
+// FirestoreTokenStore stores sealed tokens in the spotify_tokens collection,
+// one document per user.
+type FirestoreTokenStore struct {
+	client *firestore.Client
+	sealer *Sealer
+	log    *zap.SugaredLogger
+}
+
+type firestoreToken struct {
+	KeyID      string    `firestore:"key_id"`
+	WrappedKey []byte    `firestore:"wrapped_key"`
+	Ciphertext []byte    `firestore:"ciphertext"`
+	UpdatedAt  time.Time `firestore:"updated_at"`
+}
+
+// legacyToken is the plaintext schema written before tokens were encrypted.
+type legacyToken struct {
+	AccessToken  string `firestore:"access_token"`
+	RefreshToken string `firestore:"refresh_token"`
+	TokenType    string `firestore:"token_type"`
+	Expiry       int64  `firestore:"expiry"`
+}
+
+// NewFirestoreTokenStore returns a TokenStore backed by Firestore.
+func NewFirestoreTokenStore(client *firestore.Client, sealer *Sealer, log *zap.SugaredLogger) *FirestoreTokenStore {
+	return &FirestoreTokenStore{client: client, sealer: sealer, log: log}
+}
+
+func (f *FirestoreTokenStore) doc(userID string) *firestore.DocumentRef {
+	return f.client.Collection(tokenCollection).Doc(userID)
+}
+
+func (f *FirestoreTokenStore) Get(ctx context.Context, userID string) (*StoredToken, error) {
+	snap, err := f.doc(userID).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return nil, ErrTokenNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var ft firestoreToken
+	if err := snap.DataTo(&ft); err != nil {
+		return nil, err
+	}
+	if len(ft.Ciphertext) == 0 {
+		return f.migrate(ctx, userID, snap)
+	}
+	return f.open(userID, ft)
+}
+
+// open decrypts a sealed token document.
+func (f *FirestoreTokenStore) open(userID string, ft firestoreToken) (*StoredToken, error) {
+	t, err := openToken(f.sealer, userID, &sealed{
+		KeyID:      ft.KeyID,
+		WrappedKey: ft.WrappedKey,
+		Ciphertext: ft.Ciphertext,
+	})
+	if err != nil {
+		return nil, err
+	}
+	t.UpdatedAt = ft.UpdatedAt
+	return t, nil
+}
+
+// migrate re-saves a plaintext token in the sealed schema, replacing the
+// plaintext fields.
+func (f *FirestoreTokenStore) migrate(ctx context.Context, userID string, snap *firestore.DocumentSnapshot) (*StoredToken, error) {
+	var lt legacyToken
+	if err := snap.DataTo(&lt); err != nil {
+		return nil, err
+	}
+	t, ok := lt.token(snap.UpdateTime)
+	if !ok {
+		return nil, ErrTokenNotFound
+	}
+	if err := f.Put(ctx, userID, t); err != nil {
+		f.log.Warnw("Failed to encrypt legacy Spotify token", "user_id", userID, "error", err)
+	} else {
+		f.log.Infow("Encrypted legacy Spotify token", "user_id", userID)
+	}
+	return t, nil
+}
+
+// token reads a plaintext document, reporting false if it holds no token.
+func (lt legacyToken) token(updatedAt time.Time) (*StoredToken, bool) {
+	if lt.RefreshToken == "" && lt.AccessToken == "" {
+		return nil, false
+	}
+	return &StoredToken{
+		Token: &oauth2.Token{
+			AccessToken:  lt.AccessToken,
+			RefreshToken: lt.RefreshToken,
+			TokenType:    lt.TokenType,
+			Expiry:       time.Unix(lt.Expiry, 0),
+		},
+		UpdatedAt: updatedAt,
+	}, true
+}
+
+func (f *FirestoreTokenStore) Put(ctx context.Context, userID string, t *StoredToken) error {
+	ft, err := f.record(userID, t)
+	if err != nil {
+		return err
+	}
+	// Set without merge replaces the whole document, dropping any plaintext fields
+	_, err = f.doc(userID).Set(ctx, ft)
+	return err
+}
+
+// record seals t into the document Put writes.
+func (f *FirestoreTokenStore) record(userID string, t *StoredToken) (firestoreToken, error) {
+	e, err := sealToken(f.sealer, userID, t)
+	if err != nil {
+		return firestoreToken{}, err
+	}
+	return firestoreToken{
+		KeyID:      e.KeyID,
+		WrappedKey: e.WrappedKey,
+		Ciphertext: e.Ciphertext,
+		UpdatedAt:  time.Now(),
+	}, nil
+}
+
+func (f *FirestoreTokenStore) Delete(ctx context.Context, userID string) error {
+	_, err := f.doc(userID).Delete(ctx)
+	return err
+}
@@ -0,0 +1,60 @@
+package spotify
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryTokenStore keeps sealed tokens in process memory.
+type MemoryTokenStore struct {
+	sealer *Sealer
+
+	mu      sync.RWMutex
+	records map[string]memoryToken
+}
+
+type memoryToken struct {
+	sealed    *sealed
+	updatedAt time.Time
+}
+
+// NewMemoryTokenStore returns an empty in-memory TokenStore.
+func NewMemoryTokenStore(sealer *Sealer) *MemoryTokenStore {
+	return &MemoryTokenStore{sealer: sealer, records: make(map[string]memoryToken)}
+}
+
+func (m *MemoryTokenStore) Get(_ context.Context, userID string) (*StoredToken, error) {
+	m.mu.RLock()
+	rec, ok := m.records[userID]
+	m.mu.RUnlock()
+	if !ok {
+		return nil, ErrTokenNotFound
+	}
+
+	t, err := openToken(m.sealer, userID, rec.sealed)
+	if err != nil {
+		return nil, err
+	}
+	t.UpdatedAt = rec.updatedAt
+	return t, nil
+}
+
+func (m *MemoryTokenStore) Put(_ context.Context, userID string, t *StoredToken) error {
+	e, err := sealToken(m.sealer, userID, t)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.records[userID] = memoryToken{sealed: e, updatedAt: time.Now()}
+	return nil
+}
+
+func (m *MemoryTokenStore) Delete(_ context.Context, userID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.records, userID)
+	return nil
+}